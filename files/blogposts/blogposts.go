@@ -5,6 +5,11 @@ import (
 )
 
 func NewPostsFromFS(fileSystem fs.FS) ([]Post, error) {
+	return newPostsFromFS(fileSystem, func(fs.DirEntry) bool { return true })
+}
+
+// newPostsFromFS reads the files in fileSystem that keep says are posts.
+func newPostsFromFS(fileSystem fs.FS, keep func(fs.DirEntry) bool) ([]Post, error) {
 	dir, err := fs.ReadDir(fileSystem, ".")
 	if err != nil {
 		return nil, err
@@ -12,6 +17,9 @@ func NewPostsFromFS(fileSystem fs.FS) ([]Post, error) {
 
 	var posts []Post
 	for _, f := range dir {
+		if !keep(f) {
+			continue
+		}
 		post, err := getPost(fileSystem, f.Name())
 		if err != nil {
 			return nil, err
@@ -27,5 +35,5 @@ func getPost(fileSystem fs.FS, filename string) (Post, error) {
 		return Post{}, err
 	}
 	defer postFile.Close()
-	return newPost(postFile)
+	return newPost(filename, postFile)
 }
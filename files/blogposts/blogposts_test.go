@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"testing"
 	"testing/fstest"
+	"time"
 
 	"github.com/errantDev/blogposts"
 )
@@ -80,7 +81,162 @@ Thanks`
 		Title:       "Post 1",
 		Description: "Description 1",
 		Tags:        []string{"tdd", "go"},
+		Slug:        "hello-world",
 		Body: `Hello
 World`,
 	})
 }
+
+func TestNewBlogpostsReadsEveryFile(t *testing.T) {
+	posts, err := blogposts.NewPostsFromFS(fstest.MapFS{
+		"post.txt": {Data: []byte("Title: Post 1\n---\nHello")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 1 || posts[0].Slug != "post" {
+		t.Errorf("got %+v, want the post in post.txt", posts)
+	}
+}
+
+func TestFrontmatter(t *testing.T) {
+	newPost := func(t *testing.T, name, text string) blogposts.Post {
+		t.Helper()
+		posts, err := blogposts.NewPostsFromFS(fstest.MapFS{name: {Data: []byte(text)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return posts[0]
+	}
+
+	t.Run("YAML between --- lines, in any order", func(t *testing.T) {
+		got := newPost(t, "First Post.md", `---
+tags: [tdd, "go"]
+date: 2021-03-17
+# not finished yet
+draft: true
+title: "Post: the first"
+author: Chris
+reading_time: 5
+series:
+  - learn go
+  - 'with tests'
+description: >
+  One line
+  and another.
+---
+Hello`)
+
+		assertPost(t, got, blogposts.Post{
+			Title:       "Post: the first",
+			Description: "One line and another.\n",
+			Tags:        []string{"tdd", "go"},
+			Date:        time.Date(2021, time.March, 17, 0, 0, 0, 0, time.UTC),
+			Draft:       true,
+			Slug:        "first-post",
+			Body:        "Hello",
+			Meta: map[string]interface{}{
+				"author":       "Chris",
+				"reading_time": int64(5),
+				"series":       []interface{}{"learn go", "with tests"},
+			},
+		})
+	})
+
+	t.Run("TOML between +++ lines", func(t *testing.T) {
+		got := newPost(t, "post.md", `+++
+title = "Post 1"
+date = 2021-03-17T09:30:00Z
+slug = "the-first-one"
+tags = [
+  "tdd", # testing first
+  'go',
+]
+description = """
+Two
+lines"""
+rating = 4.5
++++
+Hello`)
+
+		assertPost(t, got, blogposts.Post{
+			Title:       "Post 1",
+			Description: "Two\nlines",
+			Tags:        []string{"tdd", "go"},
+			Date:        time.Date(2021, time.March, 17, 9, 30, 0, 0, time.UTC),
+			Slug:        "the-first-one",
+			Body:        "Hello",
+			Meta:        map[string]interface{}{"rating": 4.5},
+		})
+	})
+
+	t.Run("a block of text keeps its lines", func(t *testing.T) {
+		got := newPost(t, "post.md", "---\r\ntitle: Post 1\r\ndescription: |\r\n  Hello\r\n\r\n    World\r\n---\r\nBody\r\n")
+
+		if got.Description != "Hello\n\n  World\n" {
+			t.Errorf("got description %q", got.Description)
+		}
+		if got.Body != "Body" {
+			t.Errorf("got body %q", got.Body)
+		}
+	})
+
+	t.Run("slugs from file names keep letters in any script", func(t *testing.T) {
+		cases := map[string]string{
+			"Café au lait.md": "café-au-lait",
+			"cafe\u0301.md":   "cafe\u0301",
+			"日本語.md":          "日本語",
+			"Ünïcode 2.md":    "ünïcode-2",
+		}
+		for filename, want := range cases {
+			if got := newPost(t, filename, "---\ntitle: Post 1\n---\n"); got.Slug != want {
+				t.Errorf("%s got slug %q want %q", filename, got.Slug, want)
+			}
+		}
+	})
+
+	t.Run("a file name with nothing to make a slug from needs one given", func(t *testing.T) {
+		_, err := blogposts.NewPostsFromFS(fstest.MapFS{"!!!.md": {Data: []byte("---\ntitle: Post 1\n---\n")}})
+		if !errors.Is(err, blogposts.ErrEmptySlug) {
+			t.Errorf("got %v want %v", err, blogposts.ErrEmptySlug)
+		}
+
+		got := newPost(t, "!!!.md", "---\ntitle: Post 1\nslug: bangs\n---\n")
+		if got.Slug != "bangs" {
+			t.Errorf("got slug %q want bangs", got.Slug)
+		}
+	})
+
+	t.Run("says where a post is wrong", func(t *testing.T) {
+		cases := map[string]struct {
+			text string
+			want string
+		}{
+			"unclosed":         {"---\ntitle: Post 1\n", "post.md:1: frontmatter is never closed"},
+			"no title":         {"---\ndraft: false\n---\n", "post.md: post has no title"},
+			"duplicate key":    {"---\ntitle: Post 1\nTitle: Post 2\n---\n", "post.md:3: Title, first on line 2: key is given more than once"},
+			"bad date":         {"---\ntitle: Post 1\ndate: yesterday\n---\n", "post.md:3: date yesterday is not like 2006-01-02 or 2006-01-02T15:04:05Z"},
+			"bad draft":        {"+++\ntitle = 'Post 1'\ndraft = 'yes'\n+++\n", "post.md:3: draft should be true or false, not 'yes'"},
+			"bad slug":         {"---\ntitle: Post 1\nslug: Post One\n---\n", `post.md:3: slug "Post One" should be lower case letters, digits and dashes`},
+			"nested map":       {"---\ntitle: Post 1\nauthor:\n  name: Chris\n---\n", `post.md:4: nested keys are not supported, under "author"`},
+			"unclosed string":  {"---\ntitle: \"Post 1\n---\n", "post.md:2: string is never closed"},
+			"unclosed list":    {"+++\ntitle = 'Post 1'\ntags = ['go',\n+++\n", "post.md:3: list is never closed with ]"},
+			"bare toml string": {"+++\ntitle = Post 1\n+++\n", `post.md:2: can't read value "Post 1", strings need quotes`},
+			"toml table":       {"+++\ntitle = 'Post 1'\n[author]\n+++\n", "post.md:3: tables like [author] are not supported"},
+		}
+
+		for name, c := range cases {
+			t.Run(name, func(t *testing.T) {
+				_, err := blogposts.NewPostsFromFS(fstest.MapFS{"post.md": {Data: []byte(c.text)}})
+
+				var parseErr *blogposts.ParseError
+				if !errors.As(err, &parseErr) {
+					t.Fatalf("got %v, want a ParseError", err)
+				}
+				if err.Error() != c.want {
+					t.Errorf("got %q want %q", err, c.want)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/errantDev/blogposts"
+)
+
+const usage = `usage: blog build [-in posts] [-out public] [-title Blog] [-url https://example.com]
+                  [-author name] [-theme dir] [-drafts]
+
+commands:
+  build   render the posts in -in into a static site in -out: an index, a
+          page for each post and each tag, and Atom and RSS feeds; files in
+          -theme replace the default theme's layout.html, index.html,
+          post.html, tag.html and static/ files; files an earlier build
+          wrote that this one doesn't are removed; if no post has a
+          date, the feed is dated $SOURCE_DATE_EPOCH, or 1970 without it
+`
+
+func main() {
+	flag.Usage = func() { fmt.Fprint(flag.CommandLine.Output(), usage) }
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 || args[0] != "build" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	flags.Usage = flag.Usage
+	in := flags.String("in", "posts", "directory of Markdown posts")
+	out := flags.String("out", "public", "directory to write the site to")
+	title := flags.String("title", "Blog", "name of the site")
+	url := flags.String("url", "", "where the site will be published, for the feeds")
+	author := flags.String("author", "", "who writes the posts, for the feeds; the title if not given")
+	theme := flags.String("theme", "", "directory of theme files replacing the default theme's")
+	drafts := flags.Bool("drafts", false, "include posts marked as drafts")
+	flags.Parse(args[1:])
+
+	site := blogposts.Site{Title: *title, Author: *author, URL: *url, Drafts: *drafts}
+	if *theme != "" {
+		site.Theme = os.DirFS(*theme)
+	}
+	// the reproducible builds convention for a build's date, used by the
+	// feed when no post has one
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		seconds, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil {
+			log.Fatalf("SOURCE_DATE_EPOCH %q should be seconds since 1970", epoch)
+		}
+		site.Updated = time.Unix(seconds, 0)
+	}
+
+	files, err := site.Build(os.DirFS(*in))
+	if err != nil {
+		log.Fatalf("problem building %s, %v", *in, err)
+	}
+	if err := write(*out, files); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("built %d files in %s\n", len(files), *out)
+}
+
+// built lists the files the last build wrote, so the next one can remove
+// those it no longer makes without touching anything else in the directory.
+const built = ".built"
+
+func write(dir string, files map[string][]byte) error {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("problem writing %s, %v", path, err)
+		}
+		if err := os.WriteFile(path, files[name], 0644); err != nil {
+			return fmt.Errorf("problem writing %s, %v", path, err)
+		}
+	}
+
+	if err := removeStale(dir, files); err != nil {
+		return err
+	}
+	manifest := filepath.Join(dir, built)
+	if err := os.WriteFile(manifest, []byte(strings.Join(names, "\n")+"\n"), 0644); err != nil {
+		return fmt.Errorf("problem writing %s, %v", manifest, err)
+	}
+	return nil
+}
+
+// removeStale removes the files the last build wrote that this one didn't,
+// like the page of a post that's since been deleted or renamed, and any
+// directories that leaves empty.
+func removeStale(dir string, files map[string][]byte) error {
+	data, err := os.ReadFile(filepath.Join(dir, built))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("problem reading what was built before, %v", err)
+	}
+
+	for _, name := range strings.Split(string(data), "\n") {
+		if _, ok := files[name]; ok || name == "" {
+			continue
+		}
+		// the list could have been edited, so stay inside dir
+		if !fs.ValidPath(name) {
+			continue
+		}
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("problem removing %s, %v", path, err)
+		}
+		for parent := filepath.Dir(path); parent != filepath.Clean(dir); parent = filepath.Dir(parent) {
+			// only empty directories can be removed, so stop at the first
+			// that still has something in it
+			if os.Remove(parent) != nil {
+				break
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,627 @@
+package blogposts
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrUnclosedFrontmatter = errors.New("frontmatter is never closed")
+	ErrDuplicateKey        = errors.New("key is given more than once")
+	ErrMissingTitle        = errors.New("post has no title")
+	ErrEmptySlug           = errors.New("post has no slug, its file name has no letters or digits to make one from")
+)
+
+// ParseError is a post that couldn't be read, and where in it the problem
+// was. Line is 0 when the problem isn't on any one line.
+type ParseError struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %v", e.File, e.Err)
+	}
+	return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// field is one key from the frontmatter. Values are strings, bools,
+// int64s, float64s, time.Times (TOML only) or []interface{} of those.
+// text is the value as written, for fields that want a string whatever it
+// looks like.
+type field struct {
+	key   string
+	value interface{}
+	text  string
+	line  int
+}
+
+type frontmatter struct {
+	fields []field
+	body   string
+}
+
+// parseFrontmatter splits a post into its frontmatter and body. The
+// frontmatter is YAML between --- lines or TOML between +++ lines. Posts
+// written before there was frontmatter start straight in with Title: and
+// friends and end them with a ---, which reads as YAML too.
+func parseFrontmatter(text string) (frontmatter, error) {
+	text = strings.TrimPrefix(text, "\ufeff")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	lines := strings.Split(text, "\n")
+
+	delimiter, start := "---", 1
+	switch strings.TrimRight(lines[0], " \t") {
+	case "---":
+	case "+++":
+		delimiter = "+++"
+	default:
+		start = 0
+	}
+
+	end := -1
+	for i := start; i < len(lines); i++ {
+		if strings.TrimRight(lines[i], " \t") == delimiter {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return frontmatter{}, &ParseError{Line: 1, Err: ErrUnclosedFrontmatter}
+	}
+
+	parse := parseYAML
+	if delimiter == "+++" {
+		parse = parseTOML
+	}
+	fields, err := parse(lines[start:end], start+1)
+	if err != nil {
+		return frontmatter{}, err
+	}
+
+	body := strings.Join(lines[end+1:], "\n")
+	return frontmatter{fields: fields, body: strings.TrimSuffix(body, "\n")}, nil
+}
+
+// parseYAML reads the subset of YAML frontmatter needs: key: value pairs
+// at the top level, where a value is a scalar, a [flow, list], a block
+// list of "- item" lines, or a | or > block of text. Nested maps aren't
+// supported. first is the line number of lines[0].
+func parseYAML(lines []string, first int) ([]field, error) {
+	var fields []field
+	for i := 0; i < len(lines); i++ {
+		line, number := lines[i], first+i
+		fail := func(format string, args ...interface{}) ([]field, error) {
+			return nil, &ParseError{Line: number, Err: fmt.Errorf(format, args...)}
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if isIndented(line) {
+			return fail("unexpected indentation, nested keys are not supported")
+		}
+		if trimmed == "-" || strings.HasPrefix(trimmed, "- ") {
+			return fail("list item %q has no key", trimmed)
+		}
+
+		key, rest, err := yamlKey(line)
+		if err != nil {
+			return fail("%v", err)
+		}
+
+		f := field{key: key, line: number}
+		switch {
+		case rest == "":
+			// a block list, or nothing
+			var items []interface{}
+			for i+1 < len(lines) && (isIndented(lines[i+1]) || strings.TrimSpace(lines[i+1]) == "") {
+				i++
+				item := strings.TrimSpace(lines[i])
+				if item == "" || strings.HasPrefix(item, "#") {
+					continue
+				}
+				if item != "-" && !strings.HasPrefix(item, "- ") {
+					return nil, &ParseError{Line: first + i, Err: fmt.Errorf("nested keys are not supported, under %q", key)}
+				}
+				value, _, err := readValue(strings.TrimSpace(item[1:]), false)
+				if err != nil {
+					return nil, &ParseError{Line: first + i, Err: err}
+				}
+				items = append(items, value)
+			}
+			if items != nil {
+				f.value = items
+			} else {
+				f.value = ""
+			}
+		case isBlockScalar(rest):
+			var block []string
+			for i+1 < len(lines) && (isIndented(lines[i+1]) || strings.TrimSpace(lines[i+1]) == "") {
+				i++
+				block = append(block, lines[i])
+			}
+			f.value = blockScalar(rest, block)
+			f.text = f.value.(string)
+		default:
+			value, text, err := readValue(rest, false)
+			if err != nil {
+				return fail("%v", err)
+			}
+			f.value, f.text = value, text
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func isIndented(line string) bool {
+	return strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")
+}
+
+// yamlKey splits "key: rest", where the key may be quoted.
+func yamlKey(line string) (key, rest string, err error) {
+	if line[0] == '"' || line[0] == '\'' {
+		r := &valueReader{s: line}
+		value, err := r.quoted()
+		if err != nil {
+			return "", "", err
+		}
+		after := line[r.pos:]
+		if !strings.HasPrefix(after, ":") {
+			return "", "", fmt.Errorf("expected a : after key %q", value)
+		}
+		return value, strings.TrimSpace(after[1:]), nil
+	}
+
+	for i := 0; i < len(line); i++ {
+		if line[i] == ':' && (i+1 == len(line) || line[i+1] == ' ' || line[i+1] == '\t') {
+			key = strings.TrimSpace(line[:i])
+			if key == "" {
+				return "", "", errors.New("key is empty")
+			}
+			return key, strings.TrimSpace(line[i+1:]), nil
+		}
+	}
+	return "", "", fmt.Errorf("expected key: value, got %q", line)
+}
+
+func isBlockScalar(indicator string) bool {
+	switch indicator {
+	case "|", "|-", ">", ">-":
+		return true
+	}
+	return false
+}
+
+// blockScalar is the text of a | or > block: | keeps its line breaks, >
+// folds each paragraph into one line. Either ends in one line break unless
+// the indicator has a -.
+func blockScalar(indicator string, lines []string) string {
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	indent := -1
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if n := len(line) - len(strings.TrimLeft(line, " \t")); indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			lines[i] = ""
+		} else {
+			lines[i] = line[indent:]
+		}
+	}
+
+	text := strings.Join(lines, "\n")
+	if indicator[0] == '>' {
+		paragraphs := strings.Split(text, "\n\n")
+		for i, paragraph := range paragraphs {
+			paragraphs[i] = strings.ReplaceAll(strings.Trim(paragraph, "\n"), "\n", " ")
+		}
+		text = strings.Join(paragraphs, "\n")
+	}
+	if text != "" && !strings.HasSuffix(indicator, "-") {
+		text += "\n"
+	}
+	return text
+}
+
+// parseTOML reads the subset of TOML frontmatter needs: key = value pairs
+// at the top level, with strings, numbers, booleans, dates and arrays,
+// which may run over several lines. Tables aren't supported.
+func parseTOML(lines []string, first int) ([]field, error) {
+	var fields []field
+	for i := 0; i < len(lines); i++ {
+		line, number := strings.TrimSpace(lines[i]), first+i
+		fail := func(err error) ([]field, error) {
+			return nil, &ParseError{Line: number, Err: err}
+		}
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			return fail(fmt.Errorf("tables like %s are not supported", line))
+		}
+
+		key, rest, err := tomlKey(line)
+		if err != nil {
+			return fail(err)
+		}
+
+		// arrays and multi-line strings carry on until they're closed
+		for !tomlValueComplete(rest) && i+1 < len(lines) {
+			i++
+			rest += "\n" + lines[i]
+		}
+
+		value, text, err := readValue(rest, true)
+		if err != nil {
+			return fail(err)
+		}
+		fields = append(fields, field{key: key, value: value, text: text, line: number})
+	}
+	return fields, nil
+}
+
+func tomlKey(line string) (key, rest string, err error) {
+	r := &valueReader{s: line, toml: true}
+	if line[0] == '"' || line[0] == '\'' {
+		if key, err = r.quoted(); err != nil {
+			return "", "", err
+		}
+	} else {
+		for r.pos < len(line) && isBareKeyByte(line[r.pos]) {
+			r.pos++
+		}
+		key = line[:r.pos]
+		if key == "" {
+			return "", "", fmt.Errorf("expected key = value, got %q", line)
+		}
+	}
+
+	r.skipSpace()
+	if r.pos < len(line) && line[r.pos] == '.' {
+		return "", "", fmt.Errorf("dotted keys like %s are not supported", line[:strings.Index(line, "=")+1])
+	}
+	if r.pos == len(line) || line[r.pos] != '=' {
+		return "", "", fmt.Errorf("expected key = value, got %q", line)
+	}
+	return key, strings.TrimSpace(line[r.pos+1:]), nil
+}
+
+func isBareKeyByte(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_' || c == '-'
+}
+
+// tomlValueComplete is whether value has closed every array and
+// multi-line string it opened.
+func tomlValueComplete(value string) bool {
+	if strings.HasPrefix(value, `"""`) || strings.HasPrefix(value, "'''") {
+		return strings.Contains(value[3:], value[:3])
+	}
+
+	depth := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '"', '\'':
+			quote := value[i]
+			for i++; i < len(value) && value[i] != quote && value[i] != '\n'; i++ {
+				if quote == '"' && value[i] == '\\' {
+					i++
+				}
+			}
+		case '#':
+			for i < len(value) && value[i] != '\n' {
+				i++
+			}
+		case '[':
+			depth++
+		case ']':
+			depth--
+		}
+	}
+	return depth <= 0
+}
+
+// valueReader reads one value, from the start of s, in YAML or TOML.
+type valueReader struct {
+	s    string
+	pos  int
+	toml bool
+}
+
+// readValue reads the whole of s as one value, allowing only a comment
+// after it, and returns it with the text it was read from.
+func readValue(s string, toml bool) (interface{}, string, error) {
+	r := &valueReader{s: s, toml: toml}
+	value, err := r.value(false)
+	if err != nil {
+		return nil, "", err
+	}
+	text := strings.TrimSpace(s[:r.pos])
+
+	r.skipSpaceAndComments()
+	if r.pos < len(s) {
+		return nil, "", fmt.Errorf("unexpected %q after %s", s[r.pos:], text)
+	}
+	return value, text, nil
+}
+
+func (r *valueReader) value(inList bool) (interface{}, error) {
+	r.skipSpace()
+	if r.pos == len(r.s) {
+		if r.toml {
+			return nil, errors.New("value is missing")
+		}
+		return "", nil
+	}
+
+	switch r.s[r.pos] {
+	case '"', '\'':
+		if r.toml && (strings.HasPrefix(r.s[r.pos:], `"""`) || strings.HasPrefix(r.s[r.pos:], "'''")) {
+			return r.multilineString()
+		}
+		return r.quoted()
+	case '[':
+		return r.list()
+	case '{':
+		return nil, errors.New("inline maps are not supported")
+	}
+
+	start := r.pos
+	for r.pos < len(r.s) && !r.endOfBare(inList) {
+		r.pos++
+	}
+	bare := strings.TrimSpace(r.s[start:r.pos])
+	if r.toml {
+		return tomlScalar(bare)
+	}
+	return yamlScalar(bare), nil
+}
+
+// endOfBare is whether an unquoted value stops here: at a comment, or the
+// end of a list item.
+func (r *valueReader) endOfBare(inList bool) bool {
+	c := r.s[r.pos]
+	if inList && (c == ',' || c == ']') {
+		return true
+	}
+	if c == '\n' {
+		return true
+	}
+	if r.toml {
+		return c == '#'
+	}
+	// in YAML a # only starts a comment after a space
+	return c == '#' && r.pos > 0 && (r.s[r.pos-1] == ' ' || r.s[r.pos-1] == '\t')
+}
+
+func (r *valueReader) list() ([]interface{}, error) {
+	r.pos++ // [
+	items := []interface{}{}
+	for {
+		r.skipSpaceAndComments()
+		if r.pos == len(r.s) {
+			return nil, errors.New("list is never closed with ]")
+		}
+		if r.s[r.pos] == ']' {
+			r.pos++
+			return items, nil
+		}
+
+		item, err := r.value(true)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+
+		r.skipSpaceAndComments()
+		if r.pos < len(r.s) && r.s[r.pos] == ',' {
+			r.pos++
+		} else if r.pos < len(r.s) && r.s[r.pos] != ']' {
+			return nil, fmt.Errorf("expected , or ] in list, got %q", r.s[r.pos:])
+		}
+	}
+}
+
+// quoted reads a quoted string. Double quotes take backslash escapes;
+// single quotes are taken literally, except that YAML doubles a ' to
+// write one in them.
+func (r *valueReader) quoted() (string, error) {
+	quote := r.s[r.pos]
+	r.pos++
+
+	var b strings.Builder
+	for r.pos < len(r.s) {
+		c := r.s[r.pos]
+		switch {
+		case c == '\n':
+			return "", errors.New("string is never closed")
+		case c == quote && quote == '\'' && !r.toml && strings.HasPrefix(r.s[r.pos:], "''"):
+			b.WriteByte('\'')
+			r.pos += 2
+		case c == quote:
+			r.pos++
+			return b.String(), nil
+		case c == '\\' && quote == '"':
+			if err := r.escape(&b); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+			r.pos++
+		}
+	}
+	return "", errors.New("string is never closed")
+}
+
+func (r *valueReader) escape(b *strings.Builder) error {
+	r.pos++ // backslash
+	if r.pos == len(r.s) {
+		return errors.New("string ends in a \\")
+	}
+	c := r.s[r.pos]
+	r.pos++
+
+	simple := map[byte]string{'n': "\n", 't': "\t", 'r': "\r", '"': `"`, '\\': `\`, '/': "/", 'b': "\b", 'f': "\f", '0': "\x00"}
+	if s, ok := simple[c]; ok {
+		b.WriteString(s)
+		return nil
+	}
+
+	digits := map[byte]int{'x': 2, 'u': 4, 'U': 8}[c]
+	if digits == 0 || r.pos+digits > len(r.s) {
+		return fmt.Errorf(`unknown escape \%c`, c)
+	}
+	code, err := strconv.ParseUint(r.s[r.pos:r.pos+digits], 16, 32)
+	if err != nil || !utf8.ValidRune(rune(code)) {
+		return fmt.Errorf(`bad escape \%c%s`, c, r.s[r.pos:r.pos+digits])
+	}
+	b.WriteRune(rune(code))
+	r.pos += digits
+	return nil
+}
+
+// multilineString reads a TOML string in triple quotes, dropping a line
+// break straight after the opening ones.
+func (r *valueReader) multilineString() (string, error) {
+	delimiter := r.s[r.pos : r.pos+3]
+	r.pos += 3
+	if strings.HasPrefix(r.s[r.pos:], "\n") {
+		r.pos++
+	}
+
+	end := strings.Index(r.s[r.pos:], delimiter)
+	if end < 0 {
+		return "", errors.New("string is never closed")
+	}
+	raw := r.s[r.pos : r.pos+end]
+	r.pos += end + 3
+	if delimiter == "'''" {
+		return raw, nil
+	}
+
+	inner := &valueReader{s: raw, toml: true}
+	var b strings.Builder
+	for inner.pos < len(raw) {
+		if raw[inner.pos] == '\\' {
+			if err := inner.escape(&b); err != nil {
+				return "", err
+			}
+			continue
+		}
+		b.WriteByte(raw[inner.pos])
+		inner.pos++
+	}
+	return b.String(), nil
+}
+
+func (r *valueReader) skipSpace() {
+	for r.pos < len(r.s) && (r.s[r.pos] == ' ' || r.s[r.pos] == '\t') {
+		r.pos++
+	}
+}
+
+func (r *valueReader) skipSpaceAndComments() {
+	for r.pos < len(r.s) {
+		switch r.s[r.pos] {
+		case ' ', '\t', '\n':
+			r.pos++
+		case '#':
+			for r.pos < len(r.s) && r.s[r.pos] != '\n' {
+				r.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// yamlScalar is what an unquoted YAML value stands for: a bool, a number,
+// or otherwise the text itself. Dates are left as text for the fields
+// that want them to parse.
+func yamlScalar(bare string) interface{} {
+	switch bare {
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	case "~", "null", "Null", "NULL":
+		return ""
+	}
+	if looksNumeric(bare) {
+		if n, err := strconv.ParseInt(bare, 10, 64); err == nil {
+			return n
+		}
+		if f, err := strconv.ParseFloat(bare, 64); err == nil {
+			return f
+		}
+	}
+	return bare
+}
+
+func looksNumeric(s string) bool {
+	s = strings.TrimLeft(s, "+-")
+	return s != "" && ('0' <= s[0] && s[0] <= '9' || s[0] == '.')
+}
+
+var tomlDateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// tomlScalar reads an unquoted TOML value, which unlike YAML has to be a
+// bool, number or date; bare words aren't strings.
+func tomlScalar(bare string) (interface{}, error) {
+	switch bare {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "inf", "+inf", "-inf", "nan", "+nan", "-nan":
+		f, _ := strconv.ParseFloat(bare, 64)
+		return f, nil
+	}
+
+	for _, layout := range tomlDateLayouts {
+		if t, err := time.Parse(layout, bare); err == nil {
+			return t, nil
+		}
+	}
+
+	if looksNumeric(bare) && !strings.HasPrefix(bare, "_") && !strings.HasSuffix(bare, "_") && !strings.Contains(bare, "__") {
+		digits := strings.ReplaceAll(bare, "_", "")
+		if n, err := strconv.ParseInt(digits, 0, 64); err == nil {
+			return n, nil
+		}
+		if f, err := strconv.ParseFloat(digits, 64); err == nil && !strings.ContainsAny(digits, "xXpP") {
+			return f, nil
+		}
+	}
+	if bare == "" {
+		return nil, errors.New("value is missing")
+	}
+	return nil, fmt.Errorf("can't read value %q, strings need quotes", bare)
+}
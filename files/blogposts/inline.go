@@ -0,0 +1,675 @@
+package blogposts
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type inlineKind int
+
+const (
+	textInline inlineKind = iota
+	codeInline
+	emphasisInline
+	strongInline
+	linkInline
+	imageInline
+	softBreakInline
+	hardBreakInline
+)
+
+// inline is one piece of a paragraph or heading. Emphasis, links and
+// images hold the inlines inside them.
+type inline struct {
+	kind        inlineKind
+	text        string
+	dest, title string
+	first, last *inline
+	prev, next  *inline
+}
+
+func (n *inline) append(child *inline) {
+	child.prev, child.next = n.last, nil
+	if n.last != nil {
+		n.last.next = child
+	} else {
+		n.first = child
+	}
+	n.last = child
+}
+
+// delimiter is a run of * or _ that may open or close emphasis, as the
+// CommonMark spec describes in "Phase 2: inline structure".
+type delimiter struct {
+	node              *inline
+	char              byte
+	length, count     int
+	canOpen, canClose bool
+	prev, next        *delimiter
+}
+
+// bracket is a [ or ![ that may start a link or image.
+type bracket struct {
+	node   *inline
+	image  bool
+	active bool
+	pos    int
+	delims *delimiter
+	prev   *bracket
+}
+
+type linkRef struct {
+	dest, title string
+}
+
+type inlineParser struct {
+	s        string
+	pos      int
+	refs     map[string]linkRef
+	root     inline
+	delims   *delimiter
+	brackets *bracket
+}
+
+// parseInlines parses the text of a paragraph or heading.
+func parseInlines(s string, refs map[string]linkRef) *inline {
+	p := &inlineParser{s: s, refs: refs}
+	for p.pos < len(p.s) {
+		switch c := p.s[p.pos]; c {
+		case '\n':
+			p.lineBreak()
+		case '\\':
+			p.backslash()
+		case '`':
+			p.codeSpan()
+		case '*', '_':
+			p.delimiterRun()
+		case '[':
+			p.openBracket(false, 1)
+		case '!':
+			if strings.HasPrefix(p.s[p.pos:], "![") {
+				p.openBracket(true, 2)
+			} else {
+				p.text("!", 1)
+			}
+		case ']':
+			p.closeBracket()
+		case '<':
+			if !p.autolink() {
+				p.text("<", 1)
+			}
+		case '&':
+			p.entity()
+		default:
+			end := p.pos + 1
+			for end < len(p.s) && !strings.ContainsRune("\n\\`*_[]!<&", rune(p.s[end])) {
+				end++
+			}
+			p.text(p.s[p.pos:end], end-p.pos)
+		}
+	}
+	p.processEmphasis(nil)
+	return &p.root
+}
+
+func (p *inlineParser) add(n *inline) *inline {
+	p.root.append(n)
+	return n
+}
+
+func (p *inlineParser) text(s string, consumed int) *inline {
+	p.pos += consumed
+	return p.add(&inline{kind: textInline, text: s})
+}
+
+// lineBreak is hard if the line ended in two spaces, and soft otherwise.
+// Either way the spaces go.
+func (p *inlineParser) lineBreak() {
+	spaces := 0
+	for i := p.pos - 1; i >= 0 && p.s[i] == ' '; i-- {
+		spaces++
+	}
+	if last := p.root.last; last != nil && last.kind == textInline {
+		last.text = strings.TrimRight(last.text, " ")
+	}
+
+	p.pos++
+	kind := softBreakInline
+	if spaces >= 2 {
+		kind = hardBreakInline
+	}
+	p.add(&inline{kind: kind})
+	// spaces at the start of the next line go too
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *inlineParser) backslash() {
+	if p.pos+1 < len(p.s) {
+		next := p.s[p.pos+1]
+		if next == '\n' {
+			p.pos++
+			p.add(&inline{kind: hardBreakInline})
+			p.pos++
+			for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+				p.pos++
+			}
+			return
+		}
+		if isASCIIPunct(next) {
+			p.text(string(next), 2)
+			return
+		}
+	}
+	p.text(`\`, 1)
+}
+
+// codeSpan takes everything up to a run of as many backticks as opened
+// it. Without one, the backticks are just backticks.
+func (p *inlineParser) codeSpan() {
+	start := p.pos
+	opening := runLength(p.s, start, '`')
+	after := start + opening
+
+	for i := after; i < len(p.s); {
+		if p.s[i] != '`' {
+			i++
+			continue
+		}
+		closing := runLength(p.s, i, '`')
+		if closing == opening {
+			code := strings.ReplaceAll(p.s[after:i], "\n", " ")
+			if len(code) >= 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+				code = code[1 : len(code)-1]
+			}
+			p.pos = i + closing
+			p.add(&inline{kind: codeInline, text: code})
+			return
+		}
+		i += closing
+	}
+	p.text(p.s[start:after], opening)
+}
+
+func runLength(s string, i int, c byte) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == c {
+		n++
+	}
+	return n
+}
+
+func (p *inlineParser) delimiterRun() {
+	start := p.pos
+	c := p.s[start]
+	length := runLength(p.s, start, c)
+	p.pos += length
+
+	before, after := ' ', ' '
+	if start > 0 {
+		before, _ = utf8.DecodeLastRuneInString(p.s[:start])
+	}
+	if p.pos < len(p.s) {
+		after, _ = utf8.DecodeRuneInString(p.s[p.pos:])
+	}
+
+	leftFlanking := !unicode.IsSpace(after) && (!isPunct(after) || unicode.IsSpace(before) || isPunct(before))
+	rightFlanking := !unicode.IsSpace(before) && (!isPunct(before) || unicode.IsSpace(after) || isPunct(after))
+	canOpen, canClose := leftFlanking, rightFlanking
+	if c == '_' {
+		canOpen = leftFlanking && (!rightFlanking || isPunct(before))
+		canClose = rightFlanking && (!leftFlanking || isPunct(after))
+	}
+
+	node := p.add(&inline{kind: textInline, text: p.s[start:p.pos]})
+	d := &delimiter{node: node, char: c, length: length, count: length, canOpen: canOpen, canClose: canClose, prev: p.delims}
+	if p.delims != nil {
+		p.delims.next = d
+	}
+	p.delims = d
+}
+
+func (p *inlineParser) removeDelimiter(d *delimiter) {
+	if d.prev != nil {
+		d.prev.next = d.next
+	}
+	if d.next != nil {
+		d.next.prev = d.prev
+	} else {
+		p.delims = d.prev
+	}
+}
+
+func (p *inlineParser) remove(n *inline) {
+	if n.prev != nil {
+		n.prev.next = n.next
+	} else {
+		p.root.first = n.next
+	}
+	if n.next != nil {
+		n.next.prev = n.prev
+	} else {
+		p.root.last = n.prev
+	}
+}
+
+// processEmphasis matches up the delimiters above bottom into emphasis,
+// following the spec's algorithm, then forgets them.
+func (p *inlineParser) processEmphasis(bottom *delimiter) {
+	var closer *delimiter
+	for d := p.delims; d != nil && d != bottom; d = d.prev {
+		closer = d
+	}
+
+	for closer != nil {
+		if !closer.canClose {
+			closer = closer.next
+			continue
+		}
+
+		var opener *delimiter
+		for o := closer.prev; o != nil && o != bottom; o = o.prev {
+			if o.char == closer.char && o.canOpen && !oddMatch(o, closer) {
+				opener = o
+				break
+			}
+		}
+		if opener == nil {
+			next := closer.next
+			if !closer.canOpen {
+				p.removeDelimiter(closer)
+			}
+			closer = next
+			continue
+		}
+
+		use, kind := 1, emphasisInline
+		if opener.count >= 2 && closer.count >= 2 {
+			use, kind = 2, strongInline
+		}
+		opener.count -= use
+		closer.count -= use
+		opener.node.text = opener.node.text[:opener.count]
+		closer.node.text = closer.node.text[:closer.count]
+
+		// everything between the two goes inside the emphasis
+		emphasis := &inline{kind: kind}
+		for n := opener.node.next; n != closer.node; {
+			next := n.next
+			emphasis.append(n)
+			n = next
+		}
+		emphasis.prev, emphasis.next = opener.node, closer.node
+		opener.node.next, closer.node.prev = emphasis, emphasis
+
+		for d := closer.prev; d != opener; d = d.prev {
+			p.removeDelimiter(d)
+		}
+		if opener.count == 0 {
+			p.remove(opener.node)
+			p.removeDelimiter(opener)
+		}
+		if closer.count == 0 {
+			next := closer.next
+			p.remove(closer.node)
+			p.removeDelimiter(closer)
+			closer = next
+		}
+	}
+
+	for p.delims != nil && p.delims != bottom {
+		p.removeDelimiter(p.delims)
+	}
+}
+
+// oddMatch is the spec's rule of three: a delimiter that could both open
+// and close can't pair with one whose run adds up to a multiple of three,
+// unless both runs are.
+func oddMatch(opener, closer *delimiter) bool {
+	return (opener.canClose || closer.canOpen) &&
+		(opener.length+closer.length)%3 == 0 &&
+		!(opener.length%3 == 0 && closer.length%3 == 0)
+}
+
+func (p *inlineParser) openBracket(image bool, width int) {
+	node := p.text(p.s[p.pos:p.pos+width], width)
+	p.brackets = &bracket{node: node, image: image, active: true, pos: p.pos, delims: p.delims, prev: p.brackets}
+}
+
+func (p *inlineParser) closeBracket() {
+	closePos := p.pos
+	b := p.brackets
+	if b == nil || !b.active {
+		if b != nil {
+			p.brackets = b.prev
+		}
+		p.text("]", 1)
+		return
+	}
+	p.pos++
+
+	dest, title, ok := p.inlineLink()
+	if !ok {
+		label := p.s[b.pos:closePos]
+		if full, end, found := linkLabel(p.s, p.pos); found {
+			if full != "" {
+				label = full
+			}
+			p.pos = end
+		}
+		// labels are at most 999 characters
+		if len(label) <= 999 {
+			var ref linkRef
+			ref, ok = p.refs[normalizeLabel(label)]
+			dest, title = ref.dest, ref.title
+		}
+	}
+	if !ok {
+		p.brackets = b.prev
+		p.pos = closePos
+		p.text("]", 1)
+		return
+	}
+
+	kind := linkInline
+	if b.image {
+		kind = imageInline
+	}
+	link := &inline{kind: kind, dest: dest, title: title}
+	p.processEmphasis(b.delims)
+	for n := b.node.next; n != nil; {
+		next := n.next
+		link.append(n)
+		n = next
+	}
+	b.node.next = nil
+	p.root.last = b.node
+	p.remove(b.node)
+	p.add(link)
+
+	p.brackets = b.prev
+	if !b.image {
+		// links can't hold links
+		for o := p.brackets; o != nil; o = o.prev {
+			if !o.image {
+				o.active = false
+			}
+		}
+	}
+}
+
+// inlineLink reads (destination "title") after a ].
+func (p *inlineParser) inlineLink() (dest, title string, ok bool) {
+	i := p.pos
+	if i >= len(p.s) || p.s[i] != '(' {
+		return "", "", false
+	}
+	i = skipSpace(p.s, i+1)
+
+	if i < len(p.s) && p.s[i] != ')' {
+		var end int
+		if dest, end, ok = linkDestination(p.s, i); !ok {
+			return "", "", false
+		}
+		i = end
+		if j := skipSpace(p.s, i); j > i && j < len(p.s) && p.s[j] != ')' {
+			if title, end, ok = linkTitle(p.s, j); !ok {
+				return "", "", false
+			}
+			i = end
+		}
+		i = skipSpace(p.s, i)
+	}
+	if i >= len(p.s) || p.s[i] != ')' {
+		return "", "", false
+	}
+	p.pos = i + 1
+	return dest, title, true
+}
+
+func skipSpace(s string, i int) int {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == '\n') {
+		i++
+	}
+	return i
+}
+
+// linkDestination reads <a destination> or one without spaces, whose
+// parentheses balance.
+func linkDestination(s string, i int) (string, int, bool) {
+	if s[i] == '<' {
+		for j := i + 1; j < len(s); j++ {
+			switch s[j] {
+			case '\\':
+				j++
+			case '\n', '<':
+				return "", 0, false
+			case '>':
+				return unescape(s[i+1 : j]), j + 1, true
+			}
+		}
+		return "", 0, false
+	}
+
+	depth, j := 0, i
+	for ; j < len(s); j++ {
+		c := s[j]
+		if c == '\\' && j+1 < len(s) && isASCIIPunct(s[j+1]) {
+			j++
+			continue
+		}
+		if c <= ' ' || c == 0x7f {
+			break
+		}
+		if c == '(' {
+			depth++
+		}
+		if c == ')' {
+			if depth == 0 {
+				break
+			}
+			depth--
+		}
+	}
+	if j == i || depth != 0 {
+		return "", 0, false
+	}
+	return unescape(s[i:j]), j, true
+}
+
+func linkTitle(s string, i int) (string, int, bool) {
+	closing := map[byte]byte{'"': '"', '\'': '\'', '(': ')'}[s[i]]
+	if closing == 0 {
+		return "", 0, false
+	}
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case closing:
+			return unescape(s[i+1 : j]), j + 1, true
+		case '(':
+			if closing == ')' {
+				return "", 0, false
+			}
+		}
+	}
+	return "", 0, false
+}
+
+// linkLabel reads [a label], returning its text and where it ends.
+func linkLabel(s string, i int) (string, int, bool) {
+	if i >= len(s) || s[i] != '[' {
+		return "", 0, false
+	}
+	for j := i + 1; j < len(s) && j-i <= 1000; j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '[':
+			return "", 0, false
+		case ']':
+			return s[i+1 : j], j + 1, true
+		}
+	}
+	return "", 0, false
+}
+
+func normalizeLabel(label string) string {
+	return strings.ToLower(strings.Join(strings.Fields(label), " "))
+}
+
+// autolink reads <https://a.link> or <an@email.address>.
+func (p *inlineParser) autolink() bool {
+	end := strings.IndexByte(p.s[p.pos:], '>')
+	if end < 0 {
+		return false
+	}
+	target := p.s[p.pos+1 : p.pos+end]
+	if strings.ContainsAny(target, " <\n\t") {
+		return false
+	}
+
+	dest := target
+	switch {
+	case isAbsoluteURI(target):
+	case isEmail(target):
+		dest = "mailto:" + target
+	default:
+		return false
+	}
+	p.pos += end + 1
+	link := p.add(&inline{kind: linkInline, dest: dest})
+	link.append(&inline{kind: textInline, text: target})
+	return true
+}
+
+func isAbsoluteURI(s string) bool {
+	colon := strings.IndexByte(s, ':')
+	return colon >= 2 && colon <= 32 && isScheme(s[:colon])
+}
+
+func isScheme(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		letter := 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+		if !letter && (i == 0 || !('0' <= c && c <= '9' || c == '+' || c == '.' || c == '-')) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isEmail(s string) bool {
+	at := strings.IndexByte(s, '@')
+	if at < 1 {
+		return false
+	}
+	for _, c := range s[:at] {
+		if !(c < utf8.RuneSelf && (unicode.IsLetter(c) || unicode.IsDigit(c) || strings.ContainsRune(".!#$%&'*+/=?^_`{|}~-", c))) {
+			return false
+		}
+	}
+	for _, part := range strings.Split(s[at+1:], ".") {
+		if part == "" || len(part) > 63 || part[0] == '-' || part[len(part)-1] == '-' {
+			return false
+		}
+		for _, c := range part {
+			if !(c < utf8.RuneSelf && (unicode.IsLetter(c) || unicode.IsDigit(c) || c == '-')) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (p *inlineParser) entity() {
+	if decoded, width := decodeEntity(p.s[p.pos:]); width > 0 {
+		p.text(decoded, width)
+		return
+	}
+	p.text("&", 1)
+}
+
+var namedEntities = map[string]string{
+	"amp": "&", "lt": "<", "gt": ">", "quot": `"`, "apos": "'", "nbsp": " ",
+	"copy": "©", "reg": "®", "trade": "™", "hellip": "…", "mdash": "—", "ndash": "–",
+	"lsquo": "‘", "rsquo": "’", "ldquo": "“", "rdquo": "”", "laquo": "«", "raquo": "»",
+	"euro": "€", "pound": "£", "deg": "°", "times": "×", "frac12": "½", "frac34": "¾",
+	"auml": "ä", "ouml": "ö", "uuml": "ü", "Auml": "Ä", "Ouml": "Ö", "Uuml": "Ü", "szlig": "ß",
+	"eacute": "é", "egrave": "è", "AElig": "Æ", "Dcaron": "Ď",
+}
+
+// decodeEntity reads a &name;, &#123; or &#x7b; at the start of s. Names
+// it doesn't know are left as they are.
+func decodeEntity(s string) (string, int) {
+	end := strings.IndexByte(s, ';')
+	if end < 2 || end > 33 {
+		return "", 0
+	}
+	name := s[1:end]
+
+	if name[0] == '#' {
+		digits, base := name[1:], 10
+		if digits != "" && (digits[0] == 'x' || digits[0] == 'X') {
+			digits, base = digits[1:], 16
+		}
+		if digits == "" || base == 10 && len(digits) > 7 || base == 16 && len(digits) > 6 {
+			return "", 0
+		}
+		code, err := strconv.ParseUint(digits, base, 32)
+		if err != nil {
+			return "", 0
+		}
+		r := rune(code)
+		if r == 0 || !utf8.ValidRune(r) {
+			r = unicode.ReplacementChar
+		}
+		return string(r), end + 1
+	}
+
+	if decoded, ok := namedEntities[name]; ok {
+		return decoded, end + 1
+	}
+	return "", 0
+}
+
+// unescape resolves backslash escapes and entities in link destinations,
+// titles and code fence info strings.
+func unescape(s string) string {
+	if !strings.ContainsAny(s, `\&`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]):
+			i++
+			b.WriteByte(s[i])
+		case s[i] == '&':
+			if decoded, width := decodeEntity(s[i:]); width > 0 {
+				b.WriteString(decoded)
+				i += width - 1
+				continue
+			}
+			b.WriteByte('&')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+func isASCIIPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+func isPunct(r rune) bool {
+	if r < utf8.RuneSelf {
+		return isASCIIPunct(byte(r))
+	}
+	return unicode.IsPunct(r)
+}
@@ -0,0 +1,739 @@
+package blogposts
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var defaultSchemes = []string{"http", "https", "mailto"}
+
+// Renderer turns CommonMark into HTML: headings, paragraphs, lists,
+// emphasis, links, images, code and block quotes. HTML written in the
+// Markdown is escaped rather than passed through, and links and images
+// may only use Schemes, so a post can't put script into a page.
+type Renderer struct {
+	// Schemes are the URL schemes links and images may use; nil allows
+	// http, https and mailto. Relative URLs are always allowed.
+	Schemes []string
+}
+
+func (r Renderer) Render(w io.Writer, markdown string) error {
+	b := &blockParser{refs: map[string]linkRef{}}
+	blocks := b.parse(splitLines(markdown))
+
+	out := &htmlWriter{refs: b.refs, schemes: r.Schemes}
+	if out.schemes == nil {
+		out.schemes = defaultSchemes
+	}
+	out.blocks(blocks, false)
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// HTML is the post's body rendered by a default Renderer.
+func (p Post) HTML() template.HTML {
+	var html strings.Builder
+	Renderer{}.Render(&html, p.Body)
+	return template.HTML(html.String())
+}
+
+type blockKind int
+
+const (
+	paragraphBlock blockKind = iota
+	headingBlock
+	codeBlock
+	quoteBlock
+	listBlock
+	itemBlock
+	ruleBlock
+)
+
+type block struct {
+	kind     blockKind
+	text     string
+	level    int
+	info     string
+	children []*block
+	ordered  bool
+	start    int
+	tight    bool
+	// blankBefore is whether a blank line separates the block from the one
+	// before it, which makes a list loose
+	blankBefore bool
+}
+
+// splitLines breaks markdown into lines, with tabs in the indentation
+// turned into spaces.
+func splitLines(markdown string) []string {
+	markdown = strings.ReplaceAll(markdown, "\r\n", "\n")
+	markdown = strings.ReplaceAll(markdown, "\r", "\n")
+	markdown = strings.ReplaceAll(markdown, "\x00", "�")
+	lines := strings.Split(strings.TrimSuffix(markdown, "\n"), "\n")
+
+	for i, line := range lines {
+		if !strings.Contains(line, "\t") {
+			continue
+		}
+		var b strings.Builder
+		column := 0
+		for j := 0; j < len(line); j++ {
+			switch line[j] {
+			case ' ':
+				b.WriteByte(' ')
+				column++
+			case '\t':
+				width := 4 - column%4
+				b.WriteString(strings.Repeat(" ", width))
+				column += width
+			default:
+				b.WriteString(line[j:])
+				j = len(line)
+			}
+		}
+		lines[i] = b.String()
+	}
+	return lines
+}
+
+type blockParser struct {
+	refs map[string]linkRef
+}
+
+func (p *blockParser) parse(lines []string) []*block {
+	var blocks []*block
+	blank := false
+	for i := 0; i < len(lines); {
+		if isBlank(lines[i]) {
+			blank = true
+			i++
+			continue
+		}
+		b, next := p.block(lines, i)
+		if b != nil {
+			b.blankBefore = blank && len(blocks) > 0
+			blocks = append(blocks, b)
+		}
+		blank = false
+		i = next
+	}
+	return blocks
+}
+
+// block reads the block starting at lines[i], returning it and the line
+// after it. Link reference definitions have no block, so that's nil.
+func (p *blockParser) block(lines []string, i int) (*block, int) {
+	line := lines[i]
+	indent := indentOf(line)
+	if indent >= 4 {
+		return p.indentedCode(lines, i)
+	}
+
+	rest := line[indent:]
+	if isRule(rest) {
+		return &block{kind: ruleBlock}, i + 1
+	}
+	if level, text, ok := atxHeading(rest); ok {
+		return &block{kind: headingBlock, level: level, text: text}, i + 1
+	}
+	if fence, info, ok := codeFence(rest); ok {
+		return p.fencedCode(lines, i, indent, fence, info)
+	}
+	if rest[0] == '>' {
+		return p.quote(lines, i)
+	}
+	if _, ok := listMarker(line); ok {
+		return p.list(lines, i)
+	}
+	return p.paragraph(lines, i)
+}
+
+func (p *blockParser) indentedCode(lines []string, i int) (*block, int) {
+	var code []string
+	end := i
+	for j := i; j < len(lines); j++ {
+		if isBlank(lines[j]) {
+			if len(lines[j]) > 4 {
+				code = append(code, lines[j][4:])
+			} else {
+				code = append(code, "")
+			}
+			continue
+		}
+		if indentOf(lines[j]) < 4 {
+			break
+		}
+		code = append(code, lines[j][4:])
+		end = j + 1
+	}
+	code = code[:end-i]
+	return &block{kind: codeBlock, text: strings.Join(code, "\n") + "\n"}, end
+}
+
+func (p *blockParser) fencedCode(lines []string, i, indent int, fence, info string) (*block, int) {
+	var code []string
+	j := i + 1
+	for ; j < len(lines); j++ {
+		line := lines[j]
+		if closing := strings.TrimRight(line, " "); indentOf(line) < 4 {
+			closing = strings.TrimLeft(closing, " ")
+			if strings.HasPrefix(closing, fence) && strings.Trim(closing, fence[:1]) == "" {
+				j++
+				break
+			}
+		}
+		strip := indentOf(line)
+		if strip > indent {
+			strip = indent
+		}
+		code = append(code, line[strip:])
+	}
+
+	text := strings.Join(code, "\n")
+	if len(code) > 0 {
+		text += "\n"
+	}
+	return &block{kind: codeBlock, text: text, info: info}, j
+}
+
+func (p *blockParser) quote(lines []string, i int) (*block, int) {
+	var inner []string
+	lazy := false
+	j := i
+	for ; j < len(lines); j++ {
+		line := lines[j]
+		if indent := indentOf(line); indent < 4 && strings.HasPrefix(line[indent:], ">") {
+			rest := line[indent+1:]
+			inner = append(inner, strings.TrimPrefix(rest, " "))
+			lazy = false
+			continue
+		}
+		if isBlank(line) || !(lazy && !startsBlock(line) || continuesParagraph(inner, line)) {
+			break
+		}
+		inner = append(inner, line)
+		lazy = true
+	}
+	return &block{kind: quoteBlock, children: p.parse(inner)}, j
+}
+
+// marker is the start of a list item.
+type marker struct {
+	ordered bool
+	// delim is the bullet, or the . or ) after the number
+	delim   byte
+	start   int
+	width   int
+	content string
+}
+
+func listMarker(line string) (marker, bool) {
+	indent := indentOf(line)
+	if indent >= 4 || isRule(line[indent:]) {
+		return marker{}, false
+	}
+	rest := line[indent:]
+
+	m := marker{}
+	n := 0
+	switch {
+	case rest != "" && strings.IndexByte("-+*", rest[0]) >= 0:
+		m.delim, n = rest[0], 1
+	default:
+		for n < len(rest) && n < 10 && '0' <= rest[n] && rest[n] <= '9' {
+			n++
+		}
+		if n == 0 || n > 9 || n >= len(rest) || (rest[n] != '.' && rest[n] != ')') {
+			return marker{}, false
+		}
+		m.ordered, m.delim = true, rest[n]
+		m.start, _ = strconv.Atoi(rest[:n])
+		n++
+	}
+	if n < len(rest) && rest[n] != ' ' {
+		return marker{}, false
+	}
+
+	spaces := indentOf(rest[n:])
+	switch {
+	case isBlank(rest[n:]):
+		m.width, m.content = indent+n+1, ""
+	case spaces > 4:
+		// the item starts with indented code
+		m.width, m.content = indent+n+1, rest[n+1:]
+	default:
+		m.width, m.content = indent+n+spaces, rest[n+spaces:]
+	}
+	return m, true
+}
+
+func (p *blockParser) list(lines []string, i int) (*block, int) {
+	first, _ := listMarker(lines[i])
+	list := &block{kind: listBlock, ordered: first.ordered, start: first.start, tight: true}
+
+	j := i
+	for j < len(lines) {
+		for j < len(lines)-1 && isBlank(lines[j]) {
+			j++
+		}
+		m, ok := listMarker(lines[j])
+		if !ok || m.ordered != first.ordered || m.delim != first.delim {
+			break
+		}
+		if len(list.children) > 0 && j > 0 && isBlank(lines[j-1]) {
+			list.tight = false
+		}
+
+		content, next := itemLines(lines, j, m)
+		item := &block{kind: itemBlock, children: p.parse(content)}
+		for k, child := range item.children {
+			if k > 0 && child.blankBefore {
+				list.tight = false
+			}
+		}
+		list.children = append(list.children, item)
+		j = next
+	}
+
+	// blank lines after the list are the parent's
+	for j > i && isBlank(lines[j-1]) {
+		j--
+	}
+	return list, j
+}
+
+// itemLines is the content of the item that starts at lines[i], with its
+// indentation taken away, and the line after it.
+func itemLines(lines []string, i int, m marker) ([]string, int) {
+	content := []string{m.content}
+	lazy := false
+	j := i + 1
+	for ; j < len(lines); j++ {
+		line := lines[j]
+		if isBlank(line) {
+			// an item can start with at most one blank line
+			if len(content) == 1 && isBlank(content[0]) {
+				break
+			}
+			content = append(content, "")
+			lazy = false
+			continue
+		}
+		if indentOf(line) >= m.width {
+			content = append(content, line[m.width:])
+			lazy = false
+			continue
+		}
+		if isBlank(content[len(content)-1]) || !(lazy && !startsBlock(line) || continuesParagraph(content, line)) {
+			break
+		}
+		content = append(content, line)
+		lazy = true
+	}
+
+	for len(content) > 0 && isBlank(content[len(content)-1]) {
+		content = content[:len(content)-1]
+	}
+	return content, j
+}
+
+// continuesParagraph is whether line is a lazy continuation of a paragraph
+// at the end of lines: a line that, but for not being indented or quoted,
+// would carry on the paragraph.
+func continuesParagraph(lines []string, line string) bool {
+	if len(lines) == 0 || isBlank(lines[len(lines)-1]) || startsBlock(line) {
+		return false
+	}
+
+	blocks := (&blockParser{refs: map[string]linkRef{}}).parse(lines)
+	for len(blocks) > 0 {
+		last := blocks[len(blocks)-1]
+		switch last.kind {
+		case paragraphBlock:
+			return true
+		case quoteBlock, listBlock, itemBlock:
+			blocks = last.children
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// startsBlock is whether line starts something other than a paragraph.
+func startsBlock(line string) bool {
+	indent := indentOf(line)
+	if indent >= 4 {
+		return false
+	}
+	rest := line[indent:]
+	_, _, heading := atxHeading(rest)
+	_, _, fence := codeFence(rest)
+	_, item := listMarker(line)
+	return isRule(rest) || heading || fence || item || strings.HasPrefix(rest, ">")
+}
+
+// interruptsParagraph is whether line ends a paragraph. Lists can only do
+// so when they start at 1 with something in the first item, so a number at
+// the start of a wrapped line isn't mistaken for one.
+func interruptsParagraph(line string) bool {
+	if !startsBlock(line) {
+		return false
+	}
+	m, item := listMarker(line)
+	if !item || isRule(strings.TrimLeft(line, " ")) {
+		return true
+	}
+	return !isBlank(m.content) && (!m.ordered || m.start == 1)
+}
+
+func (p *blockParser) paragraph(lines []string, i int) (*block, int) {
+	text := []string{strings.TrimLeft(lines[i], " ")}
+	j := i + 1
+	for ; j < len(lines); j++ {
+		line := lines[j]
+		if isBlank(line) {
+			break
+		}
+		if level := setextLevel(line); level > 0 {
+			if heading := p.linkRefs(strings.Join(text, "\n")); heading != "" {
+				return &block{kind: headingBlock, level: level, text: heading}, j + 1
+			}
+		}
+		if interruptsParagraph(line) {
+			break
+		}
+		text = append(text, strings.TrimLeft(line, " "))
+	}
+
+	paragraph := p.linkRefs(strings.Join(text, "\n"))
+	if paragraph == "" {
+		return nil, j
+	}
+	return &block{kind: paragraphBlock, text: paragraph}, j
+}
+
+// linkRefs takes the link reference definitions from the start of a
+// paragraph, returning what's left of it.
+func (p *blockParser) linkRefs(text string) string {
+	for {
+		label, ref, end, ok := linkRefDefinition(text)
+		if !ok {
+			break
+		}
+		key := normalizeLabel(label)
+		if _, defined := p.refs[key]; !defined {
+			p.refs[key] = ref
+		}
+		text = text[end:]
+	}
+	return strings.TrimRight(text, " ")
+}
+
+// linkRefDefinition reads [label]: destination "title" from the start of
+// s, returning where it ends.
+func linkRefDefinition(s string) (string, linkRef, int, bool) {
+	label, i, ok := linkLabel(s, 0)
+	if !ok || strings.TrimSpace(label) == "" || i >= len(s) || s[i] != ':' {
+		return "", linkRef{}, 0, false
+	}
+	i = skipSpace(s, i+1)
+	if i >= len(s) {
+		return "", linkRef{}, 0, false
+	}
+	dest, i, ok := linkDestination(s, i)
+	if !ok {
+		return "", linkRef{}, 0, false
+	}
+
+	// the title is optional, but nothing else may follow on the line
+	if j := skipSpace(s, i); j > i && j < len(s) {
+		if title, end, ok := linkTitle(s, j); ok {
+			if rest, ok := restOfLine(s, end); ok {
+				return label, linkRef{dest, title}, rest, true
+			}
+		}
+	}
+	rest, ok := restOfLine(s, i)
+	if !ok {
+		return "", linkRef{}, 0, false
+	}
+	return label, linkRef{dest: dest}, rest, true
+}
+
+// restOfLine is where the next line starts, if there's only space before
+// it.
+func restOfLine(s string, i int) (int, bool) {
+	for ; i < len(s); i++ {
+		switch s[i] {
+		case ' ', '\t':
+		case '\n':
+			return i + 1, true
+		default:
+			return 0, false
+		}
+	}
+	return i, true
+}
+
+func setextLevel(line string) int {
+	if indentOf(line) >= 4 {
+		return 0
+	}
+	underline := strings.TrimSpace(line)
+	switch {
+	case underline == "":
+		return 0
+	case strings.Trim(underline, "=") == "":
+		return 1
+	case strings.Trim(underline, "-") == "":
+		return 2
+	}
+	return 0
+}
+
+func atxHeading(s string) (int, string, bool) {
+	level := runLength(s, 0, '#')
+	if level == 0 || level > 6 || (level < len(s) && s[level] != ' ') {
+		return 0, "", false
+	}
+
+	text := strings.TrimSpace(s[level:])
+	// a closing run of #s goes, if there's space before it
+	if closing := strings.TrimRight(text, "#"); closing == "" {
+		text = ""
+	} else if closing != text && strings.HasSuffix(closing, " ") {
+		text = strings.TrimRight(closing, " ")
+	}
+	return level, text, true
+}
+
+func codeFence(s string) (string, string, bool) {
+	if s == "" || (s[0] != '`' && s[0] != '~') {
+		return "", "", false
+	}
+	n := runLength(s, 0, s[0])
+	if n < 3 {
+		return "", "", false
+	}
+	info := strings.TrimSpace(s[n:])
+	if s[0] == '`' && strings.Contains(info, "`") {
+		return "", "", false
+	}
+	return s[:n], unescape(info), true
+}
+
+func isRule(s string) bool {
+	s = strings.TrimRight(s, " ")
+	if s == "" || strings.IndexByte("-*_", s[0]) < 0 {
+		return false
+	}
+	count := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case s[0]:
+			count++
+		case ' ':
+		default:
+			return false
+		}
+	}
+	return count >= 3
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+// htmlWriter writes blocks out as HTML, laid out like the CommonMark
+// reference implementation so its examples can be compared directly.
+type htmlWriter struct {
+	strings.Builder
+	refs    map[string]linkRef
+	schemes []string
+}
+
+// newline starts a new line, unless one has just been started.
+func (w *htmlWriter) newline() {
+	s := w.String()
+	if s != "" && s[len(s)-1] != '\n' {
+		w.WriteByte('\n')
+	}
+}
+
+func (w *htmlWriter) blocks(blocks []*block, tight bool) {
+	for _, b := range blocks {
+		w.block(b, tight)
+	}
+}
+
+func (w *htmlWriter) block(b *block, tight bool) {
+	switch b.kind {
+	case paragraphBlock:
+		if tight {
+			w.inlines(parseInlines(b.text, w.refs))
+			return
+		}
+		w.newline()
+		w.WriteString("<p>")
+		w.inlines(parseInlines(b.text, w.refs))
+		w.WriteString("</p>\n")
+	case headingBlock:
+		w.newline()
+		fmt.Fprintf(w, "<h%d>", b.level)
+		w.inlines(parseInlines(b.text, w.refs))
+		fmt.Fprintf(w, "</h%d>\n", b.level)
+	case codeBlock:
+		w.newline()
+		w.WriteString("<pre><code")
+		if language := strings.Fields(b.info); len(language) > 0 {
+			fmt.Fprintf(w, ` class="language-%s"`, escapeHTML(language[0]))
+		}
+		w.WriteString(">" + escapeHTML(b.text) + "</code></pre>\n")
+	case quoteBlock:
+		w.newline()
+		w.WriteString("<blockquote>\n")
+		w.blocks(b.children, false)
+		w.newline()
+		w.WriteString("</blockquote>\n")
+	case listBlock:
+		w.newline()
+		switch {
+		case !b.ordered:
+			w.WriteString("<ul>\n")
+		case b.start != 1:
+			fmt.Fprintf(w, "<ol start=\"%d\">\n", b.start)
+		default:
+			w.WriteString("<ol>\n")
+		}
+		for _, item := range b.children {
+			w.WriteString("<li>")
+			w.blocks(item.children, b.tight)
+			w.WriteString("</li>\n")
+		}
+		if b.ordered {
+			w.WriteString("</ol>\n")
+		} else {
+			w.WriteString("</ul>\n")
+		}
+	case ruleBlock:
+		w.newline()
+		w.WriteString("<hr />\n")
+	}
+}
+
+func (w *htmlWriter) inlines(parent *inline) {
+	for n := parent.first; n != nil; n = n.next {
+		switch n.kind {
+		case textInline:
+			w.WriteString(escapeHTML(n.text))
+		case codeInline:
+			w.WriteString("<code>" + escapeHTML(n.text) + "</code>")
+		case emphasisInline:
+			w.WriteString("<em>")
+			w.inlines(n)
+			w.WriteString("</em>")
+		case strongInline:
+			w.WriteString("<strong>")
+			w.inlines(n)
+			w.WriteString("</strong>")
+		case linkInline:
+			if !w.safe(n.dest) {
+				w.inlines(n)
+				continue
+			}
+			w.WriteString(`<a href="` + escapeHTML(encodeURL(n.dest)) + `"`)
+			if n.title != "" {
+				w.WriteString(` title="` + escapeHTML(n.title) + `"`)
+			}
+			w.WriteString(">")
+			w.inlines(n)
+			w.WriteString("</a>")
+		case imageInline:
+			if !w.safe(n.dest) {
+				w.WriteString(escapeHTML(plainText(n)))
+				continue
+			}
+			w.WriteString(`<img src="` + escapeHTML(encodeURL(n.dest)) + `" alt="` + escapeHTML(plainText(n)) + `"`)
+			if n.title != "" {
+				w.WriteString(` title="` + escapeHTML(n.title) + `"`)
+			}
+			w.WriteString(" />")
+		case softBreakInline:
+			w.WriteString("\n")
+		case hardBreakInline:
+			w.WriteString("<br />\n")
+		}
+	}
+}
+
+// safe is whether dest is relative or uses one of the allowed schemes.
+func (w *htmlWriter) safe(dest string) bool {
+	colon := strings.IndexByte(dest, ':')
+	if colon < 0 || !isScheme(dest[:colon]) {
+		return true
+	}
+	scheme := strings.ToLower(dest[:colon])
+	for _, allowed := range w.schemes {
+		if scheme == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// plainText is what's inside an image, without the markup, for its alt.
+func plainText(parent *inline) string {
+	var text strings.Builder
+	for n := parent.first; n != nil; n = n.next {
+		switch n.kind {
+		case textInline, codeInline:
+			text.WriteString(n.text)
+		case softBreakInline, hardBreakInline:
+			text.WriteString("\n")
+		default:
+			text.WriteString(plainText(n))
+		}
+	}
+	return text.String()
+}
+
+var htmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+func escapeHTML(s string) string {
+	return htmlEscaper.Replace(s)
+}
+
+// encodeURL percent-encodes what can't go in a URL as it is, leaving any
+// encoding already there alone.
+func encodeURL(dest string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(dest); i++ {
+		c := dest[i]
+		switch {
+		case c == '%' && i+2 < len(dest) && isHex(dest[i+1]) && isHex(dest[i+2]):
+			b.WriteByte(c)
+		case c < utf8.RuneSelf && c > ' ' && c != '%' && c != '"' && c != '<' && c != '>' &&
+			c != '\\' && c != '^' && c != '`' && c != '{' && c != '|' && c != '}' && c != 0x7f:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&15])
+		}
+	}
+	return b.String()
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
@@ -0,0 +1,253 @@
+package blogposts_test
+
+import (
+	"html/template"
+	"strings"
+	"testing"
+
+	"github.com/errantDev/blogposts"
+)
+
+// specExamples are taken from the CommonMark spec, https://spec.commonmark.org,
+// for the parts of it the Renderer supports.
+var specExamples = []struct {
+	section  string
+	markdown string
+	html     string
+}{
+	{"Thematic breaks", "***\n---\n___\n", "<hr />\n<hr />\n<hr />\n"},
+	{"Thematic breaks", "+++\n", "<p>+++</p>\n"},
+	{"Thematic breaks", "--\n**\n__\n", "<p>--\n**\n__</p>\n"},
+	{"Thematic breaks", " ***\n  ***\n   ***\n", "<hr />\n<hr />\n<hr />\n"},
+	{"Thematic breaks", "    ***\n", "<pre><code>***\n</code></pre>\n"},
+	{"Thematic breaks", " - - -\n", "<hr />\n"},
+	{"Thematic breaks", "- foo\n***\n- bar\n", "<ul>\n<li>foo</li>\n</ul>\n<hr />\n<ul>\n<li>bar</li>\n</ul>\n"},
+	{"Thematic breaks", "Foo\n***\nbar\n", "<p>Foo</p>\n<hr />\n<p>bar</p>\n"},
+	{"Thematic breaks", "Foo\n---\nbar\n", "<h2>Foo</h2>\n<p>bar</p>\n"},
+	{"Thematic breaks", "* Foo\n* * *\n* Bar\n", "<ul>\n<li>Foo</li>\n</ul>\n<hr />\n<ul>\n<li>Bar</li>\n</ul>\n"},
+	{"Thematic breaks", "- Foo\n- * * *\n", "<ul>\n<li>Foo</li>\n<li>\n<hr />\n</li>\n</ul>\n"},
+
+	{"ATX headings", "# foo\n## foo\n### foo\n#### foo\n##### foo\n###### foo\n", "<h1>foo</h1>\n<h2>foo</h2>\n<h3>foo</h3>\n<h4>foo</h4>\n<h5>foo</h5>\n<h6>foo</h6>\n"},
+	{"ATX headings", "####### foo\n", "<p>####### foo</p>\n"},
+	{"ATX headings", "#5 bolt\n\n#hashtag\n", "<p>#5 bolt</p>\n<p>#hashtag</p>\n"},
+	{"ATX headings", "\\## foo\n", "<p>## foo</p>\n"},
+	{"ATX headings", "# foo *bar* \\*baz\\*\n", "<h1>foo <em>bar</em> *baz*</h1>\n"},
+	{"ATX headings", "## foo ##\n  ###   bar    ###\n", "<h2>foo</h2>\n<h3>bar</h3>\n"},
+	{"ATX headings", "### foo ### b\n", "<h3>foo ### b</h3>\n"},
+	{"ATX headings", "# foo#\n", "<h1>foo#</h1>\n"},
+	{"ATX headings", "****\n## foo\n****\n", "<hr />\n<h2>foo</h2>\n<hr />\n"},
+	{"ATX headings", "## \n#\n### ###\n", "<h2></h2>\n<h1></h1>\n<h3></h3>\n"},
+
+	{"Setext headings", "Foo *bar*\n=========\n\nFoo *bar*\n---------\n", "<h1>Foo <em>bar</em></h1>\n<h2>Foo <em>bar</em></h2>\n"},
+	{"Setext headings", "Foo *bar\nbaz*\n====\n", "<h1>Foo <em>bar\nbaz</em></h1>\n"},
+	{"Setext headings", "Foo\n= =\n\nFoo\n--- -\n", "<p>Foo\n= =</p>\n<p>Foo</p>\n<hr />\n"},
+	{"Setext headings", "> Foo\n---\n", "<blockquote>\n<p>Foo</p>\n</blockquote>\n<hr />\n"},
+	{"Setext headings", "- Foo\n---\n", "<ul>\n<li>Foo</li>\n</ul>\n<hr />\n"},
+	{"Setext headings", "\\> foo\n------\n", "<h2>&gt; foo</h2>\n"},
+
+	{"Indented code blocks", "    a simple\n      indented code block\n", "<pre><code>a simple\n  indented code block\n</code></pre>\n"},
+	{"Indented code blocks", "    chunk1\n\n    chunk2\n  \n \n \n    chunk3\n", "<pre><code>chunk1\n\nchunk2\n\n\n\nchunk3\n</code></pre>\n"},
+	{"Indented code blocks", "Foo\n    bar\n", "<p>Foo\nbar</p>\n"},
+	{"Indented code blocks", "    <a/>\n    *hi*\n\n    - one\n", "<pre><code>&lt;a/&gt;\n*hi*\n\n- one\n</code></pre>\n"},
+
+	{"Fenced code blocks", "```\n<\n >\n```\n", "<pre><code>&lt;\n &gt;\n</code></pre>\n"},
+	{"Fenced code blocks", "~~~\n<\n >\n~~~\n", "<pre><code>&lt;\n &gt;\n</code></pre>\n"},
+	{"Fenced code blocks", "``\nfoo\n``\n", "<p><code>foo</code></p>\n"},
+	{"Fenced code blocks", "```\naaa\n~~~\n```\n", "<pre><code>aaa\n~~~\n</code></pre>\n"},
+	{"Fenced code blocks", "````\naaa\n```\n``````\n", "<pre><code>aaa\n```\n</code></pre>\n"},
+	{"Fenced code blocks", "```\n", "<pre><code></code></pre>\n"},
+	{"Fenced code blocks", "> ```\n> aaa\n\nbbb\n", "<blockquote>\n<pre><code>aaa\n</code></pre>\n</blockquote>\n<p>bbb</p>\n"},
+	{"Fenced code blocks", " ```\n aaa\naaa\n```\n", "<pre><code>aaa\naaa\n</code></pre>\n"},
+	{"Fenced code blocks", "```ruby\ndef foo(x)\n  return 3\nend\n```\n", "<pre><code class=\"language-ruby\">def foo(x)\n  return 3\nend\n</code></pre>\n"},
+	{"Fenced code blocks", "``` aa ```\nfoo\n", "<p><code>aa</code>\nfoo</p>\n"},
+	{"Fenced code blocks", "foo\n```\nbar\n```\nbaz\n", "<p>foo</p>\n<pre><code>bar\n</code></pre>\n<p>baz</p>\n"},
+
+	{"Link reference definitions", "[foo]: /url \"title\"\n\n[foo]\n", "<p><a href=\"/url\" title=\"title\">foo</a></p>\n"},
+	{"Link reference definitions", "[foo]: /url '\ntitle\nline1\nline2\n'\n\n[foo]\n", "<p><a href=\"/url\" title=\"\ntitle\nline1\nline2\n\">foo</a></p>\n"},
+	{"Link reference definitions", "[Foo bar]:\n<my url>\n'title'\n\n[Foo bar]\n", "<p><a href=\"my%20url\" title=\"title\">Foo bar</a></p>\n"},
+	{"Link reference definitions", "[foo]\n\n[foo]: url\n", "<p><a href=\"url\">foo</a></p>\n"},
+	{"Link reference definitions", "[foo]\n\n[foo]: first\n[foo]: second\n", "<p><a href=\"first\">foo</a></p>\n"},
+	{"Link reference definitions", "[FOO]: /url\n\n[Foo]\n", "<p><a href=\"/url\">Foo</a></p>\n"},
+	{"Link reference definitions", "[foo]: /url \"title\" ok\n", "<p>[foo]: /url &quot;title&quot; ok</p>\n"},
+
+	{"Paragraphs", "aaa\n\nbbb\n", "<p>aaa</p>\n<p>bbb</p>\n"},
+	{"Paragraphs", "  aaa\n bbb\n", "<p>aaa\nbbb</p>\n"},
+	{"Paragraphs", "aaa\n             bbb\n                                       ccc\n", "<p>aaa\nbbb\nccc</p>\n"},
+	{"Paragraphs", "aaa     \nbbb     \n", "<p>aaa<br />\nbbb</p>\n"},
+
+	{"Block quotes", "> # Foo\n> bar\n> baz\n", "<blockquote>\n<h1>Foo</h1>\n<p>bar\nbaz</p>\n</blockquote>\n"},
+	{"Block quotes", "> # Foo\n> bar\nbaz\n", "<blockquote>\n<h1>Foo</h1>\n<p>bar\nbaz</p>\n</blockquote>\n"},
+	{"Block quotes", "> bar\nbaz\n> foo\n", "<blockquote>\n<p>bar\nbaz\nfoo</p>\n</blockquote>\n"},
+	{"Block quotes", "> - foo\n- bar\n", "<blockquote>\n<ul>\n<li>foo</li>\n</ul>\n</blockquote>\n<ul>\n<li>bar</li>\n</ul>\n"},
+	{"Block quotes", ">\n", "<blockquote>\n</blockquote>\n"},
+	{"Block quotes", "> foo\n\n> bar\n", "<blockquote>\n<p>foo</p>\n</blockquote>\n<blockquote>\n<p>bar</p>\n</blockquote>\n"},
+	{"Block quotes", "> foo\n>\n> bar\n", "<blockquote>\n<p>foo</p>\n<p>bar</p>\n</blockquote>\n"},
+	{"Block quotes", "> > > foo\nbar\n", "<blockquote>\n<blockquote>\n<blockquote>\n<p>foo\nbar</p>\n</blockquote>\n</blockquote>\n</blockquote>\n"},
+
+	{"List items", "1.  A paragraph\n    with two lines.\n\n        indented code\n\n    > A block quote.\n", "<ol>\n<li>\n<p>A paragraph\nwith two lines.</p>\n<pre><code>indented code\n</code></pre>\n<blockquote>\n<p>A block quote.</p>\n</blockquote>\n</li>\n</ol>\n"},
+	{"List items", "- one\n\n two\n", "<ul>\n<li>one</li>\n</ul>\n<p>two</p>\n"},
+	{"List items", "- one\n\n  two\n", "<ul>\n<li>\n<p>one</p>\n<p>two</p>\n</li>\n</ul>\n"},
+	{"List items", "-one\n\n2.two\n", "<p>-one</p>\n<p>2.two</p>\n"},
+	{"List items", "123456789. ok\n", "<ol start=\"123456789\">\n<li>ok</li>\n</ol>\n"},
+	{"List items", "1234567890. not ok\n", "<p>1234567890. not ok</p>\n"},
+	{"List items", "-\n  foo\n-\n  ```\n  bar\n  ```\n-\n      baz\n", "<ul>\n<li>foo</li>\n<li>\n<pre><code>bar\n</code></pre>\n</li>\n<li>\n<pre><code>baz\n</code></pre>\n</li>\n</ul>\n"},
+	{"List items", "- foo\n-\n- bar\n", "<ul>\n<li>foo</li>\n<li></li>\n<li>bar</li>\n</ul>\n"},
+	{"List items", "foo\n*\n\nfoo\n1.\n", "<p>foo\n*</p>\n<p>foo\n1.</p>\n"},
+	{"List items", "- foo\n  - bar\n    - baz\n      - boo\n", "<ul>\n<li>foo\n<ul>\n<li>bar\n<ul>\n<li>baz\n<ul>\n<li>boo</li>\n</ul>\n</li>\n</ul>\n</li>\n</ul>\n</li>\n</ul>\n"},
+	{"List items", "- # Foo\n- Bar\n  ---\n  baz\n", "<ul>\n<li>\n<h1>Foo</h1>\n</li>\n<li>\n<h2>Bar</h2>\nbaz</li>\n</ul>\n"},
+
+	{"Lists", "- foo\n- bar\n+ baz\n", "<ul>\n<li>foo</li>\n<li>bar</li>\n</ul>\n<ul>\n<li>baz</li>\n</ul>\n"},
+	{"Lists", "1. foo\n2. bar\n3) baz\n", "<ol>\n<li>foo</li>\n<li>bar</li>\n</ol>\n<ol start=\"3\">\n<li>baz</li>\n</ol>\n"},
+	{"Lists", "Foo\n- bar\n- baz\n", "<p>Foo</p>\n<ul>\n<li>bar</li>\n<li>baz</li>\n</ul>\n"},
+	{"Lists", "The number of windows in my house is\n14.  The number of doors is 6.\n", "<p>The number of windows in my house is\n14.  The number of doors is 6.</p>\n"},
+	{"Lists", "- foo\n\n- bar\n\n\n- baz\n", "<ul>\n<li>\n<p>foo</p>\n</li>\n<li>\n<p>bar</p>\n</li>\n<li>\n<p>baz</p>\n</li>\n</ul>\n"},
+	{"Lists", "- a\n- b\n\n- c\n", "<ul>\n<li>\n<p>a</p>\n</li>\n<li>\n<p>b</p>\n</li>\n<li>\n<p>c</p>\n</li>\n</ul>\n"},
+	{"Lists", "- a\n  - b\n\n    c\n- d\n", "<ul>\n<li>a\n<ul>\n<li>\n<p>b</p>\n<p>c</p>\n</li>\n</ul>\n</li>\n<li>d</li>\n</ul>\n"},
+	{"Lists", "- a\n  > b\n  ```\n  c\n  ```\n- d\n", "<ul>\n<li>a\n<blockquote>\n<p>b</p>\n</blockquote>\n<pre><code>c\n</code></pre>\n</li>\n<li>d</li>\n</ul>\n"},
+	{"Lists", "* a\n*\n\n* c\n", "<ul>\n<li>\n<p>a</p>\n</li>\n<li></li>\n<li>\n<p>c</p>\n</li>\n</ul>\n"},
+	{"Lists", "- a\n  - b\n  - c\n\n- d\n  - e\n  - f\n", "<ul>\n<li>\n<p>a</p>\n<ul>\n<li>b</li>\n<li>c</li>\n</ul>\n</li>\n<li>\n<p>d</p>\n<ul>\n<li>e</li>\n<li>f</li>\n</ul>\n</li>\n</ul>\n"},
+
+	{"Backslash escapes", "\\*not emphasized*\n\\<br/> not a tag\n\\[not a link](/foo)\n\\`not code`\n1\\. not a list\n\\* not a list\n\\# not a heading\n\\[foo]: /url \"not a reference\"\n\\&ouml; not a character entity\n",
+		"<p>*not emphasized*\n&lt;br/&gt; not a tag\n[not a link](/foo)\n`not code`\n1. not a list\n* not a list\n# not a heading\n[foo]: /url &quot;not a reference&quot;\n&amp;ouml; not a character entity</p>\n"},
+	{"Backslash escapes", "\\\\*emphasis*\n", "<p>\\<em>emphasis</em></p>\n"},
+	{"Backslash escapes", "foo\\\nbar\n", "<p>foo<br />\nbar</p>\n"},
+	{"Backslash escapes", "`` \\[\\` ``\n", "<p><code>\\[\\`</code></p>\n"},
+	{"Backslash escapes", "[foo](/bar\\* \"ti\\*tle\")\n", "<p><a href=\"/bar*\" title=\"ti*tle\">foo</a></p>\n"},
+
+	{"Entity and numeric character references", "&#35; &#1234; &#992; &#0;\n", "<p># Ӓ Ϡ �</p>\n"},
+	{"Entity and numeric character references", "&#X22; &#XD06; &#xcab;\n", "<p>&quot; ആ ಫ</p>\n"},
+	{"Entity and numeric character references", "&nbsp &x; &#; &#x;\n&#87654321;\n&#abcdef0;\n&ThisIsNotDefined; &hi?;\n", "<p>&amp;nbsp &amp;x; &amp;#; &amp;#x;\n&amp;#87654321;\n&amp;#abcdef0;\n&amp;ThisIsNotDefined; &amp;hi?;</p>\n"},
+	{"Entity and numeric character references", "&copy\n", "<p>&amp;copy</p>\n"},
+	{"Entity and numeric character references", "[foo](/f&ouml;&ouml; \"f&ouml;&ouml;\")\n", "<p><a href=\"/f%C3%B6%C3%B6\" title=\"föö\">foo</a></p>\n"},
+	{"Entity and numeric character references", "`f&ouml;&ouml;`\n", "<p><code>f&amp;ouml;&amp;ouml;</code></p>\n"},
+
+	{"Code spans", "`foo`\n", "<p><code>foo</code></p>\n"},
+	{"Code spans", "`` foo ` bar ``\n", "<p><code>foo ` bar</code></p>\n"},
+	{"Code spans", "` `` `\n", "<p><code>``</code></p>\n"},
+	{"Code spans", "`  ``  `\n", "<p><code> `` </code></p>\n"},
+	{"Code spans", "``\nfoo\nbar  \nbaz\n``\n", "<p><code>foo bar   baz</code></p>\n"},
+	{"Code spans", "`foo\\`bar`\n", "<p><code>foo\\</code>bar`</p>\n"},
+	{"Code spans", "*foo`*`\n", "<p>*foo<code>*</code></p>\n"},
+	{"Code spans", "```foo``\n", "<p>```foo``</p>\n"},
+
+	{"Emphasis and strong emphasis", "*foo bar*\n", "<p><em>foo bar</em></p>\n"},
+	{"Emphasis and strong emphasis", "a * foo bar*\n", "<p>a * foo bar*</p>\n"},
+	{"Emphasis and strong emphasis", "foo*bar*\n", "<p>foo<em>bar</em></p>\n"},
+	{"Emphasis and strong emphasis", "_foo bar_\n", "<p><em>foo bar</em></p>\n"},
+	{"Emphasis and strong emphasis", "foo_bar_\n", "<p>foo_bar_</p>\n"},
+	{"Emphasis and strong emphasis", "**foo bar**\n", "<p><strong>foo bar</strong></p>\n"},
+	{"Emphasis and strong emphasis", "foo**bar**\n", "<p>foo<strong>bar</strong></p>\n"},
+	{"Emphasis and strong emphasis", "__foo__bar\n", "<p>__foo__bar</p>\n"},
+	{"Emphasis and strong emphasis", "*foo**bar**baz*\n", "<p><em>foo<strong>bar</strong>baz</em></p>\n"},
+	{"Emphasis and strong emphasis", "*foo**bar*\n", "<p><em>foo**bar</em></p>\n"},
+	{"Emphasis and strong emphasis", "***foo** bar*\n", "<p><em><strong>foo</strong> bar</em></p>\n"},
+	{"Emphasis and strong emphasis", "foo***bar***baz\n", "<p>foo<em><strong>bar</strong></em>baz</p>\n"},
+	{"Emphasis and strong emphasis", "foo******bar*********baz\n", "<p>foo<strong><strong><strong>bar</strong></strong></strong>***baz</p>\n"},
+	{"Emphasis and strong emphasis", "**foo*\n", "<p>*<em>foo</em></p>\n"},
+	{"Emphasis and strong emphasis", "*foo**\n", "<p><em>foo</em>*</p>\n"},
+	{"Emphasis and strong emphasis", "*(*foo*)*\n", "<p><em>(<em>foo</em>)</em></p>\n"},
+	{"Emphasis and strong emphasis", "*foo [bar](/url)*\n", "<p><em>foo <a href=\"/url\">bar</a></em></p>\n"},
+	{"Emphasis and strong emphasis", "*a `*`*\n", "<p><em>a <code>*</code></em></p>\n"},
+	{"Emphasis and strong emphasis", "**a<http://foo.bar/?q=**>\n", "<p>**a<a href=\"http://foo.bar/?q=**\">http://foo.bar/?q=**</a></p>\n"},
+
+	{"Links", "[link](/uri \"title\")\n", "<p><a href=\"/uri\" title=\"title\">link</a></p>\n"},
+	{"Links", "[link]()\n", "<p><a href=\"\">link</a></p>\n"},
+	{"Links", "[link](<>)\n", "<p><a href=\"\">link</a></p>\n"},
+	{"Links", "[link](/my uri)\n", "<p>[link](/my uri)</p>\n"},
+	{"Links", "[link](</my uri>)\n", "<p><a href=\"/my%20uri\">link</a></p>\n"},
+	{"Links", "[link](foo(and(bar)))\n", "<p><a href=\"foo(and(bar))\">link</a></p>\n"},
+	{"Links", "[link](foo\\)\\:)\n", "<p><a href=\"foo):\">link</a></p>\n"},
+	{"Links", "[link](foo%20b&auml;)\n", "<p><a href=\"foo%20b%C3%A4\">link</a></p>\n"},
+	{"Links", "[link](/url \"title \\\"&quot;\")\n", "<p><a href=\"/url\" title=\"title &quot;&quot;\">link</a></p>\n"},
+	{"Links", "[link [foo [bar]]](/uri)\n", "<p><a href=\"/uri\">link [foo [bar]]</a></p>\n"},
+	{"Links", "[link *foo **bar** `#`*](/uri)\n", "<p><a href=\"/uri\">link <em>foo <strong>bar</strong> <code>#</code></em></a></p>\n"},
+	{"Links", "[foo [bar](/uri)](/uri)\n", "<p>[foo <a href=\"/uri\">bar</a>](/uri)</p>\n"},
+	{"Links", "*[foo*](/uri)\n", "<p>*<a href=\"/uri\">foo*</a></p>\n"},
+	{"Links", "[foo *bar](baz*)\n", "<p><a href=\"baz*\">foo *bar</a></p>\n"},
+	{"Links", "[foo`](/uri)`\n", "<p>[foo<code>](/uri)</code></p>\n"},
+	{"Links", "[foo][bar]\n\n[bar]: /url \"title\"\n", "<p><a href=\"/url\" title=\"title\">foo</a></p>\n"},
+	{"Links", "[foo][]\n\n[foo]: /url \"title\"\n", "<p><a href=\"/url\" title=\"title\">foo</a></p>\n"},
+	{"Links", "[foo] bar\n\n[foo]: /url\n", "<p><a href=\"/url\">foo</a> bar</p>\n"},
+	{"Links", "[foo][bar][baz]\n\n[baz]: /url\n", "<p>[foo]<a href=\"/url\">bar</a></p>\n"},
+
+	{"Images", "![foo](/url \"title\")\n", "<p><img src=\"/url\" alt=\"foo\" title=\"title\" /></p>\n"},
+	{"Images", "![foo *bar*](train.jpg)\n", "<p><img src=\"train.jpg\" alt=\"foo bar\" /></p>\n"},
+	{"Images", "![foo ![bar](/url)](/url2)\n", "<p><img src=\"/url2\" alt=\"foo bar\" /></p>\n"},
+	{"Images", "![foo [bar](/url)](/url2)\n", "<p><img src=\"/url2\" alt=\"foo bar\" /></p>\n"},
+	{"Images", "My ![foo bar](/path/to/train.jpg  \"title\"   )\n", "<p>My <img src=\"/path/to/train.jpg\" alt=\"foo bar\" title=\"title\" /></p>\n"},
+
+	{"Autolinks", "<http://foo.bar.baz>\n", "<p><a href=\"http://foo.bar.baz\">http://foo.bar.baz</a></p>\n"},
+	{"Autolinks", "<foo@bar.example.com>\n", "<p><a href=\"mailto:foo@bar.example.com\">foo@bar.example.com</a></p>\n"},
+	{"Autolinks", "<http://foo.bar/baz bim>\n", "<p>&lt;http://foo.bar/baz bim&gt;</p>\n"},
+	{"Autolinks", "<>\n", "<p>&lt;&gt;</p>\n"},
+
+	{"Hard line breaks", "foo  \nbaz\n", "<p>foo<br />\nbaz</p>\n"},
+	{"Hard line breaks", "foo       \n     bar\n", "<p>foo<br />\nbar</p>\n"},
+	{"Hard line breaks", "*foo  \nbar*\n", "<p><em>foo<br />\nbar</em></p>\n"},
+	{"Hard line breaks", "foo\\\n", "<p>foo\\</p>\n"},
+	{"Hard line breaks", "### foo  \n", "<h3>foo</h3>\n"},
+
+	{"Soft line breaks", "foo \n baz\n", "<p>foo\nbaz</p>\n"},
+}
+
+func TestRenderer(t *testing.T) {
+	t.Run("CommonMark spec examples", func(t *testing.T) {
+		for _, example := range specExamples {
+			got := render(t, blogposts.Renderer{}, example.markdown)
+			if got != example.html {
+				t.Errorf("%s: rendering %q\ngot  %q\nwant %q", example.section, example.markdown, got, example.html)
+			}
+		}
+	})
+
+	t.Run("HTML and unsafe links are not let through", func(t *testing.T) {
+		cases := []struct {
+			name, markdown, html string
+		}{
+			{"script", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+			{"html block", "<div onclick=\"steal()\">\n\nhi\n</div>", "<p>&lt;div onclick=&quot;steal()&quot;&gt;</p>\n<p>hi\n&lt;/div&gt;</p>\n"},
+			{"javascript link", "[click](javascript:alert(1))", "<p>click</p>\n"},
+			{"shouty javascript link", "[click](JavaScript:alert(1))", "<p>click</p>\n"},
+			{"javascript autolink", "<javascript:alert(1)>", "<p>javascript:alert(1)</p>\n"},
+			{"data image", "![pixel](data:image/png;base64,AAAA)", "<p>pixel</p>\n"},
+			{"quotes in a title", "[a](/b \"\\\" onmouseover=\\\"steal()\")", "<p><a href=\"/b\" title=\"&quot; onmouseover=&quot;steal()\">a</a></p>\n"},
+		}
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				got := render(t, blogposts.Renderer{}, c.markdown)
+				if got != c.html {
+					t.Errorf("got %q want %q", got, c.html)
+				}
+			})
+		}
+	})
+
+	t.Run("links may only use the schemes it's given", func(t *testing.T) {
+		renderer := blogposts.Renderer{Schemes: []string{"https"}}
+
+		got := render(t, renderer, "[a](http://a.example) [b](https://b.example) [c](/c)")
+		want := "<p>a <a href=\"https://b.example\">b</a> <a href=\"/c\">c</a></p>\n"
+		if got != want {
+			t.Errorf("got %q want %q", got, want)
+		}
+	})
+
+	t.Run("a post renders its body", func(t *testing.T) {
+		post := blogposts.Post{Title: "Hello", Body: "# Hello\n\nSome *words*.\r\n- one\r\n- two"}
+
+		got := post.HTML()
+		want := template.HTML("<h1>Hello</h1>\n<p>Some <em>words</em>.</p>\n<ul>\n<li>one</li>\n<li>two</li>\n</ul>\n")
+		if got != want {
+			t.Errorf("got %q want %q", got, want)
+		}
+	})
+}
+
+func render(t *testing.T, renderer blogposts.Renderer, markdown string) string {
+	t.Helper()
+	var html strings.Builder
+	if err := renderer.Render(&html, markdown); err != nil {
+		t.Fatal(err)
+	}
+	return html.String()
+}
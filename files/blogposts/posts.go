@@ -1,48 +1,183 @@
 package blogposts
 
 import (
-	"bufio"
-	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"path"
 	"strings"
+	"time"
+	"unicode"
 )
 
 type Post struct {
 	Title       string
 	Description string
 	Tags        []string
-	Body        string
+	Date        time.Time
+	Draft       bool
+	// Slug is where the post lives, taken from its file name unless the
+	// frontmatter gives one
+	Slug string
+	Body string
+	// Meta holds every other key in the frontmatter, as it was written
+	Meta map[string]interface{}
 }
 
-const (
-	TitleSeparator       = "Title: "
-	DescriptionSeparator = "Description: "
-	TagsSeparator        = "Tags: "
-	BodySeparator        = "Body: "
-)
+var dateLayouts = []string{
+	"2006-01-02",
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+}
+
+func newPost(filename string, postFile io.Reader) (Post, error) {
+	data, err := io.ReadAll(postFile)
+	if err != nil {
+		return Post{}, err
+	}
+
+	front, err := parseFrontmatter(string(data))
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) {
+		parseErr.File = filename
+	}
+	if err != nil {
+		return Post{}, err
+	}
+
+	post := Post{
+		Slug: slugify(strings.TrimSuffix(path.Base(filename), path.Ext(filename))),
+		Body: front.body,
+	}
+	seen := map[string]int{}
+	for _, f := range front.fields {
+		key := strings.ToLower(f.key)
+		if line, ok := seen[key]; ok {
+			return Post{}, &ParseError{filename, f.line, fmt.Errorf("%s, first on line %d: %w", f.key, line, ErrDuplicateKey)}
+		}
+		seen[key] = f.line
 
-func newPost(postFile io.Reader) (Post, error) {
-	scanner := bufio.NewScanner(postFile)
+		switch key {
+		case "title":
+			post.Title, err = stringValue(f)
+		case "description":
+			post.Description, err = stringValue(f)
+		case "tags":
+			post.Tags, err = tagsValue(f)
+		case "date":
+			post.Date, err = dateValue(f)
+		case "draft":
+			post.Draft, err = boolValue(f)
+		case "slug":
+			post.Slug, err = slugValue(f)
+		default:
+			if post.Meta == nil {
+				post.Meta = map[string]interface{}{}
+			}
+			post.Meta[f.key] = f.value
+		}
+		if err != nil {
+			return Post{}, &ParseError{filename, f.line, err}
+		}
+	}
 
-	readMetaLine := func(separator string) string {
-		scanner.Scan()
-		return strings.TrimPrefix(scanner.Text(), separator)
+	if post.Title == "" {
+		return Post{}, &ParseError{File: filename, Err: ErrMissingTitle}
+	}
+	if post.Slug == "" {
+		return Post{}, &ParseError{File: filename, Err: ErrEmptySlug}
 	}
+	return post, nil
+}
+
+func stringValue(f field) (string, error) {
+	switch value := f.value.(type) {
+	case string:
+		return value, nil
+	case []interface{}:
+		return "", fmt.Errorf("%s should be text, not a list", f.key)
+	}
+	// a title like 2024 is still a title
+	return f.text, nil
+}
 
-	readBody := func() string {
-		scanner.Scan()
-		buf := bytes.Buffer{}
-		for scanner.Scan() {
-			fmt.Fprintln(&buf, scanner.Text())
+// tagsValue takes a list, or text separated by commas as posts without
+// frontmatter always had.
+func tagsValue(f field) ([]string, error) {
+	var items []interface{}
+	switch value := f.value.(type) {
+	case []interface{}:
+		items = value
+	case string:
+		for _, tag := range strings.Split(value, ",") {
+			items = append(items, tag)
 		}
-		return strings.TrimSuffix(buf.String(), "\n")
+	default:
+		return nil, fmt.Errorf("tags should be a list, not %v", f.text)
 	}
 
-	return Post{
-		Title:       readMetaLine(TitleSeparator),
-		Description: readMetaLine(DescriptionSeparator),
-		Tags:        strings.Split(readMetaLine(TagsSeparator), ", "),
-		Body:        readBody(),
-	}, nil
+	var tags []string
+	for _, item := range items {
+		if tag := strings.TrimSpace(fmt.Sprint(item)); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+func dateValue(f field) (time.Time, error) {
+	switch value := f.value.(type) {
+	case time.Time:
+		return value, nil
+	case string:
+		for _, layout := range dateLayouts {
+			if date, err := time.Parse(layout, value); err == nil {
+				return date, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("date %s is not like 2006-01-02 or 2006-01-02T15:04:05Z", f.text)
+}
+
+func boolValue(f field) (bool, error) {
+	value, ok := f.value.(bool)
+	if !ok {
+		return false, fmt.Errorf("%s should be true or false, not %s", f.key, f.text)
+	}
+	return value, nil
+}
+
+func slugValue(f field) (string, error) {
+	slug, err := stringValue(f)
+	if err != nil {
+		return "", err
+	}
+	if slug == "" || slugify(slug) != slug {
+		return "", fmt.Errorf("slug %q should be lower case letters, digits and dashes", slug)
+	}
+	return slug, nil
+}
+
+// slugify makes s fit for a URL: lower case letters and digits, in any
+// script, with a dash wherever there was anything else. Accents written as
+// combining marks stay with their letter rather than becoming dashes, but
+// nothing is normalised, so a café typed with a separate accent has a
+// different slug from one typed with é.
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) && !dash && b.Len() > 0 {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
 }
@@ -0,0 +1,421 @@
+package blogposts
+
+import (
+	"bytes"
+	"embed"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:embed theme
+var themeFiles embed.FS
+
+var ErrDuplicateSlug = errors.New("two posts have the same slug")
+
+// Site is a static blog: an index of the posts, a page for each post and
+// each tag, and Atom and RSS feeds.
+type Site struct {
+	Title  string
+	Author string
+	// URL is where the site will be published, like https://example.com/blog,
+	// which feeds need to link back to it. Pages link to each other
+	// relatively, so they work wherever they're put.
+	URL string
+	// Theme has files that replace the default theme's: the templates
+	// layout.html, index.html, post.html and tag.html, and anything under
+	// static/, which is copied as it is. Each page template defines
+	// "title" and "content" for the "layout" template.
+	Theme    fs.FS
+	Renderer Renderer
+	// Drafts are left out unless this is set
+	Drafts bool
+	// Updated is when the Atom feed says the site last changed if no post
+	// has a date to say it. The Unix epoch if it isn't set, so building the
+	// same posts twice makes the same feed.
+	Updated time.Time
+}
+
+// sitePage is what a theme's templates are given. Post is only set for a
+// post's page, and Tags only for the index.
+type sitePage struct {
+	Site  string
+	Title string
+	// Root leads from the page back to the top of the site
+	Root  string
+	Posts []postPage
+	Post  postPage
+	Tags  []tagLink
+}
+
+type postPage struct {
+	Title       string
+	Description string
+	Date        time.Time
+	URL         string
+	Tags        []tagLink
+	Body        template.HTML
+	Meta        map[string]interface{}
+}
+
+type tagLink struct {
+	Name string
+	URL  string
+}
+
+// Build renders the Markdown posts in postsFS, returning each of the
+// site's files by its path. Anything else there, like images, a README or
+// a directory, is left alone.
+func (s Site) Build(postsFS fs.FS) (map[string][]byte, error) {
+	posts, err := newPostsFromFS(postsFS, isMarkdown)
+	if err != nil {
+		return nil, err
+	}
+	posts = s.published(posts)
+
+	slugs := map[string]string{}
+	for _, post := range posts {
+		if other, ok := slugs[post.Slug]; ok {
+			return nil, fmt.Errorf("%q and %q are both %s: %w", other, post.Title, post.Slug, ErrDuplicateSlug)
+		}
+		slugs[post.Slug] = post.Title
+	}
+
+	pages := map[string]*template.Template{}
+	for _, name := range []string{"index.html", "post.html", "tag.html"} {
+		if pages[name], err = s.parsePage(name); err != nil {
+			return nil, err
+		}
+	}
+
+	files := map[string][]byte{}
+	render := func(file, page string, data sitePage) error {
+		data.Site = s.Title
+		data.Root = strings.Repeat("../", strings.Count(file, "/"))
+		var buf bytes.Buffer
+		if err := pages[page].ExecuteTemplate(&buf, "layout", data); err != nil {
+			return fmt.Errorf("problem rendering %s, %v", file, err)
+		}
+		files[file] = buf.Bytes()
+		return nil
+	}
+
+	tags, tagged := tagsOf(posts)
+	if err := render("index.html", "index.html", sitePage{
+		Title: s.Title,
+		Posts: s.postPages(posts, ""),
+		Tags:  tagLinks(tags, ""),
+	}); err != nil {
+		return nil, err
+	}
+	for _, post := range posts {
+		if err := render(postPath(post), "post.html", sitePage{
+			Title: post.Title,
+			Post:  s.postPage(post, "../"),
+		}); err != nil {
+			return nil, err
+		}
+	}
+	for _, tag := range tags {
+		if err := render(tagPath(tag), "tag.html", sitePage{
+			Title: tag,
+			Posts: s.postPages(tagged[slugify(tag)], "../"),
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	if files["atom.xml"], err = s.atom(posts); err != nil {
+		return nil, err
+	}
+	if files["rss.xml"], err = s.rss(posts); err != nil {
+		return nil, err
+	}
+	if err := s.copyStatic(files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func isMarkdown(entry fs.DirEntry) bool {
+	return !entry.IsDir() && path.Ext(entry.Name()) == ".md"
+}
+
+// published is the posts to build, newest first.
+func (s Site) published(posts []Post) []Post {
+	var published []Post
+	for _, post := range posts {
+		if s.Drafts || !post.Draft {
+			published = append(published, post)
+		}
+	}
+	sort.SliceStable(published, func(i, j int) bool {
+		if !published[i].Date.Equal(published[j].Date) {
+			return published[i].Date.After(published[j].Date)
+		}
+		return published[i].Title < published[j].Title
+	})
+	return published
+}
+
+// themeFile reads name from the Theme, or the default theme when the
+// Theme doesn't have it.
+func (s Site) themeFile(name string) ([]byte, error) {
+	if s.Theme != nil {
+		data, err := fs.ReadFile(s.Theme, name)
+		if !errors.Is(err, fs.ErrNotExist) {
+			return data, err
+		}
+	}
+	return fs.ReadFile(themeFiles, "theme/"+name)
+}
+
+func (s Site) parsePage(name string) (*template.Template, error) {
+	page := template.New("layout")
+	for _, file := range []string{"layout.html", name} {
+		text, err := s.themeFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("problem reading theme, %v", err)
+		}
+		if _, err := page.New(file).Parse(string(text)); err != nil {
+			return nil, fmt.Errorf("problem parsing theme, %v", err)
+		}
+	}
+	return page, nil
+}
+
+// copyStatic adds the default theme's static files, then the Theme's.
+func (s Site) copyStatic(files map[string][]byte) error {
+	defaults, _ := fs.Sub(themeFiles, "theme")
+	for _, theme := range []fs.FS{defaults, s.Theme} {
+		if theme == nil {
+			continue
+		}
+		err := fs.WalkDir(theme, "static", func(name string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return err
+			}
+			files[name], err = fs.ReadFile(theme, name)
+			return err
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("problem copying theme, %v", err)
+		}
+	}
+	return nil
+}
+
+func (s Site) postPages(posts []Post, root string) []postPage {
+	pages := make([]postPage, len(posts))
+	for i, post := range posts {
+		pages[i] = s.postPage(post, root)
+	}
+	return pages
+}
+
+func (s Site) postPage(post Post, root string) postPage {
+	var body strings.Builder
+	s.Renderer.Render(&body, post.Body)
+	return postPage{
+		Title:       post.Title,
+		Description: post.Description,
+		Date:        post.Date,
+		URL:         root + postPath(post),
+		Tags:        tagLinks(post.Tags, root),
+		Body:        template.HTML(body.String()),
+		Meta:        post.Meta,
+	}
+}
+
+// tagsOf is every tag, sorted, and the posts with each. Tags that differ
+// only in case or punctuation are one tag, named as it was first written.
+func tagsOf(posts []Post) ([]string, map[string][]Post) {
+	var tags []string
+	tagged := map[string][]Post{}
+	for _, post := range posts {
+		seen := map[string]bool{}
+		for _, tag := range post.Tags {
+			slug := slugify(tag)
+			if slug == "" || seen[slug] {
+				continue
+			}
+			seen[slug] = true
+			if tagged[slug] == nil {
+				tags = append(tags, tag)
+			}
+			tagged[slug] = append(tagged[slug], post)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return slugify(tags[i]) < slugify(tags[j])
+	})
+	return tags, tagged
+}
+
+func tagLinks(tags []string, root string) []tagLink {
+	var links []tagLink
+	for _, tag := range tags {
+		if slugify(tag) != "" {
+			links = append(links, tagLink{Name: tag, URL: root + tagPath(tag)})
+		}
+	}
+	return links
+}
+
+func postPath(post Post) string {
+	return "posts/" + post.Slug + ".html"
+}
+
+func tagPath(tag string) string {
+	return "tags/" + slugify(tag) + ".html"
+}
+
+func (s Site) link(file string) string {
+	return strings.TrimSuffix(s.URL, "/") + "/" + file
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Links   []atomLink  `xml:"link"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Link       atomLink       `xml:"link"`
+	Updated    string         `xml:"updated"`
+	Summary    string         `xml:"summary,omitempty"`
+	Categories []atomCategory `xml:"category"`
+	Content    atomContent    `xml:"content"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+func (s Site) atom(posts []Post) ([]byte, error) {
+	author := s.Author
+	if author == "" {
+		author = s.Title
+	}
+	feed := atomFeed{
+		Title:  s.Title,
+		ID:     s.link(""),
+		Links:  []atomLink{{Href: s.link("")}, {Href: s.link("atom.xml"), Rel: "self"}},
+		Author: atomAuthor{author},
+	}
+
+	var updated time.Time
+	for _, post := range posts {
+		if post.Date.After(updated) {
+			updated = post.Date
+		}
+	}
+	if updated.IsZero() {
+		updated = s.Updated
+	}
+	if updated.IsZero() {
+		updated = time.Unix(0, 0)
+	}
+	feed.Updated = updated.UTC().Format(time.RFC3339)
+
+	for _, post := range posts {
+		// Atom wants every entry to have a time, so a post without a date
+		// has the feed's
+		date := post.Date
+		if date.IsZero() {
+			date = updated
+		}
+		page := s.postPage(post, "")
+		entry := atomEntry{
+			Title:   post.Title,
+			ID:      s.link(page.URL),
+			Link:    atomLink{Href: s.link(page.URL)},
+			Updated: date.UTC().Format(time.RFC3339),
+			Summary: post.Description,
+			Content: atomContent{"html", string(page.Body)},
+		}
+		for _, tag := range post.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{tag})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return marshalFeed(feed)
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        string   `xml:"guid"`
+	PubDate     string   `xml:"pubDate,omitempty"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+}
+
+func (s Site) rss(posts []Post) ([]byte, error) {
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{Title: s.Title, Link: s.link(""), Description: s.Title},
+	}
+	for _, post := range posts {
+		page := s.postPage(post, "")
+		item := rssItem{
+			Title:       post.Title,
+			Link:        s.link(page.URL),
+			GUID:        s.link(page.URL),
+			Categories:  post.Tags,
+			Description: string(page.Body),
+		}
+		if !post.Date.IsZero() {
+			item.PubDate = post.Date.UTC().Format(time.RFC1123Z)
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+	return marshalFeed(feed)
+}
+
+func marshalFeed(feed interface{}) ([]byte, error) {
+	data, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("problem writing feed, %v", err)
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
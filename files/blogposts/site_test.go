@@ -0,0 +1,241 @@
+package blogposts_test
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/errantDev/blogposts"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+var sitePosts = fstest.MapFS{
+	"hello-world.md": {Data: []byte(`---
+title: Hello, world
+description: The first one
+date: 2021-03-17
+tags: [go, TDD]
+---
+Hello *world*, this is [the blog](https://example.com/blog).
+
+` + "```go\nfmt.Println(\"hello\")\n```\n")},
+	"second.md": {Data: []byte(`+++
+title = "Tests & <templates>"
+date = 2021-04-01T09:30:00Z
+tags = ["tdd"]
++++
+> Escape what you're given.
+`)},
+	"unfinished.md": {Data: []byte(`---
+title: Not yet
+draft: true
+---
+Coming soon`)},
+}
+
+func TestSite(t *testing.T) {
+	site := blogposts.Site{Title: "Errant Dev", Author: "Chris", URL: "https://example.com/blog/"}
+
+	t.Run("builds an index, posts, tags and feeds", func(t *testing.T) {
+		files, err := site.Build(sitePosts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertFiles(t, files,
+			"atom.xml",
+			"index.html",
+			"posts/hello-world.html",
+			"posts/second.html",
+			"rss.xml",
+			"static/style.css",
+			"tags/go.html",
+			"tags/tdd.html",
+		)
+		for name, data := range files {
+			if !strings.HasPrefix(name, "static/") {
+				assertGolden(t, filepath.Join("site", name), string(data))
+			}
+		}
+	})
+
+	t.Run("drafts are only built when asked for", func(t *testing.T) {
+		withDrafts := site
+		withDrafts.Drafts = true
+
+		files, err := withDrafts.Build(sitePosts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok := files["posts/unfinished.html"]; !ok {
+			t.Error("no page for the draft")
+		}
+	})
+
+	t.Run("a theme replaces the default theme's files", func(t *testing.T) {
+		themed := site
+		themed.Theme = fstest.MapFS{
+			"post.html":        {Data: []byte(`{{define "title"}}{{.Title}}{{end}}{{define "content"}}<div class="themed">{{.Post.Body}}</div>{{end}}`)},
+			"static/style.css": {Data: []byte("body { color: red; }")},
+			"static/logo.svg":  {Data: []byte("<svg></svg>")},
+		}
+
+		files, err := themed.Build(sitePosts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := string(files["posts/second.html"]); !strings.Contains(got, `<div class="themed"><blockquote>`) {
+			t.Errorf("post page is not from the theme, got\n%s", got)
+		}
+		if got := string(files["index.html"]); !strings.Contains(got, `<ul class="posts">`) {
+			t.Errorf("index is not from the default theme, got\n%s", got)
+		}
+		if got := string(files["static/style.css"]); got != "body { color: red; }" {
+			t.Errorf("got style.css %q, want the theme's", got)
+		}
+		if _, ok := files["static/logo.svg"]; !ok {
+			t.Error("theme's logo was not copied")
+		}
+	})
+
+	t.Run("a theme that doesn't parse is an error", func(t *testing.T) {
+		broken := site
+		broken.Theme = fstest.MapFS{"index.html": {Data: []byte(`{{define "content"}}{{.Posts`)}}
+
+		if _, err := broken.Build(sitePosts); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("two posts can't have the same slug", func(t *testing.T) {
+		posts := fstest.MapFS{
+			"a.md": {Data: []byte("---\ntitle: A\nslug: same\n---\n")},
+			"b.md": {Data: []byte("---\ntitle: B\nslug: same\n---\n")},
+		}
+
+		_, err := site.Build(posts)
+		if !errors.Is(err, blogposts.ErrDuplicateSlug) {
+			t.Errorf("got error %v want %v", err, blogposts.ErrDuplicateSlug)
+		}
+	})
+
+	t.Run("a post with no slug says which file it is", func(t *testing.T) {
+		posts := fstest.MapFS{"???.md": {Data: []byte("---\ntitle: Questions\n---\n")}}
+
+		_, err := site.Build(posts)
+		var parseErr *blogposts.ParseError
+		if !errors.As(err, &parseErr) || parseErr.File != "???.md" || !errors.Is(err, blogposts.ErrEmptySlug) {
+			t.Errorf("got error %v want %v in ???.md", err, blogposts.ErrEmptySlug)
+		}
+	})
+
+	t.Run("only Markdown files are posts", func(t *testing.T) {
+		posts := fstest.MapFS{
+			"hello-world.md":     sitePosts["hello-world.md"],
+			"README":             {Data: []byte("My posts")},
+			"cat.png":            {Data: []byte{0x89, 'P', 'N', 'G'}},
+			"drafts/old-post.md": {Data: []byte("---\ntitle: Old\n---\n")},
+			"notes.txt":          {Data: []byte("---\ntitle: Notes\n---\n")},
+		}
+
+		files, err := site.Build(posts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var built []string
+		for name := range files {
+			if strings.HasPrefix(name, "posts/") {
+				built = append(built, name)
+			}
+		}
+		if !reflect.DeepEqual(built, []string{"posts/hello-world.html"}) {
+			t.Errorf("got posts %v want only posts/hello-world.html", built)
+		}
+	})
+
+	t.Run("building the same posts twice makes the same site", func(t *testing.T) {
+		undated := fstest.MapFS{"post.md": {Data: []byte("---\ntitle: Post 1\n---\n")}}
+
+		first, err := site.Build(undated)
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := site.Build(undated)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(first, second) {
+			t.Errorf("got atom.xml\n%s\nthen\n%s", first["atom.xml"], second["atom.xml"])
+		}
+		if got := string(first["atom.xml"]); !strings.Contains(got, "<updated>1970-01-01T00:00:00Z</updated>") {
+			t.Errorf("got feed\n%s\nwant it dated 1970", got)
+		}
+	})
+
+	t.Run("a feed without dated posts is as new as the site", func(t *testing.T) {
+		undated := site
+		undated.Updated = time.Date(2021, time.May, 1, 12, 0, 0, 0, time.UTC)
+
+		for name, posts := range map[string]fstest.MapFS{
+			"no posts":     {},
+			"undated post": {"post.md": {Data: []byte("---\ntitle: Post 1\n---\n")}},
+		} {
+			files, err := undated.Build(posts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(files["atom.xml"]); strings.Contains(got, "0001-01-01") || !strings.Contains(got, "<updated>2021-05-01T12:00:00Z</updated>") {
+				t.Errorf("%s: got feed\n%s", name, got)
+			}
+		}
+	})
+}
+
+func assertFiles(t *testing.T, files map[string][]byte, want ...string) {
+	t.Helper()
+	var got []string
+	for name := range files {
+		got = append(got, name)
+	}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got files %v want %v", got, want)
+	}
+}
+
+// assertGolden compares got with testdata/name, or rewrites the file when
+// the tests are run with -update.
+func assertGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("could not update %s, %v", path, err)
+		}
+		if err := ioutil.WriteFile(path, []byte(got), 0666); err != nil {
+			t.Fatalf("could not update %s, %v", path, err)
+		}
+	}
+
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read %s, %v (run go test -update to create it)", path, err)
+	}
+	if got != string(want) {
+		t.Errorf("%s does not match, got\n%s", path, got)
+	}
+}
@@ -0,0 +1,97 @@
+package poker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	AuditWin    = "win"
+	AuditSet    = "set"
+	AuditDelete = "delete"
+	AuditRename = "rename"
+	AuditImport = "import"
+	AuditBackup = "backup"
+
+	AuditCreateLeague = "create league"
+	AuditDeleteLeague = "delete league"
+)
+
+type AuditEntry struct {
+	Time   time.Time `json:"time"`
+	User   string    `json:"user"`
+	Action string    `json:"action"`
+	League string    `json:"league,omitempty"`
+	Player string    `json:"player,omitempty"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+type AuditLog interface {
+	Record(entry AuditEntry) error
+}
+
+// FileAuditLog appends one JSON line per change to the league.
+type FileAuditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewFileAuditLog(path string) (*FileAuditLog, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("problem opening audit log %s, %v", path, err)
+	}
+	return &FileAuditLog{file: file}, nil
+}
+
+func (a *FileAuditLog) Record(entry AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, err = a.file.Write(append(line, '\n'))
+	return err
+}
+
+func (a *FileAuditLog) Close() error {
+	return a.file.Close()
+}
+
+func (p *PlayerServer) audit(r *http.Request, action, player, detail string) {
+	if p.auditLog == nil {
+		return
+	}
+	// the change has already happened, so there's nothing useful to tell
+	// the client if we fail to write it down
+	var league string
+	if scope, ok := scopeFor(r); ok && scope.name != DefaultLeague {
+		league = scope.name
+	}
+	p.auditLog.Record(AuditEntry{
+		Time:   time.Now().UTC(),
+		User:   UserFromContext(r.Context()),
+		Action: action,
+		League: league,
+		Player: player,
+		Detail: detail,
+	})
+}
+
+func (p *PlayerServer) auditLeague(r *http.Request, action, league string) {
+	if p.auditLog == nil {
+		return
+	}
+	p.auditLog.Record(AuditEntry{
+		Time:   time.Now().UTC(),
+		User:   UserFromContext(r.Context()),
+		Action: action,
+		League: league,
+	})
+}
@@ -0,0 +1,364 @@
+package poker
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("token is not valid")
+	ErrNoSuchToken  = errors.New("no such token")
+)
+
+// TokensPath and AuditPath are where the token store and audit log for the
+// league at dbPath live, so the webserver and admin commands agree.
+func TokensPath(dbPath string) string {
+	return dbPath + ".tokens"
+}
+
+func AuditPath(dbPath string) string {
+	return dbPath + ".audit.log"
+}
+
+type TokenAuthenticator interface {
+	Authenticate(token string) (user string, err error)
+}
+
+// AdminAuthenticator is a TokenAuthenticator that also knows which tokens
+// are allowed to use the /admin endpoints.
+type AdminAuthenticator interface {
+	TokenAuthenticator
+	IsAdmin(token string) (bool, error)
+}
+
+// Token is what's kept of a minted token. ID is taken from the hash, so it
+// can be listed and used to revoke the token without giving any of it away.
+// Admin tokens can also use the /admin endpoints.
+type Token struct {
+	ID      string
+	User    string
+	Hash    string
+	Created time.Time
+	Admin   bool `json:",omitempty"`
+}
+
+// FileTokenStore keeps API tokens in a JSON file next to the league. Only a
+// hash of each token is written down, so reading the file doesn't let you
+// record wins. The file is re-read whenever it changes on disk, which is how
+// tokens minted or revoked by the admin command reach a running server.
+type FileTokenStore struct {
+	mu      sync.Mutex
+	path    string
+	file    *json.Encoder
+	tokens  []Token
+	modTime time.Time
+	now     func() time.Time
+}
+
+func NewFileTokenStore(path string) (*FileTokenStore, error) {
+	store := &FileTokenStore{
+		path: path,
+		file: json.NewEncoder(&atomicTape{path}),
+		now:  time.Now,
+	}
+	if err := store.reload(); err != nil {
+		return nil, fmt.Errorf("problem loading tokens from %s, %v", path, err)
+	}
+	return store, nil
+}
+
+func (f *FileTokenStore) reload() error {
+	info, err := os.Stat(f.path)
+	if os.IsNotExist(err) {
+		f.tokens, f.modTime = nil, time.Time{}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !f.modTime.IsZero() && info.ModTime().Equal(f.modTime) {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+
+	var tokens []Token
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return err
+	}
+	f.tokens = tokens
+	f.modTime = info.ModTime()
+
+	// older files used the start of the token itself as its ID
+	rewrite := false
+	for i, token := range f.tokens {
+		if id := tokenID(token.Hash); token.ID != id {
+			f.tokens[i].ID = id
+			rewrite = true
+		}
+	}
+	if rewrite {
+		return f.save()
+	}
+	return nil
+}
+
+func (f *FileTokenStore) save() error {
+	if err := f.file.Encode(f.tokens); err != nil {
+		return err
+	}
+	if info, err := os.Stat(f.path); err == nil {
+		f.modTime = info.ModTime()
+	}
+	return nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func tokenID(hash string) string {
+	if len(hash) < 8 {
+		return hash
+	}
+	return hash[:8]
+}
+
+// Mint creates a new token for user and returns it. This is the only time
+// the token itself is available.
+func (f *FileTokenStore) Mint(user string) (string, error) {
+	return f.mint(user, false)
+}
+
+// MintAdmin is Mint for a token that can also use the /admin endpoints.
+func (f *FileTokenStore) MintAdmin(user string) (string, error) {
+	return f.mint(user, true)
+}
+
+func (f *FileTokenStore) mint(user string, admin bool) (string, error) {
+	if user == "" {
+		return "", errors.New("tokens need a user")
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(secret)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.reload(); err != nil {
+		return "", err
+	}
+
+	hash := hashToken(token)
+	f.tokens = append(f.tokens, Token{
+		ID:      tokenID(hash),
+		User:    user,
+		Hash:    hash,
+		Created: f.now().UTC(),
+		Admin:   admin,
+	})
+	return token, f.save()
+}
+
+// Revoke removes the token with the given ID, or every token belonging to
+// the user of that name.
+func (f *FileTokenStore) Revoke(idOrUser string) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.reload(); err != nil {
+		return 0, err
+	}
+
+	var kept []Token
+	for _, token := range f.tokens {
+		if token.ID != idOrUser && token.User != idOrUser {
+			kept = append(kept, token)
+		}
+	}
+
+	revoked := len(f.tokens) - len(kept)
+	if revoked == 0 {
+		return 0, ErrNoSuchToken
+	}
+
+	f.tokens = kept
+	if f.tokens == nil {
+		f.tokens = []Token{}
+	}
+	return revoked, f.save()
+}
+
+func (f *FileTokenStore) List() ([]Token, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+	tokens := make([]Token, len(f.tokens))
+	copy(tokens, f.tokens)
+	return tokens, nil
+}
+
+func (f *FileTokenStore) Authenticate(token string) (string, error) {
+	found, err := f.find(token)
+	return found.User, err
+}
+
+func (f *FileTokenStore) IsAdmin(token string) (bool, error) {
+	found, err := f.find(token)
+	return found.Admin, err
+}
+
+func (f *FileTokenStore) find(token string) (Token, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.reload(); err != nil {
+		return Token{}, err
+	}
+
+	hash := hashToken(token)
+	for _, t := range f.tokens {
+		if t.Hash == hash {
+			return t, nil
+		}
+	}
+	return Token{}, ErrInvalidToken
+}
+
+type userContextKey struct{}
+
+// UserFromContext returns who made the request, or "" for anonymous ones.
+func UserFromContext(ctx context.Context) string {
+	user, _ := ctx.Value(userContextKey{}).(string)
+	return user
+}
+
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	// browsers can't set headers on a websocket, so /ws takes it from the
+	// URL. Nothing else does, as URLs end up in logs and browser history.
+	if r.URL.Path == "/ws" {
+		return r.URL.Query().Get("access_token")
+	}
+	return ""
+}
+
+func isReadOnly(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		// the websocket is how browsers record wins, so it counts as a write
+		return r.URL.Path != "/ws"
+	}
+	return false
+}
+
+type authenticationContextKey struct{}
+
+// authentication is what tokens said about a request's token.
+type authentication struct {
+	user string
+	err  error
+}
+
+// withAuthentication checks r's token, if it has one, and keeps the answer
+// in the request's context so requireToken doesn't ask tokens again.
+func withAuthentication(r *http.Request, tokens TokenAuthenticator) *http.Request {
+	token := bearerToken(r)
+	if token == "" || tokens == nil {
+		return r
+	}
+	user, err := tokens.Authenticate(token)
+	ctx := context.WithValue(r.Context(), authenticationContextKey{}, authentication{user, err})
+	return r.WithContext(ctx)
+}
+
+// authenticated is who token belongs to, as withAuthentication found out
+// earlier in the request or, if it didn't, as tokens says now.
+func authenticated(r *http.Request, tokens TokenAuthenticator, token string) (string, error) {
+	if found, ok := r.Context().Value(authenticationContextKey{}).(authentication); ok {
+		return found.user, found.err
+	}
+	return tokens.Authenticate(token)
+}
+
+func requireToken(tokens TokenAuthenticator, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if token == "" {
+			if isReadOnly(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="poker"`)
+			writeProblem(w, r, http.StatusUnauthorized, "a bearer token is needed to change the league")
+			return
+		}
+
+		user, err := authenticated(r, tokens, token)
+		if err == ErrInvalidToken {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="poker", error="invalid_token"`)
+			writeTypedProblem(w, r, http.StatusUnauthorized, ProblemType(err), err.Error())
+			return
+		}
+		if err != nil {
+			writeProblem(w, r, http.StatusServiceUnavailable, "could not check the token")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userContextKey{}, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requireAdmin only lets requests with an admin token through to next.
+// Without tokens that can say who's an admin, nobody is.
+func requireAdmin(tokens TokenAuthenticator, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		admins, ok := tokens.(AdminAuthenticator)
+		if !ok {
+			writeProblem(w, r, http.StatusForbidden, "admin endpoints need token auth")
+			return
+		}
+
+		admin, err := admins.IsAdmin(bearerToken(r))
+		if err == ErrInvalidToken {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="poker", error="invalid_token"`)
+			writeTypedProblem(w, r, http.StatusUnauthorized, ProblemType(err), err.Error())
+			return
+		}
+		if err != nil {
+			writeProblem(w, r, http.StatusServiceUnavailable, "could not check the token")
+			return
+		}
+		if !admin {
+			writeProblem(w, r, http.StatusForbidden, "only an admin token can do that")
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,281 @@
+package poker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type StubTokens map[string]string
+
+func (s StubTokens) Authenticate(token string) (string, error) {
+	user, ok := s[token]
+	if !ok {
+		return "", ErrInvalidToken
+	}
+	return user, nil
+}
+
+type SpyAuditLog struct {
+	entries []AuditEntry
+}
+
+func (s *SpyAuditLog) Record(entry AuditEntry) error {
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func TestFileTokenStore(t *testing.T) {
+	t.Run("authenticates minted tokens", func(t *testing.T) {
+		tokens := newTokenStore(t, filepath.Join(t.TempDir(), "tokens"))
+
+		token, err := tokens.Mint("alice")
+		assertNoError(t, err)
+
+		user, err := tokens.Authenticate(token)
+		assertNoError(t, err)
+		assertResponseBody(t, user, "alice")
+
+		_, err = tokens.Authenticate("guess")
+		assertError(t, err, ErrInvalidToken)
+	})
+
+	t.Run("only admin tokens are an admin's", func(t *testing.T) {
+		tokens := newTokenStore(t, filepath.Join(t.TempDir(), "tokens"))
+		token, _ := tokens.Mint("alice")
+		adminToken, _ := tokens.MintAdmin("root")
+
+		admin, err := tokens.IsAdmin(token)
+		assertNoError(t, err)
+		if admin {
+			t.Error("alice's token is an admin's")
+		}
+		admin, err = tokens.IsAdmin(adminToken)
+		assertNoError(t, err)
+		if !admin {
+			t.Error("root's token is not an admin's")
+		}
+		_, err = tokens.IsAdmin("guess")
+		assertError(t, err, ErrInvalidToken)
+	})
+
+	t.Run("only writes down a hash of the token", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "tokens")
+		tokens := newTokenStore(t, path)
+
+		token, err := tokens.Mint("alice")
+		assertNoError(t, err)
+
+		contents, _ := ioutil.ReadFile(path)
+		if strings.Contains(string(contents), token[:8]) {
+			t.Errorf("token file contains part of the token itself: %s", contents)
+		}
+	})
+
+	t.Run("gives tokens from older files an ID that isn't part of the token", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "tokens")
+		token := "0123456789abcdef"
+		old := `[{"ID": "01234567", "User": "alice", "Hash": "` + hashToken(token) + `"}]`
+		assertNoError(t, ioutil.WriteFile(path, []byte(old), 0600))
+
+		tokens := newTokenStore(t, path)
+		list, err := tokens.List()
+		assertNoError(t, err)
+
+		if list[0].ID != hashToken(token)[:8] {
+			t.Errorf("got ID %q, want it taken from the hash", list[0].ID)
+		}
+		contents, _ := ioutil.ReadFile(path)
+		if strings.Contains(string(contents), token[:8]) {
+			t.Errorf("token file still contains part of the token: %s", contents)
+		}
+	})
+
+	t.Run("revokes by id and by user", func(t *testing.T) {
+		tokens := newTokenStore(t, filepath.Join(t.TempDir(), "tokens"))
+
+		first, _ := tokens.Mint("alice")
+		second, _ := tokens.Mint("alice")
+		third, _ := tokens.Mint("bob")
+
+		list, err := tokens.List()
+		assertNoError(t, err)
+
+		revoked, err := tokens.Revoke(list[2].ID)
+		assertNoError(t, err)
+		assertPlayerScore(t, revoked, 1)
+
+		revoked, err = tokens.Revoke("alice")
+		assertNoError(t, err)
+		assertPlayerScore(t, revoked, 2)
+
+		for _, token := range []string{first, second, third} {
+			_, err := tokens.Authenticate(token)
+			assertError(t, err, ErrInvalidToken)
+		}
+
+		_, err = tokens.Revoke("carol")
+		assertError(t, err, ErrNoSuchToken)
+	})
+
+	t.Run("sees tokens minted by another process", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "tokens")
+		server := newTokenStore(t, path)
+		admin := newTokenStore(t, path)
+
+		_, err := server.Authenticate("anything")
+		assertError(t, err, ErrInvalidToken)
+
+		token, err := admin.Mint("alice")
+		assertNoError(t, err)
+
+		user, err := server.Authenticate(token)
+		assertNoError(t, err)
+		assertResponseBody(t, user, "alice")
+	})
+}
+
+func TestTokenAuth(t *testing.T) {
+	tokens := StubTokens{"s3cret": "alice"}
+
+	t.Run("anyone can read the league and scores", func(t *testing.T) {
+		store := &StubPlayerStore{map[string]int{"Pepper": 20}, nil, nil}
+		server := NewPlayerServer(store, dummyGame, WithTokenAuth(tokens))
+
+		for _, request := range []*http.Request{
+			newLeagueRequest(http.MethodGet),
+			newPlayersRequest(http.MethodGet, "Pepper"),
+		} {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, http.StatusOK)
+		}
+	})
+
+	t.Run("recording a win needs a token", func(t *testing.T) {
+		store := &StubPlayerStore{}
+		server := NewPlayerServer(store, dummyGame, WithTokenAuth(tokens))
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPlayersRequest(http.MethodPost, "Pepper"))
+
+		assertProblem(t, response, http.StatusUnauthorized, "/players/Pepper")
+		if got := response.Result().Header.Get("WWW-Authenticate"); !strings.HasPrefix(got, "Bearer") {
+			t.Errorf("got WWW-Authenticate %q, want a Bearer challenge", got)
+		}
+		if len(store.winCalls) != 0 {
+			t.Errorf("expected no wins to be recorded, got %v", store.winCalls)
+		}
+	})
+
+	t.Run("a bad token is refused even for reads", func(t *testing.T) {
+		server := NewPlayerServer(&StubPlayerStore{}, dummyGame, WithTokenAuth(tokens))
+
+		request := newLeagueRequest(http.MethodGet)
+		request.Header.Set("Authorization", "Bearer guess")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertProblem(t, response, http.StatusUnauthorized, "/league")
+	})
+
+	t.Run("the websocket needs a token", func(t *testing.T) {
+		server := NewPlayerServer(&StubPlayerStore{}, dummyGame, WithTokenAuth(tokens))
+
+		request, _ := http.NewRequest(http.MethodGet, "/ws", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("only the websocket takes a token from the URL", func(t *testing.T) {
+		store := &StubPlayerStore{}
+		server := NewPlayerServer(store, dummyGame, WithTokenAuth(tokens))
+
+		request := newPlayersRequest(http.MethodPost, "Pepper")
+		request.URL.RawQuery = "access_token=s3cret"
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+		if len(store.winCalls) != 0 {
+			t.Errorf("expected no wins to be recorded, got %v", store.winCalls)
+		}
+	})
+
+	t.Run("records wins with a token and audits who did it", func(t *testing.T) {
+		store := &StubPlayerStore{}
+		auditLog := &SpyAuditLog{}
+		server := NewPlayerServer(store, dummyGame, WithTokenAuth(tokens), WithAuditLog(auditLog))
+
+		request := newPlayersRequest(http.MethodPost, "Pepper")
+		request.Header.Set("Authorization", "Bearer s3cret")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusAccepted)
+		assertPlayerWin(t, store, "Pepper")
+
+		if len(auditLog.entries) != 1 {
+			t.Fatalf("got %d audit entries, want 1", len(auditLog.entries))
+		}
+		got := auditLog.entries[0]
+		if got.User != "alice" || got.Action != AuditWin || got.Player != "Pepper" {
+			t.Errorf("got audit entry %+v, want alice recording a win for Pepper", got)
+		}
+	})
+
+	t.Run("failed changes are not audited", func(t *testing.T) {
+		auditLog := &SpyAuditLog{}
+		server := NewPlayerServer(&StubPlayerStore{}, dummyGame, WithTokenAuth(tokens), WithAuditLog(auditLog))
+
+		request := newPlayersRequest(http.MethodDelete, "Apollo")
+		request.Header.Set("Authorization", "Bearer s3cret")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusNotFound)
+		if len(auditLog.entries) != 0 {
+			t.Errorf("got audit entries %v, want none", auditLog.entries)
+		}
+	})
+}
+
+func TestFileAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	auditLog, err := NewFileAuditLog(path)
+	assertNoError(t, err)
+	defer auditLog.Close()
+
+	auditLog.Record(AuditEntry{User: "alice", Action: AuditWin, Player: "Pepper"})
+	auditLog.Record(AuditEntry{User: "bob", Action: AuditDelete, Player: "Floyd"})
+
+	lines := readLines(t, path)
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+
+	var got AuditEntry
+	assertNoError(t, json.Unmarshal([]byte(lines[1]), &got))
+	if got.User != "bob" || got.Action != AuditDelete || got.Player != "Floyd" {
+		t.Errorf("got %+v, want bob deleting Floyd", got)
+	}
+}
+
+func newTokenStore(t testing.TB, path string) *FileTokenStore {
+	t.Helper()
+	tokens, err := NewFileTokenStore(path)
+	assertNoError(t, err)
+	return tokens
+}
@@ -0,0 +1,255 @@
+package poker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBackupsKept is how many snapshots are kept before the oldest are
+// removed.
+const DefaultBackupsKept = 24
+
+const (
+	snapshotPrefix     = "league-"
+	snapshotSuffix     = ".json"
+	snapshotTimeFormat = "20060102T150405.000000000Z"
+)
+
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// BackupsPath is where snapshots of the league at dbPath are kept.
+func BackupsPath(dbPath string) string {
+	return dbPath + ".backups"
+}
+
+// CorruptPath is where a league file that couldn't be read is moved to
+// when a snapshot is put in its place.
+func CorruptPath(dbPath string) string {
+	return dbPath + ".corrupt"
+}
+
+// Snapshot is one copy of the league, named after when it was taken.
+type Snapshot struct {
+	Name string
+	Time time.Time
+}
+
+// Backups keeps timestamped snapshots of a league in a directory, as JSON
+// in the same shape as the file store's league, so any one of them can be
+// put back into whichever store keeps the league. Only the newest are
+// kept.
+type Backups struct {
+	mu   sync.Mutex
+	dir  string
+	keep int
+	now  func() time.Time
+}
+
+func NewBackups(dir string, keep int) (*Backups, error) {
+	if keep < 1 {
+		return nil, fmt.Errorf("at least one snapshot has to be kept, got %d", keep)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("problem creating backups directory %s, %v", dir, err)
+	}
+	return &Backups{dir: dir, keep: keep, now: time.Now}, nil
+}
+
+// Take writes the league in store to a new snapshot, then removes the
+// oldest ones beyond those kept.
+func (b *Backups) Take(store PlayerStore) (Snapshot, error) {
+	league, err := store.GetLeague()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if league == nil {
+		league = League{}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	taken := b.now().UTC()
+	snapshot := Snapshot{Name: snapshotPrefix + taken.Format(snapshotTimeFormat) + snapshotSuffix, Time: taken}
+	if err := json.NewEncoder(&atomicTape{b.path(snapshot.Name)}).Encode(league); err != nil {
+		return Snapshot{}, fmt.Errorf("problem writing snapshot %s, %v", snapshot.Name, err)
+	}
+	return snapshot, b.prune()
+}
+
+func (b *Backups) prune() error {
+	snapshots, err := b.List()
+	if err != nil {
+		return err
+	}
+	for _, old := range snapshots[min(b.keep, len(snapshots)):] {
+		if err := os.Remove(b.path(old.Name)); err != nil {
+			return fmt.Errorf("problem removing old snapshot %s, %v", old.Name, err)
+		}
+	}
+	return nil
+}
+
+// List is every snapshot kept, newest first.
+func (b *Backups) List() ([]Snapshot, error) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return nil, fmt.Errorf("problem listing snapshots, %v", err)
+	}
+
+	var snapshots []Snapshot
+	for _, entry := range entries {
+		if snapshot, ok := parseSnapshotName(entry.Name()); ok && entry.Type().IsRegular() {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.After(snapshots[j].Time)
+	})
+	return snapshots, nil
+}
+
+// Open reads the league kept in the snapshot called name.
+func (b *Backups) Open(name string) (League, error) {
+	if _, ok := parseSnapshotName(name); !ok {
+		return nil, ErrSnapshotNotFound
+	}
+	data, err := os.ReadFile(b.path(name))
+	if os.IsNotExist(err) {
+		return nil, ErrSnapshotNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("problem reading snapshot %s, %v", name, err)
+	}
+
+	league, err := NewLeague(bytes.NewReader(data))
+	if err == nil {
+		err = League(league).validate()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("snapshot %s is not a league, %v", name, err)
+	}
+	return league, nil
+}
+
+// Latest is the newest snapshot that can be read, passing over any that
+// can't.
+func (b *Backups) Latest() (Snapshot, League, error) {
+	snapshots, err := b.List()
+	if err != nil {
+		return Snapshot{}, nil, err
+	}
+	for _, snapshot := range snapshots {
+		if league, err := b.Open(snapshot.Name); err == nil {
+			return snapshot, league, nil
+		}
+	}
+	return Snapshot{}, nil, ErrSnapshotNotFound
+}
+
+func (b *Backups) path(name string) string {
+	return filepath.Join(b.dir, name)
+}
+
+func parseSnapshotName(name string) (Snapshot, bool) {
+	stamp, ok := strings.CutPrefix(name, snapshotPrefix)
+	if !ok {
+		return Snapshot{}, false
+	}
+	stamp, ok = strings.CutSuffix(stamp, snapshotSuffix)
+	if !ok {
+		return Snapshot{}, false
+	}
+	taken, err := time.Parse(snapshotTimeFormat, stamp)
+	if err != nil {
+		return Snapshot{}, false
+	}
+	return Snapshot{Name: name, Time: taken}, true
+}
+
+// RestoreLeague makes the league in store league, removing the players
+// league doesn't have and setting everyone else's wins. It goes through
+// the store, so a snapshot can be put back into any kind of store.
+func RestoreLeague(store PlayerStore, league League) error {
+	if err := league.validate(); err != nil {
+		return err
+	}
+	current, err := store.GetLeague()
+	if err != nil {
+		return err
+	}
+	for _, player := range current {
+		if league.Find(player.Name) != nil {
+			continue
+		}
+		if err := store.DeletePlayer(player.Name); err != nil {
+			return fmt.Errorf("problem removing %q, %w", player.Name, err)
+		}
+	}
+	return store.ImportLeague(league)
+}
+
+// RecoverPlayerStore opens the store config describes. When its files are
+// damaged they're moved to CorruptPath and the latest snapshot that can be
+// read is restored into a new store in their place; that snapshot is
+// returned with the store. A store that can't be opened for any other
+// reason is left alone.
+func RecoverPlayerStore(config StoreConfig, backups *Backups) (PlayerStore, func() error, *Snapshot, error) {
+	store, close, err := config.Open()
+	if !errors.Is(err, ErrCorruptStore) {
+		return store, close, nil, err
+	}
+
+	snapshot, league, latestErr := backups.Latest()
+	if latestErr != nil {
+		return nil, nil, nil, fmt.Errorf("%w, and there's no snapshot to restore", err)
+	}
+	if err := config.MoveAside(); err != nil {
+		return nil, nil, nil, err
+	}
+	if store, close, err = config.Open(); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := RestoreLeague(store, league); err != nil {
+		close()
+		return nil, nil, nil, fmt.Errorf("problem restoring %s, %w", snapshot.Name, err)
+	}
+	return store, close, &snapshot, nil
+}
+
+// WithBackups serves POST /admin/backup, which snapshots the default
+// league into backups there and then. Only admin tokens may ask, see
+// requireAdmin. Other leagues are kept in backups of their own, which
+// the webserver takes on a timer.
+func WithBackups(backups *Backups) PlayerServerOption {
+	return func(p *PlayerServer) {
+		p.backups = backups
+	}
+}
+
+func (p *PlayerServer) backupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+
+	snapshot, err := p.backups.Take(p.store)
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	p.audit(r, AuditBackup, "", snapshot.Name)
+
+	w.Header().Set("content-type", jsonContentType)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(snapshot)
+}
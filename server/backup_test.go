@@ -0,0 +1,250 @@
+package poker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newBackups(t testing.TB, keep int) (*Backups, *fakeClock) {
+	t.Helper()
+	backups, err := NewBackups(t.TempDir(), keep)
+	assertNoError(t, err)
+	clock := &fakeClock{at: historyStart}
+	backups.now = clock.Now
+	return backups, clock
+}
+
+func TestBackups(t *testing.T) {
+	t.Run("snapshots can be opened again", func(t *testing.T) {
+		backups, _ := newBackups(t, 3)
+		store := newFileSystemStore(t)
+		store.ImportLeague(League{{"Pepper", 3}, {"Chris", 1}})
+
+		snapshot, err := backups.Take(store)
+		assertNoError(t, err)
+
+		if snapshot.Name != "league-20210317T120000.000000000Z.json" || !snapshot.Time.Equal(historyStart) {
+			t.Errorf("got snapshot %+v", snapshot)
+		}
+		league, err := backups.Open(snapshot.Name)
+		assertNoError(t, err)
+		assertLeague(t, league, League{{"Pepper", 3}, {"Chris", 1}})
+	})
+
+	t.Run("only the newest are kept", func(t *testing.T) {
+		backups, clock := newBackups(t, 2)
+		store := newFileSystemStore(t)
+
+		for wins := 0; wins < 4; wins++ {
+			store.RecordWin("Pepper")
+			_, err := backups.Take(store)
+			assertNoError(t, err)
+			clock.Advance(time.Hour)
+		}
+
+		snapshots, err := backups.List()
+		assertNoError(t, err)
+		if len(snapshots) != 2 {
+			t.Fatalf("got %d snapshots want 2", len(snapshots))
+		}
+		if want := historyStart.Add(3 * time.Hour); !snapshots[0].Time.Equal(want) {
+			t.Errorf("got newest snapshot at %v want %v", snapshots[0].Time, want)
+		}
+		league, _ := backups.Open(snapshots[1].Name)
+		assertLeague(t, league, League{{"Pepper", 3}})
+	})
+
+	t.Run("the latest passes over snapshots that can't be read", func(t *testing.T) {
+		backups, clock := newBackups(t, 3)
+		store := newFileSystemStore(t)
+		store.RecordWin("Pepper")
+		backups.Take(store)
+		clock.Advance(time.Hour)
+		broken, _ := backups.Take(store)
+		os.WriteFile(backups.path(broken.Name), []byte(`[{"Name": "Pep`), 0666)
+
+		snapshot, league, err := backups.Latest()
+		assertNoError(t, err)
+		if !snapshot.Time.Equal(historyStart) {
+			t.Errorf("got snapshot from %v want %v", snapshot.Time, historyStart)
+		}
+		assertLeague(t, league, League{{"Pepper", 1}})
+	})
+
+	t.Run("names that aren't snapshots can't be opened", func(t *testing.T) {
+		backups, _ := newBackups(t, 3)
+
+		for _, name := range []string{"../game.db.json", "league-yesterday.json", "league-20210317T120000.000000000Z.json"} {
+			_, err := backups.Open(name)
+			assertError(t, err, ErrSnapshotNotFound)
+		}
+		_, _, err := backups.Latest()
+		assertError(t, err, ErrSnapshotNotFound)
+	})
+}
+
+func TestRestoreLeague(t *testing.T) {
+	store := newFileSystemStore(t)
+	assertNoError(t, store.ImportLeague(League{{"Pepper", 3}, {"Chris", 1}}))
+
+	assertNoError(t, RestoreLeague(store, League{{"Pepper", 5}, {"Cleo", 2}}))
+
+	league, _ := store.GetLeague()
+	assertLeague(t, league, League{{"Pepper", 5}, {"Cleo", 2}})
+}
+
+func TestRecoverPlayerStore(t *testing.T) {
+	setup := func(t *testing.T, kind string) (StoreConfig, *Backups) {
+		backups, _ := newBackups(t, 3)
+		store := newFileSystemStore(t)
+		store.RecordWin("Pepper")
+		_, err := backups.Take(store)
+		assertNoError(t, err)
+
+		config := StoreConfig{Kind: kind, Path: filepath.Join(t.TempDir(), DefaultDBFileNames[kind])}
+		return config, backups
+	}
+
+	// damaged is what each kind of store can't make sense of
+	damaged := map[string]string{
+		"file":     `[{"Name": "Pep`,
+		"eventlog": "not json\n",
+		"kv":       damagedKV(t),
+	}
+
+	for kind, contents := range damaged {
+		t.Run("a damaged "+kind+" store is replaced by the latest snapshot", func(t *testing.T) {
+			config, backups := setup(t, kind)
+			os.WriteFile(config.Path, []byte(contents), 0666)
+
+			store, close, restored, err := RecoverPlayerStore(config, backups)
+			assertNoError(t, err)
+			defer close()
+			if restored == nil {
+				t.Fatal("expected a snapshot to be restored")
+			}
+			assertScoreInStore(t, store, "Pepper", 1)
+
+			kept, _ := os.ReadFile(CorruptPath(config.Path))
+			if string(kept) != contents {
+				t.Errorf("got %q kept from the damaged store", kept)
+			}
+		})
+	}
+
+	t.Run("a store that can be read is left alone", func(t *testing.T) {
+		for _, contents := range []string{"", `[{"Name": "Chris", "Wins": 4}]`} {
+			config, backups := setup(t, "file")
+			if contents != "" {
+				os.WriteFile(config.Path, []byte(contents), 0666)
+			}
+
+			_, close, restored, err := RecoverPlayerStore(config, backups)
+			assertNoError(t, err)
+			close()
+			if restored != nil {
+				t.Errorf("restored %s over %q", restored.Name, contents)
+			}
+		}
+	})
+
+	t.Run("a damaged store with no snapshot to restore is an error", func(t *testing.T) {
+		backups, _ := newBackups(t, 3)
+		config := StoreConfig{Kind: "file", Path: filepath.Join(t.TempDir(), "game.db.json")}
+		os.WriteFile(config.Path, []byte("not json"), 0666)
+
+		_, _, _, err := RecoverPlayerStore(config, backups)
+		assertError(t, err, ErrCorruptStore)
+	})
+}
+
+// damagedKV is a kv data file whose first record doesn't match its
+// checksum, with a good one after it.
+func damagedKV(t testing.TB) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "game.db.kv")
+	store, err := NewKVPlayerStore(path)
+	assertNoError(t, err)
+	assertNoError(t, store.RecordWin("Chris"))
+	assertNoError(t, store.RecordWin("Cleo"))
+	assertNoError(t, store.Close())
+
+	data, err := os.ReadFile(path)
+	assertNoError(t, err)
+	data[0] ^= 0xff
+	return string(data)
+}
+
+func TestBackupEndpoint(t *testing.T) {
+	newServer := func(t *testing.T, store PlayerStore, options ...PlayerServerOption) (*PlayerServer, *Backups, *FileTokenStore) {
+		backups, _ := newBackups(t, 3)
+		tokens := newTokenStore(t, filepath.Join(t.TempDir(), "tokens"))
+		options = append(options, WithBackups(backups), WithTokenAuth(tokens))
+		return NewPlayerServer(store, dummyGame, options...), backups, tokens
+	}
+
+	serve := func(server *PlayerServer, method, token string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, "/admin/backup", nil)
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("takes a snapshot of the league", func(t *testing.T) {
+		auditLog := &SpyAuditLog{}
+		store := &StubPlayerStore{map[string]int{"Pepper": 20}, nil, League{{"Pepper", 20}}}
+		server, backups, tokens := newServer(t, store, WithAuditLog(auditLog))
+		token, _ := tokens.MintAdmin("root")
+
+		response := serve(server, http.MethodPost, token)
+
+		assertStatus(t, response.Code, http.StatusCreated)
+		var snapshot Snapshot
+		if err := json.NewDecoder(response.Body).Decode(&snapshot); err != nil {
+			t.Fatalf("could not parse %q, %v", response.Body, err)
+		}
+		league, err := backups.Open(snapshot.Name)
+		assertNoError(t, err)
+		assertLeague(t, league, League{{"Pepper", 20}})
+
+		if len(auditLog.entries) != 1 || auditLog.entries[0].Action != AuditBackup || auditLog.entries[0].Detail != snapshot.Name {
+			t.Errorf("got audit entries %+v", auditLog.entries)
+		}
+	})
+
+	t.Run("only takes them when asked with a POST", func(t *testing.T) {
+		server, _, tokens := newServer(t, &StubPlayerStore{})
+		token, _ := tokens.MintAdmin("root")
+
+		assertStatus(t, serve(server, http.MethodGet, token).Code, http.StatusMethodNotAllowed)
+	})
+
+	t.Run("only takes them for an admin", func(t *testing.T) {
+		server, backups, tokens := newServer(t, &StubPlayerStore{})
+		token, _ := tokens.Mint("alice")
+
+		assertProblem(t, serve(server, http.MethodPost, token), http.StatusForbidden, "/admin/backup")
+		assertProblem(t, serve(server, http.MethodPost, ""), http.StatusUnauthorized, "/admin/backup")
+		assertProblem(t, serve(server, http.MethodPost, "guess"), http.StatusUnauthorized, "/admin/backup")
+
+		snapshots, _ := backups.List()
+		if len(snapshots) != 0 {
+			t.Errorf("took %d snapshots", len(snapshots))
+		}
+	})
+
+	t.Run("nobody is an admin without token auth", func(t *testing.T) {
+		backups, _ := newBackups(t, 3)
+		server := NewPlayerServer(&StubPlayerStore{}, dummyGame, WithBackups(backups))
+
+		assertProblem(t, serve(server, http.MethodPost, ""), http.StatusForbidden, "/admin/backup")
+	})
+}
@@ -0,0 +1,26 @@
+package poker
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// BlindAlerter schedules an alert, returning a func that cancels it if it
+// hasn't gone off yet.
+type BlindAlerter interface {
+	ScheduleAlertAt(duration time.Duration, amount int, to io.Writer) (stop func())
+}
+
+type BlindAlerterFunc func(duration time.Duration, amount int, to io.Writer) func()
+
+func (a BlindAlerterFunc) ScheduleAlertAt(duration time.Duration, amount int, to io.Writer) func() {
+	return a(duration, amount, to)
+}
+
+func Alerter(duration time.Duration, amount int, to io.Writer) func() {
+	timer := time.AfterFunc(duration, func() {
+		fmt.Fprintf(to, "Blind is now %d\n", amount)
+	})
+	return func() { timer.Stop() }
+}
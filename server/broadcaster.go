@@ -0,0 +1,177 @@
+package poker
+
+import (
+	"context"
+	"sync"
+)
+
+// LeagueUpdate is the league as it stood after a change, and who won if the
+// change was a win.
+type LeagueUpdate struct {
+	ID     int64
+	Winner string
+	League League
+}
+
+// LeagueBroadcaster fans league updates out to every subscriber. Publishing
+// never waits for a subscriber: each update holds the whole league, so one
+// that is behind only needs the latest, and when its buffer is full the
+// oldest update waiting for it is dropped to make room.
+type LeagueBroadcaster struct {
+	mu          sync.Mutex
+	subscribers map[chan LeagueUpdate]struct{}
+	buffer      int
+	lastID      int64
+	closed      bool
+	done        chan struct{}
+}
+
+func NewLeagueBroadcaster(buffer int) *LeagueBroadcaster {
+	if buffer < 1 {
+		buffer = 1
+	}
+	return &LeagueBroadcaster{
+		subscribers: map[chan LeagueUpdate]struct{}{},
+		buffer:      buffer,
+		done:        make(chan struct{}),
+	}
+}
+
+// Subscribe returns a channel of updates that is closed once ctx is done or
+// the broadcaster is closed.
+func (b *LeagueBroadcaster) Subscribe(ctx context.Context) <-chan LeagueUpdate {
+	updates := make(chan LeagueUpdate, b.buffer)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		close(updates)
+		return updates
+	}
+	b.subscribers[updates] = struct{}{}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			b.unsubscribe(updates)
+		case <-b.done:
+		}
+	}()
+	return updates
+}
+
+func (b *LeagueBroadcaster) unsubscribe(updates chan LeagueUpdate) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[updates]; ok {
+		delete(b.subscribers, updates)
+		close(updates)
+	}
+}
+
+func (b *LeagueBroadcaster) Publish(winner string, league League) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	b.lastID++
+	update := LeagueUpdate{ID: b.lastID, Winner: winner, League: league}
+	for updates := range b.subscribers {
+		select {
+		case updates <- update:
+			continue
+		default:
+		}
+
+		// full, so make room by dropping the oldest; the subscriber may
+		// have just read it, in which case there's room anyway
+		select {
+		case <-updates:
+		default:
+		}
+		updates <- update
+	}
+}
+
+// Subscribers is how many are listening right now.
+func (b *LeagueBroadcaster) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.subscribers)
+}
+
+// Close ends every subscription, so streams finish when the server shuts
+// down rather than holding it open.
+func (b *LeagueBroadcaster) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+	close(b.done)
+	for updates := range b.subscribers {
+		delete(b.subscribers, updates)
+		close(updates)
+	}
+}
+
+// BroadcastingPlayerStore publishes the league after every change made
+// through it, while anyone is listening. Changes are made one at a time so
+// updates go out in the order the store saw them.
+type BroadcastingPlayerStore struct {
+	PlayerStore
+	mu          sync.Mutex
+	broadcaster *LeagueBroadcaster
+}
+
+func NewBroadcastingPlayerStore(store PlayerStore, broadcaster *LeagueBroadcaster) *BroadcastingPlayerStore {
+	return &BroadcastingPlayerStore{PlayerStore: store, broadcaster: broadcaster}
+}
+
+func (b *BroadcastingPlayerStore) change(winner string, change func() error) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := change(); err != nil {
+		return err
+	}
+	// reading the whole league back is only worth it for someone to hear
+	// it; anyone who subscribes after this reads the league themselves
+	if b.broadcaster.Subscribers() == 0 {
+		return nil
+	}
+	// the change is made; if the league can't be read back, listeners
+	// just hear about it with the next one
+	if league, err := b.PlayerStore.GetLeague(); err == nil {
+		b.broadcaster.Publish(winner, league)
+	}
+	return nil
+}
+
+func (b *BroadcastingPlayerStore) RecordWin(name string) error {
+	return b.change(name, func() error { return b.PlayerStore.RecordWin(name) })
+}
+
+func (b *BroadcastingPlayerStore) SetPlayerScore(name string, wins int) error {
+	return b.change("", func() error { return b.PlayerStore.SetPlayerScore(name, wins) })
+}
+
+func (b *BroadcastingPlayerStore) DeletePlayer(name string) error {
+	return b.change("", func() error { return b.PlayerStore.DeletePlayer(name) })
+}
+
+func (b *BroadcastingPlayerStore) RenamePlayer(from, to string) error {
+	return b.change("", func() error { return b.PlayerStore.RenamePlayer(from, to) })
+}
+
+func (b *BroadcastingPlayerStore) ImportLeague(league League) error {
+	return b.change("", func() error { return b.PlayerStore.ImportLeague(league) })
+}
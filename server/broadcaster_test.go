@@ -0,0 +1,257 @@
+package poker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLeagueBroadcaster(t *testing.T) {
+	t.Run("every subscriber hears every update", func(t *testing.T) {
+		broadcaster := NewLeagueBroadcaster(4)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		first := broadcaster.Subscribe(ctx)
+		second := broadcaster.Subscribe(ctx)
+		broadcaster.Publish("Chris", League{{"Chris", 1}})
+
+		for _, updates := range []<-chan LeagueUpdate{first, second} {
+			update := receiveUpdate(t, updates)
+			if update.ID != 1 || update.Winner != "Chris" {
+				t.Errorf("got %+v, want Chris's win", update)
+			}
+		}
+	})
+
+	t.Run("a slow subscriber doesn't hold up publishing and ends up with the latest", func(t *testing.T) {
+		broadcaster := NewLeagueBroadcaster(2)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		updates := broadcaster.Subscribe(ctx)
+		for wins := 1; wins <= 10; wins++ {
+			broadcaster.Publish("Chris", League{{"Chris", wins}})
+		}
+
+		receiveUpdate(t, updates)
+		latest := receiveUpdate(t, updates)
+		assertLeague(t, latest.League, League{{"Chris", 10}})
+	})
+
+	t.Run("cancelling the context unsubscribes", func(t *testing.T) {
+		broadcaster := NewLeagueBroadcaster(1)
+		ctx, cancel := context.WithCancel(context.Background())
+
+		updates := broadcaster.Subscribe(ctx)
+		cancel()
+
+		assertClosed(t, updates)
+		if got := broadcaster.Subscribers(); got != 0 {
+			t.Errorf("got %d subscribers, want 0", got)
+		}
+	})
+
+	t.Run("closing ends every subscription", func(t *testing.T) {
+		broadcaster := NewLeagueBroadcaster(1)
+
+		updates := broadcaster.Subscribe(context.Background())
+		broadcaster.Close()
+
+		assertClosed(t, updates)
+		assertClosed(t, broadcaster.Subscribe(context.Background()))
+	})
+}
+
+func TestBroadcastingPlayerStore(t *testing.T) {
+	broadcaster := NewLeagueBroadcaster(4)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := broadcaster.Subscribe(ctx)
+
+	store := NewBroadcastingPlayerStore(newFileSystemStore(t), broadcaster)
+
+	assertNoError(t, store.RecordWin("Chris"))
+	update := receiveUpdate(t, updates)
+	if update.Winner != "Chris" {
+		t.Errorf("got winner %q want Chris", update.Winner)
+	}
+	assertLeague(t, update.League, League{{"Chris", 1}})
+
+	assertNoError(t, store.SetPlayerScore("Cleo", 5))
+	update = receiveUpdate(t, updates)
+	if update.Winner != "" {
+		t.Errorf("got winner %q for a score being set, want none", update.Winner)
+	}
+	assertLeague(t, update.League, League{{"Cleo", 5}, {"Chris", 1}})
+
+	assertError(t, store.DeletePlayer("Nobody"), ErrPlayerNotFound)
+	select {
+	case update := <-updates:
+		t.Errorf("got %+v for a failed delete, want nothing", update)
+	default:
+	}
+}
+
+func TestBroadcastingPlayerStoreWithoutSubscribers(t *testing.T) {
+	players := &countingLeagueStore{PlayerStore: newFileSystemStore(t)}
+	store := NewBroadcastingPlayerStore(players, NewLeagueBroadcaster(4))
+
+	assertNoError(t, store.RecordWin("Chris"))
+	assertNoError(t, store.SetPlayerScore("Cleo", 5))
+
+	if players.leagues != 0 {
+		t.Errorf("read the league %d times with nobody listening, want 0", players.leagues)
+	}
+}
+
+func TestLeagueStream(t *testing.T) {
+	newServer := func() (*httptest.Server, *PlayerServer, *LeagueBroadcaster) {
+		broadcaster := NewLeagueBroadcaster(4)
+		store := &StubPlayerStore{nil, nil, League{{"Cleo", 32}}}
+		server := NewPlayerServer(NewBroadcastingPlayerStore(store, broadcaster), dummyGame, WithLeagueStream(broadcaster))
+		return httptest.NewServer(server), server, broadcaster
+	}
+
+	t.Run("sends the league then every change", func(t *testing.T) {
+		httpServer, _, broadcaster := newServer()
+		defer httpServer.Close()
+
+		events, closeStream := openStream(t, httpServer.URL)
+		defer closeStream()
+
+		first := readEvent(t, events)
+		assertLeague(t, first.League, League{{"Cleo", 32}})
+
+		waitForSubscribers(t, broadcaster, 1)
+		broadcaster.Publish("Chris", League{{"Cleo", 32}, {"Chris", 1}})
+
+		second := readEvent(t, events)
+		if second.Winner != "Chris" {
+			t.Errorf("got winner %q want Chris", second.Winner)
+		}
+		assertLeague(t, second.League, League{{"Cleo", 32}, {"Chris", 1}})
+	})
+
+	t.Run("unsubscribes when the client goes away", func(t *testing.T) {
+		httpServer, _, broadcaster := newServer()
+		defer httpServer.Close()
+
+		events, closeStream := openStream(t, httpServer.URL)
+		readEvent(t, events)
+		waitForSubscribers(t, broadcaster, 1)
+
+		closeStream()
+
+		waitForSubscribers(t, broadcaster, 0)
+	})
+
+	t.Run("draining the server ends the stream", func(t *testing.T) {
+		httpServer, server, _ := newServer()
+		defer httpServer.Close()
+
+		events, closeStream := openStream(t, httpServer.URL)
+		defer closeStream()
+		readEvent(t, events)
+
+		server.Drain()
+
+		// the stream times out if it's left open
+		if _, err := io.Copy(io.Discard, events); err != nil {
+			t.Errorf("stream did not end after draining, %v", err)
+		}
+	})
+
+	t.Run("there is no stream without a broadcaster", func(t *testing.T) {
+		server := NewPlayerServer(&StubPlayerStore{}, dummyGame)
+
+		request, _ := http.NewRequest(http.MethodGet, "/league/stream", nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+}
+
+func openStream(t testing.TB, serverURL string) (*bufio.Reader, func()) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, serverURL+"/league/stream", nil)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		cancel()
+		t.Fatalf("could not open the stream, %v", err)
+	}
+
+	assertStatus(t, response.StatusCode, http.StatusOK)
+	if got := response.Header.Get("content-type"); got != "text/event-stream" {
+		t.Errorf("got content-type %q want text/event-stream", got)
+	}
+
+	return bufio.NewReader(response.Body), func() {
+		cancel()
+		response.Body.Close()
+	}
+}
+
+func readEvent(t testing.TB, events *bufio.Reader) leagueEventData {
+	t.Helper()
+
+	var event leagueEventData
+	for {
+		line, err := events.ReadString('\n')
+		if err != nil {
+			t.Fatalf("stream ended before an event, %v", err)
+		}
+		if data := strings.TrimPrefix(line, "data: "); data != line {
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				t.Fatalf("could not parse event data %q, %v", data, err)
+			}
+			return event
+		}
+	}
+}
+
+func receiveUpdate(t testing.TB, updates <-chan LeagueUpdate) LeagueUpdate {
+	t.Helper()
+	select {
+	case update, ok := <-updates:
+		if !ok {
+			t.Fatal("updates closed, want an update")
+		}
+		return update
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for an update")
+	}
+	return LeagueUpdate{}
+}
+
+func assertClosed(t testing.TB, updates <-chan LeagueUpdate) {
+	t.Helper()
+	select {
+	case _, ok := <-updates:
+		if ok {
+			t.Error("got an update, want the channel closed")
+		}
+	case <-time.After(time.Second):
+		t.Error("timed out waiting for the channel to close")
+	}
+}
+
+func waitForSubscribers(t testing.TB, broadcaster *LeagueBroadcaster, want int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for broadcaster.Subscribers() != want && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := broadcaster.Subscribers(); got != want {
+		t.Errorf("got %d subscribers want %d", got, want)
+	}
+}
@@ -0,0 +1,65 @@
+package poker
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type CLI struct {
+	in   *bufio.Scanner
+	out  io.Writer
+	game Game
+}
+
+const (
+	PlayerPrompt         = "Please enter the number of players: "
+	BadPlayerInputErrMsg = "Bad value received for number of players, please try again with a number"
+	BadWinnerInputMsg    = "invalid winner input, expect format of 'PlayerName wins'"
+)
+
+func NewCLI(in io.Reader, out io.Writer, game Game) *CLI {
+	return &CLI{
+		in:   bufio.NewScanner(in),
+		out:  out,
+		game: game,
+	}
+}
+
+func (cli *CLI) PlayPoker() {
+	fmt.Fprint(cli.out, PlayerPrompt)
+
+	numberOfPlayers, err := strconv.Atoi(cli.readLine())
+	if err != nil || numberOfPlayers < 1 {
+		fmt.Fprint(cli.out, BadPlayerInputErrMsg)
+		return
+	}
+
+	_, stop := cli.game.Start(numberOfPlayers, cli.out)
+	defer stop()
+
+	winner, err := extractWinner(cli.readLine())
+	if err != nil {
+		fmt.Fprint(cli.out, BadWinnerInputMsg)
+		return
+	}
+
+	if err := cli.game.Finish(winner); err != nil {
+		fmt.Fprintf(cli.out, "could not record %s as the winner, %v", winner, err)
+	}
+}
+
+func extractWinner(userInput string) (string, error) {
+	winner := strings.TrimSuffix(userInput, " wins")
+	if winner == userInput || winner == "" {
+		return "", fmt.Errorf("%q is not of the form 'PlayerName wins'", userInput)
+	}
+	return winner, nil
+}
+
+func (cli *CLI) readLine() string {
+	cli.in.Scan()
+	return strings.TrimSpace(cli.in.Text())
+}
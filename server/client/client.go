@@ -0,0 +1,286 @@
+// Package client talks to a poker server over HTTP, so tools don't have to
+// know its routes, headers and error bodies.
+package client
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	poker "server"
+)
+
+const (
+	DefaultRetries = 3
+	DefaultBackoff = 100 * time.Millisecond
+
+	maxBackoff = 5 * time.Second
+)
+
+// Client calls a poker server. Requests that fail in a way that might not
+// happen again, like a dropped connection, a 503 or a 429, are retried with
+// exponential backoff, waiting as long as Retry-After says when it's given.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	token      string
+	retries    int
+	backoff    time.Duration
+
+	sleep  func(ctx context.Context, d time.Duration) error
+	newKey func() string
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sends requests with httpClient rather than
+// http.DefaultClient.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithToken sends token as a bearer token, for servers that want one.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithRetries retries a failed request up to retries times, waiting backoff
+// before the first retry and twice as long before each one after that.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries, c.backoff = retries, backoff
+	}
+}
+
+// New makes a Client for the server at baseURL, like
+// "http://localhost:5000".
+func New(baseURL string, options ...Option) (*Client, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("%q is not a server URL", baseURL)
+	}
+	base.Path = strings.TrimSuffix(base.Path, "/")
+
+	c := &Client{
+		baseURL:    base,
+		httpClient: http.DefaultClient,
+		retries:    DefaultRetries,
+		backoff:    DefaultBackoff,
+		sleep:      sleep,
+		newKey:     newIdempotencyKey,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c, nil
+}
+
+// GetScore is how many wins the player has.
+func (c *Client) GetScore(ctx context.Context, name string) (int, error) {
+	response, err := c.do(ctx, http.MethodGet, playerPath(name), http.Header{"Accept": {"text/plain"}})
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return 0, fmt.Errorf("problem reading %s's score, %v", name, err)
+	}
+	score, err := strconv.Atoi(strings.TrimSpace(string(body)))
+	if err != nil {
+		return 0, fmt.Errorf("problem parsing %s's score %q, %v", name, body, err)
+	}
+	return score, nil
+}
+
+// RecordWin gives the player a win. Every attempt carries the same
+// Idempotency-Key, so a retry after a lost response isn't counted twice.
+func (c *Client) RecordWin(ctx context.Context, name string) error {
+	response, err := c.do(ctx, http.MethodPost, playerPath(name), http.Header{"Idempotency-Key": {c.newKey()}})
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return nil
+}
+
+// GetLeague is every player, most wins first.
+func (c *Client) GetLeague(ctx context.Context) (poker.League, error) {
+	response, err := c.do(ctx, http.MethodGet, "/league", http.Header{"Accept": {"application/json"}})
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	league, err := poker.NewLeague(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	return league, nil
+}
+
+// do sends the request, retrying it while it fails in a way that's worth
+// retrying. Any response it returns was a success; the rest become errors.
+func (c *Client) do(ctx context.Context, method, path string, header http.Header) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		response, err := c.send(ctx, method, path, header)
+		if err == nil && response.StatusCode < http.StatusBadRequest {
+			return response, nil
+		}
+
+		var wait time.Duration
+		if err == nil {
+			wait = retryAfter(response)
+			err = newError(response)
+			response.Body.Close()
+		}
+		if attempt >= c.retries || !retryable(ctx, err) {
+			return nil, err
+		}
+
+		if wait == 0 {
+			wait = c.backoffFor(attempt)
+		}
+		if sleepErr := c.sleep(ctx, wait); sleepErr != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, path string, header http.Header) (*http.Response, error) {
+	// path is escaped already, so setting it as the unescaped Path would
+	// escape it again and "Mary Jane" would arrive as "Mary%20Jane"
+	target := *c.baseURL
+	target.RawPath = c.baseURL.EscapedPath() + path
+	unescaped, err := url.PathUnescape(target.RawPath)
+	if err != nil {
+		return nil, err
+	}
+	target.Path = unescaped
+
+	request, err := http.NewRequestWithContext(ctx, method, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	if c.token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return c.httpClient.Do(request)
+}
+
+// backoffFor doubles the wait with every attempt, with up to half of it
+// again added at random so clients that failed together don't all come
+// back together.
+func (c *Client) backoffFor(attempt int) time.Duration {
+	wait := c.backoff << attempt
+	if wait <= 0 || wait > maxBackoff {
+		wait = maxBackoff
+	}
+	if half := int64(wait / 2); half > 0 {
+		wait += time.Duration(rand.Int64N(half))
+	}
+	return wait
+}
+
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var serverErr *Error
+	if errors.As(err, &serverErr) {
+		switch serverErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	// the server never answered, so try again
+	return true
+}
+
+func retryAfter(response *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(response.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func playerPath(name string) string {
+	return "/players/" + url.PathEscape(name)
+}
+
+func newIdempotencyKey() string {
+	key := make([]byte, 16)
+	cryptorand.Read(key)
+	return hex.EncodeToString(key)
+}
+
+// Error is a request the server turned down, with the problem it gave.
+// It unwraps to the matching poker error where there is one, so callers
+// can check for poker.ErrPlayerNotFound and the like with errors.Is.
+type Error struct {
+	StatusCode int
+	Problem    poker.Problem
+}
+
+func newError(response *http.Response) *Error {
+	err := &Error{StatusCode: response.StatusCode}
+	// a body that isn't a problem, say from a proxy in the way, leaves it
+	// empty
+	json.NewDecoder(io.LimitReader(response.Body, 64<<10)).Decode(&err.Problem)
+	return err
+}
+
+func (e *Error) Error() string {
+	if e.Problem.Detail != "" {
+		return fmt.Sprintf("server answered %d, %s", e.StatusCode, e.Problem.Detail)
+	}
+	return fmt.Sprintf("server answered %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+func (e *Error) Unwrap() error {
+	if err := e.Problem.Err(); err != nil {
+		return err
+	}
+	// answers without a type of their own, like a missing token or a
+	// proxy that couldn't reach the server, still say what went wrong
+	switch e.StatusCode {
+	case http.StatusUnauthorized:
+		return poker.ErrInvalidToken
+	case http.StatusServiceUnavailable:
+		return poker.ErrStoreUnavailable
+	}
+	return nil
+}
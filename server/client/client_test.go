@@ -0,0 +1,273 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	poker "server"
+)
+
+func TestNew(t *testing.T) {
+	for _, baseURL := range []string{"", "localhost:5000", "/league"} {
+		if _, err := New(baseURL); err == nil {
+			t.Errorf("expected an error for %q", baseURL)
+		}
+	}
+}
+
+func TestRetries(t *testing.T) {
+	// flaky fails the first failures requests with status, then hands the
+	// rest to next
+	flaky := func(failures, status int, next http.Handler) (http.Handler, *int) {
+		var (
+			mu       sync.Mutex
+			attempts int
+		)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			attempts++
+			attempt := attempts
+			mu.Unlock()
+
+			if attempt <= failures {
+				if status == http.StatusTooManyRequests {
+					w.Header().Set("Retry-After", "2")
+				}
+				w.WriteHeader(status)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}), &attempts
+	}
+
+	newClient := func(t *testing.T, handler http.Handler) (*Client, *[]time.Duration) {
+		server := httptest.NewServer(handler)
+		t.Cleanup(server.Close)
+
+		client, err := New(server.URL, WithRetries(2, 10*time.Millisecond))
+		assertNoError(t, err)
+
+		var waits []time.Duration
+		client.sleep = func(ctx context.Context, d time.Duration) error {
+			waits = append(waits, d)
+			return nil
+		}
+		return client, &waits
+	}
+
+	t.Run("retries a server that is unavailable", func(t *testing.T) {
+		store := poker.NewInMemoryPlayerStore()
+		store.SetPlayerScore("Pepper", 20)
+		handler, attempts := flaky(2, http.StatusServiceUnavailable, poker.NewPlayerServer(store, nil))
+		client, waits := newClient(t, handler)
+
+		assertScore(t, client, "Pepper", 20)
+		if *attempts != 3 {
+			t.Errorf("got %d attempts want 3", *attempts)
+		}
+		if len(*waits) != 2 || (*waits)[1] < 20*time.Millisecond {
+			t.Errorf("got waits %v, want two growing ones", *waits)
+		}
+	})
+
+	t.Run("waits as long as Retry-After says", func(t *testing.T) {
+		handler, _ := flaky(1, http.StatusTooManyRequests, poker.NewPlayerServer(poker.NewInMemoryPlayerStore(), nil))
+		client, waits := newClient(t, handler)
+
+		assertNoError(t, client.RecordWin(context.Background(), "Pepper"))
+		if len(*waits) != 1 || (*waits)[0] != 2*time.Second {
+			t.Errorf("got waits %v want [2s]", *waits)
+		}
+	})
+
+	t.Run("gives up after the last retry", func(t *testing.T) {
+		handler, attempts := flaky(10, http.StatusBadGateway, http.NotFoundHandler())
+		client, _ := newClient(t, handler)
+
+		_, err := client.GetLeague(context.Background())
+
+		var serverErr *Error
+		if !errors.As(err, &serverErr) || serverErr.StatusCode != http.StatusBadGateway {
+			t.Errorf("got error %v want a 502", err)
+		}
+		if *attempts != 3 {
+			t.Errorf("got %d attempts want 3", *attempts)
+		}
+	})
+
+	t.Run("doesn't retry what won't change", func(t *testing.T) {
+		handler, attempts := flaky(0, 0, poker.NewPlayerServer(poker.NewInMemoryPlayerStore(), nil))
+		client, _ := newClient(t, handler)
+
+		_, err := client.GetScore(context.Background(), "Nobody")
+
+		assertError(t, err, poker.ErrPlayerNotFound)
+		if *attempts != 1 {
+			t.Errorf("got %d attempts want 1", *attempts)
+		}
+	})
+
+	t.Run("a win whose answer was lost is only counted once", func(t *testing.T) {
+		store := poker.NewInMemoryPlayerStore()
+		server := poker.NewPlayerServer(store, nil)
+
+		// the first win is recorded, but the client is told it failed
+		var once sync.Once
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lost := false
+			once.Do(func() {
+				server.ServeHTTP(httptest.NewRecorder(), r)
+				lost = true
+			})
+			if lost {
+				w.WriteHeader(http.StatusGatewayTimeout)
+				return
+			}
+			server.ServeHTTP(w, r)
+		})
+		client, _ := newClient(t, handler)
+
+		assertNoError(t, client.RecordWin(context.Background(), "Pepper"))
+
+		score, _ := store.GetPlayerScore("Pepper")
+		if score != 1 {
+			t.Errorf("got %d wins want 1", score)
+		}
+	})
+
+	t.Run("stops when the context is done", func(t *testing.T) {
+		handler, attempts := flaky(10, http.StatusServiceUnavailable, http.NotFoundHandler())
+		client, _ := newClient(t, handler)
+		ctx, cancel := context.WithCancel(context.Background())
+		client.sleep = func(ctx context.Context, d time.Duration) error {
+			cancel()
+			return ctx.Err()
+		}
+
+		_, err := client.GetLeague(ctx)
+
+		assertError(t, err, poker.ErrStoreUnavailable)
+		if *attempts != 1 {
+			t.Errorf("got %d attempts want 1", *attempts)
+		}
+	})
+}
+
+func TestErrorUnwrap(t *testing.T) {
+	t.Run("goes by the problem type, not the detail", func(t *testing.T) {
+		err := &Error{StatusCode: http.StatusConflict, Problem: poker.Problem{
+			Type:   poker.ProblemType(poker.ErrLeagueExists),
+			Detail: "worded however the server likes",
+		}}
+
+		assertError(t, err, poker.ErrLeagueExists)
+		if errors.Is(err, poker.ErrPlayerExists) {
+			t.Error("a league that exists was taken for a player that does")
+		}
+	})
+
+	t.Run("a detail alone doesn't make an error", func(t *testing.T) {
+		err := &Error{StatusCode: http.StatusNotFound, Problem: poker.Problem{
+			Type:   "about:blank",
+			Detail: poker.ErrPlayerNotFound.Error(),
+		}}
+
+		if got := err.Unwrap(); got != nil {
+			t.Errorf("got %v, want nothing to unwrap", got)
+		}
+	})
+}
+
+func TestToken(t *testing.T) {
+	tokens := tokenAuthenticator{"alices-token": "alice"}
+	client, server := newTestServer(t, poker.NewInMemoryPlayerStore(), poker.WithTokenAuth(tokens))
+
+	assertError(t, client.RecordWin(context.Background(), "Pepper"), poker.ErrInvalidToken)
+
+	client, err := New(server.URL, WithToken("alices-token"))
+	assertNoError(t, err)
+	assertNoError(t, client.RecordWin(context.Background(), "Pepper"))
+}
+
+func TestStreamLeague(t *testing.T) {
+	broadcaster := poker.NewLeagueBroadcaster(4)
+	store := poker.NewBroadcastingPlayerStore(poker.NewInMemoryPlayerStore(), broadcaster)
+	store.SetPlayerScore("Cleo", 32)
+	client, _ := newTestServer(t, store, poker.WithLeagueStream(broadcaster))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.StreamLeague(ctx)
+	assertNoError(t, err)
+	defer stream.Close()
+
+	first, err := stream.Next()
+	assertNoError(t, err)
+	assertLeague(t, first.League, poker.League{{Name: "Cleo", Wins: 32}})
+
+	waitForSubscribers(t, broadcaster, 1)
+	assertNoError(t, client.RecordWin(ctx, "Chris"))
+
+	second, err := stream.Next()
+	assertNoError(t, err)
+	if second.Winner != "Chris" || second.ID == 0 {
+		t.Errorf("got %+v, want Chris's win", second)
+	}
+	assertLeague(t, second.League, poker.League{{Name: "Cleo", Wins: 32}, {Name: "Chris", Wins: 1}})
+
+	broadcaster.Close()
+	if _, err := stream.Next(); err != io.EOF {
+		t.Errorf("got %v want io.EOF once the stream ends", err)
+	}
+}
+
+type tokenAuthenticator map[string]string
+
+func (t tokenAuthenticator) Authenticate(token string) (string, error) {
+	if user, ok := t[token]; ok {
+		return user, nil
+	}
+	return "", poker.ErrInvalidToken
+}
+
+func waitForSubscribers(t testing.TB, broadcaster *poker.LeagueBroadcaster, want int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for broadcaster.Subscribers() != want && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := broadcaster.Subscribers(); got != want {
+		t.Errorf("got %d subscribers want %d", got, want)
+	}
+}
+
+func assertScore(t testing.TB, client *Client, name string, want int) {
+	t.Helper()
+	got, err := client.GetScore(context.Background(), name)
+	assertNoError(t, err)
+	if got != want {
+		t.Errorf("got %d wins for %q want %d", got, name, want)
+	}
+}
+
+func assertLeague(t testing.TB, got, want poker.League) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+}
+
+func assertError(t testing.TB, got, want error) {
+	t.Helper()
+	if !errors.Is(got, want) {
+		t.Errorf("got error %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	poker "server"
+	"server/storetest"
+)
+
+// clientStore is a league seen through a Client. Scores, wins and the
+// league go over HTTP; the rest, which the client has no calls for, go
+// straight to the store behind the server.
+type clientStore struct {
+	poker.PlayerStore
+	client *Client
+}
+
+func (c clientStore) GetPlayerScore(name string) (int, error) {
+	return c.client.GetScore(context.Background(), name)
+}
+
+func (c clientStore) RecordWin(name string) error {
+	return c.client.RecordWin(context.Background(), name)
+}
+
+func (c clientStore) GetLeague() (poker.League, error) {
+	return c.client.GetLeague(context.Background())
+}
+
+// The server takes names apart from the path with poker.ParsePlayerName,
+// so the store behind it goes by the same names, as the webserver's does.
+func TestStoreContract(t *testing.T) {
+	storetest.RunPlayerStoreContract(t, storetest.Factory{
+		Open: func(t *testing.T, dir string) (poker.PlayerStore, func()) {
+			players, close, err := poker.FileSystemPlayerStoreFromFile(filepath.Join(dir, "game.db.json"))
+			assertNoError(t, err)
+			store := poker.NewCanonicalNamePlayerStore(players)
+			client, server := newTestServer(t, store)
+			return clientStore{store, client}, func() {
+				server.Close()
+				close()
+			}
+		},
+		CanonicalNames: true,
+	})
+}
+
+func newTestServer(t testing.TB, store poker.PlayerStore, options ...poker.PlayerServerOption) (*Client, *httptest.Server) {
+	t.Helper()
+
+	server := httptest.NewServer(poker.NewPlayerServer(store, nil, options...))
+	t.Cleanup(server.Close)
+
+	client, err := New(server.URL)
+	assertNoError(t, err)
+	return client, server
+}
+
+func assertNoError(t testing.TB, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("didn't expect an error but got one, %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	poker "server"
+)
+
+// LeagueStream is the league as the server sends it from /league/stream:
+// once when the stream opens and again every time it changes.
+type LeagueStream struct {
+	body   io.ReadCloser
+	events *bufio.Reader
+}
+
+// StreamLeague opens the league stream. Opening it is retried like any other
+// request, but once it's open a dropped stream is the caller's to reopen.
+func (c *Client) StreamLeague(ctx context.Context) (*LeagueStream, error) {
+	response, err := c.do(ctx, http.MethodGet, "/league/stream", http.Header{"Accept": {"text/event-stream"}})
+	if err != nil {
+		return nil, err
+	}
+	return &LeagueStream{body: response.Body, events: bufio.NewReader(response.Body)}, nil
+}
+
+// Next waits for the next league event. It returns io.EOF once the server
+// ends the stream.
+func (s *LeagueStream) Next() (poker.LeagueUpdate, error) {
+	var (
+		update poker.LeagueUpdate
+		data   strings.Builder
+	)
+	for {
+		line, err := s.events.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line == "" {
+				return poker.LeagueUpdate{}, io.EOF
+			}
+			return poker.LeagueUpdate{}, fmt.Errorf("problem reading the league stream, %v", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "" {
+			// a blank line ends an event; one without data, like a
+			// heartbeat, is nothing to report
+			if data.Len() == 0 {
+				continue
+			}
+			var event struct {
+				Winner string
+				League poker.League
+			}
+			if err := json.Unmarshal([]byte(data.String()), &event); err != nil {
+				return poker.LeagueUpdate{}, fmt.Errorf("problem parsing league event %q, %v", data.String(), err)
+			}
+			update.Winner, update.League = event.Winner, event.League
+			return update, nil
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			update.ID, _ = strconv.ParseInt(value, 10, 64)
+		case "data":
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+		}
+	}
+}
+
+func (s *LeagueStream) Close() error {
+	return s.body.Close()
+}
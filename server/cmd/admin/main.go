@@ -0,0 +1,254 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	poker "server"
+)
+
+const usage = `usage: admin [-store file] [-db game.db.json] [-k-factor 32] [-backups-kept 24] <command>
+
+-store and -db name the league the same way as for the webserver; a league
+other than the default one is at <db>.leagues/<league>/<default db name>.
+
+commands:
+  mint <user>           create a token for user and print it
+  mint-admin <user>     create a token that can also use /admin, and print it
+  revoke <id or user>   revoke one token, or every token for a user
+  list                  show who has tokens
+  recompute-ratings     replay every recorded game and rewrite the ratings;
+                        stop the webserver first, it saves its own on exit
+  merge-names           tidy up player names and merge players whose names
+                        differ only in case or spacing; stop the webserver
+                        first
+  backups               show the snapshots kept of the league, newest first
+  restore [snapshot]    put a snapshot, or the latest that can be read, in
+                        place of the league, snapshotting it first if it
+                        can be read; stop the webserver first
+`
+
+func main() {
+	storeKind := flag.String("store", "file", "player store the league is kept in: file, eventlog or kv")
+	db := flag.String("db", "", "where the store keeps the league (defaults depend on -store)")
+	compactEvery := flag.Int("compact-every", poker.DefaultCompactEvery, "wins between event log compactions (eventlog store only)")
+	kFactor := flag.Float64("k-factor", poker.DefaultKFactor, "how far one game moves a rating")
+	backupsKept := flag.Int("backups-kept", poker.DefaultBackupsKept, "snapshots to keep before removing the oldest")
+	flag.Usage = func() { fmt.Fprint(flag.CommandLine.Output(), usage) }
+	flag.Parse()
+
+	if *db == "" {
+		*db = poker.DefaultDBFileNames[*storeKind]
+	}
+	store := poker.StoreConfig{Kind: *storeKind, Path: *db, CompactEvery: *compactEvery}
+
+	tokens, err := poker.NewFileTokenStore(poker.TokensPath(*db))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	switch command := args[0]; {
+	case command == "mint" && len(args) == 2:
+		token, err := tokens.Mint(args[1])
+		if err != nil {
+			log.Fatalf("problem minting token, %v", err)
+		}
+		fmt.Println(token)
+	case command == "mint-admin" && len(args) == 2:
+		token, err := tokens.MintAdmin(args[1])
+		if err != nil {
+			log.Fatalf("problem minting token, %v", err)
+		}
+		fmt.Println(token)
+	case command == "revoke" && len(args) == 2:
+		revoked, err := tokens.Revoke(args[1])
+		if err != nil {
+			log.Fatalf("problem revoking %s, %v", args[1], err)
+		}
+		fmt.Printf("revoked %d token(s)\n", revoked)
+	case command == "list" && len(args) == 1:
+		list, err := tokens.List()
+		if err != nil {
+			log.Fatalf("problem listing tokens, %v", err)
+		}
+		out := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(out, "ID\tUSER\tCREATED\tADMIN")
+		for _, token := range list {
+			fmt.Fprintf(out, "%s\t%s\t%s\t%t\n", token.ID, token.User, token.Created.Format("2006-01-02 15:04"), token.Admin)
+		}
+		out.Flush()
+	case command == "recompute-ratings" && len(args) == 1:
+		err = recomputeRatings(*db, *kFactor)
+	case command == "merge-names" && len(args) == 1:
+		err = mergeNames(store, *kFactor)
+	case command == "backups" && len(args) == 1:
+		listBackups(*db, *backupsKept)
+	case command == "restore" && len(args) <= 2:
+		err = restore(store, *backupsKept, args[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	// commands that open stores give their errors back rather than exit,
+	// so the stores are closed, and what they hold written out, first
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// closeStore is for deferring close, giving back its error in err unless
+// err already holds one.
+func closeStore(err *error, close func() error) {
+	if closeErr := close(); *err == nil && closeErr != nil {
+		*err = closeErr
+	}
+}
+
+func recomputeRatings(db string, kFactor float64) (err error) {
+	results, err := poker.NewFileResultStore(db, kFactor)
+	if err != nil {
+		return err
+	}
+	defer closeStore(&err, results.Close)
+
+	if err := results.Recompute(); err != nil {
+		return fmt.Errorf("problem recomputing ratings, %v", err)
+	}
+	ratings, err := results.GetRatings()
+	if err != nil {
+		return err
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(out, "PLAYER\tRATING\tGAMES\tWINS")
+	for _, rating := range ratings {
+		fmt.Fprintf(out, "%s\t%.0f\t%d\t%d\n", rating.Name, rating.Rating, rating.Games, rating.Wins)
+	}
+	out.Flush()
+	return nil
+}
+
+func mergeNames(config poker.StoreConfig, kFactor float64) (err error) {
+	db := config.Path
+	players, close, err := config.Open()
+	if err != nil {
+		return err
+	}
+	defer closeStore(&err, close)
+
+	// through the history and ratings, so merged players keep the dates of
+	// their wins and the games they played
+	history, err := poker.NewHistoryPlayerStore(players, poker.HistoryPath(db))
+	if err != nil {
+		return err
+	}
+	defer closeStore(&err, history.Close)
+	results, err := poker.NewFileResultStore(db, kFactor)
+	if err != nil {
+		return err
+	}
+	defer closeStore(&err, results.Close)
+
+	merges, invalid, err := poker.MergeDuplicatePlayers(poker.NewRatedPlayerStore(history, results))
+	for _, merge := range merges {
+		fmt.Printf("%s now has %d wins, merged from %s\n", merge.Name, merge.Wins, quoteAll(merge.Merged))
+	}
+	for _, name := range invalid {
+		fmt.Printf("%q is not a valid name, rename it by hand\n", name)
+	}
+	if err != nil {
+		return fmt.Errorf("problem merging names, %v", err)
+	}
+	if len(merges) == 0 {
+		fmt.Println("nothing to merge")
+	}
+	return nil
+}
+
+func quoteAll(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = strconv.Quote(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func openBackups(db string, kept int) *poker.Backups {
+	backups, err := poker.NewBackups(poker.BackupsPath(db), kept)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return backups
+}
+
+func listBackups(db string, kept int) {
+	snapshots, err := openBackups(db, kept).List()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(out, "SNAPSHOT\tTAKEN")
+	for _, snapshot := range snapshots {
+		fmt.Fprintf(out, "%s\t%s\n", snapshot.Name, snapshot.Time.Local().Format("2006-01-02 15:04:05"))
+	}
+	out.Flush()
+}
+
+func restore(config poker.StoreConfig, kept int, args []string) (err error) {
+	backups := openBackups(config.Path, kept)
+
+	var snapshot poker.Snapshot
+	var league poker.League
+	if len(args) == 1 {
+		snapshot.Name = args[0]
+		league, err = backups.Open(snapshot.Name)
+	} else {
+		snapshot, league, err = backups.Latest()
+	}
+	if err != nil {
+		return fmt.Errorf("problem reading the snapshot, %v", err)
+	}
+
+	// the league being replaced is snapshotted too, so a restore can be
+	// undone; one that can't be read is moved aside instead
+	store, close, err := config.Open()
+	switch {
+	case err == nil:
+		taken, err := backups.Take(store)
+		if err != nil {
+			close()
+			return fmt.Errorf("problem snapshotting the current league, %v", err)
+		}
+		fmt.Printf("the current league is kept as %s\n", taken.Name)
+	case errors.Is(err, poker.ErrCorruptStore):
+		if err := config.MoveAside(); err != nil {
+			return err
+		}
+		fmt.Printf("the current league can't be read, it is kept as %s\n", poker.CorruptPath(config.Path))
+		if store, close, err = config.Open(); err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+	defer closeStore(&err, close)
+
+	if err := poker.RestoreLeague(store, league); err != nil {
+		return fmt.Errorf("problem restoring %s, %v", snapshot.Name, err)
+	}
+	fmt.Printf("restored %s, %d players\n", snapshot.Name, len(league))
+	return nil
+}
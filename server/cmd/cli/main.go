@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	poker "server"
+)
+
+const dbFileName = "game.db.json"
+
+func main() {
+	players, close, err := poker.FileSystemPlayerStoreFromFile(dbFileName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer close()
+
+	history, err := poker.NewHistoryPlayerStore(players, poker.HistoryPath(dbFileName))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer history.Close()
+
+	store := poker.NewCanonicalNamePlayerStore(history)
+	game := poker.NewTexasHoldem(poker.BlindAlerterFunc(poker.Alerter), store)
+
+	fmt.Println("Let's play poker")
+	fmt.Println("Type {Name} wins to record a win")
+	poker.NewCLI(os.Stdin, os.Stdout, game).PlayPoker()
+}
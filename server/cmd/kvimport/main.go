@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	poker "server"
+)
+
+func main() {
+	from := flag.String("from", "game.db.json", "league file written by the file system store")
+	to := flag.String("to", "game.db.kv", "kv store to import the league into")
+	flag.Parse()
+
+	db, err := os.Open(*from)
+	if err != nil {
+		log.Fatalf("problem opening file: %s, %v", *from, err)
+	}
+	defer db.Close()
+
+	league, err := poker.NewLeague(db)
+	if err != nil {
+		log.Fatalf("problem reading league from %s, %v", *from, err)
+	}
+
+	store, err := poker.NewKVPlayerStore(*to)
+	if err != nil {
+		log.Fatalf("problem opening kv store %s, %v", *to, err)
+	}
+
+	if err := store.ImportLeague(league); err != nil {
+		store.Close()
+		log.Fatalf("problem importing league, %v", err)
+	}
+	if err := store.Close(); err != nil {
+		log.Fatalf("problem closing kv store, %v", err)
+	}
+
+	log.Printf("imported %d players from %s into %s", len(league), *from, *to)
+}
@@ -1,27 +1,343 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	poker "server"
 )
 
-const dbFileName = "game.db.json"
+type config struct {
+	addr            string
+	storeKind       string
+	dbPath          string
+	compactEvery    int
+	auth            bool
+	kFactor         float64
+	winRate         float64
+	winBurst        int
+	tlsCert         string
+	tlsKey          string
+	shutdownTimeout time.Duration
+	backupEvery     time.Duration
+	backupsKept     int
+	leader          string
+	wsOrigins       string
+}
+
+// Every flag can also be set through a POKER_ environment variable, which
+// is handier in containers; flags win when both are given.
+func parseConfig() config {
+	var cfg config
+	flag.StringVar(&cfg.addr, "addr", envOr("POKER_ADDR", ":5000"), "address to listen on")
+	flag.StringVar(&cfg.storeKind, "store", envOr("POKER_STORE", "file"), "player store to use: file, eventlog or kv")
+	flag.StringVar(&cfg.dbPath, "db", envOr("POKER_DB", ""), "where the store keeps the league (defaults depend on -store)")
+	flag.IntVar(&cfg.compactEvery, "compact-every", poker.DefaultCompactEvery, "wins between event log compactions (eventlog store only)")
+	flag.BoolVar(&cfg.auth, "auth", envOr("POKER_AUTH", "true") == "true", "require a bearer token to change the league, see cmd/admin")
+	flag.Float64Var(&cfg.kFactor, "k-factor", poker.DefaultKFactor, "how far one game moves a player's rating")
+	flag.Float64Var(&cfg.winRate, "win-rate", 1, "wins a second each client may record once its burst is spent, 0 for no limit")
+	flag.IntVar(&cfg.winBurst, "win-burst", 10, "wins a client may record at once")
+	flag.StringVar(&cfg.tlsCert, "tls-cert", envOr("POKER_TLS_CERT", ""), "TLS certificate file, serves HTTPS when given with -tls-key")
+	flag.StringVar(&cfg.tlsKey, "tls-key", envOr("POKER_TLS_KEY", ""), "TLS private key file")
+	flag.DurationVar(&cfg.shutdownTimeout, "shutdown-timeout", 15*time.Second, "how long to wait for in-flight requests on shutdown")
+	flag.DurationVar(&cfg.backupEvery, "backup-every", time.Hour, "how often to snapshot the league, 0 for only when asked at /admin/backup")
+	flag.IntVar(&cfg.backupsKept, "backups-kept", poker.DefaultBackupsKept, "snapshots to keep before removing the oldest")
+	flag.StringVar(&cfg.leader, "leader", envOr("POKER_LEADER", ""), "URL of the server to follow; changes are forwarded to it and reads answered from a copy of its league")
+	flag.StringVar(&cfg.wsOrigins, "ws-origins", envOr("POKER_WS_ORIGINS", ""), "comma separated sites, like https://poker.example.com, whose pages may open the game websocket as well as this server's")
+	flag.Parse()
+
+	if cfg.dbPath == "" {
+		cfg.dbPath = poker.DefaultDBFileNames[cfg.storeKind]
+	}
+	if (cfg.tlsCert == "") != (cfg.tlsKey == "") {
+		log.Fatal("-tls-cert and -tls-key must be given together")
+	}
+	return cfg
+}
+
+func envOr(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
 
 func main() {
-	db, err := os.OpenFile(dbFileName, os.O_RDWR|os.O_CREATE, 0666)
+	cfg := parseConfig()
+	if cfg.leader != "" {
+		follow(cfg)
+		return
+	}
+
+	backups, err := poker.NewBackups(poker.BackupsPath(cfg.dbPath), cfg.backupsKept)
 	if err != nil {
-		log.Fatalf("problem opening file: %s, %v", dbFileName, err)
+		log.Fatal(err)
+	}
+	players, closeStore, err := openPlayerStore(cfg, cfg.dbPath, backups)
+	if err != nil {
+		log.Fatalf("Error creating %s player store, %v", cfg.storeKind, err)
+	}
+	history, err := poker.NewHistoryPlayerStore(players, poker.HistoryPath(cfg.dbPath))
+	if err != nil {
+		log.Fatal(err)
+	}
+	results, err := poker.NewFileResultStore(cfg.dbPath, cfg.kFactor)
+	if err != nil {
+		log.Fatal(err)
+	}
+	metrics := poker.NewMetrics()
+	stream := poker.NewLeagueBroadcaster(16)
+	broadcasting := poker.NewBroadcastingPlayerStore(poker.NewRatedPlayerStore(history, results), stream)
+	replication, err := poker.NewReplicationLog(broadcasting, poker.ReplicationLogPath(cfg.dbPath), poker.DefaultReplicationKept)
+	if err != nil {
+		log.Fatal(err)
+	}
+	store := poker.NewInstrumentedPlayerStore(poker.NewCanonicalNamePlayerStore(replication), metrics)
+	game := poker.NewTexasHoldem(poker.BlindAlerterFunc(poker.Alerter), store)
+
+	auditLog, err := poker.NewFileAuditLog(poker.AuditPath(cfg.dbPath))
+	if err != nil {
+		log.Fatal(err)
+	}
+	// every other league's wins are kept, and backed up, the same way as
+	// the default one's, in a directory of its own. Only the default
+	// league has history, ratings, the stream and replication; the server
+	// turns down asking a named league for its ratings or history.
+	leagues, err := poker.NewDirLeagueStore(poker.LeaguesPath(cfg.dbPath), func(dir string) (poker.PlayerStore, func() error, error) {
+		dbPath := leagueDBPath(cfg, dir)
+		leagueBackups, err := poker.NewBackups(poker.BackupsPath(dbPath), cfg.backupsKept)
+		if err != nil {
+			return nil, nil, err
+		}
+		store, close, err := openPlayerStore(cfg, dbPath, leagueBackups)
+		if err != nil {
+			return nil, nil, err
+		}
+		return poker.NewCanonicalNamePlayerStore(store), close, nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	options := []poker.PlayerServerOption{
+		poker.WithAuditLog(auditLog),
+		poker.WithRatings(results),
+		poker.WithHistory(history),
+		poker.WithMetrics(metrics),
+		poker.WithLeagueStream(stream),
+		poker.WithLeagues(leagues),
+		poker.WithBackups(backups),
+		poker.WithReplication(replication),
+		poker.WithAccessLog(slog.New(slog.NewJSONHandler(os.Stderr, nil))),
+		poker.WithWebsocketOrigins(websocketOrigins(cfg)...),
+		poker.WithRateLimiter(poker.NewRateLimiter(poker.RateLimits{
+			"POST /players/":                  {Rate: cfg.winRate, Burst: cfg.winBurst},
+			"POST /leagues/{league}/players/": {Rate: cfg.winRate, Burst: cfg.winBurst},
+			"POST /game/winner":               {Rate: cfg.winRate, Burst: cfg.winBurst},
+			"/ws":                             {Rate: cfg.winRate, Burst: cfg.winBurst},
+			// each snapshot taken on request pushes out an old one
+			"POST /admin/backup": {Rate: 1.0 / 60, Burst: 3},
+		})),
+	}
+
+	if cfg.auth {
+		tokens, err := poker.NewFileTokenStore(poker.TokensPath(cfg.dbPath))
+		if err != nil {
+			log.Fatal(err)
+		}
+		options = append(options, poker.WithTokenAuth(tokens))
 	}
 
-	store, err := NewFileSystemPlayerStore(db)
+	server := poker.NewPlayerServer(store, game, options...)
 
+	stopBackups := make(chan struct{})
+	if cfg.backupEvery > 0 {
+		go takeBackups(cfg, backups, store, leagues, stopBackups)
+	}
+
+	serve(cfg, server)
+	close(stopBackups)
+
+	if err := replication.Close(); err != nil {
+		log.Printf("problem closing the replication log, %v", err)
+	}
+	if err := history.Close(); err != nil {
+		log.Printf("problem closing the win history, %v", err)
+	}
+	if err := closeStore(); err != nil {
+		log.Printf("problem closing the player store, %v", err)
+	}
+	if err := leagues.Close(); err != nil {
+		log.Printf("problem closing leagues, %v", err)
+	}
+	if err := results.Close(); err != nil {
+		log.Printf("problem saving ratings, %v", err)
+	}
+	if err := auditLog.Close(); err != nil {
+		log.Printf("problem closing the audit log, %v", err)
+	}
+}
+
+// serve answers requests until the process is told to stop, then drains
+// server and lets the requests in flight finish.
+func serve(cfg config, server *poker.PlayerServer) {
+	httpServer := &http.Server{
+		Addr:              cfg.addr,
+		Handler:           server,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("listening on %s", cfg.addr)
+		if cfg.tlsCert != "" {
+			serveErr <- httpServer.ListenAndServeTLS(cfg.tlsCert, cfg.tlsKey)
+		} else {
+			serveErr <- httpServer.ListenAndServe()
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err := <-serveErr:
+		log.Fatalf("could not listen on %s, %v", cfg.addr, err)
+	case sig := <-stop:
+		log.Printf("received %v, shutting down", sig)
+	}
+
+	server.Drain()
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.shutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		log.Printf("problem draining requests, %v", err)
+	}
+}
+
+// follow serves a copy of the league kept by the server at cfg.leader,
+// forwarding changes to it. Tokens, the audit log, ratings, history and
+// other leagues are all the leader's, so none are kept here, and reads of
+// them are forwarded to the leader too.
+func follow(cfg config) {
+	metrics := poker.NewMetrics()
+	stream := poker.NewLeagueBroadcaster(16)
+	follower, err := poker.NewFollower(cfg.leader, poker.ReplicaPath(cfg.dbPath), stream)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// the follower finds names in any case itself, from the spellings the
+	// leader sends it
+	store := poker.NewInstrumentedPlayerStore(follower, metrics)
+	game := poker.NewTexasHoldem(poker.BlindAlerterFunc(poker.Alerter), store)
+
+	ctx, stopFollowing := context.WithCancel(context.Background())
+	go follower.Run(ctx)
+	log.Printf("following %s", cfg.leader)
+
+	server := poker.NewPlayerServer(store, game,
+		poker.WithLeader(follower),
+		poker.WithMetrics(metrics),
+		poker.WithLeagueStream(stream),
+		poker.WithAccessLog(slog.New(slog.NewJSONHandler(os.Stderr, nil))),
+		poker.WithWebsocketOrigins(websocketOrigins(cfg)...),
+		poker.WithRateLimiter(poker.NewRateLimiter(poker.RateLimits{
+			"POST /players/":    {Rate: cfg.winRate, Burst: cfg.winBurst},
+			"POST /game/winner": {Rate: cfg.winRate, Burst: cfg.winBurst},
+			"/ws":               {Rate: cfg.winRate, Burst: cfg.winBurst},
+		})),
+	)
+	serve(cfg, server)
+	stopFollowing()
+}
+
+func websocketOrigins(cfg config) []string {
+	var origins []string
+	for _, origin := range strings.Split(cfg.wsOrigins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// takeBackups snapshots the default league and every other one each
+// cfg.backupEvery until stop is closed.
+func takeBackups(cfg config, backups *poker.Backups, store poker.PlayerStore, leagues *poker.DirLeagueStore, stop <-chan struct{}) {
+	ticker := time.NewTicker(cfg.backupEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := backups.Take(store); err != nil {
+				log.Printf("problem taking a snapshot, %v", err)
+			}
+			backUpLeagues(cfg, leagues)
+		case <-stop:
+			return
+		}
+	}
+}
+
+func backUpLeagues(cfg config, leagues *poker.DirLeagueStore) {
+	names, err := leagues.Leagues()
+	if err != nil {
+		log.Printf("problem listing leagues to snapshot, %v", err)
+		return
+	}
+	for _, name := range names {
+		if err := backUpLeague(cfg, leagues, name); err != nil && !errors.Is(err, poker.ErrLeagueNotFound) {
+			log.Printf("problem taking a snapshot of league %s, %v", name, err)
+		}
+	}
+}
+
+func backUpLeague(cfg config, leagues *poker.DirLeagueStore, name string) error {
+	store, release, err := leagues.Store(name)
 	if err != nil {
-		log.Fatalf("Error creating file system player store, %v", err)
+		return err
 	}
-	server := NewPlayerServer(store)
+	defer release()
+
+	dbPath := leagueDBPath(cfg, filepath.Join(poker.LeaguesPath(cfg.dbPath), name))
+	backups, err := poker.NewBackups(poker.BackupsPath(dbPath), cfg.backupsKept)
+	if err != nil {
+		return err
+	}
+	_, err = backups.Take(store)
+	return err
+}
 
-	if err := http.ListenAndServe(":5000", server); err != nil {
-		log.Fatalf("could not listen on port 5000, %v", err)
+// leagueDBPath is where the league kept in dir has its store.
+func leagueDBPath(cfg config, dir string) string {
+	return filepath.Join(dir, poker.DefaultDBFileNames[cfg.storeKind])
+}
+
+// openPlayerStore opens the store at dbPath, putting back the latest of
+// backups in place of one that's damaged.
+func openPlayerStore(cfg config, dbPath string, backups *poker.Backups) (poker.PlayerStore, func() error, error) {
+	store, close, restored, err := poker.RecoverPlayerStore(poker.StoreConfig{
+		Kind:         cfg.storeKind,
+		Path:         dbPath,
+		CompactEvery: cfg.compactEvery,
+	}, backups)
+	if err != nil {
+		return nil, nil, err
+	}
+	if restored != nil {
+		log.Printf("%s could not be read, restored %s and kept the old files as %s", dbPath, restored.Name, poker.CorruptPath(dbPath))
 	}
+	return store, close, nil
 }
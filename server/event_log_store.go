@@ -0,0 +1,330 @@
+package poker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const DefaultCompactEvery = 1000
+
+const (
+	EventWin    = "win"
+	EventSet    = "set"
+	EventDelete = "delete"
+	EventRename = "rename"
+)
+
+type LeagueEvent struct {
+	Seq     int64     `json:"seq"`
+	Kind    string    `json:"kind,omitempty"`
+	Player  string    `json:"player"`
+	Time    time.Time `json:"time"`
+	GameID  string    `json:"game_id,omitempty"`
+	Wins    int       `json:"wins,omitempty"`
+	NewName string    `json:"new_name,omitempty"`
+}
+
+type leagueSnapshot struct {
+	Seq    int64  `json:"seq"`
+	League League `json:"league"`
+}
+
+// EventLogPlayerStore appends one JSON line per change to a log file and folds
+// the log into a League on startup. Every compactEvery wins the league is
+// written to a snapshot next to the log and the log is truncated, so startup
+// only has to replay the tail.
+type EventLogPlayerStore struct {
+	mu           sync.RWMutex
+	log          eventLogFile
+	snapshot     *json.Encoder
+	league       League
+	seq          int64
+	tail         int
+	compactEvery int
+	closed       bool
+	now          func() time.Time
+}
+
+// eventLogFile is the file the events are appended to.
+type eventLogFile interface {
+	io.ReadWriteSeeker
+	io.Closer
+	Truncate(size int64) error
+}
+
+func NewEventLogPlayerStore(path string, compactEvery int) (*EventLogPlayerStore, error) {
+	snapshotPath := path + ".snapshot"
+	snap, err := readSnapshot(snapshotPath)
+	if err != nil {
+		return nil, fmt.Errorf("problem loading snapshot %s, %w", snapshotPath, err)
+	}
+
+	log, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("problem opening event log %s, %v", path, err)
+	}
+
+	store := &EventLogPlayerStore{
+		log:          log,
+		snapshot:     json.NewEncoder(&atomicTape{snapshotPath}),
+		league:       snap.League,
+		seq:          snap.Seq,
+		compactEvery: compactEvery,
+		now:          time.Now,
+	}
+
+	if err := store.replay(); err != nil {
+		log.Close()
+		return nil, fmt.Errorf("problem replaying event log %s, %w", path, err)
+	}
+
+	return store, nil
+}
+
+func readSnapshot(path string) (leagueSnapshot, error) {
+	var snap leagueSnapshot
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return snap, nil
+	}
+	if err != nil {
+		return snap, err
+	}
+
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return snap, fmt.Errorf("%w, %v", ErrCorruptStore, err)
+	}
+	return snap, nil
+}
+
+func (e *EventLogPlayerStore) replay() error {
+	if _, err := e.log.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(e.log)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// a trailing line without a newline is a write that never
+			// finished, so drop it rather than refuse to start
+			if len(line) > 0 {
+				return e.log.Truncate(offset)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var event LeagueEvent
+		if err := json.Unmarshal(bytes.TrimSpace(line), &event); err != nil {
+			return fmt.Errorf("bad event at offset %d, %w, %v", offset, ErrCorruptStore, err)
+		}
+		offset += int64(len(line))
+
+		e.tail++
+		if event.Seq <= e.seq {
+			continue
+		}
+		e.apply(event)
+	}
+}
+
+func (e *EventLogPlayerStore) apply(event LeagueEvent) {
+	e.seq = event.Seq
+	e.league.apply(event)
+}
+
+// apply makes the change event records to the league.
+func (l *League) apply(event LeagueEvent) {
+	switch event.Kind {
+	case EventSet:
+		l.setWins(event.Player, event.Wins)
+	case EventDelete:
+		l.remove(event.Player)
+	case EventRename:
+		l.rename(event.Player, event.NewName)
+	default:
+		// logs written before events had a kind only ever held wins
+		if player := l.Find(event.Player); player != nil {
+			player.Wins++
+		} else {
+			*l = append(*l, Player{event.Player, 1})
+		}
+	}
+}
+
+func (e *EventLogPlayerStore) GetLeague() (League, error) {
+	e.mu.RLock()
+	league := e.league.copy()
+	e.mu.RUnlock()
+
+	sort.SliceStable(league, func(i, j int) bool {
+		return league[i].Wins > league[j].Wins
+	})
+	return league, nil
+}
+
+func (e *EventLogPlayerStore) GetPlayerScore(name string) (int, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if player := e.league.Find(name); player != nil {
+		return player.Wins, nil
+	}
+	return 0, ErrPlayerNotFound
+}
+
+func (e *EventLogPlayerStore) RecordWin(name string) error {
+	return e.RecordGameWin(name, "")
+}
+
+func (e *EventLogPlayerStore) RecordGameWin(name, gameID string) error {
+	if name == "" {
+		return ErrEmptyName
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.append(LeagueEvent{Kind: EventWin, Player: name, GameID: gameID})
+}
+
+func (e *EventLogPlayerStore) SetPlayerScore(name string, wins int) error {
+	if name == "" {
+		return ErrEmptyName
+	}
+	if wins < 0 {
+		return ErrInvalidScore
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.append(LeagueEvent{Kind: EventSet, Player: name, Wins: wins})
+}
+
+func (e *EventLogPlayerStore) DeletePlayer(name string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.league.Find(name) == nil {
+		return ErrPlayerNotFound
+	}
+	return e.append(LeagueEvent{Kind: EventDelete, Player: name})
+}
+
+func (e *EventLogPlayerStore) RenamePlayer(from, to string) error {
+	if to == "" {
+		return ErrEmptyName
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.league.Find(from) == nil {
+		return ErrPlayerNotFound
+	}
+	if from != to && e.league.Find(to) != nil {
+		return ErrPlayerExists
+	}
+	return e.append(LeagueEvent{Kind: EventRename, Player: from, NewName: to})
+}
+
+func (e *EventLogPlayerStore) ImportLeague(league League) error {
+	if err := league.validate(); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, player := range league {
+		err := e.append(LeagueEvent{Kind: EventSet, Player: player.Name, Wins: player.Wins})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *EventLogPlayerStore) append(event LeagueEvent) error {
+	if e.closed {
+		return ErrStoreUnavailable
+	}
+
+	event.Seq = e.seq + 1
+	event.Time = e.now().UTC()
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	// a write that fails part way leaves the start of a line behind, and
+	// the next event would be run into it; so it's cut off again
+	end, err := e.log.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("problem appending to event log, %v", err)
+	}
+	if _, err := e.log.Write(append(line, '\n')); err != nil {
+		if truncErr := e.log.Truncate(end); truncErr != nil {
+			// the log can't be trusted to take another event
+			e.closed = true
+		}
+		return fmt.Errorf("problem appending to event log, %v", err)
+	}
+
+	e.apply(event)
+	e.tail++
+
+	if e.compactEvery > 0 && e.tail >= e.compactEvery {
+		// the event is already safe in the log, so a failed compaction
+		// must not be reported as a failed write; we try again next time
+		e.compact()
+	}
+	return nil
+}
+
+func (e *EventLogPlayerStore) Compact() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return ErrStoreUnavailable
+	}
+	return e.compact()
+}
+
+func (e *EventLogPlayerStore) compact() error {
+	// if we crash before the truncate, the log still holds events the
+	// snapshot already counts; replay skips them by sequence number
+	err := e.snapshot.Encode(leagueSnapshot{e.seq, e.league})
+	if err != nil {
+		return fmt.Errorf("problem writing snapshot, %v", err)
+	}
+
+	if err := e.log.Truncate(0); err != nil {
+		return fmt.Errorf("problem truncating event log, %v", err)
+	}
+	e.tail = 0
+	return nil
+}
+
+func (e *EventLogPlayerStore) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.closed = true
+	return e.log.Close()
+}
@@ -0,0 +1,230 @@
+package poker
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventLogPlayerStore(t *testing.T) {
+	t.Run("folds the log back into a league on reopen", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "wins.log")
+
+		store := newEventLogStore(t, path, 0)
+		store.RecordWin("Chris")
+		store.RecordWin("Cleo")
+		store.RecordWin("Chris")
+		store.Close()
+
+		store = newEventLogStore(t, path, 0)
+		defer store.Close()
+
+		assertLeague(t, getLeague(t, store), []Player{
+			{"Chris", 2},
+			{"Cleo", 1},
+		})
+	})
+
+	t.Run("appends one event per win with time and game id", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "wins.log")
+		now := time.Date(2021, time.March, 1, 20, 0, 0, 0, time.UTC)
+
+		store := newEventLogStore(t, path, 0)
+		defer store.Close()
+		store.now = func() time.Time { return now }
+
+		assertNoError(t, store.RecordGameWin("Chris", "friday-game"))
+
+		lines := readLines(t, path)
+		if len(lines) != 1 {
+			t.Fatalf("got %d lines in the log, want 1", len(lines))
+		}
+
+		var got LeagueEvent
+		assertNoError(t, json.Unmarshal([]byte(lines[0]), &got))
+
+		want := LeagueEvent{Seq: 1, Kind: EventWin, Player: "Chris", Time: now, GameID: "friday-game"}
+		if got != want {
+			t.Errorf("got %+v want %+v", got, want)
+		}
+	})
+
+	t.Run("compacts into a snapshot and keeps only the tail", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "wins.log")
+
+		store := newEventLogStore(t, path, 3)
+		for i := 0; i < 4; i++ {
+			store.RecordWin("Chris")
+		}
+		store.RecordWin("Cleo")
+		store.Close()
+
+		if got := len(readLines(t, path)); got != 2 {
+			t.Errorf("got %d events in the tail, want 2", got)
+		}
+
+		store = newEventLogStore(t, path, 3)
+		defer store.Close()
+
+		assertLeague(t, getLeague(t, store), []Player{
+			{"Chris", 4},
+			{"Cleo", 1},
+		})
+	})
+
+	t.Run("does not double count events already in the snapshot", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "wins.log")
+
+		writeFile(t, path+".snapshot", `{"seq": 2, "league": [{"Name": "Chris", "Wins": 2}]}`)
+		writeFile(t, path, `{"seq": 1, "player": "Chris"}
+{"seq": 2, "player": "Chris"}
+{"seq": 3, "player": "Chris"}
+`)
+
+		store := newEventLogStore(t, path, 0)
+		defer store.Close()
+
+		assertScoreInStore(t, store, "Chris", 3)
+	})
+
+	t.Run("drops a half written last event", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "wins.log")
+
+		writeFile(t, path, `{"seq": 1, "player": "Chris"}
+{"seq": 2, "pla`)
+
+		store := newEventLogStore(t, path, 0)
+		defer store.Close()
+		store.RecordWin("Cleo")
+
+		assertScoreInStore(t, store, "Chris", 1)
+		if got := len(readLines(t, path)); got != 2 {
+			t.Errorf("got %d events in the log, want 2", got)
+		}
+	})
+
+	t.Run("leaves nothing behind of a write that failed part way", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "wins.log")
+
+		store := newEventLogStore(t, path, 0)
+		assertNoError(t, store.RecordWin("Chris"))
+
+		file := store.log
+		store.log = &shortWriteFile{file}
+		if err := store.RecordWin("Cleo"); err == nil {
+			t.Fatal("expected the failed write to be an error")
+		}
+		store.log = file
+		assertNoError(t, store.RecordWin("Chris"))
+		store.Close()
+
+		store = newEventLogStore(t, path, 0)
+		defer store.Close()
+		assertLeague(t, getLeague(t, store), []Player{{"Chris", 2}})
+		if got := len(readLines(t, path)); got != 2 {
+			t.Errorf("got %d events in the log, want 2", got)
+		}
+	})
+
+	t.Run("replays score changes, renames and deletes", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "wins.log")
+
+		store := newEventLogStore(t, path, 0)
+		store.RecordWin("Chris")
+		store.RecordWin("Cleo")
+		assertNoError(t, store.SetPlayerScore("Chris", 20))
+		assertNoError(t, store.RenamePlayer("Chris", "Christopher"))
+		assertNoError(t, store.DeletePlayer("Cleo"))
+		assertNoError(t, store.ImportLeague(League{{"Tiest", 14}}))
+		store.Close()
+
+		store = newEventLogStore(t, path, 0)
+		defer store.Close()
+
+		assertLeague(t, getLeague(t, store), []Player{
+			{"Christopher", 20},
+			{"Tiest", 14},
+		})
+	})
+
+	t.Run("does not log changes to missing players", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "wins.log")
+
+		store := newEventLogStore(t, path, 0)
+		defer store.Close()
+		store.RecordWin("Chris")
+		store.RecordWin("Cleo")
+
+		assertError(t, store.DeletePlayer("Apollo"), ErrPlayerNotFound)
+		assertError(t, store.RenamePlayer("Apollo", "Zeus"), ErrPlayerNotFound)
+		assertError(t, store.RenamePlayer("Chris", "Cleo"), ErrPlayerExists)
+
+		if got := len(readLines(t, path)); got != 2 {
+			t.Errorf("got %d events in the log, want 2", got)
+		}
+	})
+
+	t.Run("is unavailable once closed", func(t *testing.T) {
+		store := newEventLogStore(t, filepath.Join(t.TempDir(), "wins.log"), 0)
+		store.Close()
+
+		assertError(t, store.RecordWin("Chris"), ErrStoreUnavailable)
+	})
+
+	t.Run("refuses a corrupt event in the middle of the log", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "wins.log")
+
+		writeFile(t, path, `{"seq": 1, "player": "Chris"}
+not json
+{"seq": 3, "player": "Chris"}
+`)
+
+		_, err := NewEventLogPlayerStore(path, 0)
+		if err == nil {
+			t.Error("expected an error for a corrupt log but got none")
+		}
+	})
+}
+
+func newEventLogStore(t testing.TB, path string, compactEvery int) *EventLogPlayerStore {
+	t.Helper()
+	store, err := NewEventLogPlayerStore(path, compactEvery)
+	assertNoError(t, err)
+	return store
+}
+
+func writeFile(t testing.TB, path, contents string) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, []byte(contents), 0666); err != nil {
+		t.Fatalf("could not write %s, %v", path, err)
+	}
+}
+
+func readLines(t testing.TB, path string) []string {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("could not read %s, %v", path, err)
+	}
+	contents := strings.TrimSuffix(string(data), "\n")
+	if contents == "" {
+		return nil
+	}
+	return strings.Split(contents, "\n")
+}
+
+// shortWriteFile writes only half of what it's given, as a full disk
+// might, then fails.
+type shortWriteFile struct {
+	eventLogFile
+}
+
+func (s *shortWriteFile) Write(p []byte) (int, error) {
+	n, _ := s.eventLogFile.Write(p[:len(p)/2])
+	return n, errors.New("no space left on device")
+}
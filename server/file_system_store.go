@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"os"
 	"sort"
+	"sync"
 )
 
 type FileSystemPlayerStore struct {
+	mu       sync.RWMutex
 	database *json.Encoder
 	league   League
 }
@@ -20,15 +22,34 @@ func NewFileSystemPlayerStore(file *os.File) (*FileSystemPlayerStore, error) {
 	league, err := NewLeague(file)
 
 	if err != nil {
-		return nil, fmt.Errorf("problem loading player store from file %s, %v", file.Name(), err)
+		return nil, fmt.Errorf("problem loading player store from file %s, %w, %v", file.Name(), ErrCorruptStore, err)
 	}
 
 	return &FileSystemPlayerStore{
-		database: json.NewEncoder(&tape{file}),
+		database: json.NewEncoder(&atomicTape{file.Name()}),
 		league:   league,
 	}, nil
 }
 
+func FileSystemPlayerStoreFromFile(path string) (*FileSystemPlayerStore, func(), error) {
+	db, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, nil, fmt.Errorf("problem opening %s %v", path, err)
+	}
+
+	closeFunc := func() {
+		db.Close()
+	}
+
+	store, err := NewFileSystemPlayerStore(db)
+	if err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("problem creating file system player store, %w", err)
+	}
+
+	return store, closeFunc, nil
+}
+
 func initializaPlayerDBFile(file *os.File) error {
 	file.Seek(0, 0)
 
@@ -45,32 +66,111 @@ func initializaPlayerDBFile(file *os.File) error {
 	return nil
 }
 
-func (f *FileSystemPlayerStore) GetLeague() League {
-	sort.Slice(f.league, func(i, j int) bool {
-		return f.league[i].Wins > f.league[j].Wins
+func (f *FileSystemPlayerStore) GetLeague() (League, error) {
+	f.mu.RLock()
+	league := f.league.copy()
+	f.mu.RUnlock()
+
+	sort.SliceStable(league, func(i, j int) bool {
+		return league[i].Wins > league[j].Wins
 	})
-	return f.league
+	return league, nil
 }
 
-func (f *FileSystemPlayerStore) GetPlayerScore(name string) int {
-	var wins int
+func (f *FileSystemPlayerStore) GetPlayerScore(name string) (int, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
 	player := f.league.Find(name)
+	if player == nil {
+		return 0, ErrPlayerNotFound
+	}
+	return player.Wins, nil
+}
 
-	if player != nil {
-		wins = player.Wins
+func (f *FileSystemPlayerStore) RecordWin(name string) error {
+	if name == "" {
+		return ErrEmptyName
 	}
 
-	return wins
-}
+	f.mu.Lock()
+	defer f.mu.Unlock()
 
-func (f *FileSystemPlayerStore) RecordWin(name string) {
-	player := f.league.Find(name)
+	league := f.league.copy()
+	player := league.Find(name)
 
 	if player != nil {
 		player.Wins += 1
 	} else {
-		f.league = append(f.league, Player{name, 1})
+		league = append(league, Player{name, 1})
+	}
+
+	return f.save(league)
+}
+
+func (f *FileSystemPlayerStore) SetPlayerScore(name string, wins int) error {
+	if name == "" {
+		return ErrEmptyName
+	}
+	if wins < 0 {
+		return ErrInvalidScore
 	}
 
-	f.database.Encode(f.league)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	league := f.league.copy()
+	league.setWins(name, wins)
+	return f.save(league)
+}
+
+func (f *FileSystemPlayerStore) DeletePlayer(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	league := f.league.copy()
+	if err := league.remove(name); err != nil {
+		return err
+	}
+	return f.save(league)
+}
+
+func (f *FileSystemPlayerStore) RenamePlayer(from, to string) error {
+	if to == "" {
+		return ErrEmptyName
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	league := f.league.copy()
+	if err := league.rename(from, to); err != nil {
+		return err
+	}
+	return f.save(league)
+}
+
+func (f *FileSystemPlayerStore) ImportLeague(league League) error {
+	if err := league.validate(); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	updated := f.league.copy()
+	for _, player := range league {
+		updated.setWins(player.Name, player.Wins)
+	}
+	return f.save(updated)
+}
+
+// save only replaces the league in memory once it is safely on disk, so a
+// failed write doesn't leave us serving wins we'll forget on restart.
+func (f *FileSystemPlayerStore) save(league League) error {
+	if err := f.database.Encode(league); err != nil {
+		return fmt.Errorf("problem saving league, %v", err)
+	}
+	f.league = league
+	return nil
 }
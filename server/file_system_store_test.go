@@ -1,8 +1,11 @@
 package poker
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 )
 
@@ -17,13 +20,13 @@ func TestFileSystemStore(t *testing.T) {
 		store, err := NewFileSystemPlayerStore(database)
 		assertNoError(t, err)
 
-		got := store.GetLeague()
+		got := getLeague(t, store)
 
 		want := []Player{
 			{"Chris", 33},
 			{"Cleo", 10},
 		}
-		got = store.GetLeague()
+		got = getLeague(t, store)
 
 		assertLeague(t, got, want)
 	})
@@ -36,7 +39,7 @@ func TestFileSystemStore(t *testing.T) {
 		store, err := NewFileSystemPlayerStore(database)
 		assertNoError(t, err)
 
-		got := store.GetPlayerScore("Paul")
+		got := getScore(t, store, "Paul")
 		want := 10
 
 		assertPlayerScore(t, got, want)
@@ -51,7 +54,7 @@ func TestFileSystemStore(t *testing.T) {
 		assertNoError(t, err)
 		store.RecordWin("Paul")
 
-		got := store.GetPlayerScore("Paul")
+		got := getScore(t, store, "Paul")
 		want := 11
 
 		assertPlayerScore(t, got, want)
@@ -67,7 +70,7 @@ func TestFileSystemStore(t *testing.T) {
 		assertNoError(t, err)
 		store.RecordWin("Whiskeyjack")
 
-		got := store.GetPlayerScore("Whiskeyjack")
+		got := getScore(t, store, "Whiskeyjack")
 		want := 1
 
 		assertPlayerScore(t, got, want)
@@ -82,6 +85,53 @@ func TestFileSystemStore(t *testing.T) {
 		assertNoError(t, err)
 	})
 
+	t.Run("sets, renames and deletes players", func(t *testing.T) {
+		database, cleanDatabase := createTempFile(t, `[
+			{"Name": "Paul", "Wins": 10},
+			{"Name": "Rand", "Wins": 30}]`)
+		defer cleanDatabase()
+
+		store, err := NewFileSystemPlayerStore(database)
+		assertNoError(t, err)
+
+		assertNoError(t, store.SetPlayerScore("Paul", 40))
+		assertNoError(t, store.RenamePlayer("Paul", "Paul Atreides"))
+		assertNoError(t, store.DeletePlayer("Rand"))
+		assertNoError(t, store.ImportLeague(League{{"Whiskeyjack", 5}}))
+
+		assertError(t, store.DeletePlayer("Rand"), ErrPlayerNotFound)
+		assertError(t, store.RenamePlayer("Whiskeyjack", "Paul Atreides"), ErrPlayerExists)
+		assertError(t, store.SetPlayerScore("Paul Atreides", -1), ErrInvalidScore)
+
+		reopened, err := os.Open(database.Name())
+		assertNoError(t, err)
+		defer reopened.Close()
+
+		store, err = NewFileSystemPlayerStore(reopened)
+		assertNoError(t, err)
+
+		assertLeague(t, getLeague(t, store), []Player{
+			{"Paul Atreides", 40},
+			{"Whiskeyjack", 5},
+		})
+	})
+
+	t.Run("a failed write leaves the league as it was", func(t *testing.T) {
+		database, cleanDatabase := createTempFile(t, `[
+			{"Name": "Paul", "Wins": 10}]`)
+		defer cleanDatabase()
+
+		store, err := NewFileSystemPlayerStore(database)
+		assertNoError(t, err)
+		store.database = json.NewEncoder(&atomicTape{filepath.Join(database.Name(), "not-a-dir")})
+
+		if err := store.RecordWin("Paul"); err == nil {
+			t.Error("expected the write to fail")
+		}
+
+		assertScoreInStore(t, store, "Paul", 10)
+	})
+
 	//file_system_store_test.go
 	t.Run("league sorted", func(t *testing.T) {
 		database, cleanDatabase := createTempFile(t, `[
@@ -93,7 +143,7 @@ func TestFileSystemStore(t *testing.T) {
 
 		assertNoError(t, err)
 
-		got := store.GetLeague()
+		got := getLeague(t, store)
 
 		want := []Player{
 			{"Chris", 33},
@@ -103,12 +153,71 @@ func TestFileSystemStore(t *testing.T) {
 		assertLeague(t, got, want)
 
 		// read again
-		got = store.GetLeague()
+		got = getLeague(t, store)
 		assertLeague(t, got, want)
 	})
 
 }
 
+func TestFileSystemStoreConcurrency(t *testing.T) {
+	t.Run("records parallel wins without losing any", func(t *testing.T) {
+		database, cleanDatabase := createTempFile(t, "")
+		defer cleanDatabase()
+
+		store, err := NewFileSystemPlayerStore(database)
+		assertNoError(t, err)
+
+		players := []string{"Pepper", "Floyd", "Cleo", "Chris"}
+		winsPerPlayer := 500
+
+		var wg sync.WaitGroup
+		for i := 0; i < winsPerPlayer; i++ {
+			for _, player := range players {
+				wg.Add(1)
+				go func(name string) {
+					defer wg.Done()
+					store.RecordWin(name)
+					store.GetLeague()
+				}(player)
+			}
+		}
+		wg.Wait()
+
+		for _, player := range players {
+			assertScoreInStore(t, store, player, winsPerPlayer)
+		}
+
+		reopened, err := os.Open(database.Name())
+		assertNoError(t, err)
+		defer reopened.Close()
+
+		persisted, err := NewLeague(reopened)
+		assertNoError(t, err)
+
+		for _, player := range players {
+			got := League(persisted).Find(player)
+			if got == nil || got.Wins != winsPerPlayer {
+				t.Errorf("persisted %v for %s, want %d wins", got, player, winsPerPlayer)
+			}
+		}
+	})
+
+	t.Run("league is a copy that callers can change freely", func(t *testing.T) {
+		database, cleanDatabase := createTempFile(t, `[
+			{"Name": "Cleo", "Wins": 10},
+			{"Name": "Chris", "Wins": 33}]`)
+		defer cleanDatabase()
+
+		store, err := NewFileSystemPlayerStore(database)
+		assertNoError(t, err)
+
+		league := getLeague(t, store)
+		league[0].Wins = 0
+
+		assertScoreInStore(t, store, "Chris", 33)
+	})
+}
+
 func createTempFile(t testing.TB, initialData string) (*os.File, func()) {
 	t.Helper()
 
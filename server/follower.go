@@ -0,0 +1,347 @@
+package poker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	followerWait  = 30 * time.Second
+	followerRetry = 2 * time.Second
+)
+
+var ErrFollower = errors.New("this server is a follower, changes are made on the leader")
+
+// ReplicaPath is where a follower keeps its copy of the leader's league,
+// so it has something to serve, and less to catch up on, after a restart.
+func ReplicaPath(dbPath string) string {
+	return dbPath + ".replica"
+}
+
+// Follower is a read-only PlayerStore holding a copy of the leader's
+// league, kept up to date by tailing the leader's replication log. Until
+// it has heard from the leader, or read a copy it saved earlier, it's
+// ErrStoreUnavailable.
+type Follower struct {
+	mu      sync.RWMutex
+	leader  *url.URL
+	client  *http.Client
+	copy    *json.Encoder
+	replica replicaSnapshot
+	loaded  bool
+	// names is how the leader spells each player in the copy, by the Key
+	// of their name, kept up to date as changes arrive
+	names  map[string]string
+	stream *LeagueBroadcaster
+	wait   time.Duration
+	retry  time.Duration
+}
+
+// NewFollower follows the server at leader, keeping its copy at path.
+// Changes it hears about are published to stream, if there is one.
+func NewFollower(leader, path string, stream *LeagueBroadcaster) (*Follower, error) {
+	leaderURL, err := url.Parse(leader)
+	if err != nil || leaderURL.Scheme == "" || leaderURL.Host == "" {
+		return nil, fmt.Errorf("leader %q is not a URL like http://host:5000", leader)
+	}
+
+	f := &Follower{
+		leader: leaderURL,
+		client: &http.Client{Timeout: followerWait + 10*time.Second},
+		copy:   json.NewEncoder(&atomicTape{path}),
+		stream: stream,
+		wait:   followerWait,
+		retry:  followerRetry,
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("problem reading replica %s, %v", path, err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &f.replica); err != nil {
+			return nil, fmt.Errorf("problem reading replica %s, %v", path, err)
+		}
+		f.loaded = true
+		f.indexNames()
+	}
+	return f, nil
+}
+
+func (f *Follower) GetLeague() (League, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if !f.loaded {
+		return nil, ErrStoreUnavailable
+	}
+	return f.league(), nil
+}
+
+// GetPlayerScore finds the player in whatever case the leader stored
+// them, as the leader's CanonicalNamePlayerStore would.
+func (f *Follower) GetPlayerScore(raw string) (int, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if !f.loaded {
+		return 0, ErrStoreUnavailable
+	}
+	if player := f.replica.League.Find(raw); player != nil {
+		return player.Wins, nil
+	}
+	name, err := ParsePlayerName(raw)
+	if err != nil {
+		return 0, err
+	}
+	if player := f.replica.League.Find(f.storedName(name)); player != nil {
+		return player.Wins, nil
+	}
+	return 0, ErrPlayerNotFound
+}
+
+// StoredName is the spelling the leader knows name by, or name itself for
+// a player it hasn't seen.
+func (f *Follower) StoredName(name PlayerName) (string, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if !f.loaded {
+		return "", ErrStoreUnavailable
+	}
+	return f.storedName(name), nil
+}
+
+func (f *Follower) storedName(name PlayerName) string {
+	if stored, ok := f.names[name.Key()]; ok {
+		return stored
+	}
+	return name.String()
+}
+
+// league is the copy, most wins first. f.mu must be held.
+func (f *Follower) league() League {
+	league := f.replica.League.copy()
+	sort.SliceStable(league, func(i, j int) bool {
+		return league[i].Wins > league[j].Wins
+	})
+	return league
+}
+
+// indexNames builds names from the copy again. f.mu must be held for
+// writing.
+func (f *Follower) indexNames() {
+	f.names = indexNames(f.league())
+}
+
+func (f *Follower) RecordWin(name string) error                { return ErrFollower }
+func (f *Follower) SetPlayerScore(name string, wins int) error { return ErrFollower }
+func (f *Follower) DeletePlayer(name string) error             { return ErrFollower }
+func (f *Follower) RenamePlayer(from, to string) error         { return ErrFollower }
+func (f *Follower) ImportLeague(league League) error           { return ErrFollower }
+
+// Run keeps the copy up to date until ctx is done, waiting on the leader
+// for changes and trying again a little later when it can't be reached.
+func (f *Follower) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		if err := f.sync(ctx, f.wait); err != nil && ctx.Err() == nil {
+			select {
+			case <-time.After(f.retry):
+			case <-ctx.Done():
+			}
+		}
+	}
+}
+
+// Sync catches up with the leader once, without waiting for new changes.
+func (f *Follower) Sync(ctx context.Context) error {
+	return f.sync(ctx, 0)
+}
+
+func (f *Follower) sync(ctx context.Context, wait time.Duration) error {
+	f.mu.RLock()
+	log, seq, loaded := f.replica.Log, f.replica.Seq, f.loaded
+	f.mu.RUnlock()
+
+	if !loaded || log == "" {
+		return f.restart(ctx)
+	}
+
+	query := url.Values{"log": {log}, "after": {strconv.FormatInt(seq, 10)}}
+	if wait > 0 {
+		query.Set("wait", wait.String())
+	}
+	var events []LeagueEvent
+	err := f.get(ctx, "/replication/log?"+query.Encode(), &events)
+	if errors.Is(err, ErrReplicationGone) {
+		return f.restart(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	return f.apply(events)
+}
+
+// restart replaces the copy with the whole league from the leader.
+func (f *Follower) restart(ctx context.Context) error {
+	var snapshot replicaSnapshot
+	if err := f.get(ctx, "/replication/snapshot", &snapshot); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// a sync that finished while this one was waiting may already be
+	// further on in the same log
+	if f.loaded && snapshot.Log == f.replica.Log && snapshot.Seq <= f.replica.Seq {
+		return nil
+	}
+	f.replica, f.loaded = snapshot, true
+	f.indexNames()
+	f.publish("")
+	return f.save()
+}
+
+func (f *Follower) apply(events []LeagueEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var winner string
+	applied, reindex := false, false
+	for _, event := range events {
+		// syncs can overlap, so changes already applied by another are
+		// passed over
+		if event.Seq != f.replica.Seq+1 {
+			continue
+		}
+		f.replica.League.apply(event)
+		f.replica.Seq = event.Seq
+		applied = true
+		if event.Kind == EventWin {
+			winner = event.Player
+		} else {
+			winner = ""
+		}
+
+		switch event.Kind {
+		case EventDelete, EventRename:
+			// rare enough to look at the whole league again
+			reindex = true
+		default:
+			if key := nameKey(event.Player); f.names[key] == "" {
+				f.names[key] = event.Player
+			}
+		}
+	}
+	if !applied {
+		return nil
+	}
+	if reindex {
+		f.indexNames()
+	}
+	f.publish(winner)
+	return f.save()
+}
+
+func (f *Follower) publish(winner string) {
+	if f.stream == nil || f.stream.Subscribers() == 0 {
+		return
+	}
+	f.stream.Publish(winner, f.league())
+}
+
+func (f *Follower) save() error {
+	if err := f.copy.Encode(f.replica); err != nil {
+		return fmt.Errorf("problem saving replica, %v", err)
+	}
+	return nil
+}
+
+func (f *Follower) get(ctx context.Context, path string, into interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(f.leader.String(), "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	response, err := f.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("problem reaching the leader, %v", err)
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusGone:
+		return ErrReplicationGone
+	default:
+		return fmt.Errorf("leader answered %s with %s", path, response.Status)
+	}
+	if err := json.NewDecoder(response.Body).Decode(into); err != nil {
+		return fmt.Errorf("problem reading %s from the leader, %v", path, err)
+	}
+	return nil
+}
+
+// WithLeader makes the server one of follower's: changes are forwarded to
+// the leader, and everything else is answered from follower's copy, which
+// should be the store the server was made with. Only the default league
+// is replicated, so reads that need ratings, history or other leagues are
+// forwarded to the leader too.
+func WithLeader(follower *Follower) PlayerServerOption {
+	return func(p *PlayerServer) {
+		p.follower = follower
+	}
+}
+
+// forwardToLeader sends requests that would change the league, and reads
+// only the leader can answer, to the leader. Once a change has worked the
+// follower catches up before answering, so a client that reads straight
+// after sees its own change.
+func forwardToLeader(follower *Follower, next http.Handler) http.Handler {
+	proxy := httputil.NewSingleHostReverseProxy(follower.leader)
+	proxy.ModifyResponse = func(response *http.Response) error {
+		if response.StatusCode < http.StatusMultipleChoices && !isReadOnly(response.Request) {
+			// if this fails the copy is only behind until Run catches up
+			follower.Sync(response.Request.Context())
+		}
+		return nil
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		writeProblem(w, r, http.StatusBadGateway, "the leader could not be reached")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isReadOnly(r) && !leaderOnly(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	})
+}
+
+// leaderOnly is whether r reads something a follower doesn't keep a copy
+// of: ratings, win history or leagues other than the default one.
+func leaderOnly(r *http.Request) bool {
+	path := r.URL.EscapedPath()
+	if path == "/leagues" || strings.HasPrefix(path, "/leagues/") {
+		return true
+	}
+	if player, ok := strings.CutPrefix(path, "/players/"); ok {
+		if strings.HasSuffix(player, ratingSuffix) || strings.HasSuffix(player, historySuffix) {
+			return true
+		}
+	}
+	query, err := ParseLeagueQuery(r.URL.Query())
+	return err == nil && (query.Sort == SortByRating || query.Windowed())
+}
@@ -0,0 +1,69 @@
+package poker
+
+import (
+	"io"
+	"time"
+)
+
+type Game interface {
+	// Start sends the blind alerts to alertsDestination as they come due,
+	// or sends none when it is nil. It returns the schedule and a func that
+	// cancels the alerts still to come.
+	Start(numberOfPlayers int, alertsDestination io.Writer) ([]Blind, func())
+	Finish(winner string) error
+}
+
+type Blind struct {
+	At     time.Duration
+	Amount int
+}
+
+type TexasHoldem struct {
+	alerter BlindAlerter
+	store   PlayerStore
+}
+
+var blindAmounts = []int{100, 200, 300, 400, 500, 600, 800, 1000, 2000, 4000, 8000}
+
+func NewTexasHoldem(alerter BlindAlerter, store PlayerStore) *TexasHoldem {
+	return &TexasHoldem{
+		alerter: alerter,
+		store:   store,
+	}
+}
+
+func BlindSchedule(numberOfPlayers int) []Blind {
+	blindIncrement := time.Duration(5+numberOfPlayers) * time.Minute
+
+	schedule := make([]Blind, len(blindAmounts))
+	blindTime := 0 * time.Second
+	for i, amount := range blindAmounts {
+		schedule[i] = Blind{blindTime, amount}
+		blindTime = blindTime + blindIncrement
+	}
+	return schedule
+}
+
+func (p *TexasHoldem) Start(numberOfPlayers int, alertsDestination io.Writer) ([]Blind, func()) {
+	schedule := BlindSchedule(numberOfPlayers)
+	if alertsDestination == nil {
+		return schedule, func() {}
+	}
+
+	stops := make([]func(), len(schedule))
+	for i, blind := range schedule {
+		stops[i] = p.alerter.ScheduleAlertAt(blind.At, blind.Amount, alertsDestination)
+	}
+	return schedule, func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}
+}
+
+func (p *TexasHoldem) Finish(winner string) error {
+	if winner == "" {
+		return ErrEmptyName
+	}
+	return p.store.RecordWin(winner)
+}
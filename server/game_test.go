@@ -0,0 +1,401 @@
+package poker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type scheduledAlert struct {
+	At     time.Duration
+	Amount int
+}
+
+func (s scheduledAlert) String() string {
+	return fmt.Sprintf("%d chips at %v", s.Amount, s.At)
+}
+
+type SpyBlindAlerter struct {
+	alerts  []scheduledAlert
+	stopped int
+}
+
+func (s *SpyBlindAlerter) ScheduleAlertAt(at time.Duration, amount int, to io.Writer) func() {
+	s.alerts = append(s.alerts, scheduledAlert{at, amount})
+	return func() { s.stopped++ }
+}
+
+type GameSpy struct {
+	StartCalled     bool
+	StartCalledWith int
+
+	FinishCalled     bool
+	FinishCalledWith string
+
+	BlindAlert []byte
+
+	stopped int32
+}
+
+func (g *GameSpy) Start(numberOfPlayers int, alertsDestination io.Writer) ([]Blind, func()) {
+	g.StartCalled = true
+	g.StartCalledWith = numberOfPlayers
+	if alertsDestination != nil {
+		alertsDestination.Write(g.BlindAlert)
+	}
+	return BlindSchedule(numberOfPlayers), func() { atomic.StoreInt32(&g.stopped, 1) }
+}
+
+// Stopped is whether the alerts of the game were cancelled. The websocket
+// handler cancels them on its own goroutine, hence the atomic.
+func (g *GameSpy) Stopped() bool {
+	return atomic.LoadInt32(&g.stopped) == 1
+}
+
+func (g *GameSpy) Finish(winner string) error {
+	g.FinishCalled = true
+	g.FinishCalledWith = winner
+	return nil
+}
+
+var dummyGame = &GameSpy{}
+
+func TestGame_Start(t *testing.T) {
+	t.Run("schedules alerts on game start for 5 players", func(t *testing.T) {
+		blindAlerter := &SpyBlindAlerter{}
+		game := NewTexasHoldem(blindAlerter, &StubPlayerStore{})
+
+		game.Start(5, ioutil.Discard)
+
+		cases := []scheduledAlert{
+			{At: 0 * time.Second, Amount: 100},
+			{At: 10 * time.Minute, Amount: 200},
+			{At: 20 * time.Minute, Amount: 300},
+			{At: 30 * time.Minute, Amount: 400},
+			{At: 40 * time.Minute, Amount: 500},
+			{At: 50 * time.Minute, Amount: 600},
+			{At: 60 * time.Minute, Amount: 800},
+			{At: 70 * time.Minute, Amount: 1000},
+			{At: 80 * time.Minute, Amount: 2000},
+			{At: 90 * time.Minute, Amount: 4000},
+			{At: 100 * time.Minute, Amount: 8000},
+		}
+
+		checkSchedulingCases(t, cases, blindAlerter)
+	})
+
+	t.Run("schedules alerts on game start for 7 players", func(t *testing.T) {
+		blindAlerter := &SpyBlindAlerter{}
+		game := NewTexasHoldem(blindAlerter, &StubPlayerStore{})
+
+		game.Start(7, ioutil.Discard)
+
+		cases := []scheduledAlert{
+			{At: 0 * time.Second, Amount: 100},
+			{At: 12 * time.Minute, Amount: 200},
+			{At: 24 * time.Minute, Amount: 300},
+			{At: 36 * time.Minute, Amount: 400},
+		}
+
+		checkSchedulingCases(t, cases, blindAlerter)
+	})
+
+	t.Run("returns the schedule it set up", func(t *testing.T) {
+		game := NewTexasHoldem(&SpyBlindAlerter{}, &StubPlayerStore{})
+
+		got, _ := game.Start(5, ioutil.Discard)
+
+		if !reflect.DeepEqual(got, BlindSchedule(5)) {
+			t.Errorf("got %v want %v", got, BlindSchedule(5))
+		}
+	})
+
+	t.Run("schedules no alerts when there is nowhere to send them", func(t *testing.T) {
+		blindAlerter := &SpyBlindAlerter{}
+		game := NewTexasHoldem(blindAlerter, &StubPlayerStore{})
+
+		got, stop := game.Start(5, nil)
+		stop()
+
+		if len(blindAlerter.alerts) != 0 {
+			t.Errorf("got alerts %v, want none", blindAlerter.alerts)
+		}
+		if !reflect.DeepEqual(got, BlindSchedule(5)) {
+			t.Errorf("got %v want %v", got, BlindSchedule(5))
+		}
+	})
+
+	t.Run("stopping the game cancels every alert", func(t *testing.T) {
+		blindAlerter := &SpyBlindAlerter{}
+		game := NewTexasHoldem(blindAlerter, &StubPlayerStore{})
+
+		_, stop := game.Start(5, ioutil.Discard)
+		stop()
+
+		if blindAlerter.stopped != len(blindAlerter.alerts) {
+			t.Errorf("stopped %d of %d alerts", blindAlerter.stopped, len(blindAlerter.alerts))
+		}
+	})
+}
+
+func TestGame_Finish(t *testing.T) {
+	t.Run("records a win for the winner", func(t *testing.T) {
+		store := &StubPlayerStore{}
+		game := NewTexasHoldem(&SpyBlindAlerter{}, store)
+		winner := "Ruth"
+
+		assertNoError(t, game.Finish(winner))
+
+		assertPlayerWin(t, store, winner)
+	})
+
+	t.Run("passes on store failures", func(t *testing.T) {
+		game := NewTexasHoldem(&SpyBlindAlerter{}, &FailingPlayerStore{err: ErrStoreUnavailable})
+
+		assertError(t, game.Finish("Ruth"), ErrStoreUnavailable)
+	})
+
+	t.Run("refuses an empty winner", func(t *testing.T) {
+		store := &StubPlayerStore{}
+		game := NewTexasHoldem(&SpyBlindAlerter{}, store)
+
+		assertError(t, game.Finish(""), ErrEmptyName)
+		if len(store.winCalls) != 0 {
+			t.Errorf("expected no wins to be recorded, got %v", store.winCalls)
+		}
+	})
+}
+
+func TestAlerter(t *testing.T) {
+	t.Run("sends the alert when it is due", func(t *testing.T) {
+		out := &syncBuffer{}
+
+		Alerter(time.Millisecond, 100, out)
+
+		deadline := time.Now().Add(time.Second)
+		for out.String() == "" && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+
+		assertResponseBody(t, out.String(), "Blind is now 100\n")
+	})
+
+	t.Run("a stopped alert never goes off", func(t *testing.T) {
+		out := &syncBuffer{}
+
+		stop := Alerter(10*time.Millisecond, 100, out)
+		stop()
+		time.Sleep(50 * time.Millisecond)
+
+		assertResponseBody(t, out.String(), "")
+	})
+}
+
+func TestGameOverHTTP(t *testing.T) {
+	t.Run("POST /game starts a game and returns the blind schedule", func(t *testing.T) {
+		game := &GameSpy{}
+		server := NewPlayerServer(&StubPlayerStore{}, game)
+
+		request, _ := http.NewRequest(http.MethodPost, "/game", strings.NewReader(`{"Players": 5}`))
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusCreated)
+		assertContentType(t, response.Result().Header.Get("content-type"))
+		if game.StartCalledWith != 5 {
+			t.Errorf("wanted Start called with 5 but got %d", game.StartCalledWith)
+		}
+
+		var got startGameResponse
+		decodeJSON(t, response.Body, &got)
+		if !reflect.DeepEqual(got.Blinds, BlindSchedule(5)) {
+			t.Errorf("got schedule %v want %v", got.Blinds, BlindSchedule(5))
+		}
+	})
+
+	t.Run("POST /game rejects a bad number of players", func(t *testing.T) {
+		game := &GameSpy{}
+		server := NewPlayerServer(&StubPlayerStore{}, game)
+
+		for _, body := range []string{`{"Players": 0}`, `{"Players": "Pies"}`, ``} {
+			request, _ := http.NewRequest(http.MethodPost, "/game", strings.NewReader(body))
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, http.StatusBadRequest)
+		}
+		if game.StartCalled {
+			t.Error("game should not have started")
+		}
+	})
+
+	t.Run("POST /game/winner finishes the game", func(t *testing.T) {
+		game := &GameSpy{}
+		server := NewPlayerServer(&StubPlayerStore{}, game)
+		id := startHTTPGame(t, server, 3)
+
+		response := finishHTTPGame(server, id, "Ruth")
+
+		assertStatus(t, response.Code, http.StatusAccepted)
+		if game.FinishCalledWith != "Ruth" {
+			t.Errorf("expected finish called with 'Ruth' but got %q", game.FinishCalledWith)
+		}
+	})
+
+	t.Run("POST /game/winner needs a game that was started", func(t *testing.T) {
+		game := &GameSpy{}
+		server := NewPlayerServer(&StubPlayerStore{}, game)
+
+		request, _ := http.NewRequest(http.MethodPost, "/game/winner", strings.NewReader(`{"Winner": "Ruth"}`))
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertProblem(t, response, http.StatusBadRequest, "/game/winner")
+
+		response = finishHTTPGame(server, "not-a-game", "Ruth")
+		assertProblem(t, response, http.StatusNotFound, "/game/winner")
+
+		assertGameNotFinished(t, game)
+	})
+
+	t.Run("a game only has one winner", func(t *testing.T) {
+		store := &StubPlayerStore{}
+		server := NewPlayerServer(store, NewTexasHoldem(&SpyBlindAlerter{}, store))
+		id := startHTTPGame(t, server, 3)
+
+		assertStatus(t, finishHTTPGame(server, id, "Ruth").Code, http.StatusAccepted)
+		assertStatus(t, finishHTTPGame(server, id, "Ruth").Code, http.StatusNotFound)
+
+		if len(store.winCalls) != 1 {
+			t.Errorf("got wins %v, want one", store.winCalls)
+		}
+	})
+
+	t.Run("a game stays open when its winner can't be recorded", func(t *testing.T) {
+		store := &FailingPlayerStore{err: ErrStoreUnavailable}
+		server := NewPlayerServer(store, NewTexasHoldem(&SpyBlindAlerter{}, store))
+		id := startHTTPGame(t, server, 3)
+
+		assertStatus(t, finishHTTPGame(server, id, "Ruth").Code, http.StatusServiceUnavailable)
+
+		store.err = nil
+		assertStatus(t, finishHTTPGame(server, id, "Ruth").Code, http.StatusAccepted)
+	})
+
+	t.Run("GET /game returns the game page", func(t *testing.T) {
+		server := NewPlayerServer(&StubPlayerStore{}, &GameSpy{})
+
+		request, _ := http.NewRequest(http.MethodGet, "/game", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		if !strings.Contains(response.Body.String(), "/ws") {
+			t.Error("expected the game page to connect to /ws")
+		}
+	})
+
+	t.Run("PUT /game is not allowed", func(t *testing.T) {
+		server := NewPlayerServer(&StubPlayerStore{}, &GameSpy{})
+
+		request, _ := http.NewRequest(http.MethodPut, "/game", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusMethodNotAllowed)
+	})
+}
+
+func checkSchedulingCases(t *testing.T, cases []scheduledAlert, blindAlerter *SpyBlindAlerter) {
+	t.Helper()
+	for i, want := range cases {
+		t.Run(fmt.Sprint(want), func(t *testing.T) {
+			if len(blindAlerter.alerts) <= i {
+				t.Fatalf("alert %d was not scheduled %v", i, blindAlerter.alerts)
+			}
+
+			got := blindAlerter.alerts[i]
+			assertScheduledAlert(t, got, want)
+		})
+	}
+}
+
+func assertScheduledAlert(t testing.TB, got, want scheduledAlert) {
+	t.Helper()
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func assertPlayerWin(t testing.TB, store *StubPlayerStore, winner string) {
+	t.Helper()
+
+	if len(store.winCalls) != 1 {
+		t.Fatalf("got %d calls to RecordWin want %d", len(store.winCalls), 1)
+	}
+
+	if store.winCalls[0] != winner {
+		t.Errorf("did not store correct winner got %q want %q", store.winCalls[0], winner)
+	}
+}
+
+// startHTTPGame starts a game with POST /game and returns its ID.
+func startHTTPGame(t testing.TB, server http.Handler, numberOfPlayers int) string {
+	t.Helper()
+	request, _ := http.NewRequest(http.MethodPost, "/game", strings.NewReader(fmt.Sprintf(`{"Players": %d}`, numberOfPlayers)))
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+	assertStatus(t, response.Code, http.StatusCreated)
+
+	var got startGameResponse
+	decodeJSON(t, response.Body, &got)
+	if got.Game == "" {
+		t.Fatal("POST /game gave no game ID")
+	}
+	return got.Game
+}
+
+func finishHTTPGame(server http.Handler, id, winner string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(finishGameRequest{Game: id, Winner: winner})
+	request, _ := http.NewRequest(http.MethodPost, "/game/winner", bytes.NewReader(body))
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+	return response
+}
+
+func decodeJSON(t testing.TB, body io.Reader, into interface{}) {
+	t.Helper()
+	if err := json.NewDecoder(body).Decode(into); err != nil {
+		t.Fatalf("unable to parse response from server %q, %v", body, err)
+	}
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.String()
+}
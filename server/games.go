@@ -0,0 +1,92 @@
+package poker
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const (
+	openGameTTL  = 24 * time.Hour
+	maxOpenGames = 10000
+)
+
+// openGames are the games started over plain HTTP that haven't had a
+// winner yet, so POST /game/winner can only finish a game that was really
+// started, and only once. Games that are never finished are forgotten
+// after a day.
+type openGames struct {
+	mu    sync.Mutex
+	games map[string]openGame
+	now   func() time.Time
+}
+
+type openGame struct {
+	players int
+	at      time.Time
+}
+
+func newOpenGames() *openGames {
+	return &openGames{
+		games: map[string]openGame{},
+		now:   time.Now,
+	}
+}
+
+// start records a game of numberOfPlayers and returns its ID.
+func (g *openGames) start(numberOfPlayers int) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	if len(g.games) >= maxOpenGames {
+		g.evict(now)
+	}
+	g.games[hex.EncodeToString(id)] = openGame{players: numberOfPlayers, at: now}
+	return hex.EncodeToString(id), nil
+}
+
+// finish takes the game with id out of the open games.
+func (g *openGames) finish(id string) (openGame, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	game, ok := g.games[id]
+	if !ok || g.now().Sub(game.at) >= openGameTTL {
+		delete(g.games, id)
+		return openGame{}, false
+	}
+	delete(g.games, id)
+	return game, true
+}
+
+// reopen puts back a game whose winner could not be recorded, so the
+// client can try again.
+func (g *openGames) reopen(id string, game openGame) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.games[id] = game
+}
+
+func (g *openGames) evict(now time.Time) {
+	var oldestID string
+	var oldest time.Time
+	for id, game := range g.games {
+		if now.Sub(game.at) >= openGameTTL {
+			delete(g.games, id)
+			continue
+		}
+		if oldest.IsZero() || game.at.Before(oldest) {
+			oldestID, oldest = id, game.at
+		}
+	}
+	if len(g.games) >= maxOpenGames && oldestID != "" {
+		delete(g.games, oldestID)
+	}
+}
@@ -0,0 +1,230 @@
+package poker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HistoryPath is where the time of every win for the league at dbPath is
+// kept.
+func HistoryPath(dbPath string) string {
+	return dbPath + ".history.log"
+}
+
+type WinHistory interface {
+	GetHistory(name string) ([]time.Time, error)
+	GetLeagueBetween(since, until time.Time) (League, error)
+}
+
+type historyEntry struct {
+	Player    string    `json:"player"`
+	Time      time.Time `json:"time"`
+	RenamedTo string    `json:"renamed_to,omitempty"`
+	Deleted   bool      `json:"deleted,omitempty"`
+}
+
+// HistoryPlayerStore wraps another PlayerStore and writes down when each
+// win happened, one JSON line per win, so leagues can be worked out for any
+// stretch of time. Renames and deletes are logged too so the history keeps
+// following the league. Scores set by hand or imported have no dates, so
+// they only ever show up in the all-time league.
+type HistoryPlayerStore struct {
+	PlayerStore
+
+	mu     sync.RWMutex
+	log    *os.File
+	wins   map[string][]time.Time
+	closed bool
+	now    func() time.Time
+}
+
+func NewHistoryPlayerStore(store PlayerStore, path string) (*HistoryPlayerStore, error) {
+	log, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("problem opening win history %s, %v", path, err)
+	}
+
+	history := &HistoryPlayerStore{
+		PlayerStore: store,
+		log:         log,
+		wins:        map[string][]time.Time{},
+		now:         time.Now,
+	}
+
+	if err := history.replay(); err != nil {
+		log.Close()
+		return nil, fmt.Errorf("problem replaying win history %s, %v", path, err)
+	}
+	return history, nil
+}
+
+func (h *HistoryPlayerStore) replay() error {
+	reader := bufio.NewReader(h.log)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// a trailing line without a newline is a write that never
+			// finished
+			if len(line) > 0 {
+				return h.log.Truncate(offset)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var entry historyEntry
+		if err := json.Unmarshal(bytes.TrimSpace(line), &entry); err != nil {
+			return fmt.Errorf("bad entry at offset %d, %v", offset, err)
+		}
+		offset += int64(len(line))
+		h.apply(entry)
+	}
+}
+
+func (h *HistoryPlayerStore) apply(entry historyEntry) {
+	switch {
+	case entry.Deleted:
+		delete(h.wins, entry.Player)
+	case entry.RenamedTo != "":
+		// a rename onto a player who's already there is a merge
+		if wins, ok := h.wins[entry.Player]; ok {
+			delete(h.wins, entry.Player)
+			merged := append(h.wins[entry.RenamedTo], wins...)
+			sort.Slice(merged, func(i, j int) bool { return merged[i].Before(merged[j]) })
+			h.wins[entry.RenamedTo] = merged
+		}
+	default:
+		h.wins[entry.Player] = append(h.wins[entry.Player], entry.Time)
+	}
+}
+
+func (h *HistoryPlayerStore) append(entry historyEntry) error {
+	if h.closed {
+		return ErrStoreUnavailable
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := h.log.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("problem appending to win history, %v", err)
+	}
+	h.apply(entry)
+	return nil
+}
+
+func (h *HistoryPlayerStore) RecordWin(name string) error {
+	if name == "" {
+		return ErrEmptyName
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// only written down once the store has it, so the history never has a
+	// win the league doesn't
+	if err := h.PlayerStore.RecordWin(name); err != nil {
+		return err
+	}
+	return h.append(historyEntry{Player: name, Time: h.now().UTC()})
+}
+
+func (h *HistoryPlayerStore) DeletePlayer(name string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.PlayerStore.DeletePlayer(name); err != nil {
+		return err
+	}
+	return h.append(historyEntry{Player: name, Deleted: true, Time: h.now().UTC()})
+}
+
+func (h *HistoryPlayerStore) RenamePlayer(from, to string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.PlayerStore.RenamePlayer(from, to); err != nil {
+		return err
+	}
+	if from == to {
+		return nil
+	}
+	return h.append(historyEntry{Player: from, RenamedTo: to, Time: h.now().UTC()})
+}
+
+// MergePlayer removes from, whose wins are already counted in into, and
+// gives their history to into.
+func (h *HistoryPlayerStore) MergePlayer(from, into string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := mergePlayer(h.PlayerStore, from, into); err != nil {
+		return err
+	}
+	return h.append(historyEntry{Player: from, RenamedTo: into, Time: h.now().UTC()})
+}
+
+// GetHistory returns when name won, oldest first.
+func (h *HistoryPlayerStore) GetHistory(name string) ([]time.Time, error) {
+	if _, err := h.PlayerStore.GetPlayerScore(name); err != nil {
+		return nil, err
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	wins := make([]time.Time, len(h.wins[name]))
+	copy(wins, h.wins[name])
+	return wins, nil
+}
+
+// GetLeagueBetween counts the wins from since up to but not including
+// until. A zero since or until leaves that end open.
+func (h *HistoryPlayerStore) GetLeagueBetween(since, until time.Time) (League, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	league := League{}
+	for name, wins := range h.wins {
+		count := 0
+		for _, at := range wins {
+			if inWindow(at, since, until) {
+				count++
+			}
+		}
+		if count > 0 {
+			league = append(league, Player{name, count})
+		}
+	}
+
+	sort.Slice(league, func(i, j int) bool {
+		if league[i].Wins != league[j].Wins {
+			return league[i].Wins > league[j].Wins
+		}
+		return league[i].Name < league[j].Name
+	})
+	return league, nil
+}
+
+func inWindow(at, since, until time.Time) bool {
+	return (since.IsZero() || !at.Before(since)) && (until.IsZero() || at.Before(until))
+}
+
+func (h *HistoryPlayerStore) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	return h.log.Close()
+}
@@ -0,0 +1,237 @@
+package poker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	at time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.at
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.at = c.at.Add(d)
+}
+
+// a Wednesday
+var historyStart = time.Date(2021, time.March, 17, 12, 0, 0, 0, time.UTC)
+
+func TestHistoryPlayerStore(t *testing.T) {
+	t.Run("dates every win and passes it on", func(t *testing.T) {
+		players := newFileSystemStore(t)
+		store, clock := newHistoryStore(t, players, filepath.Join(t.TempDir(), "history.log"))
+		defer store.Close()
+
+		store.RecordWin("Chris")
+		clock.Advance(time.Hour)
+		store.RecordWin("Chris")
+
+		assertScoreInStore(t, players, "Chris", 2)
+		assertHistory(t, store, "Chris", historyStart, historyStart.Add(time.Hour))
+	})
+
+	t.Run("a win the store refuses is not dated", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "history.log")
+		store, _ := newHistoryStore(t, &FailingPlayerStore{err: ErrStoreUnavailable}, path)
+		defer store.Close()
+
+		assertError(t, store.RecordWin("Chris"), ErrStoreUnavailable)
+
+		if league, _ := store.GetLeagueBetween(time.Time{}, time.Time{}); len(league) != 0 {
+			t.Errorf("got %v, want no dated wins", league)
+		}
+		if lines := readLines(t, path); len(lines) != 0 {
+			t.Errorf("got history %v, want none", lines)
+		}
+	})
+
+	t.Run("history survives a restart", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "history.log")
+		players := newFileSystemStore(t)
+		store, _ := newHistoryStore(t, players, path)
+		store.RecordWin("Chris")
+		store.Close()
+
+		store, _ = newHistoryStore(t, players, path)
+		defer store.Close()
+		assertHistory(t, store, "Chris", historyStart)
+	})
+
+	t.Run("follows renames and deletes", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "history.log")
+		players := newFileSystemStore(t)
+		store, _ := newHistoryStore(t, players, path)
+		store.RecordWin("Chris")
+		store.RecordWin("Cleo")
+		assertNoError(t, store.RenamePlayer("Chris", "Christopher"))
+		assertNoError(t, store.DeletePlayer("Cleo"))
+		store.Close()
+
+		store, _ = newHistoryStore(t, players, path)
+		defer store.Close()
+		assertHistory(t, store, "Christopher", historyStart)
+
+		league, err := store.GetLeagueBetween(time.Time{}, time.Time{})
+		assertNoError(t, err)
+		assertLeague(t, league, League{{"Christopher", 1}})
+	})
+
+	t.Run("unknown players have no history", func(t *testing.T) {
+		store, _ := newHistoryStore(t, newFileSystemStore(t), filepath.Join(t.TempDir(), "history.log"))
+		defer store.Close()
+
+		_, err := store.GetHistory("Nobody")
+		assertError(t, err, ErrPlayerNotFound)
+	})
+
+	t.Run("counts wins in a window", func(t *testing.T) {
+		store, clock := newHistoryStore(t, newFileSystemStore(t), filepath.Join(t.TempDir(), "history.log"))
+		defer store.Close()
+
+		store.RecordWin("Chris")
+		clock.Advance(24 * time.Hour)
+		store.RecordWin("Cleo")
+		store.RecordWin("Cleo")
+		clock.Advance(24 * time.Hour)
+		store.RecordWin("Chris")
+
+		since := historyStart.Add(time.Hour)
+		until := historyStart.Add(48 * time.Hour)
+		league, err := store.GetLeagueBetween(since, until)
+		assertNoError(t, err)
+		assertLeague(t, league, League{{"Cleo", 2}})
+
+		league, _ = store.GetLeagueBetween(since, time.Time{})
+		assertLeague(t, league, League{{"Cleo", 2}, {"Chris", 1}})
+	})
+}
+
+func TestHistoryOverHTTP(t *testing.T) {
+	newServer := func(t *testing.T) (*PlayerServer, *fakeClock) {
+		store, clock := newHistoryStore(t, newFileSystemStore(t), filepath.Join(t.TempDir(), "history.log"))
+		t.Cleanup(func() { store.Close() })
+
+		// Chris won last month, Cleo last week and Pepper this week
+		clock.at = historyStart.AddDate(0, -1, 0)
+		store.RecordWin("Chris")
+		clock.at = historyStart.AddDate(0, 0, -7)
+		store.RecordWin("Cleo")
+		clock.at = historyStart
+		store.RecordWin("Pepper")
+
+		return NewPlayerServer(store, dummyGame, WithHistory(store), WithClock(clock.Now)), clock
+	}
+
+	get := func(server *PlayerServer, target string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(http.MethodGet, target, nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		return response
+	}
+
+	cases := []struct {
+		target string
+		want   League
+	}{
+		{"/league?period=week", League{{"Pepper", 1}}},
+		{"/league?period=month", League{{"Cleo", 1}, {"Pepper", 1}}},
+		{"/league?period=season", League{{"Chris", 1}, {"Cleo", 1}, {"Pepper", 1}}},
+		{"/league?since=2021-03-01", League{{"Cleo", 1}, {"Pepper", 1}}},
+		{"/league?since=2021-03-01&until=2021-03-15", League{{"Cleo", 1}}},
+		{"/league?until=2021-03-10T12:00:01Z&sort=name", League{{"Chris", 1}, {"Cleo", 1}}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.target, func(t *testing.T) {
+			server, _ := newServer(t)
+
+			response := get(server, c.target)
+
+			assertStatus(t, response.Code, http.StatusOK)
+			assertLeague(t, getLeagueFromResponse(t, response.Body), c.want)
+		})
+	}
+
+	t.Run("the clock decides which week it is", func(t *testing.T) {
+		server, clock := newServer(t)
+		clock.Advance(7 * 24 * time.Hour)
+
+		response := get(server, "/league?period=week")
+
+		assertLeague(t, getLeagueFromResponse(t, response.Body), League{})
+	})
+
+	t.Run("GET /players/{name}/history", func(t *testing.T) {
+		server, _ := newServer(t)
+
+		response := get(server, "/players/Cleo/history")
+
+		assertStatus(t, response.Code, http.StatusOK)
+		var got playerHistory
+		decodeJSON(t, response.Body, &got)
+		if got.Name != "Cleo" || len(got.Wins) != 1 || !got.Wins[0].Equal(historyStart.AddDate(0, 0, -7)) {
+			t.Errorf("got %+v, want Cleo's win a week ago", got)
+		}
+	})
+
+	t.Run("history can be windowed too", func(t *testing.T) {
+		server, _ := newServer(t)
+
+		response := get(server, "/players/Cleo/history?period=week")
+
+		var got playerHistory
+		decodeJSON(t, response.Body, &got)
+		if len(got.Wins) != 0 {
+			t.Errorf("got %v, want no wins this week", got.Wins)
+		}
+	})
+
+	t.Run("windows need history", func(t *testing.T) {
+		server := NewPlayerServer(&StubPlayerStore{}, dummyGame)
+
+		assertProblem(t, get(server, "/league?period=week"), http.StatusBadRequest, "/league")
+		assertProblem(t, get(server, "/players/Cleo/history"), http.StatusNotFound, "/players/Cleo/history")
+	})
+}
+
+func newHistoryStore(t testing.TB, store PlayerStore, path string) (*HistoryPlayerStore, *fakeClock) {
+	t.Helper()
+	history, err := NewHistoryPlayerStore(store, path)
+	assertNoError(t, err)
+
+	clock := &fakeClock{historyStart}
+	history.now = clock.Now
+	return history, clock
+}
+
+func newFileSystemStore(t testing.TB) *FileSystemPlayerStore {
+	t.Helper()
+	database, cleanDatabase := createTempFile(t, `[]`)
+	t.Cleanup(cleanDatabase)
+
+	store, err := NewFileSystemPlayerStore(database)
+	assertNoError(t, err)
+	return store
+}
+
+func assertHistory(t testing.TB, store WinHistory, name string, want ...time.Time) {
+	t.Helper()
+	got, err := store.GetHistory(name)
+	assertNoError(t, err)
+
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if !got[i].Equal(want[i]) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+}
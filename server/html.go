@@ -0,0 +1,167 @@
+package poker
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed templates static
+var assets embed.FS
+
+const recentWins = 10
+
+var pageFuncs = template.FuncMap{
+	"rank": func(offset, i int) int {
+		return offset + i + 1
+	},
+	"playerURL": func(players, name string) string {
+		return players + url.PathEscape(name)
+	},
+}
+
+var (
+	leagueTemplate = parsePage("templates/league.html")
+	playerTemplate = parsePage("templates/player.html")
+)
+
+func parsePage(page string) *template.Template {
+	return template.Must(template.New("layout").Funcs(pageFuncs).ParseFS(assets, "templates/layout.html", page))
+}
+
+type leagueView struct {
+	// Name is empty for the default league
+	Name        string
+	PlayersPath string
+	Players     []RatedPlayer
+	Rated       bool
+	Offset      int
+	Total       int
+}
+
+func newLeagueView(r *http.Request, query LeagueQuery, page interface{}, total int) leagueView {
+	view := leagueView{PlayersPath: playersPath(r), Offset: query.Offset, Total: total}
+	if scope, ok := scopeFor(r); ok && scope.name != DefaultLeague {
+		view.Name = scope.name
+	}
+	switch page := page.(type) {
+	case []RatedPlayer:
+		view.Players, view.Rated = page, true
+	case League:
+		for _, player := range page {
+			view.Players = append(view.Players, RatedPlayer{Name: player.Name, Wins: player.Wins})
+		}
+	}
+	return view
+}
+
+type playerView struct {
+	Name       string
+	Wins       int
+	Rating     *Rating
+	RecentWins []time.Time
+}
+
+// renderPage renders into a buffer first, so a template that fails half way
+// through is a 500 rather than half a page.
+func renderPage(w http.ResponseWriter, r *http.Request, page *template.Template, data interface{}) {
+	var buf bytes.Buffer
+	if err := page.ExecuteTemplate(&buf, "layout", data); err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, "could not render the page")
+		return
+	}
+	w.Header().Set("content-type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	buf.WriteTo(w)
+}
+
+func (p *PlayerServer) homeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		methodNotAllowed(w, r, http.MethodGet, http.MethodHead)
+		return
+	}
+
+	league, err := p.store.GetLeague()
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	renderPage(w, r, leagueTemplate, newLeagueView(r, LeagueQuery{}, league, len(league)))
+}
+
+func (p *PlayerServer) showPlayerPage(w http.ResponseWriter, r *http.Request, player PlayerName, wins int) {
+	name, err := resolvePlayerName(p.storeFor(r), player)
+	if err != nil {
+		name = player.String()
+	}
+	view := playerView{Name: name, Wins: wins}
+
+	// ratings and history are extras; a player page without them is still
+	// worth showing
+	if results := p.resultsFor(r); results != nil {
+		if rating, err := results.GetRating(name); err == nil {
+			view.Rating = &rating
+		}
+	}
+	if history := p.historyFor(r); history != nil {
+		if history, err := history.GetHistory(name); err == nil {
+			for i := len(history) - 1; i >= 0 && len(view.RecentWins) < recentWins; i-- {
+				view.RecentWins = append(view.RecentWins, history[i])
+			}
+		}
+	}
+
+	renderPage(w, r, playerTemplate, view)
+}
+
+// prefersHTML reports whether the Accept header asks for HTML over JSON.
+// Clients that don't say, or like both equally, get JSON as they always
+// have.
+func prefersHTML(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return false
+	}
+	return acceptQuality(accept, "text", "html") > acceptQuality(accept, "application", "json")
+}
+
+// acceptQuality is the q value accept gives type/subtype, going by the most
+// specific media range that matches it.
+func acceptQuality(accept, mainType, subType string) float64 {
+	quality, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mediaRange := strings.ToLower(strings.TrimSpace(params[0]))
+
+		var matched int
+		switch mediaRange {
+		case mainType + "/" + subType:
+			matched = 2
+		case mainType + "/*":
+			matched = 1
+		case "*/*":
+			matched = 0
+		default:
+			continue
+		}
+		if matched < specificity {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			if key, value, ok := strings.Cut(strings.TrimSpace(param), "="); ok && key == "q" {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		quality, specificity = q, matched
+	}
+	return quality
+}
@@ -0,0 +1,169 @@
+package poker
+
+import (
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+const browserAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+
+func TestHTMLPages(t *testing.T) {
+	store := &StubPlayerStore{
+		map[string]int{"Cleo": 32, "Chris & <Co>": 20},
+		nil,
+		League{{"Cleo", 32}, {"Chris & <Co>", 20}, {"Tiest", 1}},
+	}
+
+	browse := func(server *PlayerServer, target string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(http.MethodGet, target, nil)
+		request.Header.Set("Accept", browserAccept)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("the home page is the league", func(t *testing.T) {
+		server := NewPlayerServer(store, dummyGame)
+
+		response := browse(server, "/")
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertHTML(t, response)
+		assertGolden(t, "home.golden.html", response.Body.String())
+	})
+
+	t.Run("browsers get the league as a page", func(t *testing.T) {
+		server := NewPlayerServer(store, dummyGame)
+
+		response := browse(server, "/league?limit=2&offset=1")
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertHTML(t, response)
+		assertGolden(t, "league-page.golden.html", response.Body.String())
+	})
+
+	t.Run("a league ranked by rating shows the ratings", func(t *testing.T) {
+		results := newStubResultStore()
+		results.RecordResult(GameResult{Winner: "Cleo", Losers: []string{"Tiest"}})
+		server := NewPlayerServer(store, dummyGame, WithRatings(results))
+
+		response := browse(server, "/league?rank=rating")
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertGolden(t, "league-rated.golden.html", response.Body.String())
+	})
+
+	t.Run("player pages show wins, rating and recent history", func(t *testing.T) {
+		history, clock := newHistoryStore(t, newFileSystemStore(t), filepath.Join(t.TempDir(), "history.log"))
+		defer history.Close()
+		history.RecordWin("Cleo")
+		clock.Advance(26 * time.Hour)
+		history.RecordWin("Cleo")
+
+		results := newStubResultStore()
+		results.RecordResult(GameResult{Winner: "Cleo", Losers: []string{"Tiest"}})
+		server := NewPlayerServer(history, dummyGame, WithRatings(results), WithHistory(history))
+
+		response := browse(server, "/players/Cleo")
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertHTML(t, response)
+		assertGolden(t, "player.golden.html", response.Body.String())
+	})
+
+	t.Run("names are escaped", func(t *testing.T) {
+		server := NewPlayerServer(store, dummyGame)
+
+		response := browse(server, "/players/Chris%20&%20%3CCo%3E")
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertGolden(t, "player-escaped.golden.html", response.Body.String())
+	})
+
+	t.Run("asking for JSON still gets JSON", func(t *testing.T) {
+		server := NewPlayerServer(store, dummyGame)
+
+		request, _ := http.NewRequest(http.MethodGet, "/league", nil)
+		request.Header.Set("Accept", "application/json")
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertContentType(t, response.Result().Header.Get("content-type"))
+		assertLeague(t, getLeagueFromResponse(t, response.Body), store.league)
+	})
+
+	t.Run("serves the stylesheet", func(t *testing.T) {
+		server := NewPlayerServer(store, dummyGame)
+
+		response := browse(server, "/static/style.css")
+
+		assertStatus(t, response.Code, http.StatusOK)
+	})
+
+	t.Run("other paths are still not found", func(t *testing.T) {
+		server := NewPlayerServer(store, dummyGame)
+
+		assertStatus(t, browse(server, "/nowhere").Code, http.StatusNotFound)
+	})
+}
+
+func TestPrefersHTML(t *testing.T) {
+	cases := []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"application/json", false},
+		{"text/html", true},
+		{browserAccept, true},
+		{"text/html;q=0.5, application/json", false},
+		{"text/*, application/json;q=0.9", true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.accept, func(t *testing.T) {
+			request, _ := http.NewRequest(http.MethodGet, "/league", nil)
+			request.Header.Set("Accept", c.accept)
+
+			if got := prefersHTML(request); got != c.want {
+				t.Errorf("got %v want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func assertHTML(t testing.TB, response *httptest.ResponseRecorder) {
+	t.Helper()
+	if got := response.Header().Get("content-type"); got != "text/html; charset=utf-8" {
+		t.Errorf("got content-type %q want html", got)
+	}
+}
+
+// assertGolden compares got with testdata/name, or rewrites the file when
+// the tests are run with -update.
+func assertGolden(t testing.TB, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+
+	if *update {
+		if err := ioutil.WriteFile(path, []byte(got), 0666); err != nil {
+			t.Fatalf("could not update %s, %v", path, err)
+		}
+	}
+
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read %s, %v (run go test -update to create it)", path, err)
+	}
+	if got != string(want) {
+		t.Errorf("%s does not match, got\n%s", path, got)
+	}
+}
@@ -0,0 +1,129 @@
+package poker
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	idempotencyTTL       = 24 * time.Hour
+	maxIdempotencyKeys   = 10000
+)
+
+// idempotencyKeys remembers the requests clients marked with an
+// Idempotency-Key, so a retry of one that already worked gets the same
+// answer rather than doing it again. Keys are only kept in memory, for a
+// day, and no more than max at once.
+type idempotencyKeys struct {
+	mu      sync.Mutex
+	entries map[string]*idempotentRequest
+	max     int
+	now     func() time.Time
+}
+
+type idempotentRequest struct {
+	path   string
+	status int
+	done   bool
+	at     time.Time
+}
+
+func newIdempotencyKeys() *idempotencyKeys {
+	return &idempotencyKeys{
+		entries: map[string]*idempotentRequest{},
+		max:     maxIdempotencyKeys,
+		now:     time.Now,
+	}
+}
+
+// begin claims key for a request to path. If the key has been used before
+// it returns that request instead, and the caller should not go ahead. If
+// every key kept is for a request still being handled, there's no room for
+// key and it returns neither.
+func (k *idempotencyKeys) begin(key, path string) (*idempotentRequest, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := k.now()
+	if previous, ok := k.entries[key]; ok && now.Sub(previous.at) < idempotencyTTL {
+		copied := *previous
+		return &copied, false
+	}
+
+	if len(k.entries) >= k.max {
+		k.evict(now)
+		if len(k.entries) >= k.max {
+			return nil, false
+		}
+	}
+	k.entries[key] = &idempotentRequest{path: path, at: now}
+	return nil, true
+}
+
+// finish records how the request holding key went. Failures are forgotten
+// so the client can try again with the same key.
+func (k *idempotencyKeys) finish(key string, status int) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if status >= 300 {
+		delete(k.entries, key)
+		return
+	}
+	if entry, ok := k.entries[key]; ok {
+		entry.status = status
+		entry.done = true
+	}
+}
+
+func (k *idempotencyKeys) evict(now time.Time) {
+	var oldestKey string
+	var oldest time.Time
+	for key, entry := range k.entries {
+		if now.Sub(entry.at) >= idempotencyTTL {
+			delete(k.entries, key)
+			continue
+		}
+		if entry.done && (oldest.IsZero() || entry.at.Before(oldest)) {
+			oldestKey, oldest = key, entry.at
+		}
+	}
+	if len(k.entries) >= k.max && oldestKey != "" {
+		delete(k.entries, oldestKey)
+	}
+}
+
+// idempotent serves the request with handle once per Idempotency-Key.
+// Keys are scoped to whoever is asking, so two clients can't collide on
+// the same one.
+func (p *PlayerServer) idempotent(w http.ResponseWriter, r *http.Request, handle http.HandlerFunc) {
+	key := r.Header.Get(idempotencyKeyHeader)
+	if key == "" {
+		handle(w, r)
+		return
+	}
+	key = requestClient(r) + "|" + key
+
+	previous, ok := p.idempotency.begin(key, r.URL.Path)
+	switch {
+	case ok:
+		recorder := &statusRecorder{ResponseWriter: w}
+		handle(recorder, r)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		p.idempotency.finish(key, recorder.status)
+	case previous == nil:
+		w.Header().Set("Retry-After", "1")
+		writeProblem(w, r, http.StatusServiceUnavailable, "too many requests with an Idempotency-Key are being handled, try again shortly")
+	case previous.path != r.URL.Path:
+		writeProblem(w, r, http.StatusUnprocessableEntity, "this Idempotency-Key was already used for "+previous.path)
+	case !previous.done:
+		writeProblem(w, r, http.StatusConflict, "a request with this Idempotency-Key is still being handled")
+	default:
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(previous.status)
+	}
+}
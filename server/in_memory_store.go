@@ -0,0 +1,102 @@
+package poker
+
+import (
+	"sort"
+	"sync"
+)
+
+// InMemoryPlayerStore keeps the league in memory only. It is for tests and
+// tools that want a real store without a file behind it.
+type InMemoryPlayerStore struct {
+	mu     sync.RWMutex
+	league League
+}
+
+func NewInMemoryPlayerStore() *InMemoryPlayerStore {
+	return &InMemoryPlayerStore{}
+}
+
+func (i *InMemoryPlayerStore) GetPlayerScore(name string) (int, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	player := i.league.Find(name)
+	if player == nil {
+		return 0, ErrPlayerNotFound
+	}
+	return player.Wins, nil
+}
+
+func (i *InMemoryPlayerStore) RecordWin(name string) error {
+	if name == "" {
+		return ErrEmptyName
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if player := i.league.Find(name); player != nil {
+		player.Wins++
+		return nil
+	}
+	i.league = append(i.league, Player{name, 1})
+	return nil
+}
+
+func (i *InMemoryPlayerStore) GetLeague() (League, error) {
+	i.mu.RLock()
+	league := i.league.copy()
+	i.mu.RUnlock()
+
+	sort.SliceStable(league, func(a, b int) bool {
+		return league[a].Wins > league[b].Wins
+	})
+	return league, nil
+}
+
+func (i *InMemoryPlayerStore) SetPlayerScore(name string, wins int) error {
+	if name == "" {
+		return ErrEmptyName
+	}
+	if wins < 0 {
+		return ErrInvalidScore
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.league.setWins(name, wins)
+	return nil
+}
+
+func (i *InMemoryPlayerStore) DeletePlayer(name string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.league.remove(name)
+}
+
+func (i *InMemoryPlayerStore) RenamePlayer(from, to string) error {
+	if to == "" {
+		return ErrEmptyName
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.league.rename(from, to)
+}
+
+func (i *InMemoryPlayerStore) ImportLeague(league League) error {
+	if err := league.validate(); err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for _, player := range league {
+		i.league.setWins(player.Name, player.Wins)
+	}
+	return nil
+}
@@ -0,0 +1,562 @@
+package poker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+)
+
+// KVPlayerStore keeps players in an append-only data file and an in-memory
+// hash index from name to the offset of that player's latest record, so
+// scores are found without scanning the league. The index is persisted to
+// a hint file on Close so reopening a large league doesn't have to read
+// every record; anything appended after the hint was written is scanned.
+//
+// A data record is laid out as
+//
+//	crc32 (4 bytes) | wins (8 bytes) | name length (2 bytes) | name
+//
+// with the checksum covering everything after it. Deleting a player appends
+// a record with wins of -1, a tombstone that drops them from the index.
+// Renaming appends one record with wins of -2, whose name is
+//
+//	wins (8 bytes) | old name length (2 bytes) | old name | new name
+//
+// so a crash can't leave the player under both names.
+//
+// Once most of the file is records that have been overwritten or deleted,
+// the live ones are copied to a new file that replaces it.
+type KVPlayerStore struct {
+	mu     sync.RWMutex
+	path   string
+	data   *os.File
+	size   int64
+	index  map[string]int64
+	hint   io.Writer
+	closed bool
+	// live is how big the file would be with only the latest record for
+	// each player
+	live        int64
+	compactSize int64
+}
+
+const (
+	kvHeaderSize  = 4 + 8 + 2
+	kvMaxNameSize = 1<<16 - 1
+	kvTombstone   = -1
+	kvRename      = -2
+	// kvCompactSize is how big the file gets before it's worth compacting
+	kvCompactSize = 1 << 20
+)
+
+var errCorruptRecord = fmt.Errorf("%w, corrupt record", ErrCorruptStore)
+
+// kvRecord is one record read back from the data file. renamedFrom is only
+// set for a rename.
+type kvRecord struct {
+	name        string
+	wins        int
+	renamedFrom string
+	size        int64
+}
+
+func NewKVPlayerStore(path string) (*KVPlayerStore, error) {
+	data, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("problem opening kv data file %s, %v", path, err)
+	}
+
+	store := &KVPlayerStore{
+		path:        path,
+		data:        data,
+		index:       map[string]int64{},
+		hint:        &atomicTape{path + ".idx"},
+		compactSize: kvCompactSize,
+	}
+
+	if err := store.load(path + ".idx"); err != nil {
+		data.Close()
+		return nil, fmt.Errorf("problem loading kv store %s, %w", path, err)
+	}
+
+	return store, nil
+}
+
+func (k *KVPlayerStore) load(hintPath string) error {
+	info, err := k.data.Stat()
+	if err != nil {
+		return err
+	}
+
+	index, indexed, err := readHint(hintPath)
+	if err != nil || indexed > info.Size() {
+		// a missing or stale hint only costs us a full scan
+		index, indexed = map[string]int64{}, 0
+	}
+	k.index = index
+
+	size, err := k.scan(indexed, info.Size())
+	if err != nil {
+		return err
+	}
+
+	if size < info.Size() {
+		// the last record was only partly written when we went down
+		if err := k.data.Truncate(size); err != nil {
+			return err
+		}
+	}
+	k.size = size
+
+	k.live = 0
+	for name := range k.index {
+		k.live += kvRecordSize(name)
+	}
+	return nil
+}
+
+// scan indexes the records from offset from to the end of the file, which
+// is size long, returning where the last whole record ends. A bad record
+// with more after it means the file is damaged, and it is an error rather
+// than a reason to throw away what follows.
+func (k *KVPlayerStore) scan(from, size int64) (int64, error) {
+	reader := bufio.NewReader(io.NewSectionReader(k.data, from, 1<<62))
+	offset := from
+	for {
+		record, err := readKVRecord(reader)
+		if err == io.EOF {
+			return offset, nil
+		}
+		if err == io.ErrUnexpectedEOF || err == errCorruptRecord && offset+record.size >= size {
+			// a damaged length can make a record in the middle look like
+			// it runs off the end, so it's only the torn last record if
+			// there's no whole record after it
+			whole, err := k.wholeRecordAfter(offset, size)
+			if err != nil {
+				return offset, err
+			}
+			if !whole {
+				return offset, nil
+			}
+			return offset, fmt.Errorf("record at offset %d, %w", offset, errCorruptRecord)
+		}
+		if err != nil {
+			return offset, fmt.Errorf("record at offset %d, %w", offset, err)
+		}
+
+		switch {
+		case record.wins == kvTombstone:
+			delete(k.index, record.name)
+		case record.renamedFrom != "":
+			delete(k.index, record.renamedFrom)
+			k.index[record.name] = offset
+		default:
+			k.index[record.name] = offset
+		}
+		offset += record.size
+	}
+}
+
+// wholeRecordAfter is whether a record with a good checksum starts
+// anywhere between offset and size. Only the last record can have been cut
+// short by a crash, so one after offset means the file is damaged.
+func (k *KVPlayerStore) wholeRecordAfter(offset, size int64) (bool, error) {
+	tail := make([]byte, size-offset)
+	if _, err := k.data.ReadAt(tail, offset); err != nil && err != io.EOF {
+		return false, err
+	}
+	for at := 1; at+kvHeaderSize <= len(tail); at++ {
+		nameLen := int(binary.BigEndian.Uint16(tail[at+12:]))
+		if at+kvHeaderSize+nameLen > len(tail) {
+			continue
+		}
+		if _, err := readKVRecord(bytes.NewReader(tail[at:])); err == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func readKVRecord(r io.Reader) (kvRecord, error) {
+	header := make([]byte, kvHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return kvRecord{}, err
+	}
+
+	nameBytes := make([]byte, binary.BigEndian.Uint16(header[12:]))
+	if _, err := io.ReadFull(r, nameBytes); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return kvRecord{}, err
+	}
+	record := kvRecord{size: int64(len(header) + len(nameBytes))}
+
+	checksum := crc32.NewIEEE()
+	checksum.Write(header[4:])
+	checksum.Write(nameBytes)
+	if checksum.Sum32() != binary.BigEndian.Uint32(header) {
+		return record, errCorruptRecord
+	}
+
+	record.name = string(nameBytes)
+	record.wins = int(int64(binary.BigEndian.Uint64(header[4:])))
+	if record.wins != kvRename {
+		return record, nil
+	}
+
+	if len(nameBytes) < 10 {
+		return record, errCorruptRecord
+	}
+	fromLen := int(binary.BigEndian.Uint16(nameBytes[8:]))
+	if 10+fromLen > len(nameBytes) {
+		return record, errCorruptRecord
+	}
+	record.wins = int(int64(binary.BigEndian.Uint64(nameBytes)))
+	record.renamedFrom = string(nameBytes[10 : 10+fromLen])
+	record.name = string(nameBytes[10+fromLen:])
+	return record, nil
+}
+
+func encodeKVRecord(name string, wins int) []byte {
+	record := make([]byte, kvHeaderSize+len(name))
+	binary.BigEndian.PutUint64(record[4:], uint64(int64(wins)))
+	binary.BigEndian.PutUint16(record[12:], uint16(len(name)))
+	copy(record[kvHeaderSize:], name)
+	binary.BigEndian.PutUint32(record, crc32.ChecksumIEEE(record[4:]))
+	return record
+}
+
+func encodeKVRename(from, to string, wins int) []byte {
+	name := make([]byte, 10, 10+len(from)+len(to))
+	binary.BigEndian.PutUint64(name, uint64(int64(wins)))
+	binary.BigEndian.PutUint16(name[8:], uint16(len(from)))
+	name = append(append(name, from...), to...)
+	return encodeKVRecord(string(name), kvRename)
+}
+
+func kvRecordSize(name string) int64 {
+	return int64(kvHeaderSize + len(name))
+}
+
+// The hint file is the data size it covers, the number of entries, then one
+// offset, name length and name per player, followed by a crc32 of it all.
+func readHint(path string) (map[string]int64, int64, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(contents) < 16 {
+		return nil, 0, errCorruptRecord
+	}
+
+	body, sum := contents[:len(contents)-4], contents[len(contents)-4:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(sum) {
+		return nil, 0, errCorruptRecord
+	}
+
+	r := bytes.NewReader(body)
+	var size int64
+	var count uint32
+	binary.Read(r, binary.BigEndian, &size)
+	binary.Read(r, binary.BigEndian, &count)
+
+	index := make(map[string]int64, count)
+	for i := uint32(0); i < count; i++ {
+		var offset int64
+		var nameLen uint16
+		if err := binary.Read(r, binary.BigEndian, &offset); err != nil {
+			return nil, 0, err
+		}
+		if err := binary.Read(r, binary.BigEndian, &nameLen); err != nil {
+			return nil, 0, err
+		}
+		name := make([]byte, nameLen)
+		if _, err := io.ReadFull(r, name); err != nil {
+			return nil, 0, err
+		}
+		index[string(name)] = offset
+	}
+	return index, size, nil
+}
+
+func (k *KVPlayerStore) writeHint() error {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, k.size)
+	binary.Write(&buf, binary.BigEndian, uint32(len(k.index)))
+	for name, offset := range k.index {
+		binary.Write(&buf, binary.BigEndian, offset)
+		binary.Write(&buf, binary.BigEndian, uint16(len(name)))
+		buf.WriteString(name)
+	}
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(buf.Bytes()))
+
+	_, err := k.hint.Write(buf.Bytes())
+	return err
+}
+
+func (k *KVPlayerStore) wins(name string) (int, error) {
+	offset, ok := k.index[name]
+	if !ok {
+		return 0, ErrPlayerNotFound
+	}
+
+	record, err := readKVRecord(io.NewSectionReader(k.data, offset, kvHeaderSize+kvMaxNameSize))
+	if err != nil {
+		return 0, fmt.Errorf("problem reading %s at offset %d, %v", name, offset, err)
+	}
+	return record.wins, nil
+}
+
+func (k *KVPlayerStore) put(name string, wins int) error {
+	if len(name) > kvMaxNameSize {
+		return fmt.Errorf("player name is %d bytes, the most we can store is %d", len(name), kvMaxNameSize)
+	}
+	_, existed := k.index[name]
+	if err := k.append(encodeKVRecord(name, wins)); err != nil {
+		return err
+	}
+
+	if wins == kvTombstone {
+		delete(k.index, name)
+		k.live -= kvRecordSize(name)
+	} else {
+		if !existed {
+			k.live += kvRecordSize(name)
+		}
+		k.index[name] = k.size
+	}
+	k.grew(kvRecordSize(name))
+	return nil
+}
+
+// append writes record at the end of the data file, leaving k.size where
+// it starts.
+func (k *KVPlayerStore) append(record []byte) error {
+	if k.closed {
+		return ErrStoreUnavailable
+	}
+	_, err := k.data.WriteAt(record, k.size)
+	return err
+}
+
+// grew moves k.size past a record that's just been appended, compacting
+// the file when most of it is dead.
+func (k *KVPlayerStore) grew(n int64) {
+	k.size += n
+	if k.size < k.compactSize || k.size < 2*k.live {
+		return
+	}
+	// the change is already safe in the file; if compacting fails the old
+	// file is kept and it's tried again after the next change
+	k.compact()
+}
+
+// compact writes the latest record for each player to a new file and puts
+// it in place of the data file. The hint is removed first, since its
+// offsets are into the old file.
+func (k *KVPlayerStore) compact() error {
+	compacted := k.path + ".compact"
+	file, err := os.OpenFile(compacted, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	index := make(map[string]int64, len(k.index))
+	writer := bufio.NewWriter(file)
+	var size int64
+	for name := range k.index {
+		wins, err := k.wins(name)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		record := encodeKVRecord(name, wins)
+		writer.Write(record)
+		index[name] = size
+		size += int64(len(record))
+	}
+
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := os.Remove(k.path + ".idx"); err != nil && !os.IsNotExist(err) {
+		file.Close()
+		return err
+	}
+	if err := os.Rename(compacted, k.path); err != nil {
+		file.Close()
+		return err
+	}
+
+	k.data.Close()
+	k.data, k.index, k.size, k.live = file, index, size, size
+	return k.writeHint()
+}
+
+func (k *KVPlayerStore) GetPlayerScore(name string) (int, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if k.closed {
+		return 0, ErrStoreUnavailable
+	}
+	return k.wins(name)
+}
+
+func (k *KVPlayerStore) RecordWin(name string) error {
+	if name == "" {
+		return ErrEmptyName
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	wins, err := k.wins(name)
+	if err != nil && err != ErrPlayerNotFound {
+		return err
+	}
+	return k.put(name, wins+1)
+}
+
+func (k *KVPlayerStore) GetLeague() (League, error) {
+	league, err := k.players()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(league, func(i, j int) bool {
+		if league[i].Wins != league[j].Wins {
+			return league[i].Wins > league[j].Wins
+		}
+		return league[i].Name < league[j].Name
+	})
+	return league, nil
+}
+
+func (k *KVPlayerStore) players() (League, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if k.closed {
+		return nil, ErrStoreUnavailable
+	}
+
+	league := make(League, 0, len(k.index))
+	for name := range k.index {
+		wins, err := k.wins(name)
+		if err != nil {
+			return nil, err
+		}
+		league = append(league, Player{name, wins})
+	}
+	return league, nil
+}
+
+func (k *KVPlayerStore) SetPlayerScore(name string, wins int) error {
+	if name == "" {
+		return ErrEmptyName
+	}
+	if wins < 0 {
+		return ErrInvalidScore
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return k.put(name, wins)
+}
+
+func (k *KVPlayerStore) DeletePlayer(name string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, ok := k.index[name]; !ok {
+		return ErrPlayerNotFound
+	}
+	return k.put(name, kvTombstone)
+}
+
+func (k *KVPlayerStore) RenamePlayer(from, to string) error {
+	if to == "" {
+		return ErrEmptyName
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	wins, err := k.wins(from)
+	if err != nil {
+		return err
+	}
+	if from == to {
+		return nil
+	}
+	if _, exists := k.index[to]; exists {
+		return ErrPlayerExists
+	}
+
+	record := encodeKVRename(from, to, wins)
+	if len(record) > kvHeaderSize+kvMaxNameSize {
+		return fmt.Errorf("player names are %d bytes together, the most we can store is %d", len(from)+len(to), kvMaxNameSize-10)
+	}
+	if err := k.append(record); err != nil {
+		return err
+	}
+
+	delete(k.index, from)
+	k.index[to] = k.size
+	k.live += kvRecordSize(to) - kvRecordSize(from)
+	k.grew(int64(len(record)))
+	return nil
+}
+
+// ImportLeague sets each player's wins to the value in league, replacing
+// whatever the store held for them before. It is how an existing
+// game.db.json is brought across.
+func (k *KVPlayerStore) ImportLeague(league League) error {
+	if err := league.validate(); err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for _, player := range league {
+		if err := k.put(player.Name, player.Wins); err != nil {
+			return fmt.Errorf("problem importing %s, %v", player.Name, err)
+		}
+	}
+	if err := k.data.Sync(); err != nil {
+		return err
+	}
+	return k.writeHint()
+}
+
+func (k *KVPlayerStore) Close() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.closed {
+		return nil
+	}
+	k.closed = true
+
+	if err := k.writeHint(); err != nil {
+		k.data.Close()
+		return fmt.Errorf("problem writing kv index, %v", err)
+	}
+	return k.data.Close()
+}
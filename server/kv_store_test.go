@@ -0,0 +1,256 @@
+package poker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKVPlayerStore(t *testing.T) {
+	t.Run("records and looks up wins", func(t *testing.T) {
+		store := newKVStore(t, filepath.Join(t.TempDir(), "league.kv"))
+		defer store.Close()
+
+		store.RecordWin("Chris")
+		store.RecordWin("Chris")
+		store.RecordWin("Cleo")
+
+		assertScoreInStore(t, store, "Chris", 2)
+		assertScoreInStore(t, store, "Cleo", 1)
+		_, err := store.GetPlayerScore("Apollo")
+		assertError(t, err, ErrPlayerNotFound)
+		assertLeague(t, getLeague(t, store), []Player{
+			{"Chris", 2},
+			{"Cleo", 1},
+		})
+	})
+
+	t.Run("reopens from the index file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "league.kv")
+
+		store := newKVStore(t, path)
+		store.RecordWin("Chris")
+		store.RecordWin("Cleo")
+		assertNoError(t, store.Close())
+
+		store = newKVStore(t, path)
+		defer store.Close()
+		store.RecordWin("Cleo")
+
+		assertLeague(t, getLeague(t, store), []Player{
+			{"Cleo", 2},
+			{"Chris", 1},
+		})
+	})
+
+	t.Run("rebuilds the index when it is missing", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "league.kv")
+
+		store := newKVStore(t, path)
+		store.RecordWin("Chris")
+		store.RecordWin("Chris")
+		store.Close()
+		os.Remove(path + ".idx")
+
+		store = newKVStore(t, path)
+		defer store.Close()
+
+		assertScoreInStore(t, store, "Chris", 2)
+	})
+
+	t.Run("picks up records written after the index", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "league.kv")
+
+		store := newKVStore(t, path)
+		store.RecordWin("Chris")
+		store.Close()
+
+		// simulate a crash: records land in the data file but the index
+		// is never rewritten
+		store = newKVStore(t, path)
+		store.RecordWin("Chris")
+		store.RecordWin("Cleo")
+		store.data.Close()
+
+		store = newKVStore(t, path)
+		defer store.Close()
+
+		assertScoreInStore(t, store, "Chris", 2)
+		assertScoreInStore(t, store, "Cleo", 1)
+	})
+
+	t.Run("drops a half written last record", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "league.kv")
+
+		store := newKVStore(t, path)
+		store.RecordWin("Chris")
+		store.data.Close()
+
+		data, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0666)
+		assertNoError(t, err)
+		data.Write(encodeKVRecord("Cleo", 1)[:6])
+		data.Close()
+
+		store = newKVStore(t, path)
+		defer store.Close()
+		store.RecordWin("Cleo")
+
+		assertLeague(t, getLeague(t, store), []Player{
+			{"Chris", 1},
+			{"Cleo", 1},
+		})
+	})
+
+	t.Run("renames and deletes players across a reopen", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "league.kv")
+
+		store := newKVStore(t, path)
+		store.RecordWin("Chris")
+		store.RecordWin("Cleo")
+		assertNoError(t, store.SetPlayerScore("Tiest", 14))
+		assertNoError(t, store.RenamePlayer("Chris", "Christopher"))
+		assertNoError(t, store.DeletePlayer("Cleo"))
+		assertError(t, store.DeletePlayer("Cleo"), ErrPlayerNotFound)
+		assertError(t, store.RenamePlayer("Tiest", "Christopher"), ErrPlayerExists)
+		store.data.Close()
+
+		// without the index the tombstones have to be found by scanning
+		store = newKVStore(t, path)
+		defer store.Close()
+
+		assertLeague(t, getLeague(t, store), []Player{
+			{"Tiest", 14},
+			{"Christopher", 1},
+		})
+	})
+
+	t.Run("refuses to start when a record before the last is damaged", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "league.kv")
+
+		store := newKVStore(t, path)
+		store.RecordWin("Chris")
+		store.RecordWin("Cleo")
+		store.data.Close()
+		os.Remove(path + ".idx")
+
+		data, err := os.OpenFile(path, os.O_WRONLY, 0666)
+		assertNoError(t, err)
+		data.WriteAt([]byte("X"), kvHeaderSize)
+		data.Close()
+		before, _ := os.Stat(path)
+
+		_, err = NewKVPlayerStore(path)
+		if err == nil {
+			t.Fatal("expected an error opening a damaged store")
+		}
+		if after, _ := os.Stat(path); after.Size() != before.Size() {
+			t.Errorf("the file was cut from %d to %d bytes", before.Size(), after.Size())
+		}
+	})
+
+	t.Run("refuses to start when a record in the middle says it's longer than the file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "league.kv")
+
+		store := newKVStore(t, path)
+		store.RecordWin("a")
+		store.RecordWin("bb")
+		store.RecordWin("cc")
+		store.RecordWin("dd")
+		store.RecordWin("ee")
+		store.data.Close()
+		os.Remove(path + ".idx")
+
+		// the second record's name length, as if it ran past the end
+		data, err := os.OpenFile(path, os.O_WRONLY, 0666)
+		assertNoError(t, err)
+		data.WriteAt([]byte{0xff, 0xff}, kvRecordSize("a")+12)
+		data.Close()
+		before, _ := os.Stat(path)
+
+		_, err = NewKVPlayerStore(path)
+		assertError(t, err, ErrCorruptStore)
+		if after, _ := os.Stat(path); after.Size() != before.Size() {
+			t.Errorf("the file was cut from %d to %d bytes", before.Size(), after.Size())
+		}
+	})
+
+	t.Run("renames with a single record", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "league.kv")
+
+		store := newKVStore(t, path)
+		store.RecordWin("Chris")
+		before := store.size
+		assertNoError(t, store.RenamePlayer("Chris", "Christopher"))
+		if grown := store.size - before; grown != int64(len(encodeKVRename("Chris", "Christopher", 1))) {
+			t.Errorf("rename wrote %d bytes", grown)
+		}
+		store.data.Close()
+		os.Remove(path + ".idx")
+
+		store = newKVStore(t, path)
+		defer store.Close()
+
+		assertLeague(t, getLeague(t, store), []Player{{"Christopher", 1}})
+	})
+
+	t.Run("compacts once most of the file is overwritten records", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "league.kv")
+
+		store := newKVStore(t, path)
+		store.compactSize = 1024
+		assertNoError(t, store.SetPlayerScore("Cleo", 3))
+		for i := 0; i < 100; i++ {
+			assertNoError(t, store.RecordWin("Chris"))
+		}
+		assertNoError(t, store.RenamePlayer("Cleo", "Ruth"))
+
+		if store.size >= 1024 {
+			t.Errorf("store is %d bytes, it should have been compacted", store.size)
+		}
+		assertNoError(t, store.Close())
+
+		store = newKVStore(t, path)
+		defer store.Close()
+		assertLeague(t, getLeague(t, store), []Player{{"Chris", 100}, {"Ruth", 3}})
+	})
+
+	t.Run("is unavailable once closed", func(t *testing.T) {
+		store := newKVStore(t, filepath.Join(t.TempDir(), "league.kv"))
+		store.Close()
+
+		assertError(t, store.RecordWin("Chris"), ErrStoreUnavailable)
+		_, err := store.GetLeague()
+		assertError(t, err, ErrStoreUnavailable)
+	})
+
+	t.Run("imports a league from a file system store", func(t *testing.T) {
+		database, cleanDatabase := createTempFile(t, `[
+			{"Name": "Cleo", "Wins": 10},
+			{"Name": "Chris", "Wins": 33}]`)
+		defer cleanDatabase()
+		database.Seek(0, 0)
+
+		league, err := NewLeague(database)
+		assertNoError(t, err)
+
+		path := filepath.Join(t.TempDir(), "league.kv")
+		store := newKVStore(t, path)
+		assertNoError(t, store.ImportLeague(league))
+		store.Close()
+
+		store = newKVStore(t, path)
+		defer store.Close()
+
+		assertLeague(t, getLeague(t, store), []Player{
+			{"Chris", 33},
+			{"Cleo", 10},
+		})
+	})
+}
+
+func newKVStore(t testing.TB, path string) *KVPlayerStore {
+	t.Helper()
+	store, err := NewKVPlayerStore(path)
+	assertNoError(t, err)
+	return store
+}
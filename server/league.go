@@ -1,13 +1,28 @@
 package poker
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
 )
 
 type League []Player
 
+var (
+	ErrEmptyName        = errors.New("player name cannot be empty")
+	ErrStoreUnavailable = errors.New("player store is unavailable")
+	ErrPlayerNotFound   = errors.New("player not found")
+	ErrPlayerExists     = errors.New("player already exists")
+	ErrInvalidScore     = errors.New("wins cannot be negative")
+	// ErrCorruptStore is a store that couldn't be opened because its files
+	// are damaged, rather than because they couldn't be got at.
+	ErrCorruptStore = errors.New("player store is damaged")
+)
+
 func (l League) Find(name string) *Player {
 	for i, player := range l {
 		if player.Name == name {
@@ -17,6 +32,54 @@ func (l League) Find(name string) *Player {
 	return nil
 }
 
+func (l League) copy() League {
+	league := make(League, len(l))
+	copy(league, l)
+	return league
+}
+
+func (l League) validate() error {
+	for _, player := range l {
+		if player.Name == "" {
+			return ErrEmptyName
+		}
+		if player.Wins < 0 {
+			return fmt.Errorf("%s has %d wins, %w", player.Name, player.Wins, ErrInvalidScore)
+		}
+	}
+	return nil
+}
+
+func (l *League) setWins(name string, wins int) {
+	if player := l.Find(name); player != nil {
+		player.Wins = wins
+		return
+	}
+	*l = append(*l, Player{name, wins})
+}
+
+func (l *League) remove(name string) error {
+	for i, player := range *l {
+		if player.Name == name {
+			*l = append((*l)[:i], (*l)[i+1:]...)
+			return nil
+		}
+	}
+	return ErrPlayerNotFound
+}
+
+func (l League) rename(from, to string) error {
+	player := l.Find(from)
+	if player == nil {
+		return ErrPlayerNotFound
+	}
+	if from != to && l.Find(to) != nil {
+		return ErrPlayerExists
+	}
+	player.Name = to
+	return nil
+}
+
 func NewLeague(rdr io.Reader) ([]Player, error) {
 	var league []Player
 	err := json.NewDecoder(rdr).Decode(&league)
@@ -25,3 +88,39 @@ func NewLeague(rdr io.Reader) ([]Player, error) {
 	}
 	return league, err
 }
+
+// NewLeagueFromCSV reads name,wins rows, skipping a Name,Wins header if
+// there is one.
+func NewLeagueFromCSV(rdr io.Reader) (League, error) {
+	records, err := csv.NewReader(rdr).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("problem parsing league csv, %v", err)
+	}
+
+	var league League
+	for i, record := range records {
+		if len(record) != 2 {
+			return nil, fmt.Errorf("problem parsing league csv, line %d has %d fields, want 2", i+1, len(record))
+		}
+		if i == 0 && strings.EqualFold(record[0], "name") {
+			continue
+		}
+
+		wins, err := strconv.Atoi(strings.TrimSpace(record[1]))
+		if err != nil {
+			return nil, fmt.Errorf("problem parsing league csv, line %d has wins %q", i+1, record[1])
+		}
+		league = append(league, Player{record[0], wins})
+	}
+	return league, nil
+}
+
+func (l League) WriteCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"Name", "Wins"})
+	for _, player := range l {
+		out.Write([]string{player.Name, strconv.Itoa(player.Wins)})
+	}
+	out.Flush()
+	return out.Error()
+}
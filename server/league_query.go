@@ -0,0 +1,284 @@
+package poker
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SortByWins   = "wins"
+	SortByName   = "name"
+	SortByRating = "rating"
+
+	// MaxLeagueLimit is the most players a page can ask for; a bigger limit
+	// is treated as this one
+	MaxLeagueLimit = 1000
+
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+
+	PeriodWeek   = "week"
+	PeriodMonth  = "month"
+	PeriodSeason = "season"
+)
+
+// LeagueQuery picks a page out of a league. A zero Limit means everything
+// from Offset onwards. Since and Until, or a Period ending now, restrict the
+// league to wins in that window.
+type LeagueQuery struct {
+	Limit      int
+	Offset     int
+	Sort       string
+	Order      string
+	NamePrefix string
+	Since      time.Time
+	Until      time.Time
+	Period     string
+}
+
+func ParseLeagueQuery(values url.Values) (LeagueQuery, error) {
+	q := LeagueQuery{
+		Sort:       SortByWins,
+		NamePrefix: values.Get("name_prefix"),
+	}
+
+	var err error
+	if q.Limit, err = nonNegativeParam(values, "limit"); err != nil {
+		return q, err
+	}
+	if q.Limit > MaxLeagueLimit {
+		q.Limit = MaxLeagueLimit
+	}
+	if q.Offset, err = nonNegativeParam(values, "offset"); err != nil {
+		return q, err
+	}
+
+	// rank reads better than sort for asking who's best, so it's accepted
+	// as another name for the same thing
+	if rank := values.Get("rank"); rank != "" {
+		if rank != SortByWins && rank != SortByRating {
+			return q, fmt.Errorf("rank must be %s or %s, got %q", SortByWins, SortByRating, rank)
+		}
+		q.Sort = rank
+	}
+	if sortBy := values.Get("sort"); sortBy != "" {
+		if sortBy != SortByWins && sortBy != SortByName && sortBy != SortByRating {
+			return q, fmt.Errorf("sort must be %s, %s or %s, got %q", SortByWins, SortByName, SortByRating, sortBy)
+		}
+		q.Sort = sortBy
+	}
+
+	// most wins first, but names read best A to Z
+	q.Order = OrderDesc
+	if q.Sort == SortByName {
+		q.Order = OrderAsc
+	}
+	if order := values.Get("order"); order != "" {
+		if order != OrderAsc && order != OrderDesc {
+			return q, fmt.Errorf("order must be %s or %s, got %q", OrderAsc, OrderDesc, order)
+		}
+		q.Order = order
+	}
+
+	if q.Since, err = timeParam(values, "since"); err != nil {
+		return q, err
+	}
+	if q.Until, err = timeParam(values, "until"); err != nil {
+		return q, err
+	}
+	if !q.Since.IsZero() && !q.Until.IsZero() && !q.Since.Before(q.Until) {
+		return q, fmt.Errorf("since must be before until")
+	}
+
+	if period := values.Get("period"); period != "" {
+		if period != PeriodWeek && period != PeriodMonth && period != PeriodSeason {
+			return q, fmt.Errorf("period must be %s, %s or %s, got %q", PeriodWeek, PeriodMonth, PeriodSeason, period)
+		}
+		if !q.Since.IsZero() || !q.Until.IsZero() {
+			return q, fmt.Errorf("period cannot be combined with since or until")
+		}
+		q.Period = period
+	}
+
+	return q, nil
+}
+
+// timeParam takes either a full RFC 3339 time or a date, which means
+// midnight UTC at the start of that day.
+func timeParam(values url.Values, name string) (time.Time, error) {
+	raw := values.Get(name)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", raw); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%s must be a date like 2006-01-02 or an RFC 3339 time, got %q", name, raw)
+}
+
+// Windowed reports whether q only wants wins from some stretch of time.
+func (q LeagueQuery) Windowed() bool {
+	return q.Period != "" || !q.Since.IsZero() || !q.Until.IsZero()
+}
+
+// Window returns the stretch of time q covers. Periods are the current
+// week from Monday, calendar month or season, where the seasons are the
+// quarters of the year, all in UTC.
+func (q LeagueQuery) Window(now time.Time) (since, until time.Time) {
+	now = now.UTC()
+	year, month, day := now.Date()
+
+	switch q.Period {
+	case PeriodWeek:
+		daysSinceMonday := (int(now.Weekday()) + 6) % 7
+		since = time.Date(year, month, day-daysSinceMonday, 0, 0, 0, 0, time.UTC)
+		return since, since.AddDate(0, 0, 7)
+	case PeriodMonth:
+		since = time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+		return since, since.AddDate(0, 1, 0)
+	case PeriodSeason:
+		firstMonth := month - (month-1)%3
+		since = time.Date(year, firstMonth, 1, 0, 0, 0, 0, time.UTC)
+		return since, since.AddDate(0, 3, 0)
+	}
+	return q.Since, q.Until
+}
+
+func nonNegativeParam(values url.Values, name string) (int, error) {
+	raw := values.Get(name)
+	if raw == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a whole number of zero or more, got %q", name, raw)
+	}
+	return n, nil
+}
+
+// Apply filters and sorts league, then returns the requested page along
+// with how many players matched before paging. Sorting by rating needs the
+// ratings, so use ApplyRatings for that.
+func (q LeagueQuery) Apply(league League) (League, int) {
+	matched := League{}
+	for _, player := range league {
+		if strings.HasPrefix(player.Name, q.NamePrefix) {
+			matched = append(matched, player)
+		}
+	}
+
+	// stable, so players on the same wins keep the order the store gave us
+	sort.SliceStable(matched, q.less(func(i, j int) bool {
+		if q.Sort == SortByName {
+			return matched[i].Name < matched[j].Name
+		}
+		return matched[i].Wins < matched[j].Wins
+	}))
+
+	start, end := q.page(len(matched))
+	return matched[start:end], len(matched)
+}
+
+// ApplyRatings is Apply for a league with ratings alongside. Players who
+// have lost games without ever winning one are rated too, so they are
+// included with no wins.
+func (q LeagueQuery) ApplyRatings(league League, ratings []Rating) ([]RatedPlayer, int) {
+	byName := map[string]Rating{}
+	for _, rating := range ratings {
+		byName[rating.Name] = rating
+	}
+
+	var all []RatedPlayer
+	for _, player := range league {
+		rated := RatedPlayer{Name: player.Name, Wins: player.Wins, Rating: InitialRating}
+		if rating, ok := byName[player.Name]; ok {
+			rated.Rating, rated.Games = rating.Rating, rating.Games
+			delete(byName, player.Name)
+		}
+		all = append(all, rated)
+	}
+	for _, rating := range ratings {
+		if _, ok := byName[rating.Name]; ok {
+			all = append(all, RatedPlayer{Name: rating.Name, Rating: rating.Rating, Games: rating.Games})
+		}
+	}
+
+	matched := []RatedPlayer{}
+	for _, player := range all {
+		if strings.HasPrefix(player.Name, q.NamePrefix) {
+			matched = append(matched, player)
+		}
+	}
+
+	sort.SliceStable(matched, q.less(func(i, j int) bool {
+		switch q.Sort {
+		case SortByName:
+			return matched[i].Name < matched[j].Name
+		case SortByWins:
+			return matched[i].Wins < matched[j].Wins
+		}
+		return matched[i].Rating < matched[j].Rating
+	}))
+
+	start, end := q.page(len(matched))
+	return matched[start:end], len(matched)
+}
+
+// less turns an ascending comparison into one that follows q.Order.
+func (q LeagueQuery) less(ascending func(i, j int) bool) func(i, j int) bool {
+	if q.Order == OrderDesc {
+		return func(i, j int) bool { return ascending(j, i) }
+	}
+	return ascending
+}
+
+func (q LeagueQuery) page(total int) (start, end int) {
+	if q.Offset >= total {
+		return total, total
+	}
+
+	// compared against what's left rather than added to the offset, which
+	// could overflow
+	end = total
+	if q.Limit > 0 && q.Limit < total-q.Offset {
+		end = q.Offset + q.Limit
+	}
+	return q.Offset, end
+}
+
+// Links returns the Link header value pointing at the pages either side of
+// this one, or "" when there's only one page.
+func (q LeagueQuery) Links(base url.URL, total int) string {
+	if q.Limit == 0 {
+		return ""
+	}
+
+	var links []string
+	link := func(offset int, rel string) {
+		values := base.Query()
+		values.Set("limit", strconv.Itoa(q.Limit))
+		values.Set("offset", strconv.Itoa(offset))
+		base.RawQuery = values.Encode()
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, base.RequestURI(), rel))
+	}
+
+	if q.Offset < total && q.Limit < total-q.Offset {
+		link(q.Offset+q.Limit, "next")
+	}
+	if q.Offset > 0 {
+		prev := q.Offset - q.Limit
+		if prev < 0 {
+			prev = 0
+		}
+		link(prev, "prev")
+	}
+
+	return strings.Join(links, ", ")
+}
@@ -0,0 +1,165 @@
+package poker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestLeagueQuery(t *testing.T) {
+	league := League{
+		{"Cleo", 32},
+		{"Chris", 20},
+		{"Tiest", 14},
+		{"Pepper", 14},
+		{"Floyd", 10},
+	}
+
+	cases := []struct {
+		query     string
+		wantPage  League
+		wantTotal int
+	}{
+		{"", league, 5},
+		{"limit=2", League{{"Cleo", 32}, {"Chris", 20}}, 5},
+		{"limit=2&offset=2", League{{"Tiest", 14}, {"Pepper", 14}}, 5},
+		{"limit=2&offset=4", League{{"Floyd", 10}}, 5},
+		{"offset=10", League{}, 5},
+		{"limit=9223372036854775807&offset=3", League{{"Pepper", 14}, {"Floyd", 10}}, 5},
+		{"limit=9223372036854775807&offset=9223372036854775807", League{}, 5},
+		{"sort=wins&order=asc", League{{"Floyd", 10}, {"Tiest", 14}, {"Pepper", 14}, {"Chris", 20}, {"Cleo", 32}}, 5},
+		{"sort=name", League{{"Chris", 20}, {"Cleo", 32}, {"Floyd", 10}, {"Pepper", 14}, {"Tiest", 14}}, 5},
+		{"sort=name&order=desc&limit=1", League{{"Tiest", 14}}, 5},
+		{"name_prefix=C", League{{"Cleo", 32}, {"Chris", 20}}, 2},
+		{"name_prefix=C&sort=name&limit=1&offset=1", League{{"Cleo", 32}}, 2},
+	}
+
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			values, _ := url.ParseQuery(c.query)
+			query, err := ParseLeagueQuery(values)
+			assertNoError(t, err)
+
+			page, total := query.Apply(league)
+
+			assertLeague(t, page, c.wantPage)
+			if total != c.wantTotal {
+				t.Errorf("got total %d want %d", total, c.wantTotal)
+			}
+		})
+	}
+
+	t.Run("rejects bad parameters", func(t *testing.T) {
+		for _, query := range []string{"limit=-1", "limit=lots", "offset=-5", "sort=age", "rank=name", "order=sideways"} {
+			values, _ := url.ParseQuery(query)
+			if _, err := ParseLeagueQuery(values); err == nil {
+				t.Errorf("expected an error for %q", query)
+			}
+		}
+	})
+}
+
+func TestLeagueQueryLinks(t *testing.T) {
+	cases := []struct {
+		target string
+		total  int
+		want   string
+	}{
+		{"/league", 50, ""},
+		{"/league?limit=10", 50, `</league?limit=10&offset=10>; rel="next"`},
+		{"/league?limit=10&offset=20&sort=name", 50, `</league?limit=10&offset=30&sort=name>; rel="next", </league?limit=10&offset=10&sort=name>; rel="prev"`},
+		{"/league?limit=10&offset=5", 12, `</league?limit=10&offset=0>; rel="prev"`},
+		{"/league?limit=9223372036854775807&offset=10", 50, `</league?limit=1000&offset=0>; rel="prev"`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.target, func(t *testing.T) {
+			target, _ := url.Parse(c.target)
+			query, err := ParseLeagueQuery(target.Query())
+			assertNoError(t, err)
+
+			got := query.Links(*target, c.total)
+			if got != c.want {
+				t.Errorf("got %q want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestPaginatedLeague(t *testing.T) {
+	store := StubPlayerStore{nil, nil, []Player{
+		{"Cleo", 32},
+		{"Chris", 20},
+		{"Tiest", 14},
+	}}
+	server := NewPlayerServer(&store, dummyGame)
+
+	t.Run("returns a page with the total and links", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/league?limit=1&offset=1", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertLeague(t, getLeagueFromResponse(t, response.Body), []Player{{"Chris", 20}})
+
+		header := response.Result().Header
+		if got := header.Get("X-Total-Count"); got != "3" {
+			t.Errorf("got X-Total-Count %q want %q", got, "3")
+		}
+		wantLinks := `</league?limit=1&offset=2>; rel="next", </league?limit=1&offset=0>; rel="prev"`
+		if got := header.Get("Link"); got != wantLinks {
+			t.Errorf("got Link %q want %q", got, wantLinks)
+		}
+	})
+
+	t.Run("bad parameters are a bad request", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/league?sort=age", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+	})
+}
+
+func TestLeagueQueryWindow(t *testing.T) {
+	// a Sunday in the second quarter
+	now := time.Date(2021, time.May, 16, 18, 30, 0, 0, time.UTC)
+
+	cases := []struct {
+		query     string
+		wantSince time.Time
+		wantUntil time.Time
+	}{
+		{"", time.Time{}, time.Time{}},
+		{"period=week", time.Date(2021, time.May, 10, 0, 0, 0, 0, time.UTC), time.Date(2021, time.May, 17, 0, 0, 0, 0, time.UTC)},
+		{"period=month", time.Date(2021, time.May, 1, 0, 0, 0, 0, time.UTC), time.Date(2021, time.June, 1, 0, 0, 0, 0, time.UTC)},
+		{"period=season", time.Date(2021, time.April, 1, 0, 0, 0, 0, time.UTC), time.Date(2021, time.July, 1, 0, 0, 0, 0, time.UTC)},
+		{"since=2021-01-02", time.Date(2021, time.January, 2, 0, 0, 0, 0, time.UTC), time.Time{}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			values, _ := url.ParseQuery(c.query)
+			query, err := ParseLeagueQuery(values)
+			assertNoError(t, err)
+
+			since, until := query.Window(now)
+			if !since.Equal(c.wantSince) || !until.Equal(c.wantUntil) {
+				t.Errorf("got %v to %v, want %v to %v", since, until, c.wantSince, c.wantUntil)
+			}
+		})
+	}
+
+	t.Run("rejects bad windows", func(t *testing.T) {
+		for _, query := range []string{"since=yesterday", "period=fortnight", "period=week&since=2021-01-01", "since=2021-02-01&until=2021-01-01"} {
+			values, _ := url.ParseQuery(query)
+			if _, err := ParseLeagueQuery(values); err == nil {
+				t.Errorf("expected an error for %q", query)
+			}
+		}
+	})
+}
@@ -0,0 +1,405 @@
+package poker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// DefaultLeague is the league the server has always kept, served at
+// /league and /players/ as well as under /leagues/default.
+const DefaultLeague = "default"
+
+const maxLeagueNameLength = 32
+
+var (
+	ErrLeagueNotFound    = errors.New("league not found")
+	ErrLeagueExists      = errors.New("league already exists")
+	ErrInvalidLeagueName = errors.New("league names are lower case letters, digits and dashes")
+	ErrDefaultLeague     = errors.New("the default league cannot be deleted")
+)
+
+// LeagueStore keeps the leagues other than the default one, each in a
+// PlayerStore of its own. The func Store returns must be called once the
+// store is done with, and a league isn't deleted while its store is in use.
+type LeagueStore interface {
+	Store(league string) (PlayerStore, func(), error)
+	CreateLeague(league string) error
+	DeleteLeague(league string) error
+	Leagues() ([]string, error)
+}
+
+func LeaguesPath(dbPath string) string {
+	return dbPath + ".leagues"
+}
+
+// LeagueOpener opens the store for a league kept in dir, creating it if
+// it's empty. The func it returns closes the store.
+type LeagueOpener func(dir string) (PlayerStore, func() error, error)
+
+// DirLeagueStore keeps each league in a directory of its own under one
+// directory, so a league is listed by being there and deleted by removing
+// it. Stores are opened when first asked for and kept open.
+type DirLeagueStore struct {
+	mu     sync.Mutex
+	dir    string
+	open   LeagueOpener
+	stores map[string]*openLeague
+	// deleting are the leagues waiting for their stores to be done with
+	// before they're removed, which can't be used in the meantime
+	deleting map[string]bool
+}
+
+type openLeague struct {
+	store PlayerStore
+	close func() error
+	// inUse is held for reading by everyone using the store, so it's only
+	// closed once they're done
+	inUse sync.RWMutex
+}
+
+func NewDirLeagueStore(dir string, open LeagueOpener) (*DirLeagueStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("problem creating leagues directory %s, %v", dir, err)
+	}
+	return &DirLeagueStore{
+		dir:      dir,
+		open:     open,
+		stores:   map[string]*openLeague{},
+		deleting: map[string]bool{},
+	}, nil
+}
+
+func (d *DirLeagueStore) Store(league string) (PlayerStore, func(), error) {
+	if err := checkLeagueName(league); err != nil {
+		return nil, nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	open, ok := d.stores[league]
+	if !ok {
+		if d.deleting[league] || !d.exists(league) {
+			return nil, nil, ErrLeagueNotFound
+		}
+		var err error
+		if open, err = d.openLeague(league); err != nil {
+			return nil, nil, err
+		}
+	}
+	// only stores still in d.stores are locked for writing, and never
+	// while d.mu is held, so this doesn't wait
+	open.inUse.RLock()
+	return open.store, open.inUse.RUnlock, nil
+}
+
+func (d *DirLeagueStore) CreateLeague(league string) error {
+	if err := checkLeagueName(league); err != nil {
+		return err
+	}
+	if league == DefaultLeague {
+		return ErrLeagueExists
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.deleting[league] || d.exists(league) {
+		return ErrLeagueExists
+	}
+	if err := os.Mkdir(filepath.Join(d.dir, league), 0755); err != nil {
+		return fmt.Errorf("problem creating league %s, %v", league, err)
+	}
+	if _, err := d.openLeague(league); err != nil {
+		os.RemoveAll(filepath.Join(d.dir, league))
+		return err
+	}
+	return nil
+}
+
+// DeleteLeague waits for everyone using the league's store to be done,
+// then closes it and removes everything in it. The league can't be used
+// or created again while it waits.
+func (d *DirLeagueStore) DeleteLeague(league string) error {
+	if league == DefaultLeague {
+		return ErrDefaultLeague
+	}
+	if err := checkLeagueName(league); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	if d.deleting[league] || !d.exists(league) {
+		d.mu.Unlock()
+		return ErrLeagueNotFound
+	}
+	open := d.stores[league]
+	delete(d.stores, league)
+	d.deleting[league] = true
+	d.mu.Unlock()
+
+	defer func() {
+		d.mu.Lock()
+		delete(d.deleting, league)
+		d.mu.Unlock()
+	}()
+
+	if open != nil {
+		open.inUse.Lock()
+		defer open.inUse.Unlock()
+		if err := open.close(); err != nil {
+			return fmt.Errorf("problem closing league %s, %v", league, err)
+		}
+	}
+	if err := os.RemoveAll(filepath.Join(d.dir, league)); err != nil {
+		return fmt.Errorf("problem removing league %s, %v", league, err)
+	}
+	return nil
+}
+
+func (d *DirLeagueStore) Leagues() ([]string, error) {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return nil, fmt.Errorf("problem listing leagues, %v", err)
+	}
+
+	var leagues []string
+	for _, entry := range entries {
+		if entry.IsDir() && checkLeagueName(entry.Name()) == nil {
+			leagues = append(leagues, entry.Name())
+		}
+	}
+	sort.Strings(leagues)
+	return leagues, nil
+}
+
+// Close closes every league's store that was opened.
+func (d *DirLeagueStore) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var errs []error
+	for league, open := range d.stores {
+		if err := open.close(); err != nil {
+			errs = append(errs, fmt.Errorf("problem closing league %s, %v", league, err))
+		}
+		delete(d.stores, league)
+	}
+	return errors.Join(errs...)
+}
+
+func (d *DirLeagueStore) exists(league string) bool {
+	info, err := os.Stat(filepath.Join(d.dir, league))
+	return err == nil && info.IsDir()
+}
+
+func (d *DirLeagueStore) openLeague(league string) (*openLeague, error) {
+	store, close, err := d.open(filepath.Join(d.dir, league))
+	if err != nil {
+		return nil, fmt.Errorf("problem opening league %s, %w", league, err)
+	}
+	open := &openLeague{store: store, close: close}
+	d.stores[league] = open
+	return open, nil
+}
+
+// checkLeagueName keeps league names to what's safe in a path, both on
+// disk and in a URL.
+func checkLeagueName(league string) error {
+	if league == "" || len(league) > maxLeagueNameLength || league[0] == '-' {
+		return ErrInvalidLeagueName
+	}
+	for _, r := range league {
+		if !('a' <= r && r <= 'z' || '0' <= r && r <= '9' || r == '-') {
+			return ErrInvalidLeagueName
+		}
+	}
+	return nil
+}
+
+// WithLeagues serves leagues other than the default one from leagues,
+// under /leagues. Only wins are kept for them: ratings, win history, the
+// league stream, replication and backups are the default league's alone,
+// so asking a named league for its ratings or history is turned down.
+func WithLeagues(leagues LeagueStore) PlayerServerOption {
+	return func(p *PlayerServer) {
+		p.leagues = leagues
+	}
+}
+
+type leagueContextKey struct{}
+
+// leagueScope is the league a request under /leagues/{league} is for.
+type leagueScope struct {
+	name  string
+	store PlayerStore
+}
+
+func scopeFor(r *http.Request) (leagueScope, bool) {
+	scope, ok := r.Context().Value(leagueContextKey{}).(leagueScope)
+	return scope, ok
+}
+
+// storeFor is the store of the league r is for.
+func (p *PlayerServer) storeFor(r *http.Request) PlayerStore {
+	if scope, ok := scopeFor(r); ok {
+		return scope.store
+	}
+	return p.store
+}
+
+// inDefaultLeague is whether r is for the default league, however it got
+// there, as that's the only one with ratings and history.
+func inDefaultLeague(r *http.Request) bool {
+	scope, ok := scopeFor(r)
+	return !ok || scope.name == DefaultLeague
+}
+
+func (p *PlayerServer) resultsFor(r *http.Request) ResultStore {
+	if !inDefaultLeague(r) {
+		return nil
+	}
+	return p.results
+}
+
+func (p *PlayerServer) historyFor(r *http.Request) WinHistory {
+	if !inDefaultLeague(r) {
+		return nil
+	}
+	return p.history
+}
+
+// playersPath is where the players of the league r is for are served.
+func playersPath(r *http.Request) string {
+	if scope, ok := scopeFor(r); ok {
+		return "/leagues/" + scope.name + "/players/"
+	}
+	return "/players/"
+}
+
+// inLeague serves next for the league named in the path.
+func (p *PlayerServer) inLeague(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		league := r.PathValue("league")
+
+		scope := leagueScope{name: league, store: p.store}
+		if league != DefaultLeague {
+			store, release, err := p.leagues.Store(league)
+			if err != nil {
+				writeStoreError(w, r, err)
+				return
+			}
+			defer release()
+			scope.store = store
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), leagueContextKey{}, scope)))
+	}
+}
+
+type LeagueSummary struct {
+	Name    string
+	Players int
+}
+
+type createLeagueRequest struct {
+	Name string
+}
+
+func (p *PlayerServer) leaguesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		p.listLeagues(w, r)
+	case http.MethodPost:
+		p.createLeague(w, r)
+	default:
+		methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+	}
+}
+
+func (p *PlayerServer) listLeagues(w http.ResponseWriter, r *http.Request) {
+	names, err := p.leagues.Leagues()
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+
+	summaries := []LeagueSummary{{Name: DefaultLeague}}
+	league, err := p.store.GetLeague()
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	summaries[0].Players = len(league)
+
+	for _, name := range names {
+		players, err := p.leaguePlayers(name)
+		if errors.Is(err, ErrLeagueNotFound) {
+			// deleted since it was listed
+			continue
+		}
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+		summaries = append(summaries, LeagueSummary{Name: name, Players: players})
+	}
+
+	w.Header().Set("content-type", jsonContentType)
+	json.NewEncoder(w).Encode(summaries)
+}
+
+func (p *PlayerServer) leaguePlayers(name string) (int, error) {
+	store, release, err := p.leagues.Store(name)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	league, err := store.GetLeague()
+	return len(league), err
+}
+
+func (p *PlayerServer) createLeague(w http.ResponseWriter, r *http.Request) {
+	var req createLeagueRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		writeProblem(w, r, http.StatusBadRequest, `expected a body like {"Name": "london"}`)
+		return
+	}
+
+	if err := p.leagues.CreateLeague(req.Name); err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	p.auditLeague(r, AuditCreateLeague, req.Name)
+	w.Header().Set("Location", "/leagues/"+req.Name)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (p *PlayerServer) namedLeagueHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		p.inLeague(p.leagueHandler)(w, r)
+	case http.MethodDelete:
+		p.deleteLeague(w, r)
+	default:
+		methodNotAllowed(w, r, http.MethodDelete, http.MethodGet)
+	}
+}
+
+func (p *PlayerServer) deleteLeague(w http.ResponseWriter, r *http.Request) {
+	league := r.PathValue("league")
+	if err := p.leagues.DeleteLeague(league); err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	p.auditLeague(r, AuditDeleteLeague, league)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,275 @@
+package poker
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newDirLeagueStore(t testing.TB, dir string) *DirLeagueStore {
+	t.Helper()
+
+	leagues, err := NewDirLeagueStore(dir, func(dir string) (PlayerStore, func() error, error) {
+		store, close, err := FileSystemPlayerStoreFromFile(filepath.Join(dir, "game.db.json"))
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, func() error { close(); return nil }, nil
+	})
+	assertNoError(t, err)
+	t.Cleanup(func() { leagues.Close() })
+	return leagues
+}
+
+// leagueStore is the store for league, given back when the test is done.
+func leagueStore(t testing.TB, leagues LeagueStore, league string) PlayerStore {
+	t.Helper()
+	store, release, err := leagues.Store(league)
+	assertNoError(t, err)
+	t.Cleanup(release)
+	return store
+}
+
+func TestDirLeagueStore(t *testing.T) {
+	t.Run("created leagues are listed and have their own players", func(t *testing.T) {
+		leagues := newDirLeagueStore(t, t.TempDir())
+
+		assertNoError(t, leagues.CreateLeague("london"))
+		assertNoError(t, leagues.CreateLeague("berlin"))
+
+		london := leagueStore(t, leagues, "london")
+		assertNoError(t, london.RecordWin("Pepper"))
+
+		berlin := leagueStore(t, leagues, "berlin")
+		_, err := berlin.GetPlayerScore("Pepper")
+		assertError(t, err, ErrPlayerNotFound)
+
+		assertLeagueNames(t, leagues, []string{"berlin", "london"})
+	})
+
+	t.Run("leagues are still there when opened again", func(t *testing.T) {
+		dir := t.TempDir()
+		leagues := newDirLeagueStore(t, dir)
+		assertNoError(t, leagues.CreateLeague("london"))
+		london, release, err := leagues.Store("london")
+		assertNoError(t, err)
+		assertNoError(t, london.RecordWin("Pepper"))
+		release()
+		assertNoError(t, leagues.Close())
+
+		leagues = newDirLeagueStore(t, dir)
+		assertScoreInStore(t, leagueStore(t, leagues, "london"), "Pepper", 1)
+	})
+
+	t.Run("deleting a league removes it", func(t *testing.T) {
+		dir := t.TempDir()
+		leagues := newDirLeagueStore(t, dir)
+		assertNoError(t, leagues.CreateLeague("london"))
+
+		assertNoError(t, leagues.DeleteLeague("london"))
+
+		_, _, err := leagues.Store("london")
+		assertError(t, err, ErrLeagueNotFound)
+		if _, err := os.Stat(filepath.Join(dir, "london")); !os.IsNotExist(err) {
+			t.Errorf("league's directory is still there, %v", err)
+		}
+	})
+
+	t.Run("turns down what it can't do", func(t *testing.T) {
+		leagues := newDirLeagueStore(t, t.TempDir())
+		assertNoError(t, leagues.CreateLeague("london"))
+
+		assertError(t, leagues.CreateLeague("london"), ErrLeagueExists)
+		assertError(t, leagues.CreateLeague(DefaultLeague), ErrLeagueExists)
+		assertError(t, leagues.DeleteLeague(DefaultLeague), ErrDefaultLeague)
+		assertError(t, leagues.DeleteLeague("paris"), ErrLeagueNotFound)
+		_, _, err := leagues.Store("paris")
+		assertError(t, err, ErrLeagueNotFound)
+
+		for _, name := range []string{"", "London", "-london", "../london", "new york", strings.Repeat("a", 33)} {
+			assertError(t, leagues.CreateLeague(name), ErrInvalidLeagueName)
+		}
+	})
+
+	t.Run("a league in use is deleted once it's done with", func(t *testing.T) {
+		leagues := newDirLeagueStore(t, t.TempDir())
+		assertNoError(t, leagues.CreateLeague("london"))
+		london, release, err := leagues.Store("london")
+		assertNoError(t, err)
+
+		deleted := make(chan error)
+		go func() { deleted <- leagues.DeleteLeague("london") }()
+
+		eventually(t, func() bool {
+			_, release, err := leagues.Store("london")
+			if err == nil {
+				release()
+			}
+			return errors.Is(err, ErrLeagueNotFound)
+		})
+		assertError(t, leagues.CreateLeague("london"), ErrLeagueExists)
+		assertNoError(t, london.RecordWin("Pepper"))
+
+		select {
+		case err := <-deleted:
+			t.Fatalf("deleted the league while it was in use, %v", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		release()
+		assertNoError(t, <-deleted)
+		assertLeagueNames(t, leagues, nil)
+	})
+}
+
+func TestLeaguesServer(t *testing.T) {
+	newServer := func(t *testing.T, options ...PlayerServerOption) (*PlayerServer, *StubPlayerStore, *DirLeagueStore) {
+		store := &StubPlayerStore{map[string]int{"Pepper": 20}, nil, League{{"Pepper", 20}}}
+		leagues := newDirLeagueStore(t, t.TempDir())
+		assertNoError(t, leagues.CreateLeague("london"))
+		options = append(options, WithLeagues(leagues))
+		return NewPlayerServer(store, dummyGame, options...), store, leagues
+	}
+
+	serve := func(server *PlayerServer, method, path, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, strings.NewReader(body))
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("each league keeps its own players", func(t *testing.T) {
+		server, store, leagues := newServer(t)
+
+		assertStatus(t, serve(server, http.MethodPost, "/leagues/london/players/Chris", "").Code, http.StatusAccepted)
+
+		assertScoreInStore(t, leagueStore(t, leagues, "london"), "Chris", 1)
+		if len(store.winCalls) != 0 {
+			t.Errorf("the default league got wins %v", store.winCalls)
+		}
+
+		response := serve(server, http.MethodGet, "/leagues/london/players/Chris", "")
+		assertStatus(t, response.Code, http.StatusOK)
+		assertResponseBody(t, response.Body.String(), "1")
+
+		response = serve(server, http.MethodGet, "/leagues/london", "")
+		assertStatus(t, response.Code, http.StatusOK)
+		assertLeague(t, getLeagueFromResponse(t, response.Body), League{{"Chris", 1}})
+	})
+
+	t.Run("the default league is there under its name too", func(t *testing.T) {
+		server, store, _ := newServer(t)
+
+		assertStatus(t, serve(server, http.MethodPost, "/leagues/default/players/Pepper", "").Code, http.StatusAccepted)
+		assertPlayerWin(t, store, "Pepper")
+
+		for _, path := range []string{"/league", "/leagues/default"} {
+			response := serve(server, http.MethodGet, path, "")
+			assertStatus(t, response.Code, http.StatusOK)
+			assertLeague(t, getLeagueFromResponse(t, response.Body), League{{"Pepper", 20}})
+		}
+	})
+
+	t.Run("leagues can be listed, created and deleted", func(t *testing.T) {
+		server, _, _ := newServer(t)
+
+		response := serve(server, http.MethodPost, "/leagues", `{"Name": "berlin"}`)
+		assertStatus(t, response.Code, http.StatusCreated)
+		if got := response.Header().Get("Location"); got != "/leagues/berlin" {
+			t.Errorf("got Location %q want /leagues/berlin", got)
+		}
+
+		assertStatus(t, serve(server, http.MethodDelete, "/leagues/london", "").Code, http.StatusNoContent)
+
+		response = serve(server, http.MethodGet, "/leagues", "")
+		assertStatus(t, response.Code, http.StatusOK)
+		var got []LeagueSummary
+		if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+			t.Fatalf("could not parse %q, %v", response.Body, err)
+		}
+		want := []LeagueSummary{{Name: DefaultLeague, Players: 1}, {Name: "berlin", Players: 0}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %+v want %+v", got, want)
+		}
+	})
+
+	t.Run("tells the client what went wrong", func(t *testing.T) {
+		server, _, _ := newServer(t)
+
+		assertProblem(t, serve(server, http.MethodGet, "/leagues/paris", ""), http.StatusNotFound, "/leagues/paris")
+		assertProblem(t, serve(server, http.MethodPost, "/leagues/paris/players/Chris", ""), http.StatusNotFound, "/leagues/paris/players/Chris")
+		assertProblem(t, serve(server, http.MethodPost, "/leagues", `{"Name": "london"}`), http.StatusConflict, "/leagues")
+		assertProblem(t, serve(server, http.MethodPost, "/leagues", `{"Name": "New York"}`), http.StatusBadRequest, "/leagues")
+		assertProblem(t, serve(server, http.MethodDelete, "/leagues/default", ""), http.StatusConflict, "/leagues/default")
+	})
+
+	t.Run("only the default league has ratings and history", func(t *testing.T) {
+		results := newStubResultStore()
+		results.RecordResult(GameResult{Winner: "Pepper", Losers: []string{"Chris"}})
+		history, _ := newHistoryStore(t, &StubPlayerStore{}, filepath.Join(t.TempDir(), "history.log"))
+		server, _, _ := newServer(t, WithRatings(results), WithHistory(history))
+
+		assertStatus(t, serve(server, http.MethodGet, "/leagues/default/players/Pepper/rating", "").Code, http.StatusOK)
+		assertProblem(t, serve(server, http.MethodGet, "/leagues/london/players/Pepper/rating", ""), http.StatusNotFound, "/leagues/london/players/Pepper/rating")
+		assertProblem(t, serve(server, http.MethodGet, "/leagues/london/players/Pepper/history", ""), http.StatusNotFound, "/leagues/london/players/Pepper/history")
+		assertProblem(t, serve(server, http.MethodGet, "/leagues/london?rank=rating", ""), http.StatusBadRequest, "/leagues/london")
+		assertProblem(t, serve(server, http.MethodGet, "/leagues/london?period=week", ""), http.StatusBadRequest, "/leagues/london")
+	})
+
+	t.Run("the league page links to the league's players", func(t *testing.T) {
+		server, _, leagues := newServer(t)
+		leagueStore(t, leagues, "london").RecordWin("Chris")
+
+		request, _ := http.NewRequest(http.MethodGet, "/leagues/london", nil)
+		request.Header.Set("Accept", browserAccept)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		for _, want := range []string{"<h1>london league</h1>", `href="/leagues/london/players/Chris"`} {
+			if !strings.Contains(response.Body.String(), want) {
+				t.Errorf("page is missing %s", want)
+			}
+		}
+	})
+
+	t.Run("changes are audited with their league", func(t *testing.T) {
+		auditLog := &SpyAuditLog{}
+		server, _, _ := newServer(t, WithAuditLog(auditLog))
+
+		serve(server, http.MethodPost, "/leagues/london/players/Chris", "")
+		serve(server, http.MethodPost, "/leagues", `{"Name": "berlin"}`)
+
+		if len(auditLog.entries) != 2 {
+			t.Fatalf("got %d audit entries want 2", len(auditLog.entries))
+		}
+		if entry := auditLog.entries[0]; entry.League != "london" || entry.Player != "Chris" || entry.Action != AuditWin {
+			t.Errorf("got %+v for the win", entry)
+		}
+		if entry := auditLog.entries[1]; entry.League != "berlin" || entry.Action != AuditCreateLeague {
+			t.Errorf("got %+v for the new league", entry)
+		}
+	})
+
+	t.Run("there are no other leagues without a league store", func(t *testing.T) {
+		server := NewPlayerServer(&StubPlayerStore{}, dummyGame)
+
+		assertStatus(t, serve(server, http.MethodGet, "/leagues", "").Code, http.StatusNotFound)
+	})
+}
+
+func assertLeagueNames(t testing.TB, leagues LeagueStore, want []string) {
+	t.Helper()
+	got, err := leagues.Leagues()
+	assertNoError(t, err)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got leagues %v want %v", got, want)
+	}
+}
@@ -0,0 +1,187 @@
+//go:build ignore
+
+// maketables writes normalize_tables.go from the Unicode Character
+// Database. Fetch UnicodeData.txt and CompositionExclusions.txt for the
+// version wanted from https://www.unicode.org/Public/ and run
+//
+//	go run maketables.go -version 14.0.0 -data UnicodeData.txt -exclusions CompositionExclusions.txt
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	version := flag.String("version", "", "Unicode version the files are from")
+	dataPath := flag.String("data", "UnicodeData.txt", "path to UnicodeData.txt")
+	exclusionsPath := flag.String("exclusions", "CompositionExclusions.txt", "path to CompositionExclusions.txt")
+	out := flag.String("out", "normalize_tables.go", "file to write")
+	flag.Parse()
+
+	if *version == "" {
+		log.Fatal("-version is needed, so the tables say what they're from")
+	}
+
+	classes, decompositions := readData(*dataPath)
+	exclusions := readExclusions(*exclusionsPath)
+
+	// pairs starting with a non-starter never compose, and singletons
+	// can't, so only the listed exclusions are left for the table
+	for r, d := range decompositions {
+		if d[1] != 0 && classes[d[0]] != 0 {
+			exclusions[r] = true
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by maketables.go; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package poker\n\n")
+	fmt.Fprintf(&buf, "// unicodeVersion is the version of Unicode these tables are from.\n")
+	fmt.Fprintf(&buf, "const unicodeVersion = %q\n\n", *version)
+
+	writeClasses(&buf, classes)
+	writeDecompositions(&buf, decompositions)
+	writeExclusions(&buf, exclusions)
+
+	source, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatalf("problem formatting tables, %v", err)
+	}
+	if err := os.WriteFile(*out, source, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func readData(path string) (map[rune]uint8, map[rune][2]rune) {
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	classes := map[rune]uint8{}
+	decompositions := map[rune][2]rune{}
+
+	lines := bufio.NewScanner(file)
+	for lines.Scan() {
+		fields := strings.Split(lines.Text(), ";")
+		if len(fields) < 6 {
+			continue
+		}
+		r := parseRune(fields[0])
+
+		class, err := strconv.Atoi(fields[3])
+		if err != nil {
+			log.Fatalf("bad combining class for %U, %v", r, err)
+		}
+		if class != 0 {
+			classes[r] = uint8(class)
+		}
+
+		// compatibility decompositions are tagged, like "<compat> 0020";
+		// NFC only uses canonical ones
+		decomposition := fields[5]
+		if decomposition == "" || strings.HasPrefix(decomposition, "<") {
+			continue
+		}
+		parts := strings.Fields(decomposition)
+		if len(parts) > 2 {
+			log.Fatalf("%U decomposes to %d runes, want at most 2", r, len(parts))
+		}
+		var d [2]rune
+		for i, part := range parts {
+			d[i] = parseRune(part)
+		}
+		decompositions[r] = d
+	}
+	if err := lines.Err(); err != nil {
+		log.Fatal(err)
+	}
+	return classes, decompositions
+}
+
+func readExclusions(path string) map[rune]bool {
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	exclusions := map[rune]bool{}
+	lines := bufio.NewScanner(file)
+	for lines.Scan() {
+		line, _, _ := strings.Cut(lines.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			exclusions[parseRune(line)] = true
+		}
+	}
+	if err := lines.Err(); err != nil {
+		log.Fatal(err)
+	}
+	return exclusions
+}
+
+func writeClasses(buf *bytes.Buffer, classes map[rune]uint8) {
+	runes := sortedRunes(classes)
+
+	fmt.Fprintf(buf, "// combiningClasses are the runs of runes with a canonical combining\n")
+	fmt.Fprintf(buf, "// class other than zero, in order.\n")
+	fmt.Fprintf(buf, "var combiningClasses = []combiningClassRange{\n")
+	for i := 0; i < len(runes); {
+		lo, class := runes[i], classes[runes[i]]
+		j := i + 1
+		for j < len(runes) && runes[j] == runes[j-1]+1 && classes[runes[j]] == class {
+			j++
+		}
+		fmt.Fprintf(buf, "\t{0x%04X, 0x%04X, %d},\n", lo, runes[j-1], class)
+		i = j
+	}
+	fmt.Fprintf(buf, "}\n\n")
+}
+
+func writeDecompositions(buf *bytes.Buffer, decompositions map[rune][2]rune) {
+	fmt.Fprintf(buf, "// canonicalDecompositions take a rune one step apart; the second rune\n")
+	fmt.Fprintf(buf, "// is zero for those that decompose to a single rune.\n")
+	fmt.Fprintf(buf, "var canonicalDecompositions = map[rune][2]rune{\n")
+	for _, r := range sortedRunes(decompositions) {
+		d := decompositions[r]
+		fmt.Fprintf(buf, "\t0x%04X: {0x%04X, 0x%04X},\n", r, d[0], d[1])
+	}
+	fmt.Fprintf(buf, "}\n\n")
+}
+
+func writeExclusions(buf *bytes.Buffer, exclusions map[rune]bool) {
+	fmt.Fprintf(buf, "// compositionExclusions decompose to a pair of runes that NFC must\n")
+	fmt.Fprintf(buf, "// not put back together.\n")
+	fmt.Fprintf(buf, "var compositionExclusions = map[rune]bool{\n")
+	for _, r := range sortedRunes(exclusions) {
+		fmt.Fprintf(buf, "\t0x%04X: true,\n", r)
+	}
+	fmt.Fprintf(buf, "}\n")
+}
+
+func sortedRunes[V any](m map[rune]V) []rune {
+	runes := make([]rune, 0, len(m))
+	for r := range m {
+		runes = append(runes, r)
+	}
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+	return runes
+}
+
+func parseRune(hex string) rune {
+	r, err := strconv.ParseUint(strings.TrimSpace(hex), 16, 32)
+	if err != nil {
+		log.Fatalf("bad code point %q, %v", hex, err)
+	}
+	return rune(r)
+}
@@ -0,0 +1,321 @@
+package poker
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultLatencyBuckets are the upper bounds, in seconds, of the latency
+// histograms.
+var DefaultLatencyBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metrics collects what the server is doing and writes it out in the
+// Prometheus text exposition format. Each series is kept under its
+// rendered labels, which is all the exposition format needs.
+type Metrics struct {
+	mu          sync.Mutex
+	requests    map[string]float64
+	durations   map[string]*histogram
+	storeWrites map[string]*histogram
+	wins        float64
+	buckets     []float64
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests:    map[string]float64{},
+		durations:   map[string]*histogram{},
+		storeWrites: map[string]*histogram{},
+		buckets:     DefaultLatencyBuckets,
+	}
+}
+
+func (m *Metrics) observeRequest(route, method string, code int, took time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[labels("code", strconv.Itoa(code), "method", method, "route", route)]++
+	m.observe(m.durations, labels("route", route), took)
+}
+
+func (m *Metrics) observeStoreWrite(op string, took time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.observe(m.storeWrites, labels("op", op), took)
+}
+
+func (m *Metrics) winRecorded() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.wins++
+}
+
+func (m *Metrics) observe(series map[string]*histogram, key string, took time.Duration) {
+	h, ok := series[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		series[key] = h
+	}
+
+	seconds := took.Seconds()
+	for i, bound := range m.buckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// WriteMetrics writes every series out, along with leagueSize players in
+// the league.
+func (m *Metrics) WriteMetrics(w io.Writer, leagueSize int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := bufio.NewWriter(w)
+
+	header(out, "poker_http_requests_total", "counter", "Requests served, by route, method and status code.")
+	for _, key := range sortedKeys(m.requests) {
+		fmt.Fprintf(out, "poker_http_requests_total%s %s\n", key, formatFloat(m.requests[key]))
+	}
+
+	header(out, "poker_http_request_duration_seconds", "histogram", "How long requests took to serve, by route.")
+	m.writeHistograms(out, "poker_http_request_duration_seconds", m.durations)
+
+	header(out, "poker_wins_recorded_total", "counter", "Wins recorded since the server started.")
+	fmt.Fprintf(out, "poker_wins_recorded_total %s\n", formatFloat(m.wins))
+
+	header(out, "poker_store_write_duration_seconds", "histogram", "How long writes to the player store took, by operation.")
+	m.writeHistograms(out, "poker_store_write_duration_seconds", m.storeWrites)
+
+	header(out, "poker_league_players", "gauge", "Players in the league.")
+	fmt.Fprintf(out, "poker_league_players %d\n", leagueSize)
+
+	return out.Flush()
+}
+
+func (m *Metrics) writeHistograms(out io.Writer, name string, series map[string]*histogram) {
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		h := series[key]
+		// the le label goes last, inside the braces the key already has
+		withLE := func(le string) string {
+			return strings.TrimSuffix(key, "}") + `,le="` + le + `"}`
+		}
+		for i, bound := range m.buckets {
+			fmt.Fprintf(out, "%s_bucket%s %d\n", name, withLE(formatFloat(bound)), h.counts[i])
+		}
+		fmt.Fprintf(out, "%s_bucket%s %d\n", name, withLE("+Inf"), h.count)
+		fmt.Fprintf(out, "%s_sum%s %s\n", name, key, formatFloat(h.sum))
+		fmt.Fprintf(out, "%s_count%s %d\n", name, key, h.count)
+	}
+}
+
+func header(out io.Writer, name, kind, help string) {
+	fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func sortedKeys(series map[string]float64) []string {
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels renders name, value pairs as {name="value",...}.
+func labels(pairs ...string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, pairs[i], labelEscaper.Replace(pairs[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func (p *PlayerServer) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	league, err := p.store.GetLeague()
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+
+	w.Header().Set("content-type", metricsContentType)
+	p.metrics.WriteMetrics(w, len(league))
+}
+
+// statusRecorder remembers what a handler answered so it can be logged and
+// counted. It passes hijacking and flushing through, as the websocket and
+// anything streaming need them.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(p)
+	s.bytes += n
+	return n, err
+}
+
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T cannot be hijacked", s.ResponseWriter)
+	}
+	conn, buf, err := hijacker.Hijack()
+	if err == nil {
+		s.status = http.StatusSwitchingProtocols
+	}
+	return conn, buf, err
+}
+
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		if s.status == 0 {
+			s.status = http.StatusOK
+		}
+		flusher.Flush()
+	}
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// observe logs and counts every request. Requests are counted under the
+// pattern they were routed by rather than their path, so /players/Chris
+// and /players/Cleo are one route.
+func observe(metrics *Metrics, logger *slog.Logger, route func(*http.Request) string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(recorder, r)
+
+		took := time.Since(start)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		pattern := route(r)
+		if pattern == "" {
+			pattern = "unmatched"
+		}
+
+		if metrics != nil {
+			metrics.observeRequest(pattern, r.Method, recorder.status, took)
+		}
+		if logger != nil {
+			logger.LogAttrs(r.Context(), slog.LevelInfo, "request",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("route", pattern),
+				slog.Int("status", recorder.status),
+				slog.Int("bytes", recorder.bytes),
+				slog.Duration("duration", took),
+				slog.String("remote", r.RemoteAddr),
+				slog.String("user_agent", r.UserAgent()),
+			)
+		}
+	})
+}
+
+// InstrumentedPlayerStore times every write to the store it wraps and
+// counts the wins that go through it. Wrap the store the game uses too, so
+// wins from the websocket and the CLI are counted as well.
+type InstrumentedPlayerStore struct {
+	PlayerStore
+	metrics *Metrics
+}
+
+func NewInstrumentedPlayerStore(store PlayerStore, metrics *Metrics) *InstrumentedPlayerStore {
+	return &InstrumentedPlayerStore{store, metrics}
+}
+
+func (i *InstrumentedPlayerStore) timed(op string, write func() error) error {
+	start := time.Now()
+	err := write()
+	i.metrics.observeStoreWrite(op, time.Since(start))
+	return err
+}
+
+// StoredName asks the store underneath, which may keep an index of names.
+func (i *InstrumentedPlayerStore) StoredName(name PlayerName) (string, error) {
+	return resolvePlayerName(i.PlayerStore, name)
+}
+
+func (i *InstrumentedPlayerStore) RecordWin(name string) error {
+	err := i.timed("record_win", func() error { return i.PlayerStore.RecordWin(name) })
+	if err == nil {
+		i.metrics.winRecorded()
+	}
+	return err
+}
+
+func (i *InstrumentedPlayerStore) SetPlayerScore(name string, wins int) error {
+	return i.timed("set", func() error { return i.PlayerStore.SetPlayerScore(name, wins) })
+}
+
+func (i *InstrumentedPlayerStore) DeletePlayer(name string) error {
+	return i.timed("delete", func() error { return i.PlayerStore.DeletePlayer(name) })
+}
+
+func (i *InstrumentedPlayerStore) RenamePlayer(from, to string) error {
+	return i.timed("rename", func() error { return i.PlayerStore.RenamePlayer(from, to) })
+}
+
+func (i *InstrumentedPlayerStore) ImportLeague(league League) error {
+	return i.timed("import", func() error { return i.PlayerStore.ImportLeague(league) })
+}
@@ -0,0 +1,158 @@
+package poker
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsExposition(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.buckets = []float64{0.1, 1}
+
+	metrics.observeRequest("/players/", http.MethodGet, 200, 50*time.Millisecond)
+	metrics.observeRequest("/players/", http.MethodGet, 200, 500*time.Millisecond)
+	metrics.observeRequest("/league", http.MethodGet, 400, time.Millisecond)
+	metrics.observeStoreWrite("record_win", 2*time.Second)
+	metrics.winRecorded()
+
+	var out bytes.Buffer
+	assertNoError(t, metrics.WriteMetrics(&out, 3))
+
+	want := `# HELP poker_http_requests_total Requests served, by route, method and status code.
+# TYPE poker_http_requests_total counter
+poker_http_requests_total{code="200",method="GET",route="/players/"} 2
+poker_http_requests_total{code="400",method="GET",route="/league"} 1
+# HELP poker_http_request_duration_seconds How long requests took to serve, by route.
+# TYPE poker_http_request_duration_seconds histogram
+poker_http_request_duration_seconds_bucket{route="/league",le="0.1"} 1
+poker_http_request_duration_seconds_bucket{route="/league",le="1"} 1
+poker_http_request_duration_seconds_bucket{route="/league",le="+Inf"} 1
+poker_http_request_duration_seconds_sum{route="/league"} 0.001
+poker_http_request_duration_seconds_count{route="/league"} 1
+poker_http_request_duration_seconds_bucket{route="/players/",le="0.1"} 1
+poker_http_request_duration_seconds_bucket{route="/players/",le="1"} 2
+poker_http_request_duration_seconds_bucket{route="/players/",le="+Inf"} 2
+poker_http_request_duration_seconds_sum{route="/players/"} 0.55
+poker_http_request_duration_seconds_count{route="/players/"} 2
+# HELP poker_wins_recorded_total Wins recorded since the server started.
+# TYPE poker_wins_recorded_total counter
+poker_wins_recorded_total 1
+# HELP poker_store_write_duration_seconds How long writes to the player store took, by operation.
+# TYPE poker_store_write_duration_seconds histogram
+poker_store_write_duration_seconds_bucket{op="record_win",le="0.1"} 0
+poker_store_write_duration_seconds_bucket{op="record_win",le="1"} 0
+poker_store_write_duration_seconds_bucket{op="record_win",le="+Inf"} 1
+poker_store_write_duration_seconds_sum{op="record_win"} 2
+poker_store_write_duration_seconds_count{op="record_win"} 1
+# HELP poker_league_players Players in the league.
+# TYPE poker_league_players gauge
+poker_league_players 3
+`
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestLabelEscaping(t *testing.T) {
+	got := labels("route", `a"b\c`+"\n")
+	want := `{route="a\"b\\c\n"}`
+	if got != want {
+		t.Errorf("got %s want %s", got, want)
+	}
+}
+
+func TestObservedServer(t *testing.T) {
+	newServer := func() (*PlayerServer, *syncBuffer) {
+		metrics := NewMetrics()
+		logs := &syncBuffer{}
+		store := &StubPlayerStore{map[string]int{"Pepper": 20}, nil, League{{"Pepper", 20}, {"Floyd", 10}}}
+		server := NewPlayerServer(NewInstrumentedPlayerStore(store, metrics), dummyGame,
+			WithMetrics(metrics), WithAccessLog(slog.New(slog.NewJSONHandler(logs, nil))))
+		return server, logs
+	}
+
+	scrape := func(t testing.TB, server *PlayerServer) string {
+		t.Helper()
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		assertStatus(t, response.Code, http.StatusOK)
+		if got := response.Header().Get("content-type"); got != metricsContentType {
+			t.Errorf("got content-type %q want %q", got, metricsContentType)
+		}
+		return response.Body.String()
+	}
+
+	t.Run("counts requests by route rather than path", func(t *testing.T) {
+		server, _ := newServer()
+
+		server.ServeHTTP(httptest.NewRecorder(), newPlayersRequest(http.MethodGet, "Pepper"))
+		server.ServeHTTP(httptest.NewRecorder(), newPlayersRequest(http.MethodGet, "Nobody"))
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nowhere", nil))
+
+		body := scrape(t, server)
+		assertMetric(t, body, `poker_http_requests_total{code="200",method="GET",route="/players/"} 1`)
+		assertMetric(t, body, `poker_http_requests_total{code="404",method="GET",route="/players/"} 1`)
+		assertMetric(t, body, `poker_http_requests_total{code="404",method="GET",route="unmatched"} 1`)
+		assertMetric(t, body, `poker_http_request_duration_seconds_count{route="/players/"} 2`)
+		assertMetric(t, body, `poker_league_players 2`)
+	})
+
+	t.Run("counts wins and times store writes", func(t *testing.T) {
+		server, _ := newServer()
+
+		server.ServeHTTP(httptest.NewRecorder(), newPlayersRequest(http.MethodPost, "Pepper"))
+		server.ServeHTTP(httptest.NewRecorder(), newPlayersRequestWithBody(http.MethodPut, "Pepper", `{"Wins": 3}`))
+
+		body := scrape(t, server)
+		assertMetric(t, body, `poker_wins_recorded_total 1`)
+		assertMetric(t, body, `poker_store_write_duration_seconds_count{op="record_win"} 1`)
+		assertMetric(t, body, `poker_store_write_duration_seconds_count{op="set"} 1`)
+	})
+
+	t.Run("logs every request", func(t *testing.T) {
+		server, logs := newServer()
+
+		server.ServeHTTP(httptest.NewRecorder(), newPlayersRequest(http.MethodGet, "Pepper"))
+
+		var entry map[string]interface{}
+		assertNoError(t, json.Unmarshal([]byte(logs.String()), &entry))
+		if entry["msg"] != "request" || entry["path"] != "/players/Pepper" || entry["route"] != "/players/" || entry["status"] != float64(200) {
+			t.Errorf("got log entry %v, want a 200 for /players/Pepper", entry)
+		}
+	})
+
+	t.Run("the websocket still upgrades", func(t *testing.T) {
+		server, logs := newServer()
+		httpServer := httptest.NewServer(server)
+		defer httpServer.Close()
+
+		ws := mustDialWS(t, httpServer.URL)
+		ws.send(t, opText, "3")
+		ws.send(t, opText, "Ruth")
+		ws.waitForClose(t)
+		ws.conn.Close()
+
+		// the log line is written once the handler returns
+		deadline := time.Now().Add(time.Second)
+		for !strings.Contains(logs.String(), `"status":101`) && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		assertMetric(t, scrape(t, server), `poker_http_requests_total{code="101",method="GET",route="/ws"} 1`)
+	})
+}
+
+func assertMetric(t testing.TB, body, line string) {
+	t.Helper()
+	for _, got := range strings.Split(body, "\n") {
+		if got == line {
+			return
+		}
+	}
+	t.Errorf("metrics did not include %q, got\n%s", line, body)
+}
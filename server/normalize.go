@@ -0,0 +1,161 @@
+package poker
+
+import (
+	"sort"
+	"sync"
+)
+
+//go:generate go run maketables.go -version 14.0.0 -data UnicodeData.txt -exclusions CompositionExclusions.txt
+
+// NFC puts s into Unicode Normalization Form C, so that text which looks
+// the same, like "é" typed as one rune or as "e" and a combining accent,
+// is the same string. See https://unicode.org/reports/tr15/.
+func NFC(s string) string {
+	if isNFCQuick(s) {
+		return s
+	}
+
+	var runes []rune
+	for _, r := range s {
+		runes = appendDecomposed(runes, r)
+	}
+	reorder(runes)
+	return string(compose(runes))
+}
+
+// isNFCQuick is true for the common case of text with nothing below
+// U+0300 that could decompose or combine.
+func isNFCQuick(s string) bool {
+	for _, r := range s {
+		if r >= 0x300 {
+			return false
+		}
+	}
+	return true
+}
+
+// Hangul syllables are decomposed and composed by arithmetic rather than
+// from the tables.
+const (
+	hangulSBase  = 0xAC00
+	hangulLBase  = 0x1100
+	hangulVBase  = 0x1161
+	hangulTBase  = 0x11A7
+	hangulLCount = 19
+	hangulVCount = 21
+	hangulTCount = 28
+	hangulNCount = hangulVCount * hangulTCount
+	hangulSCount = hangulLCount * hangulNCount
+)
+
+func appendDecomposed(runes []rune, r rune) []rune {
+	if s := r - hangulSBase; s >= 0 && s < hangulSCount {
+		runes = append(runes, hangulLBase+s/hangulNCount, hangulVBase+(s%hangulNCount)/hangulTCount)
+		if t := s % hangulTCount; t != 0 {
+			runes = append(runes, hangulTBase+t)
+		}
+		return runes
+	}
+
+	d, ok := canonicalDecompositions[r]
+	if !ok {
+		return append(runes, r)
+	}
+	runes = appendDecomposed(runes, d[0])
+	if d[1] != 0 {
+		runes = appendDecomposed(runes, d[1])
+	}
+	return runes
+}
+
+// reorder puts every run of combining marks into canonical order, which is
+// by combining class, keeping marks of the same class as they were.
+func reorder(runes []rune) {
+	for i := 0; i < len(runes); {
+		if combiningClass(runes[i]) == 0 {
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(runes) && combiningClass(runes[j]) != 0 {
+			j++
+		}
+		marks := runes[i:j]
+		sort.SliceStable(marks, func(a, b int) bool {
+			return combiningClass(marks[a]) < combiningClass(marks[b])
+		})
+		i = j
+	}
+}
+
+// compose puts decomposed runes back together where it can, in place. A
+// mark combines with the last starter unless a mark of the same or a
+// lower class comes between them.
+func compose(runes []rune) []rune {
+	if len(runes) == 0 {
+		return runes
+	}
+
+	starter, last := 0, int(combiningClass(runes[0]))
+	if last != 0 {
+		// nothing can combine with a leading mark
+		last = 256
+	}
+	out := 1
+	for _, r := range runes[1:] {
+		class := int(combiningClass(r))
+		if composite, ok := composePair(runes[starter], r); ok && (last < class || last == 0) {
+			runes[starter] = composite
+			continue
+		}
+		if class == 0 {
+			starter = out
+		}
+		last = class
+		runes[out] = r
+		out++
+	}
+	return runes[:out]
+}
+
+func composePair(a, b rune) (rune, bool) {
+	if l, v := a-hangulLBase, b-hangulVBase; l >= 0 && l < hangulLCount && v >= 0 && v < hangulVCount {
+		return hangulSBase + (l*hangulVCount+v)*hangulTCount, true
+	}
+	if s, t := a-hangulSBase, b-hangulTBase; s >= 0 && s < hangulSCount && s%hangulTCount == 0 && t > 0 && t < hangulTCount {
+		return a + t, true
+	}
+
+	composite, ok := compositions()[[2]rune{a, b}]
+	return composite, ok
+}
+
+// compositions is canonicalDecompositions turned around, less the pairs
+// that are excluded from composing.
+var compositions = sync.OnceValue(func() map[[2]rune]rune {
+	pairs := map[[2]rune]rune{}
+	for r, d := range canonicalDecompositions {
+		if d[1] != 0 && !compositionExclusions[r] {
+			pairs[d] = r
+		}
+	}
+	return pairs
+})
+
+type combiningClassRange struct {
+	lo, hi rune
+	class  uint8
+}
+
+func combiningClass(r rune) uint8 {
+	if r < 0x300 {
+		return 0
+	}
+	i := sort.Search(len(combiningClasses), func(i int) bool {
+		return combiningClasses[i].hi >= r
+	})
+	if i < len(combiningClasses) && combiningClasses[i].lo <= r {
+		return combiningClasses[i].class
+	}
+	return 0
+}
@@ -0,0 +1,419 @@
+package poker
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxPlayerNameLength is the most characters a name can have.
+const MaxPlayerNameLength = 64
+
+var ErrInvalidName = errors.New("player name is not valid")
+
+// PlayerName is a name as the league keeps it: in NFC, with no space at
+// either end and single spaces inside. Names are told apart without regard
+// to case, see Key, but kept in the case they were given.
+type PlayerName string
+
+// ParsePlayerName tidies raw into a PlayerName, or says why it can't be
+// one. Names can't be empty or longer than MaxPlayerNameLength, and can't
+// hold a / or characters that aren't meant to be seen.
+func ParsePlayerName(raw string) (PlayerName, error) {
+	if !utf8.ValidString(raw) {
+		return "", fmt.Errorf("%q is not UTF-8, %w", raw, ErrInvalidName)
+	}
+
+	name := normaliseName(raw)
+	if name == "" {
+		return "", ErrEmptyName
+	}
+	if length := utf8.RuneCountInString(name); length > MaxPlayerNameLength {
+		return "", fmt.Errorf("%q has %d characters, more than %d, %w", name, length, MaxPlayerNameLength, ErrInvalidName)
+	}
+	for _, r := range name {
+		if !allowedInName(r) {
+			return "", fmt.Errorf("%q can't contain %U, %w", name, r, ErrInvalidName)
+		}
+	}
+	return PlayerName(name), nil
+}
+
+func normaliseName(raw string) string {
+	return NFC(strings.Join(strings.Fields(raw), " "))
+}
+
+func allowedInName(r rune) bool {
+	switch {
+	case r == '/':
+		// it would be taken for part of the path in /players/{name}
+		return false
+	case r == '\u200c', r == '\u200d':
+		// joiners hold some scripts and emoji together
+		return true
+	case unicode.IsControl(r), unicode.Is(unicode.Cf, r), unicode.Is(unicode.Co, r):
+		return false
+	}
+	return true
+}
+
+func (n PlayerName) String() string {
+	return string(n)
+}
+
+// Key is the same for names that differ only in case, in the way
+// strings.EqualFold compares them, and different otherwise.
+func (n PlayerName) Key() string {
+	return strings.Map(foldRune, string(n))
+}
+
+// foldRune picks the smallest rune that folds to the same one as r, so
+// every rune in a fold orbit maps to the same place.
+func foldRune(r rune) rune {
+	smallest := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < smallest {
+			smallest = f
+		}
+	}
+	return smallest
+}
+
+// nameKey is the Key of a name already in the league, which may have been
+// stored before names were tidied.
+func nameKey(stored string) string {
+	return PlayerName(normaliseName(stored)).Key()
+}
+
+// findName is the player in the league who goes by name, in whatever case
+// they were stored.
+func (l League) findName(name PlayerName) *Player {
+	key := name.Key()
+	for i, player := range l {
+		if nameKey(player.Name) == key {
+			return &l[i]
+		}
+	}
+	return nil
+}
+
+// playerNameFromPath unescapes the name in a /players/{name} path, less
+// suffix, like "/rating", for the sub-resources. It goes by the escaped
+// path, so a %2F in a name can't be taken for a separator.
+func playerNameFromPath(r *http.Request, suffix string) (PlayerName, error) {
+	escaped := strings.TrimSuffix(strings.TrimPrefix(r.URL.EscapedPath(), playersPath(r)), suffix)
+	raw, err := url.PathUnescape(escaped)
+	if err != nil {
+		return "", fmt.Errorf("%q is not escaped properly, %w", escaped, ErrInvalidName)
+	}
+	return ParsePlayerName(raw)
+}
+
+// CanonicalNamePlayerStore checks and tidies every name on its way into
+// the store, and gives names that differ only in case to the player
+// already in the league, so "pepper" and "Pepper" are one player, spelt
+// the way they first played. It keeps its own index of the names, so
+// every change to the store has to go through it.
+type CanonicalNamePlayerStore struct {
+	PlayerStore
+	// mu keeps a name from being looked up and then taken by a different
+	// spelling before it's written
+	mu sync.RWMutex
+	// names is how the store spells each player, by the Key of their name.
+	// It's read from the league the first time it's needed.
+	names map[string]string
+}
+
+func NewCanonicalNamePlayerStore(store PlayerStore) *CanonicalNamePlayerStore {
+	return &CanonicalNamePlayerStore{PlayerStore: store}
+}
+
+// load fills names from the league if it hasn't been already. The league
+// is most wins first, so of two players stored before names were tidied
+// the one with more wins is found, as League.findName would.
+func (c *CanonicalNamePlayerStore) load() error {
+	if c.names != nil {
+		return nil
+	}
+	league, err := c.PlayerStore.GetLeague()
+	if err != nil {
+		return err
+	}
+	c.names = indexNames(league)
+	return nil
+}
+
+// indexNames is how league spells each player, by the Key of their name.
+// Of two players in it stored before names were tidied, the first wins.
+func indexNames(league League) map[string]string {
+	names := make(map[string]string, len(league))
+	for _, player := range league {
+		key := nameKey(player.Name)
+		if _, ok := names[key]; !ok {
+			names[key] = player.Name
+		}
+	}
+	return names
+}
+
+// StoredName is the spelling the store knows name by, or name itself for
+// a player it hasn't seen.
+func (c *CanonicalNamePlayerStore) StoredName(name PlayerName) (string, error) {
+	c.mu.RLock()
+	if c.names != nil {
+		defer c.mu.RUnlock()
+		return c.storedName(name), nil
+	}
+	c.mu.RUnlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.load(); err != nil {
+		return "", err
+	}
+	return c.storedName(name), nil
+}
+
+func (c *CanonicalNamePlayerStore) storedName(name PlayerName) string {
+	if stored, ok := c.names[name.Key()]; ok {
+		return stored
+	}
+	return name.String()
+}
+
+// resolve checks raw and finds how the store spells it. It's for changes,
+// so c.mu must be held for writing.
+func (c *CanonicalNamePlayerStore) resolve(raw string) (PlayerName, string, error) {
+	name, err := ParsePlayerName(raw)
+	if err != nil {
+		return "", "", err
+	}
+	if err := c.load(); err != nil {
+		return "", "", err
+	}
+	return name, c.storedName(name), nil
+}
+
+// resolvePlayerName is how store spells name. Stores that keep an index
+// of names are asked; the rest have their league searched.
+func resolvePlayerName(store PlayerStore, name PlayerName) (string, error) {
+	if resolver, ok := store.(interface {
+		StoredName(name PlayerName) (string, error)
+	}); ok {
+		return resolver.StoredName(name)
+	}
+
+	league, err := store.GetLeague()
+	if err != nil {
+		return "", err
+	}
+	if player := league.findName(name); player != nil {
+		return player.Name, nil
+	}
+	return name.String(), nil
+}
+
+func (c *CanonicalNamePlayerStore) GetPlayerScore(raw string) (int, error) {
+	name, err := ParsePlayerName(raw)
+	if err != nil {
+		return 0, err
+	}
+	stored, err := c.StoredName(name)
+	if err != nil {
+		return 0, err
+	}
+	return c.PlayerStore.GetPlayerScore(stored)
+}
+
+func (c *CanonicalNamePlayerStore) RecordWin(raw string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	name, stored, err := c.resolve(raw)
+	if err != nil {
+		return err
+	}
+	if err := c.PlayerStore.RecordWin(stored); err != nil {
+		return err
+	}
+	c.names[name.Key()] = stored
+	return nil
+}
+
+func (c *CanonicalNamePlayerStore) SetPlayerScore(raw string, wins int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	name, stored, err := c.resolve(raw)
+	if err != nil {
+		return err
+	}
+	if err := c.PlayerStore.SetPlayerScore(stored, wins); err != nil {
+		return err
+	}
+	c.names[name.Key()] = stored
+	return nil
+}
+
+func (c *CanonicalNamePlayerStore) DeletePlayer(raw string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	name, stored, err := c.resolve(raw)
+	if err != nil {
+		return err
+	}
+	if err := c.PlayerStore.DeletePlayer(stored); err != nil {
+		return err
+	}
+	delete(c.names, name.Key())
+	return nil
+}
+
+// RenamePlayer can change the case of a name, but not take one that
+// another player has in any case.
+func (c *CanonicalNamePlayerStore) RenamePlayer(from, to string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fromName, stored, err := c.resolve(from)
+	if err != nil {
+		return err
+	}
+	name, err := ParsePlayerName(to)
+	if err != nil {
+		return err
+	}
+	if other, ok := c.names[name.Key()]; ok && other != stored {
+		return ErrPlayerExists
+	}
+
+	if err := c.PlayerStore.RenamePlayer(stored, name.String()); err != nil {
+		return err
+	}
+	delete(c.names, fromName.Key())
+	c.names[name.Key()] = name.String()
+	return nil
+}
+
+// ImportLeague resolves every name like the other changes do, and when the
+// import itself names a player twice the last one wins.
+func (c *CanonicalNamePlayerStore) ImportLeague(league League) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.load(); err != nil {
+		return err
+	}
+
+	var resolved League
+	for _, player := range league {
+		name, err := ParsePlayerName(player.Name)
+		if err != nil {
+			return err
+		}
+		stored := c.storedName(name)
+		if earlier := resolved.findName(name); earlier != nil {
+			stored = earlier.Name
+		}
+		resolved.setWins(stored, player.Wins)
+	}
+	if err := c.PlayerStore.ImportLeague(resolved); err != nil {
+		return err
+	}
+	for _, player := range resolved {
+		c.names[nameKey(player.Name)] = player.Name
+	}
+	return nil
+}
+
+// NameMerge is a player whose name was tidied up, or who other spellings
+// of their name were merged into.
+type NameMerge struct {
+	Name   string
+	Merged []string
+	Wins   int
+}
+
+// MergeDuplicatePlayers is a one off for leagues kept from before names
+// were tidied, where "Pepper", "pepper" and "Pepper " could all be
+// different players. Each lot becomes one player with all their wins,
+// named as whichever had the most wins, tidied up. The merged wins are
+// written before any duplicate is removed, so a merge that fails part way
+// can double count but never lose a win. Stores that keep more about a
+// player, like their history or rating, move it onto the kept name. Names
+// that can't be tidied into valid ones are left alone and returned, to be
+// renamed by hand.
+func MergeDuplicatePlayers(store PlayerStore) (merges []NameMerge, invalid []string, err error) {
+	league, err := store.GetLeague()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var keys []string
+	groups := map[string]League{}
+	for _, player := range league {
+		name, err := ParsePlayerName(player.Name)
+		if err != nil {
+			invalid = append(invalid, player.Name)
+			continue
+		}
+		key := name.Key()
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], player)
+	}
+
+	// the league is most wins first, so each group's first player is the
+	// one whose spelling is kept
+	for _, key := range keys {
+		group := groups[key]
+		keeper := group[0]
+		name := normaliseName(keeper.Name)
+		if len(group) == 1 && keeper.Name == name {
+			continue
+		}
+
+		merge := NameMerge{Name: name, Wins: keeper.Wins}
+		for _, other := range group[1:] {
+			merge.Wins += other.Wins
+		}
+		if merge.Wins != keeper.Wins {
+			if err := store.SetPlayerScore(keeper.Name, merge.Wins); err != nil {
+				return merges, invalid, fmt.Errorf("problem setting %q's wins, %w", keeper.Name, err)
+			}
+		}
+		for _, other := range group[1:] {
+			if err := mergePlayer(store, other.Name, keeper.Name); err != nil {
+				return merges, invalid, fmt.Errorf("problem merging %q into %q, %w", other.Name, keeper.Name, err)
+			}
+			merge.Merged = append(merge.Merged, other.Name)
+		}
+		if keeper.Name != name {
+			if err := store.RenamePlayer(keeper.Name, name); err != nil {
+				return merges, invalid, fmt.Errorf("problem renaming %q to %q, %w", keeper.Name, name, err)
+			}
+			merge.Merged = append(merge.Merged, keeper.Name)
+		}
+		merges = append(merges, merge)
+	}
+	return merges, invalid, nil
+}
+
+// mergePlayer removes from, whose wins are already counted in into, from
+// store. Stores that keep more about a player than their wins move it to
+// into instead of dropping it.
+func mergePlayer(store PlayerStore, from, into string) error {
+	if merger, ok := store.(interface {
+		MergePlayer(from, into string) error
+	}); ok {
+		return merger.MergePlayer(from, into)
+	}
+	return store.DeletePlayer(from)
+}
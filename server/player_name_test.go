@@ -0,0 +1,332 @@
+package poker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNFC(t *testing.T) {
+	cases := []struct {
+		name, in, want string
+	}{
+		{"ascii is left alone", "Pepper", "Pepper"},
+		{"a letter and its accent are composed", "Zoe\u0308", "Zoë"},
+		{"composed letters are left alone", "Zoë", "Zoë"},
+		{"marks are put in order before composing", "a\u0301\u0323", "ạ\u0301"},
+		{"a mark blocked by one of the same class stays apart", "a\u0301\u0301", "á\u0301"},
+		{"singletons are replaced", "\u212b", "Å"},
+		{"excluded compositions stay decomposed", "\u0958", "क\u093c"},
+		{"hangul is composed", "\u1112\u1161\u11ab", "한"},
+		{"hangul syllables are left alone", "한국어", "한국어"},
+		{"a leading mark is kept", "\u0301e", "\u0301e"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := NFC(c.in)
+			if got != c.want {
+				t.Errorf("got %+q want %+q", got, c.want)
+			}
+			if again := NFC(got); again != got {
+				t.Errorf("normalising %+q again gave %+q", got, again)
+			}
+		})
+	}
+}
+
+func TestParsePlayerName(t *testing.T) {
+	t.Run("tidies names up", func(t *testing.T) {
+		cases := map[string]PlayerName{
+			"Pepper":         "Pepper",
+			"  Pepper  ":     "Pepper",
+			"Mary \t  Jane":  "Mary Jane",
+			"Zoe\u0308":      "Zoë",
+			"👩\u200d💻 Coder": "👩\u200d💻 Coder",
+		}
+		for raw, want := range cases {
+			got, err := ParsePlayerName(raw)
+			assertNoError(t, err)
+			if got != want {
+				t.Errorf("got %+q from %+q want %+q", got, raw, want)
+			}
+		}
+	})
+
+	t.Run("turns down names that can't be used", func(t *testing.T) {
+		cases := map[string]error{
+			"":                      ErrEmptyName,
+			"   ":                   ErrEmptyName,
+			"a/b":                   ErrInvalidName,
+			"bell\a":                ErrInvalidName,
+			"right\u202eto left":    ErrInvalidName,
+			"\xff":                  ErrInvalidName,
+			strings.Repeat("a", 65): ErrInvalidName,
+		}
+		for raw, want := range cases {
+			_, err := ParsePlayerName(raw)
+			assertError(t, err, want)
+		}
+	})
+
+	t.Run("the longest name is allowed", func(t *testing.T) {
+		_, err := ParsePlayerName(strings.Repeat("é", MaxPlayerNameLength))
+		assertNoError(t, err)
+	})
+}
+
+func TestPlayerNameKey(t *testing.T) {
+	same := [][2]PlayerName{
+		{"Pepper", "PEPPER"},
+		{"Zoë", "ZOË"},
+		{"kelvin", "\u212aelvin"},
+		{"Σίσυφος", "ΣΊΣΥΦΟΣ"},
+	}
+	for _, names := range same {
+		if names[0].Key() != names[1].Key() {
+			t.Errorf("%q and %q have different keys", names[0], names[1])
+		}
+	}
+
+	if PlayerName("Pepper").Key() == PlayerName("Peppers").Key() {
+		t.Error("different names have the same key")
+	}
+}
+
+func TestCanonicalNamePlayerStore(t *testing.T) {
+	newStore := func(t *testing.T) (*CanonicalNamePlayerStore, *FileSystemPlayerStore) {
+		players := newFileSystemStore(t)
+		assertNoError(t, players.SetPlayerScore("Pepper", 2))
+		return NewCanonicalNamePlayerStore(players), players
+	}
+
+	t.Run("names in another case or spacing are the same player", func(t *testing.T) {
+		store, players := newStore(t)
+
+		assertNoError(t, store.RecordWin("pepper"))
+		assertNoError(t, store.RecordWin(" PEPPER "))
+
+		assertScoreInStore(t, players, "Pepper", 4)
+		assertScoreInStore(t, store, "pEpPeR", 4)
+	})
+
+	t.Run("new players are stored tidied up", func(t *testing.T) {
+		store, players := newStore(t)
+
+		assertNoError(t, store.RecordWin("  Zoe\u0308 "))
+
+		assertScoreInStore(t, players, "Zoë", 1)
+	})
+
+	t.Run("bad names are turned down", func(t *testing.T) {
+		store, _ := newStore(t)
+
+		assertError(t, store.RecordWin("a/b"), ErrInvalidName)
+		assertError(t, store.SetPlayerScore("", 1), ErrEmptyName)
+	})
+
+	t.Run("a rename can change case but not take someone else's name", func(t *testing.T) {
+		store, players := newStore(t)
+		assertNoError(t, store.RecordWin("Floyd"))
+
+		assertError(t, store.RenamePlayer("floyd", "PEPPER"), ErrPlayerExists)
+		assertNoError(t, store.RenamePlayer("pepper", "PEPPER"))
+
+		assertScoreInStore(t, players, "PEPPER", 2)
+	})
+
+	t.Run("imports go to the players already there", func(t *testing.T) {
+		store, players := newStore(t)
+
+		assertNoError(t, store.ImportLeague(League{{"pepper", 10}, {"Cleo", 1}, {"CLEO", 3}}))
+
+		league, _ := players.GetLeague()
+		assertLeague(t, league, League{{"Pepper", 10}, {"Cleo", 3}})
+	})
+
+	t.Run("the league is read once, not on every lookup", func(t *testing.T) {
+		players := &countingLeagueStore{PlayerStore: newFileSystemStore(t)}
+		assertNoError(t, players.SetPlayerScore("Pepper", 2))
+		store := NewCanonicalNamePlayerStore(players)
+
+		assertNoError(t, store.RecordWin("pepper"))
+		assertNoError(t, store.RecordWin("Floyd"))
+		assertNoError(t, store.RenamePlayer("floyd", "Cleo"))
+		assertScoreInStore(t, store, "CLEO", 1)
+		stored, err := resolvePlayerName(NewInstrumentedPlayerStore(store, NewMetrics()), "PEPPER")
+		assertNoError(t, err)
+
+		if stored != "Pepper" {
+			t.Errorf("got %q want Pepper", stored)
+		}
+		if players.leagues != 1 {
+			t.Errorf("read the league %d times, want once", players.leagues)
+		}
+	})
+}
+
+type countingLeagueStore struct {
+	PlayerStore
+	leagues int
+}
+
+func (c *countingLeagueStore) GetLeague() (League, error) {
+	c.leagues++
+	return c.PlayerStore.GetLeague()
+}
+
+// deleteFailingStore can't delete anyone, as if the disk filled up part
+// way through a merge.
+type deleteFailingStore struct {
+	PlayerStore
+}
+
+func (d deleteFailingStore) DeletePlayer(name string) error {
+	return ErrStoreUnavailable
+}
+
+func TestMergeDuplicatePlayers(t *testing.T) {
+	store := newFileSystemStore(t)
+	assertNoError(t, store.ImportLeague(League{
+		{"Pepper", 5},
+		{"pepper", 2},
+		{"Pepper ", 1},
+		{"Zoe\u0308", 1},
+		{"a/b", 3},
+		{"Floyd", 1},
+	}))
+
+	merges, invalid, err := MergeDuplicatePlayers(store)
+	assertNoError(t, err)
+
+	wantMerges := []NameMerge{
+		{Name: "Pepper", Merged: []string{"pepper", "Pepper "}, Wins: 8},
+		{Name: "Zoë", Merged: []string{"Zoe\u0308"}, Wins: 1},
+	}
+	if !reflect.DeepEqual(merges, wantMerges) {
+		t.Errorf("got merges %+v want %+v", merges, wantMerges)
+	}
+	if !reflect.DeepEqual(invalid, []string{"a/b"}) {
+		t.Errorf("got invalid names %q want [a/b]", invalid)
+	}
+
+	league, _ := store.GetLeague()
+	assertLeague(t, league, League{{"Pepper", 8}, {"a/b", 3}, {"Zoë", 1}, {"Floyd", 1}})
+
+	t.Run("running it again does nothing", func(t *testing.T) {
+		merges, _, err := MergeDuplicatePlayers(store)
+		assertNoError(t, err)
+		if len(merges) != 0 {
+			t.Errorf("got merges %+v want none", merges)
+		}
+	})
+
+	t.Run("no wins are lost when a merge fails part way", func(t *testing.T) {
+		players := newFileSystemStore(t)
+		assertNoError(t, players.ImportLeague(League{{"Pepper", 5}, {"pepper", 2}}))
+
+		_, _, err := MergeDuplicatePlayers(deleteFailingStore{players})
+		assertError(t, err, ErrStoreUnavailable)
+
+		assertScoreInStore(t, players, "Pepper", 7)
+	})
+
+	t.Run("history and ratings are merged too", func(t *testing.T) {
+		dir := t.TempDir()
+		players := newFileSystemStore(t)
+		history, clock := newHistoryStore(t, players, filepath.Join(dir, "history.log"))
+		results := newResultStore(t, filepath.Join(dir, "game.db.json"), DefaultKFactor)
+		store := NewRatedPlayerStore(history, results)
+
+		assertNoError(t, store.RecordWin("Pepper"))
+		clock.Advance(time.Hour)
+		assertNoError(t, store.RecordWin("pepper"))
+		assertNoError(t, results.RecordResult(GameResult{Winner: "Pepper", Losers: []string{"Cleo"}}))
+		assertNoError(t, results.RecordResult(GameResult{Winner: "pepper", Losers: []string{"Cleo"}}))
+
+		_, _, err := MergeDuplicatePlayers(store)
+		assertNoError(t, err)
+
+		wins, err := history.GetHistory("Pepper")
+		assertNoError(t, err)
+		want := []time.Time{historyStart, historyStart.Add(time.Hour)}
+		if !reflect.DeepEqual(wins, want) {
+			t.Errorf("got history %v want %v", wins, want)
+		}
+
+		rating, err := results.GetRating("Pepper")
+		assertNoError(t, err)
+		if rating.Games != 2 || rating.Wins != 2 {
+			t.Errorf("got %+v want 2 games and 2 wins", rating)
+		}
+		if _, err := results.GetRating("pepper"); err == nil {
+			t.Error("pepper still has a rating of their own")
+		}
+	})
+}
+
+func TestPlayerNamesInPaths(t *testing.T) {
+	newServer := func() (*PlayerServer, *FileSystemPlayerStore) {
+		players := newFileSystemStore(t)
+		players.SetPlayerScore("Zoë", 3)
+		return NewPlayerServer(NewCanonicalNamePlayerStore(players), dummyGame), players
+	}
+
+	serve := func(server *PlayerServer, method, path string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("percent-encoded names are unescaped", func(t *testing.T) {
+		server, _ := newServer()
+
+		for _, path := range []string{"/players/Zo%C3%AB", "/players/zoe%CC%88", "/players/%20ZO%C3%8B%20"} {
+			response := serve(server, http.MethodGet, path)
+			assertStatus(t, response.Code, http.StatusOK)
+			assertResponseBody(t, response.Body.String(), "3")
+		}
+	})
+
+	t.Run("an escaped slash is part of the name, not the path", func(t *testing.T) {
+		server, _ := newServer()
+
+		response := serve(server, http.MethodPost, "/players/x%2Frating")
+
+		assertProblem(t, response, http.StatusBadRequest, "/players/x/rating")
+	})
+
+	t.Run("a player can be called rating", func(t *testing.T) {
+		server, players := newServer()
+
+		assertStatus(t, serve(server, http.MethodPost, "/players/rating").Code, http.StatusAccepted)
+
+		assertScoreInStore(t, players, "rating", 1)
+	})
+
+	t.Run("names that are too long are turned down", func(t *testing.T) {
+		server, _ := newServer()
+		path := "/players/" + strings.Repeat("a", MaxPlayerNameLength+1)
+
+		assertProblem(t, serve(server, http.MethodPost, path), http.StatusBadRequest, path)
+	})
+
+	t.Run("renames are checked and tidied", func(t *testing.T) {
+		server, players := newServer()
+
+		request, _ := http.NewRequest(http.MethodPatch, "/players/zo%C3%AB", strings.NewReader(`{"Name": " Zoë Smith "}`))
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusNoContent)
+		if got := response.Header().Get("Location"); got != "/players/Zo%C3%AB%20Smith" {
+			t.Errorf("got Location %q", got)
+		}
+		assertScoreInStore(t, players, "Zoë Smith", 3)
+	})
+}
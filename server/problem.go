@@ -0,0 +1,115 @@
+package poker
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const problemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details body. Every error response from
+// PlayerServer carries one so clients have a single shape to decode.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+// problemTypes give each error a client might want to tell apart its own
+// problem type, as the status alone doesn't and the detail is for people.
+var problemTypes = []struct {
+	err  error
+	name string
+}{
+	{ErrEmptyName, "empty-name"},
+	{ErrInvalidName, "invalid-name"},
+	{ErrInvalidScore, "invalid-score"},
+	{ErrNoOpponents, "no-opponents"},
+	{ErrInvalidLeagueName, "invalid-league-name"},
+	{ErrPlayerNotFound, "player-not-found"},
+	{ErrLeagueNotFound, "league-not-found"},
+	{ErrPlayerExists, "player-exists"},
+	{ErrLeagueExists, "league-exists"},
+	{ErrDefaultLeague, "default-league"},
+	{ErrReplicationGone, "replication-gone"},
+	{ErrStoreUnavailable, "store-unavailable"},
+	{ErrInvalidToken, "invalid-token"},
+}
+
+const problemTypePrefix = "urn:poker:problem:"
+
+// ProblemType is the problem type a response for err carries, or
+// about:blank when err has none of its own.
+func ProblemType(err error) string {
+	for _, problem := range problemTypes {
+		if errors.Is(err, problem.err) {
+			return problemTypePrefix + problem.name
+		}
+	}
+	return "about:blank"
+}
+
+// Err is the error the problem's type stands for, or nil.
+func (p Problem) Err() error {
+	for _, problem := range problemTypes {
+		if p.Type == problemTypePrefix+problem.name {
+			return problem.err
+		}
+	}
+	return nil
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	writeTypedProblem(w, r, status, "about:blank", detail)
+}
+
+func writeTypedProblem(w http.ResponseWriter, r *http.Request, status int, problemType, detail string) {
+	w.Header().Set("content-type", problemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Problem{
+		Type:     problemType,
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+	})
+}
+
+func writeStoreError(w http.ResponseWriter, r *http.Request, err error) {
+	status := storeErrorStatus(err)
+
+	detail := err.Error()
+	if status == http.StatusInternalServerError {
+		// don't hand out file paths and the like to whoever is asking
+		detail = "the player store failed to handle the request"
+	}
+	writeTypedProblem(w, r, status, ProblemType(err), detail)
+}
+
+func storeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrEmptyName), errors.Is(err, ErrInvalidName), errors.Is(err, ErrInvalidScore), errors.Is(err, ErrNoOpponents),
+		errors.Is(err, ErrInvalidLeagueName):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrPlayerNotFound), errors.Is(err, ErrLeagueNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrPlayerExists), errors.Is(err, ErrLeagueExists), errors.Is(err, ErrDefaultLeague):
+		return http.StatusConflict
+	case errors.Is(err, ErrReplicationGone):
+		return http.StatusGone
+	case errors.Is(err, ErrStoreUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func methodNotAllowed(w http.ResponseWriter, r *http.Request, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeProblem(w, r, http.StatusMethodNotAllowed, r.Method+" is not supported here")
+}
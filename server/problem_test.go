@@ -0,0 +1,154 @@
+package poker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type FailingPlayerStore struct {
+	StubPlayerStore
+	err error
+}
+
+func (f *FailingPlayerStore) GetPlayerScore(name string) (int, error) {
+	return 0, f.err
+}
+
+func (f *FailingPlayerStore) RecordWin(name string) error {
+	return f.err
+}
+
+func (f *FailingPlayerStore) GetLeague() (League, error) {
+	return nil, f.err
+}
+
+func TestProblemResponses(t *testing.T) {
+	t.Run("missing players are a 404 problem without a score", func(t *testing.T) {
+		server := NewPlayerServer(&StubPlayerStore{}, dummyGame)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPlayersRequest(http.MethodGet, "Apollo"))
+
+		assertProblem(t, response, http.StatusNotFound, "/players/Apollo")
+	})
+
+	t.Run("empty player names are a bad request", func(t *testing.T) {
+		store := &StubPlayerStore{}
+		server := NewPlayerServer(store, dummyGame)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPlayersRequest(http.MethodPost, ""))
+
+		assertProblem(t, response, http.StatusBadRequest, "/players/")
+		if len(store.winCalls) != 0 {
+			t.Errorf("expected no wins to be recorded, got %v", store.winCalls)
+		}
+	})
+
+	t.Run("players with no wins are still found", func(t *testing.T) {
+		server := NewPlayerServer(&StubPlayerStore{map[string]int{"Floyd": 0}, nil, nil}, dummyGame)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPlayersRequest(http.MethodGet, "Floyd"))
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertResponseBody(t, response.Body.String(), "0")
+	})
+
+	cases := []struct {
+		err        error
+		wantStatus int
+		wantType   string
+	}{
+		{ErrStoreUnavailable, http.StatusServiceUnavailable, "urn:poker:problem:store-unavailable"},
+		{fmt.Errorf("wrapped, %w", ErrStoreUnavailable), http.StatusServiceUnavailable, "urn:poker:problem:store-unavailable"},
+		{ErrPlayerExists, http.StatusConflict, "urn:poker:problem:player-exists"},
+		{errors.New("disk on fire"), http.StatusInternalServerError, "about:blank"},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("store error %q", c.err), func(t *testing.T) {
+			server := NewPlayerServer(&FailingPlayerStore{err: c.err}, dummyGame)
+
+			for _, request := range []*http.Request{
+				newPlayersRequest(http.MethodPost, "Pepper"),
+				newPlayersRequest(http.MethodGet, "Pepper"),
+				newLeagueRequest(http.MethodGet),
+			} {
+				response := httptest.NewRecorder()
+				server.ServeHTTP(response, request)
+
+				assertProblemType(t, response, c.wantType)
+				assertProblem(t, response, c.wantStatus, request.URL.Path)
+			}
+		})
+	}
+
+	t.Run("each type stands for the error it was made from", func(t *testing.T) {
+		for _, problem := range problemTypes {
+			got := Problem{Type: ProblemType(problem.err)}.Err()
+			if got != problem.err {
+				t.Errorf("got %v back from %s, want %v", got, ProblemType(problem.err), problem.err)
+			}
+		}
+	})
+
+	t.Run("internal errors don't leak their details", func(t *testing.T) {
+		server := NewPlayerServer(&FailingPlayerStore{err: errors.New("open /var/lib/game.db.json: disk on fire")}, dummyGame)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPlayersRequest(http.MethodPost, "Pepper"))
+
+		if strings.Contains(response.Body.String(), "/var/lib") {
+			t.Errorf("response leaked the store error: %s", response.Body.String())
+		}
+	})
+}
+
+// assertProblemType checks the problem in response without using up its
+// body.
+func assertProblemType(t testing.TB, response *httptest.ResponseRecorder, want string) {
+	t.Helper()
+	var problem Problem
+	if err := json.Unmarshal(response.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("could not decode problem %q, %v", response.Body, err)
+	}
+	if problem.Type != want {
+		t.Errorf("got problem type %q want %q", problem.Type, want)
+	}
+}
+
+func assertProblem(t testing.TB, response *httptest.ResponseRecorder, wantStatus int, wantInstance string) {
+	t.Helper()
+
+	assertStatus(t, response.Code, wantStatus)
+	if got := response.Result().Header.Get("content-type"); got != problemContentType {
+		t.Errorf("got content-type %q want %q", got, problemContentType)
+	}
+
+	var problem Problem
+	decodeJSON(t, response.Body, &problem)
+
+	// the type is checked by assertProblemType where it matters
+	if problem.Type != "about:blank" && problem.Err() == nil {
+		t.Errorf("got problem type %q, want about:blank or one of ours", problem.Type)
+	}
+	want := Problem{
+		Type:     problem.Type,
+		Title:    http.StatusText(wantStatus),
+		Status:   wantStatus,
+		Detail:   problem.Detail,
+		Instance: wantInstance,
+	}
+	if problem != want {
+		t.Errorf("got problem %+v want %+v", problem, want)
+	}
+	if problem.Detail == "" {
+		t.Error("expected the problem to explain itself")
+	}
+}
@@ -0,0 +1,179 @@
+package poker
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimit lets a client make Burst requests at once, then Rate a second
+// after that.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimits are keyed by the route pattern a request is served by, like
+// "/players/", optionally with a method in front, like "POST /players/".
+// A limit for the method and route wins over one for the route alone.
+type RateLimits map[string]RateLimit
+
+const maxRateLimitBuckets = 10000
+
+// RateLimiter keeps a token bucket per client for every limited route, and
+// never more than maxRateLimitBuckets of them.
+type RateLimiter struct {
+	mu      sync.Mutex
+	limits  RateLimits
+	buckets map[string]*tokenBucket
+	now     func() time.Time
+}
+
+type tokenBucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func NewRateLimiter(limits RateLimits) *RateLimiter {
+	return &RateLimiter{
+		limits:  limits,
+		buckets: map[string]*tokenBucket{},
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from client's bucket for the route, or says how long
+// until there will be one.
+func (l *RateLimiter) Allow(method, route, client string) (bool, time.Duration) {
+	name, limit, ok := l.limit(method, route)
+	if !ok {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	key := name + "|" + client
+	bucket, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxRateLimitBuckets {
+			l.prune(now)
+		}
+		if len(l.buckets) >= maxRateLimitBuckets {
+			l.evictIdlest()
+		}
+		bucket = &tokenBucket{limit: limit, tokens: float64(limit.Burst), last: now}
+		l.buckets[key] = bucket
+	}
+	bucket.refill(now)
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - bucket.tokens) / limit.Rate * float64(time.Second))
+	return false, wait
+}
+
+// limit finds the limit for method and route, and the name it's kept under.
+func (l *RateLimiter) limit(method, route string) (string, RateLimit, bool) {
+	name := method + " " + route
+	limit, ok := l.limits[name]
+	if !ok {
+		name = route
+		limit, ok = l.limits[name]
+	}
+	if !ok || limit.Rate <= 0 {
+		return "", limit, false
+	}
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	return name, limit, true
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(b.limit.Burst), b.tokens+elapsed*b.limit.Rate)
+		b.last = now
+	}
+}
+
+// prune forgets buckets that have filled up again, as a full bucket is no
+// different from a new one.
+func (l *RateLimiter) prune(now time.Time) {
+	for key, bucket := range l.buckets {
+		bucket.refill(now)
+		if bucket.tokens >= float64(bucket.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// evictIdlest makes room when every bucket is still in use by forgetting
+// the one that was used longest ago.
+func (l *RateLimiter) evictIdlest() {
+	var idlest string
+	var last time.Time
+	for key, bucket := range l.buckets {
+		if idlest == "" || bucket.last.Before(last) {
+			idlest, last = key, bucket.last
+		}
+	}
+	delete(l.buckets, idlest)
+}
+
+// requestClient is who made a request that's been through requireToken:
+// the user their token belongs to, or their IP address when they sent none.
+func requestClient(r *http.Request) string {
+	if user := UserFromContext(r.Context()); user != "" {
+		return "user:" + user
+	}
+	return "ip:" + remoteHost(r)
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return host
+}
+
+// rateLimitClient is who to limit a request that's been through
+// withAuthentication as. Only a token that was accepted earns a bucket of
+// its own; anything else is limited by IP address, so making up tokens
+// doesn't get a client round its limit.
+func rateLimitClient(r *http.Request) string {
+	if found, ok := r.Context().Value(authenticationContextKey{}).(authentication); ok && found.err == nil {
+		return "user:" + found.user
+	}
+	return "ip:" + remoteHost(r)
+}
+
+func rateLimit(limiter *RateLimiter, tokens TokenAuthenticator, route func(*http.Request) string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pattern := route(r)
+		if _, _, limited := limiter.limit(r.Method, pattern); !limited {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// the token is only checked once, here, for requireToken as well
+		r = withAuthentication(r, tokens)
+		ok, wait := limiter.Allow(r.Method, pattern, rateLimitClient(r))
+		if !ok {
+			seconds := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			writeProblem(w, r, http.StatusTooManyRequests, "slow down, try again in "+strconv.Itoa(seconds)+"s")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
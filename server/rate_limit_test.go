@@ -0,0 +1,259 @@
+package poker
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	newLimiter := func(limits RateLimits) (*RateLimiter, *fakeClock) {
+		limiter := NewRateLimiter(limits)
+		clock := &fakeClock{historyStart}
+		limiter.now = clock.Now
+		return limiter, clock
+	}
+
+	t.Run("allows a burst then refills at the rate", func(t *testing.T) {
+		limiter, clock := newLimiter(RateLimits{"/players/": {Rate: 2, Burst: 3}})
+
+		for i := 0; i < 3; i++ {
+			assertAllowed(t, limiter, "GET", "/players/", "ip:1")
+		}
+		ok, wait := limiter.Allow("GET", "/players/", "ip:1")
+		if ok || wait != 500*time.Millisecond {
+			t.Errorf("got %v waiting %v, want refused for 500ms", ok, wait)
+		}
+
+		clock.Advance(500 * time.Millisecond)
+		assertAllowed(t, limiter, "GET", "/players/", "ip:1")
+	})
+
+	t.Run("each client has its own bucket", func(t *testing.T) {
+		limiter, _ := newLimiter(RateLimits{"/players/": {Rate: 1, Burst: 1}})
+
+		assertAllowed(t, limiter, "GET", "/players/", "ip:1")
+		assertAllowed(t, limiter, "GET", "/players/", "ip:2")
+	})
+
+	t.Run("a limit for the method wins over the route's", func(t *testing.T) {
+		limiter, _ := newLimiter(RateLimits{
+			"/players/":      {Rate: 100, Burst: 100},
+			"POST /players/": {Rate: 1, Burst: 1},
+		})
+
+		assertAllowed(t, limiter, "POST", "/players/", "ip:1")
+		if ok, _ := limiter.Allow("POST", "/players/", "ip:1"); ok {
+			t.Error("second POST was allowed, want it limited")
+		}
+		assertAllowed(t, limiter, "GET", "/players/", "ip:1")
+	})
+
+	t.Run("never keeps more than the most buckets", func(t *testing.T) {
+		limiter, _ := newLimiter(RateLimits{"/players/": {Rate: 1, Burst: 2}})
+
+		// each bucket is left part spent, so none can be pruned
+		for i := 0; i < maxRateLimitBuckets+10; i++ {
+			limiter.Allow("GET", "/players/", fmt.Sprintf("ip:%d", i))
+		}
+
+		if len(limiter.buckets) > maxRateLimitBuckets {
+			t.Errorf("got %d buckets, want no more than %d", len(limiter.buckets), maxRateLimitBuckets)
+		}
+	})
+
+	t.Run("routes without a limit are not limited", func(t *testing.T) {
+		limiter, _ := newLimiter(RateLimits{"/players/": {Rate: 1, Burst: 1}})
+
+		for i := 0; i < 10; i++ {
+			assertAllowed(t, limiter, "GET", "/league", "ip:1")
+		}
+	})
+}
+
+func TestRateLimitedServer(t *testing.T) {
+	newServer := func(options ...PlayerServerOption) (*PlayerServer, *StubPlayerStore) {
+		store := &StubPlayerStore{map[string]int{"Pepper": 20}, nil, nil}
+		limiter := NewRateLimiter(RateLimits{"POST /players/": {Rate: 0.5, Burst: 2}})
+		limiter.now = (&fakeClock{historyStart}).Now
+		return NewPlayerServer(store, dummyGame, append(options, WithRateLimiter(limiter))...), store
+	}
+
+	post := func(server *PlayerServer, remote, token string) *httptest.ResponseRecorder {
+		request := newPlayersRequest(http.MethodPost, "Pepper")
+		request.RemoteAddr = remote
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("answers 429 with Retry-After once the burst is spent", func(t *testing.T) {
+		server, store := newServer()
+
+		assertStatus(t, post(server, "10.0.0.1:1234", "").Code, http.StatusAccepted)
+		assertStatus(t, post(server, "10.0.0.1:5678", "").Code, http.StatusAccepted)
+		response := post(server, "10.0.0.1:1234", "")
+
+		assertProblem(t, response, http.StatusTooManyRequests, "/players/Pepper")
+		if got := response.Header().Get("Retry-After"); got != "2" {
+			t.Errorf("got Retry-After %q want %q", got, "2")
+		}
+		if len(store.winCalls) != 2 {
+			t.Errorf("got %d wins, want 2", len(store.winCalls))
+		}
+	})
+
+	t.Run("clients with tokens are limited by who they are, not address", func(t *testing.T) {
+		server, _ := newServer(WithTokenAuth(StubTokens{"alices-token": "alice"}))
+
+		post(server, "10.0.0.1:1234", "guess-1")
+		post(server, "10.0.0.1:1234", "guess-2")
+
+		assertStatus(t, post(server, "10.0.0.1:1234", "alices-token").Code, http.StatusAccepted)
+	})
+
+	t.Run("tokens that aren't accepted are limited by address", func(t *testing.T) {
+		server, _ := newServer(WithTokenAuth(StubTokens{"alices-token": "alice"}))
+
+		post(server, "10.0.0.1:1234", "guess-1")
+		post(server, "10.0.0.1:1234", "guess-2")
+
+		assertStatus(t, post(server, "10.0.0.1:1234", "guess-3").Code, http.StatusTooManyRequests)
+	})
+
+	t.Run("a token is only checked once a request", func(t *testing.T) {
+		tokens := &countingTokens{TokenAuthenticator: StubTokens{"alices-token": "alice"}}
+		server, _ := newServer(WithTokenAuth(tokens))
+
+		assertStatus(t, post(server, "10.0.0.1:1234", "alices-token").Code, http.StatusAccepted)
+		assertStatus(t, post(server, "10.0.0.1:1234", "guess").Code, http.StatusUnauthorized)
+
+		if tokens.calls != 2 {
+			t.Errorf("got %d token checks for 2 requests, want 2", tokens.calls)
+		}
+	})
+
+	t.Run("reads are not limited", func(t *testing.T) {
+		server, _ := newServer()
+
+		for i := 0; i < 5; i++ {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newPlayersRequest(http.MethodGet, "Pepper"))
+			assertStatus(t, response.Code, http.StatusOK)
+		}
+	})
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	post := func(server *PlayerServer, name, key string) *httptest.ResponseRecorder {
+		request := newPlayersRequest(http.MethodPost, name)
+		request.Header.Set(idempotencyKeyHeader, key)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("a retried win is only counted once", func(t *testing.T) {
+		store := &StubPlayerStore{}
+		server := NewPlayerServer(store, dummyGame)
+
+		assertStatus(t, post(server, "Pepper", "abc").Code, http.StatusAccepted)
+		response := post(server, "Pepper", "abc")
+
+		assertStatus(t, response.Code, http.StatusAccepted)
+		if response.Header().Get("Idempotent-Replayed") != "true" {
+			t.Error("replay was not marked as one")
+		}
+		if len(store.winCalls) != 1 {
+			t.Errorf("got %d wins, want 1", len(store.winCalls))
+		}
+	})
+
+	t.Run("different keys are different wins", func(t *testing.T) {
+		store := &StubPlayerStore{}
+		server := NewPlayerServer(store, dummyGame)
+
+		post(server, "Pepper", "abc")
+		post(server, "Pepper", "def")
+
+		if len(store.winCalls) != 2 {
+			t.Errorf("got %d wins, want 2", len(store.winCalls))
+		}
+	})
+
+	t.Run("a key can't be reused for another player", func(t *testing.T) {
+		server := NewPlayerServer(&StubPlayerStore{}, dummyGame)
+
+		post(server, "Pepper", "abc")
+
+		assertProblem(t, post(server, "Floyd", "abc"), http.StatusUnprocessableEntity, "/players/Floyd")
+	})
+
+	t.Run("failures can be retried with the same key", func(t *testing.T) {
+		failing := &FailingPlayerStore{err: ErrStoreUnavailable}
+		server := NewPlayerServer(failing, dummyGame)
+		assertStatus(t, post(server, "Pepper", "abc").Code, http.StatusServiceUnavailable)
+
+		failing.err = nil
+		assertStatus(t, post(server, "Pepper", "abc").Code, http.StatusAccepted)
+	})
+
+	t.Run("new keys are refused while every key kept is still being handled", func(t *testing.T) {
+		store := &StubPlayerStore{}
+		server := NewPlayerServer(store, dummyGame)
+		server.idempotency.max = 1
+		server.idempotency.begin("in-flight", "/players/Chris")
+
+		response := post(server, "Pepper", "abc")
+		assertProblem(t, response, http.StatusServiceUnavailable, "/players/Pepper")
+		if response.Header().Get("Retry-After") == "" {
+			t.Error("no Retry-After on a refused key")
+		}
+		if len(server.idempotency.entries) != 1 {
+			t.Errorf("got %d keys kept, want 1", len(server.idempotency.entries))
+		}
+
+		server.idempotency.finish("in-flight", http.StatusAccepted)
+		assertStatus(t, post(server, "Pepper", "abc").Code, http.StatusAccepted)
+		if len(store.winCalls) != 1 {
+			t.Errorf("got %d wins, want 1", len(store.winCalls))
+		}
+	})
+
+	t.Run("keys expire after a day", func(t *testing.T) {
+		store := &StubPlayerStore{}
+		server := NewPlayerServer(store, dummyGame)
+		clock := &fakeClock{historyStart}
+		server.idempotency.now = clock.Now
+
+		post(server, "Pepper", "abc")
+		clock.Advance(25 * time.Hour)
+		post(server, "Pepper", "abc")
+
+		if len(store.winCalls) != 2 {
+			t.Errorf("got %d wins, want 2", len(store.winCalls))
+		}
+	})
+}
+
+type countingTokens struct {
+	TokenAuthenticator
+	calls int
+}
+
+func (c *countingTokens) Authenticate(token string) (string, error) {
+	c.calls++
+	return c.TokenAuthenticator.Authenticate(token)
+}
+
+func assertAllowed(t testing.TB, limiter *RateLimiter, method, route, client string) {
+	t.Helper()
+	if ok, wait := limiter.Allow(method, route, client); !ok {
+		t.Errorf("%s %s for %s was refused for %v, want allowed", method, route, client, wait)
+	}
+}
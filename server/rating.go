@@ -0,0 +1,488 @@
+package poker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	InitialRating  = 1500.0
+	DefaultKFactor = 32.0
+)
+
+var ErrNoOpponents = errors.New("a result needs the winner and at least one other player")
+
+// ResultsPath and RatingsPath are where the head-to-head results for the
+// league at dbPath, and the ratings worked out from them, are kept.
+func ResultsPath(dbPath string) string {
+	return dbPath + ".results.log"
+}
+
+func RatingsPath(dbPath string) string {
+	return dbPath + ".ratings"
+}
+
+// GameResult is who won a game and who else was at the table.
+type GameResult struct {
+	Winner string    `json:"winner"`
+	Losers []string  `json:"losers"`
+	Time   time.Time `json:"time"`
+}
+
+// NewGameResult works out the losers from everyone who played, whether or
+// not players includes the winner.
+func NewGameResult(winner string, players []string) (GameResult, error) {
+	result := GameResult{Winner: winner}
+	if winner == "" {
+		return result, ErrEmptyName
+	}
+
+	seen := map[string]bool{winner: true}
+	for _, player := range players {
+		if player == "" {
+			return result, ErrEmptyName
+		}
+		if !seen[player] {
+			seen[player] = true
+			result.Losers = append(result.Losers, player)
+		}
+	}
+	if len(result.Losers) == 0 {
+		return result, ErrNoOpponents
+	}
+	return result, nil
+}
+
+type Rating struct {
+	Name   string
+	Rating float64
+	Games  int
+	Wins   int
+}
+
+// RatedPlayer is how a player appears in a league ranked by rating.
+type RatedPlayer struct {
+	Name   string
+	Wins   int
+	Rating float64
+	Games  int
+}
+
+// Elo rates players from game results. A game with several players counts
+// as the winner beating each of the others, with the K factor shared out
+// between those pairings so a big table isn't worth more than a heads-up.
+type Elo struct {
+	K       float64
+	ratings map[string]*Rating
+}
+
+func NewElo(k float64) *Elo {
+	return &Elo{K: k, ratings: map[string]*Rating{}}
+}
+
+func (e *Elo) player(name string) *Rating {
+	rating, ok := e.ratings[name]
+	if !ok {
+		rating = &Rating{Name: name, Rating: InitialRating}
+		e.ratings[name] = rating
+	}
+	return rating
+}
+
+func (e *Elo) Apply(result GameResult) {
+	if len(result.Losers) == 0 {
+		return
+	}
+
+	winner := e.player(result.Winner)
+	k := e.K / float64(len(result.Losers))
+
+	// every pairing is scored against the ratings from before the game
+	deltas := make([]float64, len(result.Losers))
+	for i, name := range result.Losers {
+		expected := 1 / (1 + math.Pow(10, (e.player(name).Rating-winner.Rating)/400))
+		deltas[i] = k * (1 - expected)
+	}
+
+	for i, name := range result.Losers {
+		loser := e.player(name)
+		loser.Rating -= deltas[i]
+		loser.Games++
+		winner.Rating += deltas[i]
+	}
+	winner.Games++
+	winner.Wins++
+}
+
+// Rename moves a player's rating to their new name. If the new name is
+// rated already the two are merged, weighted by how many games each played.
+func (e *Elo) Rename(from, to string) {
+	rating, ok := e.ratings[from]
+	if !ok || from == to {
+		return
+	}
+	delete(e.ratings, from)
+	rating.Name = to
+
+	if kept, ok := e.ratings[to]; ok && kept.Games+rating.Games > 0 {
+		games := float64(kept.Games + rating.Games)
+		rating.Rating = (kept.Rating*float64(kept.Games) + rating.Rating*float64(rating.Games)) / games
+		rating.Games += kept.Games
+		rating.Wins += kept.Wins
+	}
+	e.ratings[to] = rating
+}
+
+func (e *Elo) Remove(name string) {
+	delete(e.ratings, name)
+}
+
+func (e *Elo) Rating(name string) (Rating, bool) {
+	rating, ok := e.ratings[name]
+	if !ok {
+		return Rating{}, false
+	}
+	return *rating, true
+}
+
+// Ratings returns every rated player, best first.
+func (e *Elo) Ratings() []Rating {
+	ratings := make([]Rating, 0, len(e.ratings))
+	for _, rating := range e.ratings {
+		ratings = append(ratings, *rating)
+	}
+	sort.Slice(ratings, func(i, j int) bool {
+		if ratings[i].Rating != ratings[j].Rating {
+			return ratings[i].Rating > ratings[j].Rating
+		}
+		return ratings[i].Name < ratings[j].Name
+	})
+	return ratings
+}
+
+type ResultStore interface {
+	RecordResult(result GameResult) error
+	GetRating(name string) (Rating, error)
+	GetRatings() ([]Rating, error)
+	RenamePlayer(from, to string) error
+	DeletePlayer(name string) error
+}
+
+// resultsEntry is a line of the results log: a game, or a player being
+// renamed or deleted, which the ratings follow from then on.
+type resultsEntry struct {
+	GameResult
+	Player    string `json:"player,omitempty"`
+	RenamedTo string `json:"renamed_to,omitempty"`
+	Deleted   bool   `json:"deleted,omitempty"`
+}
+
+type playerChange struct {
+	Player    string    `json:"player"`
+	RenamedTo string    `json:"renamed_to,omitempty"`
+	Deleted   bool      `json:"deleted,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+func (e *Elo) applyEntry(entry resultsEntry) {
+	switch {
+	case entry.Player == "":
+		e.Apply(entry.GameResult)
+	case entry.Deleted:
+		e.Remove(entry.Player)
+	default:
+		e.Rename(entry.Player, entry.RenamedTo)
+	}
+}
+
+type ratingsSnapshot struct {
+	K       float64  `json:"k"`
+	Results int      `json:"results"`
+	Ratings []Rating `json:"ratings"`
+}
+
+// FileResultStore appends one JSON line per game to a results log and keeps
+// Elo ratings up to date as results come in. Renames and deletes are logged
+// too so the ratings keep following the league. The ratings are written to
+// a snapshot after every change so startup only replays the lines logged
+// since; if the snapshot is missing, was made with a different K factor or
+// doesn't match the log, every line is replayed.
+type FileResultStore struct {
+	mu       sync.RWMutex
+	log      *os.File
+	snapshot *json.Encoder
+	elo      *Elo
+	// results counts the lines of the log the ratings have taken in
+	results int
+	closed  bool
+	now     func() time.Time
+}
+
+func NewFileResultStore(dbPath string, k float64) (*FileResultStore, error) {
+	log, err := os.OpenFile(ResultsPath(dbPath), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("problem opening results log %s, %v", ResultsPath(dbPath), err)
+	}
+
+	store := &FileResultStore{
+		log:      log,
+		snapshot: json.NewEncoder(&atomicTape{RatingsPath(dbPath)}),
+		elo:      NewElo(k),
+		now:      time.Now,
+	}
+
+	// a snapshot we can't use only costs us a full replay
+	snap, _ := readRatingsSnapshot(RatingsPath(dbPath))
+	if snap.K == k {
+		for i := range snap.Ratings {
+			store.elo.ratings[snap.Ratings[i].Name] = &snap.Ratings[i]
+		}
+		store.results = snap.Results
+	}
+
+	if err := store.replay(); err != nil {
+		log.Close()
+		return nil, fmt.Errorf("problem replaying results log %s, %v", ResultsPath(dbPath), err)
+	}
+	return store, nil
+}
+
+func readRatingsSnapshot(path string) (ratingsSnapshot, error) {
+	var snap ratingsSnapshot
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return snap, err
+	}
+	err = json.Unmarshal(data, &snap)
+	return snap, err
+}
+
+func (f *FileResultStore) replay() error {
+	entries, err := readResults(f.log)
+	if err != nil {
+		return err
+	}
+
+	if f.results > len(entries) {
+		// the snapshot counts lines the log doesn't have, so it belongs to
+		// some other log
+		f.elo, f.results = NewElo(f.elo.K), 0
+	}
+	for _, entry := range entries[f.results:] {
+		f.elo.applyEntry(entry)
+	}
+	f.results = len(entries)
+	return nil
+}
+
+func readResults(log *os.File) ([]resultsEntry, error) {
+	if _, err := log.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var results []resultsEntry
+	reader := bufio.NewReader(log)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// a trailing line without a newline is a write that never
+			// finished
+			if len(line) > 0 {
+				return results, log.Truncate(offset)
+			}
+			return results, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var result resultsEntry
+		if err := json.Unmarshal(bytes.TrimSpace(line), &result); err != nil {
+			return nil, fmt.Errorf("bad result at offset %d, %v", offset, err)
+		}
+		offset += int64(len(line))
+		results = append(results, result)
+	}
+}
+
+func (f *FileResultStore) RecordResult(result GameResult) error {
+	if result.Winner == "" {
+		return ErrEmptyName
+	}
+	if len(result.Losers) == 0 {
+		return ErrNoOpponents
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return ErrStoreUnavailable
+	}
+
+	result.Time = f.now().UTC()
+	if err := f.append(result); err != nil {
+		return err
+	}
+	f.elo.Apply(result)
+	return f.changed()
+}
+
+// RenamePlayer moves name's rating to their new name, merging it with the
+// rating already there if there is one.
+func (f *FileResultStore) RenamePlayer(from, to string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return ErrStoreUnavailable
+	}
+	if _, ok := f.elo.Rating(from); !ok || from == to {
+		return nil
+	}
+
+	if err := f.append(playerChange{Player: from, RenamedTo: to, Time: f.now().UTC()}); err != nil {
+		return err
+	}
+	f.elo.Rename(from, to)
+	return f.changed()
+}
+
+func (f *FileResultStore) DeletePlayer(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return ErrStoreUnavailable
+	}
+	if _, ok := f.elo.Rating(name); !ok {
+		return nil
+	}
+
+	if err := f.append(playerChange{Player: name, Deleted: true, Time: f.now().UTC()}); err != nil {
+		return err
+	}
+	f.elo.Remove(name)
+	return f.changed()
+}
+
+func (f *FileResultStore) append(entry interface{}) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := f.log.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("problem appending to results log, %v", err)
+	}
+	return nil
+}
+
+// changed counts a line just logged and saves the ratings, so a restart
+// doesn't have to replay it.
+func (f *FileResultStore) changed() error {
+	f.results++
+	return f.saveSnapshot()
+}
+
+func (f *FileResultStore) GetRating(name string) (Rating, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if rating, ok := f.elo.Rating(name); ok {
+		return rating, nil
+	}
+	return Rating{}, ErrPlayerNotFound
+}
+
+func (f *FileResultStore) GetRatings() ([]Rating, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.elo.Ratings(), nil
+}
+
+// Recompute throws the ratings away and replays every result in the log,
+// which is how a change to the K factor or a hand-edited log takes effect.
+func (f *FileResultStore) Recompute() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return ErrStoreUnavailable
+	}
+
+	f.elo, f.results = NewElo(f.elo.K), 0
+	if err := f.replay(); err != nil {
+		return err
+	}
+	return f.saveSnapshot()
+}
+
+func (f *FileResultStore) saveSnapshot() error {
+	err := f.snapshot.Encode(ratingsSnapshot{f.elo.K, f.results, f.elo.Ratings()})
+	if err != nil {
+		return fmt.Errorf("problem writing ratings, %v", err)
+	}
+	return nil
+}
+
+func (f *FileResultStore) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+
+	if err := f.saveSnapshot(); err != nil {
+		f.log.Close()
+		return err
+	}
+	return f.log.Close()
+}
+
+// RatedPlayerStore wraps another PlayerStore so renaming or deleting a
+// player does the same to their rating.
+type RatedPlayerStore struct {
+	PlayerStore
+	results ResultStore
+}
+
+func NewRatedPlayerStore(store PlayerStore, results ResultStore) *RatedPlayerStore {
+	return &RatedPlayerStore{PlayerStore: store, results: results}
+}
+
+func (r *RatedPlayerStore) DeletePlayer(name string) error {
+	if err := r.PlayerStore.DeletePlayer(name); err != nil {
+		return err
+	}
+	return r.results.DeletePlayer(name)
+}
+
+func (r *RatedPlayerStore) RenamePlayer(from, to string) error {
+	if err := r.PlayerStore.RenamePlayer(from, to); err != nil {
+		return err
+	}
+	return r.results.RenamePlayer(from, to)
+}
+
+// MergePlayer removes from, whose wins are already counted in into, and
+// folds their rating into into's.
+func (r *RatedPlayerStore) MergePlayer(from, into string) error {
+	if err := mergePlayer(r.PlayerStore, from, into); err != nil {
+		return err
+	}
+	return r.results.RenamePlayer(from, into)
+}
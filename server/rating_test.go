@@ -0,0 +1,461 @@
+package poker
+
+import (
+	"bytes"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type StubResultStore struct {
+	results []GameResult
+	elo     *Elo
+}
+
+func newStubResultStore() *StubResultStore {
+	return &StubResultStore{elo: NewElo(DefaultKFactor)}
+}
+
+func (s *StubResultStore) RecordResult(result GameResult) error {
+	s.results = append(s.results, result)
+	s.elo.Apply(result)
+	return nil
+}
+
+type failingResultStore struct {
+	*StubResultStore
+}
+
+func (f *failingResultStore) RecordResult(result GameResult) error {
+	return ErrStoreUnavailable
+}
+
+func (s *StubResultStore) GetRating(name string) (Rating, error) {
+	if rating, ok := s.elo.Rating(name); ok {
+		return rating, nil
+	}
+	return Rating{}, ErrPlayerNotFound
+}
+
+func (s *StubResultStore) GetRatings() ([]Rating, error) {
+	return s.elo.Ratings(), nil
+}
+
+func (s *StubResultStore) RenamePlayer(from, to string) error {
+	s.elo.Rename(from, to)
+	return nil
+}
+
+func (s *StubResultStore) DeletePlayer(name string) error {
+	s.elo.Remove(name)
+	return nil
+}
+
+func TestElo(t *testing.T) {
+	t.Run("evenly matched heads-up moves both by half of K", func(t *testing.T) {
+		elo := NewElo(32)
+		elo.Apply(GameResult{Winner: "Chris", Losers: []string{"Cleo"}})
+
+		assertRating(t, elo, "Chris", 1516)
+		assertRating(t, elo, "Cleo", 1484)
+	})
+
+	t.Run("beating a stronger player is worth more", func(t *testing.T) {
+		elo := NewElo(32)
+		elo.Apply(GameResult{Winner: "Cleo", Losers: []string{"Ruth"}})
+		elo.Apply(GameResult{Winner: "Chris", Losers: []string{"Cleo"}})
+
+		chris, _ := elo.Rating("Chris")
+		if chris.Rating <= 1516 {
+			t.Errorf("got %.2f, want more than an even win", chris.Rating)
+		}
+	})
+
+	t.Run("a big table shares K between the losers", func(t *testing.T) {
+		elo := NewElo(32)
+		elo.Apply(GameResult{Winner: "Chris", Losers: []string{"Cleo", "Ruth", "Tiest"}})
+
+		assertRating(t, elo, "Chris", 1516)
+		assertRating(t, elo, "Ruth", 1500-16.0/3)
+
+		tiest, _ := elo.Rating("Tiest")
+		if tiest.Games != 1 || tiest.Wins != 0 {
+			t.Errorf("got %+v, want one game and no wins", tiest)
+		}
+	})
+
+	t.Run("a rename onto a rated player merges the two by games played", func(t *testing.T) {
+		elo := NewElo(32)
+		elo.Apply(GameResult{Winner: "Chris", Losers: []string{"Cleo"}})
+		elo.Apply(GameResult{Winner: "chris", Losers: []string{"Ruth"}})
+		elo.Apply(GameResult{Winner: "chris", Losers: []string{"Ruth"}})
+		before, _ := elo.Rating("chris")
+
+		elo.Rename("chris", "Chris")
+
+		merged, _ := elo.Rating("Chris")
+		if merged.Games != 3 || merged.Wins != 3 {
+			t.Errorf("got %+v, want three games and three wins", merged)
+		}
+		assertRating(t, elo, "Chris", (1516+2*before.Rating)/3)
+		if _, ok := elo.Rating("chris"); ok {
+			t.Error("the old name is still rated")
+		}
+	})
+
+	t.Run("ratings are best first", func(t *testing.T) {
+		elo := NewElo(32)
+		elo.Apply(GameResult{Winner: "Chris", Losers: []string{"Cleo"}})
+
+		ratings := elo.Ratings()
+		if len(ratings) != 2 || ratings[0].Name != "Chris" || ratings[1].Name != "Cleo" {
+			t.Errorf("got %+v, want Chris then Cleo", ratings)
+		}
+	})
+}
+
+func TestNewGameResult(t *testing.T) {
+	t.Run("the winner is not one of the losers", func(t *testing.T) {
+		result, err := NewGameResult("Chris", []string{"Cleo", "Chris", "Ruth", "Cleo"})
+		assertNoError(t, err)
+
+		if strings.Join(result.Losers, ",") != "Cleo,Ruth" {
+			t.Errorf("got losers %v, want Cleo and Ruth", result.Losers)
+		}
+	})
+
+	t.Run("needs someone to beat", func(t *testing.T) {
+		_, err := NewGameResult("Chris", []string{"Chris"})
+		assertError(t, err, ErrNoOpponents)
+	})
+
+	t.Run("refuses empty names", func(t *testing.T) {
+		_, err := NewGameResult("Chris", []string{""})
+		assertError(t, err, ErrEmptyName)
+	})
+}
+
+func TestFileResultStore(t *testing.T) {
+	t.Run("ratings survive a restart", func(t *testing.T) {
+		db := filepath.Join(t.TempDir(), "game.db.json")
+		store := newResultStore(t, db, 32)
+		assertNoError(t, store.RecordResult(GameResult{Winner: "Chris", Losers: []string{"Cleo"}}))
+		assertNoError(t, store.Close())
+
+		store = newResultStore(t, db, 32)
+		defer store.Close()
+		assertStoredRating(t, store, "Chris", 1516)
+	})
+
+	t.Run("replays results recorded after the snapshot", func(t *testing.T) {
+		db := filepath.Join(t.TempDir(), "game.db.json")
+		store := newResultStore(t, db, 32)
+		store.RecordResult(GameResult{Winner: "Chris", Losers: []string{"Cleo"}})
+		store.Close()
+
+		writeFile(t, ResultsPath(db), strings.Join(readLines(t, ResultsPath(db)), "\n")+"\n"+
+			`{"winner":"Chris","losers":["Ruth"]}`+"\n")
+
+		store = newResultStore(t, db, 32)
+		defer store.Close()
+		chris, err := store.GetRating("Chris")
+		assertNoError(t, err)
+		if chris.Games != 2 {
+			t.Errorf("got %d games, want 2", chris.Games)
+		}
+	})
+
+	t.Run("a new K factor replays everything", func(t *testing.T) {
+		db := filepath.Join(t.TempDir(), "game.db.json")
+		store := newResultStore(t, db, 32)
+		store.RecordResult(GameResult{Winner: "Chris", Losers: []string{"Cleo"}})
+		store.Close()
+
+		store = newResultStore(t, db, 16)
+		defer store.Close()
+		assertStoredRating(t, store, "Chris", 1508)
+	})
+
+	t.Run("recompute replays the whole log", func(t *testing.T) {
+		db := filepath.Join(t.TempDir(), "game.db.json")
+		store := newResultStore(t, db, 32)
+		defer store.Close()
+		store.RecordResult(GameResult{Winner: "Chris", Losers: []string{"Cleo"}})
+
+		// someone corrects the log by hand
+		writeFile(t, ResultsPath(db), `{"winner":"Cleo","losers":["Chris"]}`+"\n")
+		assertNoError(t, store.Recompute())
+
+		assertStoredRating(t, store, "Cleo", 1516)
+		assertStoredRating(t, store, "Chris", 1484)
+	})
+
+	t.Run("saves the ratings with every result", func(t *testing.T) {
+		db := filepath.Join(t.TempDir(), "game.db.json")
+		store := newResultStore(t, db, 32)
+		defer store.Close()
+		assertNoError(t, store.RecordResult(GameResult{Winner: "Chris", Losers: []string{"Cleo"}}))
+
+		snap, err := readRatingsSnapshot(RatingsPath(db))
+		assertNoError(t, err)
+		if snap.Results != 1 || len(snap.Ratings) != 2 {
+			t.Errorf("got snapshot %+v, want the one result", snap)
+		}
+	})
+
+	t.Run("renames and deletes survive a restart", func(t *testing.T) {
+		db := filepath.Join(t.TempDir(), "game.db.json")
+		store := newResultStore(t, db, 32)
+		assertNoError(t, store.RecordResult(GameResult{Winner: "Chris", Losers: []string{"Cleo"}}))
+		assertNoError(t, store.RenamePlayer("Chris", "Christopher"))
+		assertNoError(t, store.DeletePlayer("Cleo"))
+		assertNoError(t, store.Close())
+
+		// without the snapshot, so the log has to say what happened
+		os.Remove(RatingsPath(db))
+		store = newResultStore(t, db, 32)
+		defer store.Close()
+
+		assertStoredRating(t, store, "Christopher", 1516)
+		for _, name := range []string{"Chris", "Cleo"} {
+			_, err := store.GetRating(name)
+			assertError(t, err, ErrPlayerNotFound)
+		}
+	})
+
+	t.Run("unrated players are not found", func(t *testing.T) {
+		store := newResultStore(t, filepath.Join(t.TempDir(), "game.db.json"), 32)
+		defer store.Close()
+
+		_, err := store.GetRating("Nobody")
+		assertError(t, err, ErrPlayerNotFound)
+	})
+}
+
+func TestRatingsOverHTTP(t *testing.T) {
+	newServer := func() (*PlayerServer, *StubResultStore, *StubPlayerStore) {
+		store := &StubPlayerStore{map[string]int{}, nil, League{{"Chris", 3}, {"Cleo", 5}}}
+		results := newStubResultStore()
+		return NewPlayerServer(store, NewTexasHoldem(&SpyBlindAlerter{}, store), WithRatings(results)), results, store
+	}
+
+	t.Run("records who played when a game finishes", func(t *testing.T) {
+		server, results, store := newServer()
+		id := startHTTPGame(t, server, 2)
+
+		request, _ := http.NewRequest(http.MethodPost, "/game/winner",
+			strings.NewReader(`{"Game": "`+id+`", "Winner": "Chris", "Players": ["Chris", "Cleo"]}`))
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusAccepted)
+		assertPlayerWin(t, store, "Chris")
+		if len(results.results) != 1 || results.results[0].Losers[0] != "Cleo" {
+			t.Errorf("got results %+v, want Chris beating Cleo", results.results)
+		}
+	})
+
+	t.Run("no result is recorded when the win can't be", func(t *testing.T) {
+		store := &StubPlayerStore{map[string]int{}, nil, League{{"Chris", 3}, {"Cleo", 5}}}
+		game := NewTexasHoldem(&SpyBlindAlerter{}, &FailingPlayerStore{err: ErrStoreUnavailable})
+		results := newStubResultStore()
+		server := NewPlayerServer(store, game, WithRatings(results))
+		id := startHTTPGame(t, server, 2)
+
+		request, _ := http.NewRequest(http.MethodPost, "/game/winner",
+			strings.NewReader(`{"Game": "`+id+`", "Winner": "Chris", "Players": ["Chris", "Cleo"]}`))
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusServiceUnavailable)
+		if len(results.results) != 0 {
+			t.Errorf("got results %+v, want none", results.results)
+		}
+	})
+
+	t.Run("a game over the websocket is rated the same way", func(t *testing.T) {
+		server, results, store := newServer()
+		httpServer := httptest.NewServer(server)
+		defer httpServer.Close()
+
+		ws := mustDialWS(t, httpServer.URL)
+		ws.send(t, opText, "2")
+		ws.send(t, opText, `{"Winner": "Chris", "Players": ["Chris", "Cleo"]}`)
+		ws.waitForClose(t)
+
+		assertPlayerWin(t, store, "Chris")
+		if len(results.results) != 1 || results.results[0].Losers[0] != "Cleo" {
+			t.Errorf("got results %+v, want Chris beating Cleo", results.results)
+		}
+	})
+
+	t.Run("a websocket game is held to the players it started with", func(t *testing.T) {
+		server, results, store := newServer()
+		httpServer := httptest.NewServer(server)
+		defer httpServer.Close()
+
+		ws := mustDialWS(t, httpServer.URL)
+		ws.send(t, opText, "1")
+		ws.send(t, opText, `{"Winner": "Chris", "Players": ["Chris", "Cleo"]}`)
+		assertWebsocketMessage(t, ws, "could not record Chris as the winner, more players than were at the table, the game was started for 1")
+		ws.waitForClose(t)
+
+		if len(store.winCalls) != 0 || len(results.results) != 0 {
+			t.Errorf("recorded %v and %+v, want nothing", store.winCalls, results.results)
+		}
+	})
+
+	t.Run("a win that went in is a success even if the game can't be rated", func(t *testing.T) {
+		store := &StubPlayerStore{map[string]int{}, nil, League{{"Chris", 3}, {"Cleo", 5}}}
+		var logs bytes.Buffer
+		server := NewPlayerServer(store, NewTexasHoldem(&SpyBlindAlerter{}, store),
+			WithRatings(&failingResultStore{newStubResultStore()}),
+			WithAccessLog(slog.New(slog.NewJSONHandler(&logs, nil))),
+		)
+		id := startHTTPGame(t, server, 2)
+
+		finish := func() int {
+			request, _ := http.NewRequest(http.MethodPost, "/game/winner",
+				strings.NewReader(`{"Game": "`+id+`", "Winner": "Chris", "Players": ["Chris", "Cleo"]}`))
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, request)
+			return response.Code
+		}
+
+		assertStatus(t, finish(), http.StatusAccepted)
+		assertPlayerWin(t, store, "Chris")
+		if !strings.Contains(logs.String(), "problem rating a finished game") {
+			t.Errorf("the failure wasn't logged, got %s", logs.String())
+		}
+		// the game is over, so trying again can't count the win twice
+		assertStatus(t, finish(), http.StatusNotFound)
+		if len(store.winCalls) != 1 {
+			t.Errorf("got wins %v, want one", store.winCalls)
+		}
+	})
+
+	t.Run("a table of one is a bad request", func(t *testing.T) {
+		server, _, store := newServer()
+		id := startHTTPGame(t, server, 2)
+
+		request, _ := http.NewRequest(http.MethodPost, "/game/winner",
+			strings.NewReader(`{"Game": "`+id+`", "Winner": "Chris", "Players": ["Chris"]}`))
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertProblem(t, response, http.StatusBadRequest, "/game/winner")
+		if len(store.winCalls) != 0 {
+			t.Errorf("recorded %v, want no wins", store.winCalls)
+		}
+	})
+
+	t.Run("GET /players/{name}/rating", func(t *testing.T) {
+		server, results, _ := newServer()
+		results.RecordResult(GameResult{Winner: "Chris", Losers: []string{"Cleo"}})
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPlayersRequest(http.MethodGet, "Chris/rating"))
+
+		assertStatus(t, response.Code, http.StatusOK)
+		var got Rating
+		decodeJSON(t, response.Body, &got)
+		if got.Name != "Chris" || got.Rating != 1516 || got.Games != 1 {
+			t.Errorf("got %+v, want Chris on 1516 after one game", got)
+		}
+	})
+
+	t.Run("unrated players are not found", func(t *testing.T) {
+		server, _, _ := newServer()
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPlayersRequest(http.MethodGet, "Floyd/rating"))
+
+		assertProblem(t, response, http.StatusNotFound, "/players/Floyd/rating")
+	})
+
+	t.Run("GET /league?rank=rating", func(t *testing.T) {
+		server, results, _ := newServer()
+		results.RecordResult(GameResult{Winner: "Chris", Losers: []string{"Cleo", "Ruth"}})
+
+		request, _ := http.NewRequest(http.MethodGet, "/league?rank=rating", nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		var got []RatedPlayer
+		decodeJSON(t, response.Body, &got)
+		if len(got) != 3 || got[0].Name != "Chris" || got[0].Wins != 3 || got[2].Wins != 0 {
+			t.Errorf("got %+v, want Chris first and Ruth rated with no wins", got)
+		}
+	})
+
+	t.Run("rank=rating needs ratings", func(t *testing.T) {
+		server := NewPlayerServer(&StubPlayerStore{}, dummyGame)
+
+		request, _ := http.NewRequest(http.MethodGet, "/league?rank=rating", nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertProblem(t, response, http.StatusBadRequest, "/league")
+	})
+}
+
+func TestRatedPlayerStore(t *testing.T) {
+	t.Run("ratings follow renames and deletes", func(t *testing.T) {
+		results := newStubResultStore()
+		results.RecordResult(GameResult{Winner: "Chris", Losers: []string{"Cleo"}})
+		store := NewRatedPlayerStore(NewInMemoryPlayerStore(), results)
+		store.RecordWin("Chris")
+		store.RecordWin("Cleo")
+
+		assertNoError(t, store.RenamePlayer("Chris", "Christopher"))
+		assertNoError(t, store.DeletePlayer("Cleo"))
+
+		assertStoredRating(t, results, "Christopher", 1516)
+		if ratings, _ := results.GetRatings(); len(ratings) != 1 {
+			t.Errorf("got ratings %+v, want only Christopher's", ratings)
+		}
+	})
+
+	t.Run("ratings are left alone when the store fails", func(t *testing.T) {
+		results := newStubResultStore()
+		results.RecordResult(GameResult{Winner: "Chris", Losers: []string{"Cleo"}})
+		store := NewRatedPlayerStore(&StubPlayerStore{}, results)
+
+		assertError(t, store.DeletePlayer("Cleo"), ErrPlayerNotFound)
+
+		assertStoredRating(t, results, "Cleo", 1484)
+	})
+}
+
+func newResultStore(t testing.TB, db string, k float64) *FileResultStore {
+	t.Helper()
+	store, err := NewFileResultStore(db, k)
+	assertNoError(t, err)
+	return store
+}
+
+func assertRating(t testing.TB, elo *Elo, name string, want float64) {
+	t.Helper()
+	rating, ok := elo.Rating(name)
+	if !ok {
+		t.Fatalf("%s has no rating", name)
+	}
+	if math.Abs(rating.Rating-want) > 0.01 {
+		t.Errorf("got %s on %.2f, want %.2f", name, rating.Rating, want)
+	}
+}
+
+func assertStoredRating(t testing.TB, store ResultStore, name string, want float64) {
+	t.Helper()
+	rating, err := store.GetRating(name)
+	assertNoError(t, err)
+	if math.Abs(rating.Rating-want) > 0.01 {
+		t.Errorf("got %s on %.2f, want %.2f", name, rating.Rating, want)
+	}
+}
@@ -0,0 +1,363 @@
+package poker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultReplicationKept is how many changes the leader keeps for
+// followers to catch up with; one further behind starts again from the
+// whole league.
+const DefaultReplicationKept = 10000
+
+const (
+	maxReplicationWait  = time.Minute
+	maxReplicationBatch = 1000
+)
+
+var ErrReplicationGone = errors.New("the replication log no longer goes back that far")
+
+// ReplicationLogPath is where the leader for the league at dbPath keeps the
+// changes its followers tail.
+func ReplicationLogPath(dbPath string) string {
+	return dbPath + ".replication.log"
+}
+
+// replicationLogHeader is the first line of the log. ID changes whenever
+// the log is started again from nothing, so a follower can't mistake
+// someone else's changes for the ones it was following. Seq is the change
+// before the first one still in the file.
+type replicationLogHeader struct {
+	ID  string `json:"id"`
+	Seq int64  `json:"seq"`
+}
+
+// replicaSnapshot is the whole league as it stood after change Seq of the
+// log with ID Log. Followers start from one and keep one on disk.
+type replicaSnapshot struct {
+	Log    string `json:"log"`
+	Seq    int64  `json:"seq"`
+	League League `json:"league"`
+}
+
+// ReplicationLog numbers every change made through it and writes it down,
+// so followers can ask for the ones they haven't seen. Changes are made
+// one at a time so the numbers follow the order the store saw them in.
+// Only the last kept are held on to; the file is rewritten with just those
+// once it has twice as many.
+type ReplicationLog struct {
+	PlayerStore
+
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	id      string
+	base    int64
+	seq     int64
+	events  []LeagueEvent
+	kept    int
+	changed chan struct{}
+	closed  bool
+	now     func() time.Time
+}
+
+func NewReplicationLog(store PlayerStore, path string, kept int) (*ReplicationLog, error) {
+	if kept < 1 {
+		kept = DefaultReplicationKept
+	}
+	r := &ReplicationLog{
+		PlayerStore: store,
+		path:        path,
+		kept:        kept,
+		changed:     make(chan struct{}),
+		now:         time.Now,
+	}
+	if err := r.load(); err != nil {
+		return nil, fmt.Errorf("problem loading replication log %s, %v", path, err)
+	}
+	return r, nil
+}
+
+func (r *ReplicationLog) load() error {
+	data, err := os.ReadFile(r.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	reader := bufio.NewReader(bytes.NewReader(data))
+	header, err := reader.ReadBytes('\n')
+	if err == io.EOF {
+		// new, or the header never finished being written; either way
+		// nothing was ever logged under it
+		return r.start()
+	}
+	var h replicationLogHeader
+	if err := json.Unmarshal(header, &h); err != nil || h.ID == "" {
+		return fmt.Errorf("bad header, %v", err)
+	}
+	r.id, r.base, r.seq = h.ID, h.Seq, h.Seq
+
+	complete := true
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// a trailing line without a newline is a change that was never
+			// logged, so drop it
+			complete = len(line) == 0
+			break
+		}
+		var event LeagueEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			return fmt.Errorf("bad change after %d, %v", r.seq, err)
+		}
+		r.events = append(r.events, event)
+		r.seq = event.Seq
+	}
+
+	if !complete || len(r.events) >= 2*r.kept {
+		return r.rewrite()
+	}
+	return r.openForAppend()
+}
+
+func (r *ReplicationLog) start() error {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	r.id = hex.EncodeToString(id)
+	return r.rewrite()
+}
+
+// rewrite replaces the file with the header and the changes kept.
+func (r *ReplicationLog) rewrite() error {
+	if len(r.events) > r.kept {
+		r.events = append([]LeagueEvent(nil), r.events[len(r.events)-r.kept:]...)
+	}
+	r.base = r.seq
+	if len(r.events) > 0 {
+		r.base = r.events[0].Seq - 1
+	}
+
+	var buf bytes.Buffer
+	out := json.NewEncoder(&buf)
+	out.Encode(replicationLogHeader{ID: r.id, Seq: r.base})
+	for _, event := range r.events {
+		out.Encode(event)
+	}
+	if _, err := (&atomicTape{r.path}).Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return r.openForAppend()
+}
+
+func (r *ReplicationLog) openForAppend() error {
+	if r.file != nil {
+		r.file.Close()
+	}
+	file, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	r.file = file
+	return nil
+}
+
+// change makes a change to the store and logs what it did. If the change
+// is made but can't be logged the error says so; followers won't see it
+// until they next start from the whole league.
+func (r *ReplicationLog) change(change func() error, events ...LeagueEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return ErrStoreUnavailable
+	}
+	if err := change(); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	now := r.now().UTC()
+	for i := range events {
+		events[i].Seq = r.seq + int64(i) + 1
+		events[i].Time = now
+		line, err := json.Marshal(events[i])
+		if err != nil {
+			return err
+		}
+		buf.Write(append(line, '\n'))
+	}
+	if _, err := r.file.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("problem logging change for followers, %v", err)
+	}
+
+	r.events = append(r.events, events...)
+	r.seq += int64(len(events))
+	close(r.changed)
+	r.changed = make(chan struct{})
+
+	if len(r.events) >= 2*r.kept {
+		// the change is already safe in the log, so failing to trim it
+		// is tried again next time rather than reported
+		r.rewrite()
+	}
+	return nil
+}
+
+func (r *ReplicationLog) RecordWin(name string) error {
+	return r.change(func() error {
+		return r.PlayerStore.RecordWin(name)
+	}, LeagueEvent{Kind: EventWin, Player: name})
+}
+
+func (r *ReplicationLog) SetPlayerScore(name string, wins int) error {
+	return r.change(func() error {
+		return r.PlayerStore.SetPlayerScore(name, wins)
+	}, LeagueEvent{Kind: EventSet, Player: name, Wins: wins})
+}
+
+func (r *ReplicationLog) DeletePlayer(name string) error {
+	return r.change(func() error {
+		return r.PlayerStore.DeletePlayer(name)
+	}, LeagueEvent{Kind: EventDelete, Player: name})
+}
+
+func (r *ReplicationLog) RenamePlayer(from, to string) error {
+	return r.change(func() error {
+		return r.PlayerStore.RenamePlayer(from, to)
+	}, LeagueEvent{Kind: EventRename, Player: from, NewName: to})
+}
+
+// ImportLeague is logged as setting each player's wins, which is what an
+// import does.
+func (r *ReplicationLog) ImportLeague(league League) error {
+	events := make([]LeagueEvent, len(league))
+	for i, player := range league {
+		events[i] = LeagueEvent{Kind: EventSet, Player: player.Name, Wins: player.Wins}
+	}
+	return r.change(func() error {
+		return r.PlayerStore.ImportLeague(league)
+	}, events...)
+}
+
+func (r *ReplicationLog) snapshot() (replicaSnapshot, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	league, err := r.PlayerStore.GetLeague()
+	if err != nil {
+		return replicaSnapshot{}, err
+	}
+	return replicaSnapshot{Log: r.id, Seq: r.seq, League: league}, nil
+}
+
+// since is the changes to log after change seq, waiting up to wait for
+// one if there are none yet. It's ErrReplicationGone when they can't be
+// had: the log is another one, or doesn't go back, or forward, that far.
+func (r *ReplicationLog) since(ctx context.Context, log string, seq int64, wait time.Duration) ([]LeagueEvent, error) {
+	r.mu.Lock()
+	if log != r.id || seq < r.base || seq > r.seq {
+		r.mu.Unlock()
+		return nil, ErrReplicationGone
+	}
+	if seq == r.seq && wait > 0 {
+		changed := r.changed
+		r.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-changed:
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+		return r.since(ctx, log, seq, 0)
+	}
+	defer r.mu.Unlock()
+
+	// kept events are numbered one after another from base
+	events := r.events[seq-r.base:]
+	if len(events) > maxReplicationBatch {
+		events = events[:maxReplicationBatch]
+	}
+	return append([]LeagueEvent{}, events...), nil
+}
+
+func (r *ReplicationLog) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closed = true
+	return r.file.Close()
+}
+
+// WithReplication serves log to followers at /replication/snapshot and
+// /replication/log. Only the default league is replicated.
+func WithReplication(log *ReplicationLog) PlayerServerOption {
+	return func(p *PlayerServer) {
+		p.replication = log
+	}
+}
+
+func (p *PlayerServer) replicationSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	snapshot, err := p.replication.snapshot()
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	w.Header().Set("content-type", jsonContentType)
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// replicationLogHandler answers GET /replication/log?log=ID&after=SEQ with
+// the changes after SEQ. With wait=30s it holds on for up to that long
+// when there are none yet, so followers hear about changes as they happen.
+func (p *PlayerServer) replicationLogHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	query := r.URL.Query()
+	after, err := strconv.ParseInt(query.Get("after"), 10, 64)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "after must be the number of the last change seen")
+		return
+	}
+	var wait time.Duration
+	if raw := query.Get("wait"); raw != "" {
+		if wait, err = time.ParseDuration(raw); err != nil || wait < 0 {
+			writeProblem(w, r, http.StatusBadRequest, fmt.Sprintf("wait %q is not a duration like 30s", raw))
+			return
+		}
+		wait = min(wait, maxReplicationWait)
+		// like the stream, a long poll outlives the server's write timeout
+		http.NewResponseController(w).SetWriteDeadline(time.Now().Add(wait + 10*time.Second))
+	}
+
+	events, err := p.replication.since(r.Context(), query.Get("log"), after, wait)
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	w.Header().Set("content-type", jsonContentType)
+	json.NewEncoder(w).Encode(events)
+}
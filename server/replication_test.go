@@ -0,0 +1,299 @@
+package poker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newReplicationLog(t testing.TB, store PlayerStore, path string, kept int) *ReplicationLog {
+	t.Helper()
+	log, err := NewReplicationLog(store, path, kept)
+	assertNoError(t, err)
+	t.Cleanup(func() { log.Close() })
+	return log
+}
+
+func TestReplicationLog(t *testing.T) {
+	t.Run("changes are numbered in the order they're made", func(t *testing.T) {
+		log := newReplicationLog(t, NewInMemoryPlayerStore(), filepath.Join(t.TempDir(), "replication.log"), 10)
+
+		assertNoError(t, log.RecordWin("Pepper"))
+		assertNoError(t, log.ImportLeague(League{{"Chris", 3}, {"Cleo", 1}}))
+		assertNoError(t, log.RenamePlayer("Cleo", "Ruth"))
+		assertError(t, log.DeletePlayer("Floyd"), ErrPlayerNotFound)
+
+		events, err := log.since(context.Background(), log.id, 0, 0)
+		assertNoError(t, err)
+		assertEvents(t, events,
+			LeagueEvent{Seq: 1, Kind: EventWin, Player: "Pepper"},
+			LeagueEvent{Seq: 2, Kind: EventSet, Player: "Chris", Wins: 3},
+			LeagueEvent{Seq: 3, Kind: EventSet, Player: "Cleo", Wins: 1},
+			LeagueEvent{Seq: 4, Kind: EventRename, Player: "Cleo", NewName: "Ruth"},
+		)
+	})
+
+	t.Run("carries on where it left off when opened again", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "replication.log")
+		log := newReplicationLog(t, NewInMemoryPlayerStore(), path, 10)
+		log.RecordWin("Pepper")
+		log.RecordWin("Pepper")
+		id := log.id
+		log.Close()
+
+		log = newReplicationLog(t, NewInMemoryPlayerStore(), path, 10)
+		assertNoError(t, log.RecordWin("Chris"))
+
+		events, err := log.since(context.Background(), id, 1, 0)
+		assertNoError(t, err)
+		assertEvents(t, events,
+			LeagueEvent{Seq: 2, Kind: EventWin, Player: "Pepper"},
+			LeagueEvent{Seq: 3, Kind: EventWin, Player: "Chris"},
+		)
+	})
+
+	t.Run("only the newest changes are kept", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "replication.log")
+		log := newReplicationLog(t, NewInMemoryPlayerStore(), path, 2)
+		for i := 0; i < 5; i++ {
+			log.RecordWin("Pepper")
+		}
+		log.Close()
+		log = newReplicationLog(t, NewInMemoryPlayerStore(), path, 2)
+
+		_, err := log.since(context.Background(), log.id, 0, 0)
+		assertError(t, err, ErrReplicationGone)
+		events, err := log.since(context.Background(), log.id, 3, 0)
+		assertNoError(t, err)
+		assertEvents(t, events,
+			LeagueEvent{Seq: 4, Kind: EventWin, Player: "Pepper"},
+			LeagueEvent{Seq: 5, Kind: EventWin, Player: "Pepper"},
+		)
+	})
+
+	t.Run("changes from another log, or not made yet, can't be had", func(t *testing.T) {
+		log := newReplicationLog(t, NewInMemoryPlayerStore(), filepath.Join(t.TempDir(), "replication.log"), 10)
+		log.RecordWin("Pepper")
+
+		_, err := log.since(context.Background(), "someone-else", 0, 0)
+		assertError(t, err, ErrReplicationGone)
+		_, err = log.since(context.Background(), log.id, 2, 0)
+		assertError(t, err, ErrReplicationGone)
+	})
+
+	t.Run("waits for the next change", func(t *testing.T) {
+		log := newReplicationLog(t, NewInMemoryPlayerStore(), filepath.Join(t.TempDir(), "replication.log"), 10)
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			log.RecordWin("Pepper")
+		}()
+		events, err := log.since(context.Background(), log.id, 0, time.Minute)
+
+		assertNoError(t, err)
+		assertEvents(t, events, LeagueEvent{Seq: 1, Kind: EventWin, Player: "Pepper"})
+	})
+}
+
+type replicatedLeague struct {
+	leader      *httptest.Server
+	leaderStore *ReplicationLog
+	follower    *httptest.Server
+	replica     *Follower
+	replicaPath string
+}
+
+// newReplicatedLeague starts a leader, made with options as well as its
+// replication log, and a follower of it.
+func newReplicatedLeague(t *testing.T, options ...PlayerServerOption) *replicatedLeague {
+	t.Helper()
+	dir := t.TempDir()
+
+	r := &replicatedLeague{replicaPath: filepath.Join(dir, "replica")}
+	r.leaderStore = newReplicationLog(t, NewInMemoryPlayerStore(), filepath.Join(dir, "replication.log"), 10)
+	options = append(options, WithReplication(r.leaderStore))
+	r.leader = httptest.NewServer(NewPlayerServer(r.leaderStore, dummyGame, options...))
+	t.Cleanup(r.leader.Close)
+
+	r.startFollower(t)
+	return r
+}
+
+func (r *replicatedLeague) startFollower(t *testing.T) {
+	t.Helper()
+	replica, err := NewFollower(r.leader.URL, r.replicaPath, nil)
+	assertNoError(t, err)
+	replica.wait, replica.retry = 50*time.Millisecond, 10*time.Millisecond
+
+	r.replica = replica
+	r.follower = httptest.NewServer(NewPlayerServer(replica, dummyGame, WithLeader(replica)))
+	t.Cleanup(r.follower.Close)
+}
+
+func (r *replicatedLeague) run(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.replica.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestFollower(t *testing.T) {
+	t.Run("changes made on a follower go to the leader and can be read straight back", func(t *testing.T) {
+		league := newReplicatedLeague(t)
+
+		response := httpDo(t, http.MethodPost, league.follower.URL+"/players/Pepper")
+		assertStatus(t, response.StatusCode, http.StatusAccepted)
+
+		assertScoreInStore(t, league.leaderStore, "Pepper", 1)
+		assertScoreInStore(t, league.replica, "Pepper", 1)
+		response = httpDo(t, http.MethodGet, league.follower.URL+"/players/Pepper")
+		assertStatus(t, response.StatusCode, http.StatusOK)
+	})
+
+	t.Run("changes made on the leader reach the follower", func(t *testing.T) {
+		league := newReplicatedLeague(t)
+		league.run(t)
+
+		league.leaderStore.RecordWin("Pepper")
+		league.leaderStore.RecordWin("Chris")
+		league.leaderStore.RecordWin("Pepper")
+
+		eventually(t, func() bool {
+			got, err := league.replica.GetLeague()
+			return err == nil && len(got) == 2 && got[0] == Player{"Pepper", 2}
+		})
+	})
+
+	t.Run("names the leader adds later are found in any case", func(t *testing.T) {
+		league := newReplicatedLeague(t)
+		assertNoError(t, league.replica.Sync(context.Background()))
+
+		canonical := NewCanonicalNamePlayerStore(league.leaderStore)
+		assertNoError(t, canonical.RecordWin("Pepper"))
+		assertNoError(t, canonical.RecordWin("Chris"))
+		assertNoError(t, canonical.RenamePlayer("Chris", "Christopher"))
+		assertNoError(t, league.replica.Sync(context.Background()))
+
+		assertScoreInStore(t, league.replica, "pepper", 1)
+		assertScoreInStore(t, league.replica, "CHRISTOPHER", 1)
+		_, err := league.replica.GetPlayerScore("chris")
+		assertError(t, err, ErrPlayerNotFound)
+
+		response := httpDo(t, http.MethodGet, league.follower.URL+"/players/pepper")
+		assertStatus(t, response.StatusCode, http.StatusOK)
+	})
+
+	t.Run("a follower that restarts serves its copy and catches up", func(t *testing.T) {
+		league := newReplicatedLeague(t)
+		league.leaderStore.RecordWin("Pepper")
+		assertNoError(t, league.replica.Sync(context.Background()))
+		league.follower.Close()
+
+		league.leaderStore.RecordWin("Pepper")
+		league.startFollower(t)
+
+		assertScoreInStore(t, league.replica, "Pepper", 1)
+		assertNoError(t, league.replica.Sync(context.Background()))
+		assertScoreInStore(t, league.replica, "Pepper", 2)
+	})
+
+	t.Run("a follower starts again from the whole league when the log is new", func(t *testing.T) {
+		league := newReplicatedLeague(t)
+		league.leaderStore.RecordWin("Pepper")
+		assertNoError(t, league.replica.Sync(context.Background()))
+
+		// as if the leader lost its log: same league, changes numbered
+		// from the start again
+		league.leaderStore.id = "new-log"
+		league.leaderStore.RecordWin("Chris")
+
+		assertNoError(t, league.replica.Sync(context.Background()))
+		got, _ := league.replica.GetLeague()
+		assertLeague(t, got, League{{"Pepper", 1}, {"Chris", 1}})
+	})
+
+	t.Run("a follower that has never heard from the leader is not ready", func(t *testing.T) {
+		league := newReplicatedLeague(t)
+		league.leader.Close()
+
+		response := httpDo(t, http.MethodGet, league.follower.URL+"/readyz")
+		assertStatus(t, response.StatusCode, http.StatusServiceUnavailable)
+		response = httpDo(t, http.MethodPost, league.follower.URL+"/players/Pepper")
+		assertStatus(t, response.StatusCode, http.StatusBadGateway)
+	})
+
+	t.Run("reads only the leader keeps go to the leader", func(t *testing.T) {
+		results := newStubResultStore()
+		results.RecordResult(GameResult{Winner: "Pepper", Losers: []string{"Chris"}})
+		history, _ := newHistoryStore(t, &StubPlayerStore{map[string]int{"Pepper": 1}, nil, nil}, filepath.Join(t.TempDir(), "history.log"))
+		league := newReplicatedLeague(t,
+			WithRatings(results),
+			WithHistory(history),
+			WithLeagues(newDirLeagueStore(t, t.TempDir())),
+		)
+		league.leaderStore.RecordWin("Pepper")
+		assertNoError(t, league.replica.Sync(context.Background()))
+
+		for _, path := range []string{
+			"/league?rank=rating",
+			"/league?period=week",
+			"/players/Pepper/rating",
+			"/players/Pepper/history",
+			"/leagues",
+			"/leagues/default",
+		} {
+			response := httpDo(t, http.MethodGet, league.follower.URL+path)
+			if response.StatusCode != http.StatusOK {
+				t.Errorf("got status %d for %s, want 200", response.StatusCode, path)
+			}
+		}
+	})
+
+	t.Run("is read only", func(t *testing.T) {
+		league := newReplicatedLeague(t)
+
+		assertError(t, league.replica.RecordWin("Pepper"), ErrFollower)
+	})
+}
+
+func httpDo(t testing.TB, method, url string) *http.Response {
+	t.Helper()
+	request, _ := http.NewRequest(method, url, nil)
+	response, err := http.DefaultClient.Do(request)
+	assertNoError(t, err)
+	response.Body.Close()
+	return response
+}
+
+func eventually(t testing.TB, ok func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !ok() {
+		if time.Now().After(deadline) {
+			t.Fatal("gave up waiting")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func assertEvents(t testing.TB, got []LeagueEvent, want ...LeagueEvent) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d events %+v want %d", len(got), got, len(want))
+	}
+	for i := range want {
+		got[i].Time = time.Time{}
+		if got[i] != want[i] {
+			t.Errorf("got event %+v want %+v", got[i], want[i])
+		}
+	}
+}
@@ -1,76 +1,766 @@
 package poker
 
 import (
+	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
+//go:embed game.html
+var gamePage []byte
+
 type PlayerStore interface {
-	GetPlayerScore(name string) int
-	RecordWin(name string)
-	GetLeague() League
+	GetPlayerScore(name string) (int, error)
+	RecordWin(name string) error
+	GetLeague() (League, error)
+	SetPlayerScore(name string, wins int) error
+	DeletePlayer(name string) error
+	RenamePlayer(from, to string) error
+	ImportLeague(league League) error
 }
 
 type PlayerServer struct {
-	store PlayerStore
+	store       PlayerStore
+	game        Game
+	tokens      TokenAuthenticator
+	auditLog    AuditLog
+	results     ResultStore
+	history     WinHistory
+	now         func() time.Time
+	metrics     *Metrics
+	logger      *slog.Logger
+	limiter     *RateLimiter
+	idempotency *idempotencyKeys
+	games       *openGames
+	origins     []string
+	wsIdle      time.Duration
+	stream      *LeagueBroadcaster
+	leagues     LeagueStore
+	backups     *Backups
+	replication *ReplicationLog
+	follower    *Follower
+	draining    int32
 	http.Handler
 }
 
+type PlayerServerOption func(*PlayerServer)
+
+// WithTokenAuth makes every request that changes the league carry a bearer
+// token that tokens accepts. Reading the league stays open to everyone.
+func WithTokenAuth(tokens TokenAuthenticator) PlayerServerOption {
+	return func(p *PlayerServer) {
+		p.tokens = tokens
+	}
+}
+
+// WithAuditLog writes down who made each change to the league.
+func WithAuditLog(auditLog AuditLog) PlayerServerOption {
+	return func(p *PlayerServer) {
+		p.auditLog = auditLog
+	}
+}
+
+// WithRatings records who played in each finished game so players can be
+// ranked by rating as well as by wins.
+func WithRatings(results ResultStore) PlayerServerOption {
+	return func(p *PlayerServer) {
+		p.results = results
+	}
+}
+
+// WithHistory lets the league be asked for wins in a stretch of time and
+// players for when they won.
+func WithHistory(history WinHistory) PlayerServerOption {
+	return func(p *PlayerServer) {
+		p.history = history
+	}
+}
+
+// WithClock sets what "this week" or "this month" is measured from.
+func WithClock(now func() time.Time) PlayerServerOption {
+	return func(p *PlayerServer) {
+		p.now = now
+	}
+}
+
+// WithMetrics counts requests and serves the counts at /metrics.
+func WithMetrics(metrics *Metrics) PlayerServerOption {
+	return func(p *PlayerServer) {
+		p.metrics = metrics
+	}
+}
+
+// WithAccessLog logs a line for every request served.
+func WithAccessLog(logger *slog.Logger) PlayerServerOption {
+	return func(p *PlayerServer) {
+		p.logger = logger
+	}
+}
+
+// WithRateLimiter turns away clients who make more requests than limiter
+// allows with 429 Too Many Requests.
+func WithRateLimiter(limiter *RateLimiter) PlayerServerOption {
+	return func(p *PlayerServer) {
+		p.limiter = limiter
+	}
+}
+
+// WithLeagueStream serves GET /league/stream, which pushes the league to
+// the client whenever stream publishes a change.
+func WithLeagueStream(stream *LeagueBroadcaster) PlayerServerOption {
+	return func(p *PlayerServer) {
+		p.stream = stream
+	}
+}
+
+// WithWebsocketOrigins lets pages on other sites, given like
+// "https://poker.example.com", open the game's websocket. Otherwise only
+// pages this server serves can.
+func WithWebsocketOrigins(origins ...string) PlayerServerOption {
+	return func(p *PlayerServer) {
+		p.origins = origins
+	}
+}
+
 type Player struct {
 	Name string
 	Wins int
 }
 
-const jsonContentType = "application/json"
+const (
+	jsonContentType = "application/json"
+	csvContentType  = "text/csv"
+)
 
-func NewPlayerServer(store PlayerStore) *PlayerServer {
+type setScoreRequest struct {
+	Wins *int
+}
+
+type renameRequest struct {
+	Name string
+}
+
+type startGameRequest struct {
+	Players int
+}
+
+type startGameResponse struct {
+	Game    string
+	Players int
+	Blinds  []Blind
+}
+
+type finishGameRequest struct {
+	Game    string
+	Winner  string
+	Players []string
+}
+
+func NewPlayerServer(store PlayerStore, game Game, options ...PlayerServerOption) *PlayerServer {
 	p := &PlayerServer{
-		store,
-		http.NewServeMux(),
+		store:       store,
+		game:        game,
+		now:         time.Now,
+		idempotency: newIdempotencyKeys(),
+		games:       newOpenGames(),
+		wsIdle:      websocketIdleTimeout,
+	}
+	for _, option := range options {
+		option(p)
 	}
 
 	router := http.NewServeMux()
+	router.Handle("/{$}", http.HandlerFunc(p.homeHandler))
+	router.Handle("/static/", http.FileServer(http.FS(assets)))
 	router.Handle("/league", http.HandlerFunc(p.leagueHandler))
+	router.Handle("/league/import", http.HandlerFunc(p.importHandler))
+	router.Handle("/league/export", http.HandlerFunc(p.exportHandler))
 	router.Handle("/players/", http.HandlerFunc(p.playersHandler))
+	router.Handle("/game", http.HandlerFunc(p.gameHandler))
+	router.Handle("/game/winner", http.HandlerFunc(p.finishGameHandler))
+	router.Handle("/ws", http.HandlerFunc(p.webSocket))
+	router.Handle("/healthz", http.HandlerFunc(p.healthHandler))
+	router.Handle("/readyz", http.HandlerFunc(p.readyHandler))
+	if p.stream != nil {
+		router.Handle("/league/stream", http.HandlerFunc(p.leagueStreamHandler))
+	}
+	if p.metrics != nil {
+		router.Handle("/metrics", http.HandlerFunc(p.metricsHandler))
+	}
+	if p.leagues != nil {
+		router.Handle("/leagues", http.HandlerFunc(p.leaguesHandler))
+		router.Handle("/leagues/{league}", http.HandlerFunc(p.namedLeagueHandler))
+		router.Handle("/leagues/{league}/players/", p.inLeague(p.playersHandler))
+	}
+	if p.backups != nil {
+		router.Handle("/admin/backup", requireAdmin(p.tokens, p.backupHandler))
+	}
+	if p.replication != nil {
+		router.Handle("/replication/snapshot", http.HandlerFunc(p.replicationSnapshotHandler))
+		router.Handle("/replication/log", http.HandlerFunc(p.replicationLogHandler))
+	}
+
+	route := func(r *http.Request) string {
+		_, pattern := router.Handler(r)
+		return pattern
+	}
 
 	p.Handler = router
+	if p.tokens != nil {
+		p.Handler = requireToken(p.tokens, p.Handler)
+	}
+	// the leader checks tokens on what's forwarded to it
+	if p.follower != nil {
+		p.Handler = forwardToLeader(p.follower, p.Handler)
+	}
+	// limited before the token is checked, so requests with a bad token
+	// count against the address they came from
+	if p.limiter != nil {
+		p.Handler = rateLimit(p.limiter, p.tokens, route, p.Handler)
+	}
+	if p.metrics != nil || p.logger != nil {
+		p.Handler = observe(p.metrics, p.logger, route, p.Handler)
+	}
 	return p
 }
 
 func (p *PlayerServer) leagueHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	query, page, total, ok := p.queryLeague(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if links := query.Links(*r.URL, total); links != "" {
+		w.Header().Set("Link", links)
+	}
+
+	w.Header().Add("Vary", "Accept")
+	if prefersHTML(r) {
+		renderPage(w, r, leagueTemplate, newLeagueView(r, query, page, total))
+		return
+	}
+
 	w.Header().Set("content-type", jsonContentType)
-	json.NewEncoder(w).Encode(p.store.GetLeague())
 	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
+}
+
+// queryLeague answers the league query in r's URL with either a League or,
+// when ranked by rating, a []RatedPlayer. When it can't, it has already
+// told the client why.
+func (p *PlayerServer) queryLeague(w http.ResponseWriter, r *http.Request) (query LeagueQuery, page interface{}, total int, ok bool) {
+	query, err := ParseLeagueQuery(r.URL.Query())
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	results, history := p.resultsFor(r), p.historyFor(r)
+	if query.Sort == SortByRating && results == nil {
+		writeProblem(w, r, http.StatusBadRequest, "this league does not keep ratings")
+		return
+	}
+	if query.Windowed() && history == nil {
+		writeProblem(w, r, http.StatusBadRequest, "this league does not keep win history")
+		return
+	}
+	if query.Windowed() && query.Sort == SortByRating {
+		writeProblem(w, r, http.StatusBadRequest, "ratings cover every game, they cannot be limited to a period")
+		return
+	}
+
+	var league League
+	if query.Windowed() {
+		league, err = history.GetLeagueBetween(query.Window(p.now()))
+	} else {
+		league, err = p.storeFor(r).GetLeague()
+	}
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+
+	if query.Sort == SortByRating {
+		ratings, err := results.GetRatings()
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+		page, total = query.ApplyRatings(league, ratings)
+	} else {
+		page, total = query.Apply(league)
+	}
+	return query, page, total, true
 }
 
 func (p *PlayerServer) playersHandler(w http.ResponseWriter, r *http.Request) {
+	// by the escaped path, so a player called "x%2Frating" isn't taken for
+	// x's rating
+	switch escaped := strings.TrimPrefix(r.URL.EscapedPath(), playersPath(r)); {
+	case strings.HasSuffix(escaped, ratingSuffix):
+		p.showRating(w, r)
+		return
+	case strings.HasSuffix(escaped, historySuffix):
+		p.showHistory(w, r)
+		return
+	}
+
+	player, err := playerNameFromPath(r, "")
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+
 	switch r.Method {
 	case http.MethodPost:
-		p.processWin(w, r)
+		p.idempotent(w, r, func(w http.ResponseWriter, r *http.Request) {
+			p.processWin(w, r, player)
+		})
+	case http.MethodGet:
+		p.showScore(w, r, player)
+	case http.MethodPut:
+		p.setScore(w, r, player)
+	case http.MethodDelete:
+		p.deletePlayer(w, r, player)
+	case http.MethodPatch:
+		p.renamePlayer(w, r, player)
+	default:
+		methodNotAllowed(w, r, http.MethodDelete, http.MethodGet, http.MethodPatch, http.MethodPost, http.MethodPut)
+	}
+}
+
+func (p *PlayerServer) showScore(w http.ResponseWriter, r *http.Request, player PlayerName) {
+	score, err := p.storeFor(r).GetPlayerScore(player.String())
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+
+	w.Header().Add("Vary", "Accept")
+	if prefersHTML(r) {
+		p.showPlayerPage(w, r, player, score)
+		return
+	}
+	fmt.Fprint(w, score)
+}
+
+const ratingSuffix = "/rating"
+
+func (p *PlayerServer) showRating(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	results := p.resultsFor(r)
+	if results == nil {
+		writeProblem(w, r, http.StatusNotFound, "this league does not keep ratings")
+		return
+	}
+
+	player, err := p.storedPlayerName(r, ratingSuffix)
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+
+	rating, err := results.GetRating(player)
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	w.Header().Set("content-type", jsonContentType)
+	json.NewEncoder(w).Encode(rating)
+}
+
+const historySuffix = "/history"
+
+type playerHistory struct {
+	Name string
+	Wins []time.Time
+}
+
+func (p *PlayerServer) showHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	history := p.historyFor(r)
+	if history == nil {
+		writeProblem(w, r, http.StatusNotFound, "this league does not keep win history")
+		return
+	}
+
+	player, err := p.storedPlayerName(r, historySuffix)
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+
+	query, err := ParseLeagueQuery(r.URL.Query())
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	wins, err := history.GetHistory(player)
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+
+	since, until := query.Window(p.now())
+	found := playerHistory{Name: player, Wins: []time.Time{}}
+	for _, at := range wins {
+		if inWindow(at, since, until) {
+			found.Wins = append(found.Wins, at)
+		}
+	}
+
+	w.Header().Set("content-type", jsonContentType)
+	json.NewEncoder(w).Encode(found)
+}
+
+func (p *PlayerServer) processWin(w http.ResponseWriter, r *http.Request, player PlayerName) {
+	if err := p.storeFor(r).RecordWin(player.String()); err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	p.audit(r, AuditWin, player.String(), "")
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (p *PlayerServer) setScore(w http.ResponseWriter, r *http.Request, player PlayerName) {
+	var req setScoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Wins == nil || *req.Wins < 0 {
+		writeProblem(w, r, http.StatusBadRequest, `expected a body like {"Wins": 10} with wins of zero or more`)
+		return
+	}
+
+	if err := p.storeFor(r).SetPlayerScore(player.String(), *req.Wins); err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	p.audit(r, AuditSet, player.String(), fmt.Sprintf("%d wins", *req.Wins))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *PlayerServer) deletePlayer(w http.ResponseWriter, r *http.Request, player PlayerName) {
+	if err := p.storeFor(r).DeletePlayer(player.String()); err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	p.audit(r, AuditDelete, player.String(), "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *PlayerServer) renamePlayer(w http.ResponseWriter, r *http.Request, player PlayerName) {
+	var req renameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		writeProblem(w, r, http.StatusBadRequest, `expected a body like {"Name": "Chris"}`)
+		return
+	}
+	to, err := ParsePlayerName(req.Name)
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+
+	if err := p.storeFor(r).RenamePlayer(player.String(), to.String()); err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	p.audit(r, AuditRename, player.String(), "renamed to "+to.String())
+	w.Header().Set("Location", playersPath(r)+url.PathEscape(to.String()))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *PlayerServer) importHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+
+	var league League
+	var err error
+	if mediaType(r.Header.Get("content-type")) == csvContentType {
+		league, err = NewLeagueFromCSV(r.Body)
+	} else {
+		league, err = NewLeague(r.Body)
+	}
+	if err == nil {
+		err = league.validate()
+	}
+	if err != nil {
+		writeTypedProblem(w, r, http.StatusBadRequest, ProblemType(err), err.Error())
+		return
+	}
+
+	if err := p.store.ImportLeague(league); err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	p.audit(r, AuditImport, "", fmt.Sprintf("%d players", len(league)))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *PlayerServer) exportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	league, err := p.store.GetLeague()
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		w.Header().Set("content-type", jsonContentType)
+		w.Header().Set("content-disposition", `attachment; filename="league.json"`)
+		json.NewEncoder(w).Encode(league)
+	case "csv":
+		w.Header().Set("content-type", csvContentType)
+		w.Header().Set("content-disposition", `attachment; filename="league.csv"`)
+		league.WriteCSV(w)
+	default:
+		writeProblem(w, r, http.StatusBadRequest, fmt.Sprintf("unknown format %q, want csv or json", format))
+	}
+}
+
+func mediaType(contentType string) string {
+	return strings.TrimSpace(strings.Split(contentType, ";")[0])
+}
+
+func (p *PlayerServer) gameHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
 	case http.MethodGet:
-		p.showScore(w, r)
+		w.Header().Set("content-type", "text/html; charset=utf-8")
+		w.Write(gamePage)
+	case http.MethodPost:
+		p.startGame(w, r)
+	default:
+		methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
 	}
 }
 
-func (p *PlayerServer) showScore(w http.ResponseWriter, r *http.Request) {
-	player := getPlayerName(r.URL.Path)
-	score := p.store.GetPlayerScore(player)
-	if score == 0 {
-		w.WriteHeader(http.StatusNotFound)
+func (p *PlayerServer) startGame(w http.ResponseWriter, r *http.Request) {
+	var req startGameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Players < 1 {
+		writeProblem(w, r, http.StatusBadRequest, "expected a positive number of players")
+		return
 	}
-	fmt.Fprint(w, p.store.GetPlayerScore(player))
+
+	// plain HTTP has nowhere to push alerts as they fire, so none are
+	// scheduled and clients get the whole schedule up front instead
+	blinds, _ := p.game.Start(req.Players, nil)
+	id, err := p.games.start(req.Players)
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+
+	w.Header().Set("content-type", jsonContentType)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(startGameResponse{id, req.Players, blinds})
 }
 
-func (p *PlayerServer) processWin(w http.ResponseWriter, r *http.Request) {
-	player := getPlayerName(r.URL.Path)
-	p.store.RecordWin(player)
+func (p *PlayerServer) finishGameHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+
+	var req finishGameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Winner == "" {
+		writeProblem(w, r, http.StatusBadRequest, "expected the name of the winner")
+		return
+	}
+	if req.Game == "" {
+		writeProblem(w, r, http.StatusBadRequest, "expected the game from POST /game")
+		return
+	}
+	game, ok := p.games.finish(req.Game)
+	if !ok {
+		writeProblem(w, r, http.StatusNotFound, fmt.Sprintf("no game %q is being played", req.Game))
+		return
+	}
+	// the game stays open until its winner is recorded, so a failure can
+	// be retried
+	finished := false
+	defer func() {
+		if !finished {
+			p.games.reopen(req.Game, game)
+		}
+	}()
+
+	if err := p.finishGame(r, game.players, req.Winner, req.Players); err != nil {
+		if errors.Is(err, errTooManyPlayers) {
+			writeProblem(w, r, http.StatusBadRequest, err.Error())
+		} else {
+			writeStoreError(w, r, err)
+		}
+		return
+	}
+	finished = true
+	p.audit(r, AuditWin, req.Winner, "")
 	w.WriteHeader(http.StatusAccepted)
 }
 
-func getPlayerName(path string) string {
-	return strings.TrimPrefix(path, "/players/")
+var errTooManyPlayers = errors.New("more players than were at the table")
+
+// finishGame records winner as the winner of a game started for
+// numberOfPlayers and, when players says who was at the table, rates them.
+// Games played over HTTP and over the websocket both finish here.
+func (p *PlayerServer) finishGame(r *http.Request, numberOfPlayers int, winner string, players []string) error {
+	if len(players) > numberOfPlayers {
+		return fmt.Errorf("%w, the game was started for %d", errTooManyPlayers, numberOfPlayers)
+	}
+
+	// the table is checked before the win goes in, so one we can't rate
+	// doesn't leave behind a win the ratings never hear about
+	var result GameResult
+	if p.results != nil && len(players) > 0 {
+		stored, err := p.storedPlayerNames(append([]string{winner}, players...))
+		if err == nil {
+			result, err = NewGameResult(stored[0], stored[1:])
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := p.game.Finish(winner); err != nil {
+		return err
+	}
+	// the win is in and the game is over, so failing now would only have
+	// the client try again and count the win twice; the game goes
+	// unrated, and the log says so
+	if result.Winner != "" {
+		if err := p.results.RecordResult(result); err != nil {
+			p.log().LogAttrs(r.Context(), slog.LevelError, "problem rating a finished game",
+				slog.String("winner", result.Winner),
+				slog.Any("losers", result.Losers),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+	return nil
+}
+
+// log is the access log's logger, or the default one without it.
+func (p *PlayerServer) log() *slog.Logger {
+	if p.logger != nil {
+		return p.logger
+	}
+	return slog.Default()
+}
+
+func (p *PlayerServer) webSocket(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgradeWebsocket(w, r, p.origins, p.wsIdle)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+
+	numberOfPlayersMsg, err := ws.ReadMessage()
+	if err != nil {
+		return
+	}
+
+	numberOfPlayers, err := strconv.Atoi(strings.TrimSpace(string(numberOfPlayersMsg)))
+	if err != nil || numberOfPlayers < 1 {
+		ws.WriteText(BadPlayerInputErrMsg)
+		return
+	}
+	// the alerts stop when the game is over or the browser goes away,
+	// whichever comes first
+	_, stop := p.game.Start(numberOfPlayers, ws)
+	defer stop()
+
+	// the winner's name, or a finishGameRequest so the players at the
+	// table can be rated as they are over HTTP
+	message, err := ws.ReadMessage()
+	if err != nil {
+		return
+	}
+	var req finishGameRequest
+	if err := json.Unmarshal(message, &req); err != nil {
+		req = finishGameRequest{Winner: strings.TrimSpace(string(message))}
+	}
+	if err := p.finishGame(r, numberOfPlayers, req.Winner, req.Players); err != nil {
+		ws.WriteText(fmt.Sprintf("could not record %s as the winner, %v", req.Winner, err))
+		return
+	}
+	p.audit(r, AuditWin, req.Winner, "")
+}
+
+// Drain marks the server as shutting down so /readyz starts failing and
+// load balancers stop sending it new work. Open league streams are ended,
+// as they would otherwise hold the shutdown up.
+func (p *PlayerServer) Drain() {
+	atomic.StoreInt32(&p.draining, 1)
+	if p.stream != nil {
+		p.stream.Close()
+	}
+}
+
+func (p *PlayerServer) healthHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, "ok")
+}
+
+func (p *PlayerServer) readyHandler(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&p.draining) == 1 {
+		writeProblem(w, r, http.StatusServiceUnavailable, "shutting down")
+		return
+	}
+	if _, err := p.store.GetLeague(); err != nil {
+		writeProblem(w, r, http.StatusServiceUnavailable, "the player store is not answering")
+		return
+	}
+	fmt.Fprint(w, "ok")
+}
+
+// storedPlayerNames spells each of names the way the store has them, so
+// ratings are kept under the same names as wins.
+func (p *PlayerServer) storedPlayerNames(names []string) ([]string, error) {
+	stored := make([]string, len(names))
+	for i, raw := range names {
+		name, err := ParsePlayerName(raw)
+		if err != nil {
+			return nil, err
+		}
+		if stored[i], err = resolvePlayerName(p.store, name); err != nil {
+			return nil, err
+		}
+	}
+	return stored, nil
+}
+
+// storedPlayerName is the name in a /players/{name}{suffix} path, spelt
+// the way the store has it, for looking them up in ratings and history
+// which go by that spelling.
+func (p *PlayerServer) storedPlayerName(r *http.Request, suffix string) (string, error) {
+	name, err := playerNameFromPath(r, suffix)
+	if err != nil {
+		return "", err
+	}
+	return resolvePlayerName(p.storeFor(r), name)
 }
 
 func GetPlayerScore(player string) int {
@@ -1,11 +1,13 @@
 package poker
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -15,18 +17,58 @@ type StubPlayerStore struct {
 	league   []Player
 }
 
-func (s *StubPlayerStore) GetPlayerScore(name string) int {
-	score := s.scores[name]
-	return score
+func (s *StubPlayerStore) GetPlayerScore(name string) (int, error) {
+	score, ok := s.scores[name]
+	if !ok {
+		return 0, ErrPlayerNotFound
+	}
+	return score, nil
 }
 
-func (s *StubPlayerStore) RecordWin(name string) {
+func (s *StubPlayerStore) RecordWin(name string) error {
 	s.winCalls = append(s.winCalls, name)
+	return nil
 }
 
 //server_test.go
-func (s *StubPlayerStore) GetLeague() League {
-	return s.league
+func (s *StubPlayerStore) GetLeague() (League, error) {
+	return s.league, nil
+}
+
+func (s *StubPlayerStore) SetPlayerScore(name string, wins int) error {
+	if s.scores == nil {
+		s.scores = map[string]int{}
+	}
+	s.scores[name] = wins
+	return nil
+}
+
+func (s *StubPlayerStore) DeletePlayer(name string) error {
+	if _, ok := s.scores[name]; !ok {
+		return ErrPlayerNotFound
+	}
+	delete(s.scores, name)
+	return nil
+}
+
+func (s *StubPlayerStore) RenamePlayer(from, to string) error {
+	wins, ok := s.scores[from]
+	if !ok {
+		return ErrPlayerNotFound
+	}
+	if _, exists := s.scores[to]; exists {
+		return ErrPlayerExists
+	}
+	delete(s.scores, from)
+	s.scores[to] = wins
+	return nil
+}
+
+func (s *StubPlayerStore) ImportLeague(league League) error {
+	for _, player := range league {
+		s.SetPlayerScore(player.Name, player.Wins)
+	}
+	return nil
 }
 
 func newPlayersRequest(method, name string) *http.Request {
@@ -34,6 +76,11 @@ func newPlayersRequest(method, name string) *http.Request {
 	return req
 }
 
+func newPlayersRequestWithBody(method, name, body string) *http.Request {
+	req, _ := http.NewRequest(method, fmt.Sprintf("/players/%s", name), strings.NewReader(body))
+	return req
+}
+
 func newLeagueRequest(method string) *http.Request {
 	req, _ := http.NewRequest(method, "/league", nil)
 	return req
@@ -49,7 +96,7 @@ func TestGETPlayers(t *testing.T) {
 		nil,
 		nil,
 	}
-	server := NewPlayerServer(&store)
+	server := NewPlayerServer(&store, dummyGame)
 	t.Run("Returns Pepper's score", func(t *testing.T) {
 
 		request := newPlayersRequest(http.MethodGet, "Pepper")
@@ -86,7 +133,7 @@ func TestStoreWins(t *testing.T) {
 		nil,
 		nil,
 	}
-	server := NewPlayerServer(&store)
+	server := NewPlayerServer(&store, dummyGame)
 	t.Run("Records wins on post", func(t *testing.T) {
 		player := "Pepper"
 		request := newPlayersRequest(http.MethodPost, player)
@@ -116,7 +163,7 @@ func TestLeague(t *testing.T) {
 		}
 
 		store := StubPlayerStore{nil, nil, wantedLeague}
-		server := NewPlayerServer(&store)
+		server := NewPlayerServer(&store, dummyGame)
 
 		request := newLeagueRequest(http.MethodGet)
 		response := httptest.NewRecorder()
@@ -130,6 +177,237 @@ func TestLeague(t *testing.T) {
 	})
 }
 
+func TestPlayersREST(t *testing.T) {
+	newStore := func() *StubPlayerStore {
+		return &StubPlayerStore{
+			map[string]int{
+				"Pepper": 20,
+				"Floyd":  10,
+			},
+			nil,
+			nil,
+		}
+	}
+
+	t.Run("PUT sets a player's score", func(t *testing.T) {
+		store := newStore()
+		server := NewPlayerServer(store, dummyGame)
+
+		request := newPlayersRequestWithBody(http.MethodPut, "Pepper", `{"Wins": 42}`)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusNoContent)
+		assertPlayerScore(t, store.scores["Pepper"], 42)
+	})
+
+	t.Run("PUT without a score is a bad request", func(t *testing.T) {
+		server := NewPlayerServer(newStore(), dummyGame)
+
+		for _, body := range []string{``, `{}`, `{"Wins": "lots"}`, `{"Wins": -1}`} {
+			request := newPlayersRequestWithBody(http.MethodPut, "Pepper", body)
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("DELETE removes a player", func(t *testing.T) {
+		store := newStore()
+		server := NewPlayerServer(store, dummyGame)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPlayersRequest(http.MethodDelete, "Floyd"))
+
+		assertStatus(t, response.Code, http.StatusNoContent)
+		if _, ok := store.scores["Floyd"]; ok {
+			t.Error("expected Floyd to have been deleted")
+		}
+	})
+
+	t.Run("DELETE of a missing player is not found", func(t *testing.T) {
+		server := NewPlayerServer(newStore(), dummyGame)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPlayersRequest(http.MethodDelete, "Apollo"))
+
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+
+	t.Run("PATCH renames a player", func(t *testing.T) {
+		store := newStore()
+		server := NewPlayerServer(store, dummyGame)
+
+		request := newPlayersRequestWithBody(http.MethodPatch, "Floyd", `{"Name": "Floyd Mayweather"}`)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusNoContent)
+		assertPlayerScore(t, store.scores["Floyd Mayweather"], 10)
+	})
+
+	t.Run("PATCH onto an existing player is a conflict", func(t *testing.T) {
+		server := NewPlayerServer(newStore(), dummyGame)
+
+		request := newPlayersRequestWithBody(http.MethodPatch, "Floyd", `{"Name": "Pepper"}`)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusConflict)
+	})
+
+	t.Run("other methods are not allowed", func(t *testing.T) {
+		server := NewPlayerServer(newStore(), dummyGame)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPlayersRequest(http.MethodOptions, "Pepper"))
+
+		assertStatus(t, response.Code, http.StatusMethodNotAllowed)
+		assertAllow(t, response, "DELETE, GET, PATCH, POST, PUT")
+	})
+
+	t.Run("POST to /league is not allowed", func(t *testing.T) {
+		server := NewPlayerServer(newStore(), dummyGame)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newLeagueRequest(http.MethodPost))
+
+		assertStatus(t, response.Code, http.StatusMethodNotAllowed)
+		assertAllow(t, response, "GET")
+	})
+}
+
+func TestLeagueImportExport(t *testing.T) {
+	t.Run("imports a JSON league", func(t *testing.T) {
+		store := &StubPlayerStore{}
+		server := NewPlayerServer(store, dummyGame)
+
+		request, _ := http.NewRequest(http.MethodPost, "/league/import", strings.NewReader(`[{"Name": "Cleo", "Wins": 32}]`))
+		request.Header.Set("content-type", jsonContentType)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusNoContent)
+		assertPlayerScore(t, store.scores["Cleo"], 32)
+	})
+
+	t.Run("imports a CSV league", func(t *testing.T) {
+		store := &StubPlayerStore{}
+		server := NewPlayerServer(store, dummyGame)
+
+		request, _ := http.NewRequest(http.MethodPost, "/league/import", strings.NewReader("Name,Wins\nCleo,32\nChris,20\n"))
+		request.Header.Set("content-type", "text/csv; charset=utf-8")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusNoContent)
+		assertPlayerScore(t, store.scores["Cleo"], 32)
+		assertPlayerScore(t, store.scores["Chris"], 20)
+	})
+
+	t.Run("rejects a league it cannot read", func(t *testing.T) {
+		server := NewPlayerServer(&StubPlayerStore{}, dummyGame)
+
+		for _, body := range []string{`not json`, `[{"Name": "Cleo", "Wins": -3}]`, `[{"Wins": 3}]`} {
+			request, _ := http.NewRequest(http.MethodPost, "/league/import", strings.NewReader(body))
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, http.StatusBadRequest)
+		}
+	})
+
+	wantedLeague := []Player{
+		{"Cleo", 32},
+		{"Chris", 20},
+	}
+
+	t.Run("exports JSON by default", func(t *testing.T) {
+		server := NewPlayerServer(&StubPlayerStore{nil, nil, wantedLeague}, dummyGame)
+
+		request, _ := http.NewRequest(http.MethodGet, "/league/export", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response.Result().Header.Get("content-type"))
+		assertLeague(t, getLeagueFromResponse(t, response.Body), wantedLeague)
+	})
+
+	t.Run("exports CSV", func(t *testing.T) {
+		server := NewPlayerServer(&StubPlayerStore{nil, nil, wantedLeague}, dummyGame)
+
+		request, _ := http.NewRequest(http.MethodGet, "/league/export?format=csv", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertResponseBody(t, response.Body.String(), "Name,Wins\nCleo,32\nChris,20\n")
+	})
+
+	t.Run("unknown formats are a bad request", func(t *testing.T) {
+		server := NewPlayerServer(&StubPlayerStore{nil, nil, wantedLeague}, dummyGame)
+
+		request, _ := http.NewRequest(http.MethodGet, "/league/export?format=xml", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+	})
+}
+
+func TestHealthChecks(t *testing.T) {
+	get := func(server *PlayerServer, path string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, httptest.NewRequest(http.MethodGet, path, nil))
+		return response
+	}
+
+	t.Run("healthz is ok while the process is up", func(t *testing.T) {
+		server := NewPlayerServer(&FailingPlayerStore{err: errors.New("disk on fire")}, dummyGame)
+
+		response := get(server, "/healthz")
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertResponseBody(t, response.Body.String(), "ok")
+	})
+
+	t.Run("readyz is ok when the store answers", func(t *testing.T) {
+		server := NewPlayerServer(&StubPlayerStore{}, dummyGame)
+
+		response := get(server, "/readyz")
+
+		assertStatus(t, response.Code, http.StatusOK)
+	})
+
+	t.Run("readyz is unavailable when the store fails", func(t *testing.T) {
+		server := NewPlayerServer(&FailingPlayerStore{err: errors.New("disk on fire")}, dummyGame)
+
+		response := get(server, "/readyz")
+
+		assertProblem(t, response, http.StatusServiceUnavailable, "/readyz")
+	})
+
+	t.Run("readyz is unavailable once draining", func(t *testing.T) {
+		server := NewPlayerServer(&StubPlayerStore{}, dummyGame)
+		server.Drain()
+
+		assertProblem(t, get(server, "/readyz"), http.StatusServiceUnavailable, "/readyz")
+		assertStatus(t, get(server, "/healthz").Code, http.StatusOK)
+	})
+}
+
 // Integration Tests:
 func TestRecordingWinsAndRetrievingLeague(t *testing.T) {
 
@@ -138,7 +416,7 @@ func TestRecordingWinsAndRetrievingLeague(t *testing.T) {
 	store, err := NewFileSystemPlayerStore(database)
 	assertNoError(t, err)
 
-	server := NewPlayerServer(store)
+	server := NewPlayerServer(store, dummyGame)
 	player := "Pepper"
 
 	server.ServeHTTP(httptest.NewRecorder(), newPlayersRequest(http.MethodPost, player))
@@ -201,3 +479,36 @@ func assertNoError(t testing.TB, err error) {
 		t.Fatalf("didn't expect error, but received %v", err)
 	}
 }
+
+func assertError(t testing.TB, got, want error) {
+	t.Helper()
+	if !errors.Is(got, want) {
+		t.Errorf("got error %v, want %v", got, want)
+	}
+}
+
+func assertAllow(t testing.TB, response *httptest.ResponseRecorder, want string) {
+	t.Helper()
+	if got := response.Result().Header.Get("Allow"); got != want {
+		t.Errorf("got Allow header %q, want %q", got, want)
+	}
+}
+
+func getScore(t testing.TB, store PlayerStore, name string) int {
+	t.Helper()
+	score, err := store.GetPlayerScore(name)
+	assertNoError(t, err)
+	return score
+}
+
+func getLeague(t testing.TB, store PlayerStore) League {
+	t.Helper()
+	league, err := store.GetLeague()
+	assertNoError(t, err)
+	return league
+}
+
+func assertScoreInStore(t testing.TB, store PlayerStore, name string, want int) {
+	t.Helper()
+	assertPlayerScore(t, getScore(t, store, name), want)
+}
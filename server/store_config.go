@@ -0,0 +1,72 @@
+package poker
+
+import (
+	"fmt"
+	"os"
+)
+
+// DefaultDBFileNames is where each kind of store keeps its league unless
+// told otherwise.
+var DefaultDBFileNames = map[string]string{
+	"file":     "game.db.json",
+	"eventlog": "game.events.log",
+	"kv":       "game.db.kv",
+}
+
+// StoreConfig says which kind of player store keeps a league, and where,
+// so the webserver and admin commands open it the same way.
+type StoreConfig struct {
+	Kind         string
+	Path         string
+	CompactEvery int
+}
+
+// Open opens the store. The func it returns closes it.
+func (c StoreConfig) Open() (PlayerStore, func() error, error) {
+	switch c.Kind {
+	case "file":
+		store, close, err := FileSystemPlayerStoreFromFile(c.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, func() error { close(); return nil }, nil
+	case "eventlog":
+		store, err := NewEventLogPlayerStore(c.Path, c.CompactEvery)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, store.Close, nil
+	case "kv":
+		store, err := NewKVPlayerStore(c.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, store.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown store %q, want file, eventlog or kv", c.Kind)
+	}
+}
+
+// Files are the files the store keeps the league in.
+func (c StoreConfig) Files() []string {
+	switch c.Kind {
+	case "eventlog":
+		return []string{c.Path, c.Path + ".snapshot"}
+	case "kv":
+		return []string{c.Path, c.Path + ".idx"}
+	default:
+		return []string{c.Path}
+	}
+}
+
+// MoveAside moves the store's files to their CorruptPath, so a new store
+// can be opened in their place without losing them.
+func (c StoreConfig) MoveAside() error {
+	for _, path := range c.Files() {
+		err := os.Rename(path, CorruptPath(path))
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("problem moving %s aside, %v", path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,405 @@
+// Package storetest checks that a PlayerStore behaves the way PlayerServer
+// expects any store to, so a new backend can prove itself by running
+// RunPlayerStoreContract from its own tests. Stores that can't be written
+// to, like a follower's copy of the league, run RunReadContract instead.
+package storetest
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	poker "server"
+)
+
+// Factory is how the contract gets hold of the store under test.
+type Factory struct {
+	// Open opens a store over dir, which starts out empty, and a func that
+	// closes it. Opening the same dir again once the store is closed must
+	// find everything stored in it.
+	Open func(t *testing.T, dir string) (store poker.PlayerStore, close func())
+
+	// Volatile stores keep nothing once closed, so they skip the checks
+	// that reopen dir.
+	Volatile bool
+
+	// CanonicalNames is set for stores that go by poker.ParsePlayerName, so
+	// names differing only in case, like "pepper" and "Pepper", are one
+	// player and names it refuses can't be stored. Other stores keep any
+	// name but "" exactly as given.
+	CanonicalNames bool
+}
+
+// ReadFactory is how the read contract gets hold of a store that already
+// holds a league, for stores that can't be given one through their own
+// methods.
+type ReadFactory struct {
+	// Open opens a store holding league, which may be empty.
+	Open func(t *testing.T, league poker.League) poker.PlayerStore
+
+	// CanonicalNames is as for Factory.
+	CanonicalNames bool
+}
+
+var unicodeNames = []string{"Zoë", "Ægir", "李雷", "Ольга", "😀 Smiley", "Mary Jane", "50% off"}
+
+// invalidName is a name poker.ParsePlayerName refuses.
+const invalidName = "a/b"
+
+// RunPlayerStoreContract runs the whole contract against the store factory
+// opens, each check on a store of its own.
+func RunPlayerStoreContract(t *testing.T, factory Factory) {
+	names := unicodeNames
+	if !factory.CanonicalNames {
+		names = append(names, invalidName)
+	}
+
+	open := func(t *testing.T) (poker.PlayerStore, string) {
+		dir := t.TempDir()
+		store, close := factory.Open(t, dir)
+		t.Cleanup(close)
+		return store, dir
+	}
+
+	t.Run("reads", func(t *testing.T) {
+		RunReadContract(t, ReadFactory{
+			Open: func(t *testing.T, league poker.League) poker.PlayerStore {
+				store, _ := open(t)
+				if len(league) > 0 {
+					assertNoError(t, store.ImportLeague(league))
+				}
+				return store
+			},
+			CanonicalNames: factory.CanonicalNames,
+		})
+	})
+
+	t.Run("a new store has an empty league", func(t *testing.T) {
+		store, _ := open(t)
+
+		league, err := store.GetLeague()
+		assertNoError(t, err)
+		if len(league) != 0 {
+			t.Errorf("got %v want an empty league", league)
+		}
+	})
+
+	t.Run("wins are counted", func(t *testing.T) {
+		store, _ := open(t)
+
+		recordWins(t, store, "Pepper", 3)
+
+		assertScore(t, store, "Pepper", 3)
+	})
+
+	t.Run("the league is ordered by wins", func(t *testing.T) {
+		store, _ := open(t)
+
+		recordWins(t, store, "Chris", 1)
+		recordWins(t, store, "Cleo", 3)
+		recordWins(t, store, "Pepper", 2)
+
+		league, err := store.GetLeague()
+		assertNoError(t, err)
+		assertLeague(t, league, poker.League{{Name: "Cleo", Wins: 3}, {Name: "Pepper", Wins: 2}, {Name: "Chris", Wins: 1}})
+	})
+
+	t.Run("unknown players are not found", func(t *testing.T) {
+		store, _ := open(t)
+		recordWins(t, store, "Pepper", 1)
+
+		_, err := store.GetPlayerScore("Nobody")
+		assertError(t, err, poker.ErrPlayerNotFound)
+		assertError(t, store.DeletePlayer("Nobody"), poker.ErrPlayerNotFound)
+		assertError(t, store.RenamePlayer("Nobody", "Somebody"), poker.ErrPlayerNotFound)
+	})
+
+	if factory.CanonicalNames {
+		t.Run("names differing only in case are one player", func(t *testing.T) {
+			store, _ := open(t)
+			recordWins(t, store, "Pepper", 1)
+			recordWins(t, store, "pepper", 1)
+
+			assertScore(t, store, "PEPPER", 2)
+			league, err := store.GetLeague()
+			assertNoError(t, err)
+			assertLeague(t, league, poker.League{{Name: "Pepper", Wins: 2}})
+		})
+
+		t.Run("names that aren't valid are refused", func(t *testing.T) {
+			store, _ := open(t)
+
+			assertError(t, store.RecordWin(invalidName), poker.ErrInvalidName)
+		})
+	} else {
+		t.Run("names differing only in case are different players", func(t *testing.T) {
+			store, _ := open(t)
+			recordWins(t, store, "Pepper", 1)
+
+			_, err := store.GetPlayerScore("pepper")
+			assertError(t, err, poker.ErrPlayerNotFound)
+		})
+	}
+
+	t.Run("empty names are refused", func(t *testing.T) {
+		store, _ := open(t)
+		recordWins(t, store, "Pepper", 1)
+
+		assertError(t, store.RecordWin(""), poker.ErrEmptyName)
+		assertError(t, store.SetPlayerScore("", 1), poker.ErrEmptyName)
+		assertError(t, store.RenamePlayer("Pepper", ""), poker.ErrEmptyName)
+		assertError(t, store.ImportLeague(poker.League{{Name: "", Wins: 1}}), poker.ErrEmptyName)
+
+		league, err := store.GetLeague()
+		assertNoError(t, err)
+		assertLeague(t, league, poker.League{{Name: "Pepper", Wins: 1}})
+	})
+
+	t.Run("unicode names are kept as given", func(t *testing.T) {
+		store, _ := open(t)
+
+		for i, name := range names {
+			recordWins(t, store, name, i+1)
+		}
+		for i, name := range names {
+			assertScore(t, store, name, i+1)
+		}
+	})
+
+	t.Run("scores can be set but not below zero", func(t *testing.T) {
+		store, _ := open(t)
+
+		assertNoError(t, store.SetPlayerScore("Pepper", 20))
+		assertScore(t, store, "Pepper", 20)
+
+		assertError(t, store.SetPlayerScore("Pepper", -1), poker.ErrInvalidScore)
+		assertScore(t, store, "Pepper", 20)
+	})
+
+	t.Run("players can be deleted", func(t *testing.T) {
+		store, _ := open(t)
+		recordWins(t, store, "Pepper", 2)
+
+		assertNoError(t, store.DeletePlayer("Pepper"))
+
+		_, err := store.GetPlayerScore("Pepper")
+		assertError(t, err, poker.ErrPlayerNotFound)
+	})
+
+	t.Run("players can be renamed but not onto someone else", func(t *testing.T) {
+		store, _ := open(t)
+		recordWins(t, store, "Pepper", 2)
+		recordWins(t, store, "Floyd", 1)
+
+		assertError(t, store.RenamePlayer("Pepper", "Floyd"), poker.ErrPlayerExists)
+		assertNoError(t, store.RenamePlayer("Pepper", "Salt"))
+
+		assertScore(t, store, "Salt", 2)
+		assertScore(t, store, "Floyd", 1)
+		_, err := store.GetPlayerScore("Pepper")
+		assertError(t, err, poker.ErrPlayerNotFound)
+	})
+
+	t.Run("importing sets the players given and leaves the rest", func(t *testing.T) {
+		store, _ := open(t)
+		recordWins(t, store, "Pepper", 2)
+		recordWins(t, store, "Floyd", 1)
+
+		assertNoError(t, store.ImportLeague(poker.League{{Name: "Floyd", Wins: 10}, {Name: "Cleo", Wins: 5}}))
+
+		assertScore(t, store, "Pepper", 2)
+		assertScore(t, store, "Floyd", 10)
+		assertScore(t, store, "Cleo", 5)
+	})
+
+	t.Run("a bad import changes nothing", func(t *testing.T) {
+		store, _ := open(t)
+		recordWins(t, store, "Pepper", 2)
+
+		err := store.ImportLeague(poker.League{{Name: "Pepper", Wins: 10}, {Name: "Floyd", Wins: -1}})
+		assertError(t, err, poker.ErrInvalidScore)
+
+		assertScore(t, store, "Pepper", 2)
+	})
+
+	t.Run("concurrent wins are all counted", func(t *testing.T) {
+		store, _ := open(t)
+
+		const players, wins = 4, 25
+		var wg sync.WaitGroup
+		for i := 0; i < players*wins; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if err := store.RecordWin(fmt.Sprintf("Player %d", i%players)); err != nil {
+					t.Error(err)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		for i := 0; i < players; i++ {
+			assertScore(t, store, fmt.Sprintf("Player %d", i), wins)
+		}
+	})
+
+	if factory.Volatile {
+		return
+	}
+
+	t.Run("everything is still there after reopening", func(t *testing.T) {
+		dir := t.TempDir()
+
+		store, close := factory.Open(t, dir)
+		recordWins(t, store, "Pepper", 3)
+		recordWins(t, store, "Floyd", 1)
+		for _, name := range names {
+			recordWins(t, store, name, 1)
+		}
+		assertNoError(t, store.SetPlayerScore("Cleo", 7))
+		assertNoError(t, store.RenamePlayer("Floyd", "Salt"))
+		assertNoError(t, store.DeletePlayer("Cleo"))
+		want, err := store.GetLeague()
+		assertNoError(t, err)
+		close()
+
+		store, close = factory.Open(t, dir)
+		defer close()
+
+		got, err := store.GetLeague()
+		assertNoError(t, err)
+		assertSameLeague(t, got, want)
+		assertScore(t, store, "Salt", 1)
+		_, err = store.GetPlayerScore("Cleo")
+		assertError(t, err, poker.ErrPlayerNotFound)
+	})
+
+	t.Run("a reopened store carries on counting", func(t *testing.T) {
+		dir := t.TempDir()
+
+		store, close := factory.Open(t, dir)
+		recordWins(t, store, "Pepper", 2)
+		close()
+
+		store, close = factory.Open(t, dir)
+		defer close()
+		recordWins(t, store, "Pepper", 1)
+
+		assertScore(t, store, "Pepper", 3)
+	})
+}
+
+// RunReadContract runs the part of the contract that only reads, each
+// check on a store of its own that factory opens.
+func RunReadContract(t *testing.T, factory ReadFactory) {
+	names := unicodeNames
+	if !factory.CanonicalNames {
+		names = append(names, invalidName)
+	}
+
+	t.Run("an empty league has no players", func(t *testing.T) {
+		store := factory.Open(t, nil)
+
+		league, err := store.GetLeague()
+		assertNoError(t, err)
+		if len(league) != 0 {
+			t.Errorf("got %v want an empty league", league)
+		}
+	})
+
+	t.Run("scores are read back for every name", func(t *testing.T) {
+		var league poker.League
+		for i, name := range names {
+			league = append(league, poker.Player{Name: name, Wins: i + 1})
+		}
+		store := factory.Open(t, league)
+
+		for i, name := range names {
+			assertScore(t, store, name, i+1)
+		}
+	})
+
+	t.Run("the league is ordered by wins", func(t *testing.T) {
+		store := factory.Open(t, poker.League{{Name: "Chris", Wins: 1}, {Name: "Cleo", Wins: 3}, {Name: "Pepper", Wins: 2}})
+
+		league, err := store.GetLeague()
+		assertNoError(t, err)
+		assertLeague(t, league, poker.League{{Name: "Cleo", Wins: 3}, {Name: "Pepper", Wins: 2}, {Name: "Chris", Wins: 1}})
+	})
+
+	t.Run("unknown players are not found", func(t *testing.T) {
+		store := factory.Open(t, poker.League{{Name: "Pepper", Wins: 1}})
+
+		_, err := store.GetPlayerScore("Nobody")
+		assertError(t, err, poker.ErrPlayerNotFound)
+	})
+
+	if factory.CanonicalNames {
+		t.Run("names are found in any case", func(t *testing.T) {
+			store := factory.Open(t, poker.League{{Name: "Pepper", Wins: 2}})
+
+			assertScore(t, store, "PEPPER", 2)
+		})
+	} else {
+		t.Run("names are only found in the case given", func(t *testing.T) {
+			store := factory.Open(t, poker.League{{Name: "Pepper", Wins: 2}})
+
+			_, err := store.GetPlayerScore("pepper")
+			assertError(t, err, poker.ErrPlayerNotFound)
+		})
+	}
+}
+
+func recordWins(t testing.TB, store poker.PlayerStore, name string, wins int) {
+	t.Helper()
+	for i := 0; i < wins; i++ {
+		assertNoError(t, store.RecordWin(name))
+	}
+}
+
+func assertScore(t testing.TB, store poker.PlayerStore, name string, want int) {
+	t.Helper()
+	got, err := store.GetPlayerScore(name)
+	assertNoError(t, err)
+	if got != want {
+		t.Errorf("got %d wins for %q want %d", got, name, want)
+	}
+}
+
+func assertLeague(t testing.TB, got, want poker.League) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+}
+
+// assertSameLeague ignores the order of players with the same wins, which
+// the contract leaves up to the store.
+func assertSameLeague(t testing.TB, got, want poker.League) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %v want %v", got, want)
+	}
+	for i, player := range want {
+		found := got.Find(player.Name)
+		if found == nil || found.Wins != player.Wins || got[i].Wins != player.Wins {
+			t.Fatalf("got %v want %v", got, want)
+		}
+	}
+}
+
+func assertNoError(t testing.TB, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("didn't expect an error but got one, %v", err)
+	}
+}
+
+func assertError(t testing.TB, got, want error) {
+	t.Helper()
+	if !errors.Is(got, want) {
+		t.Errorf("got error %v, want %v", got, want)
+	}
+}
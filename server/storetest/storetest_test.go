@@ -0,0 +1,76 @@
+package storetest
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	poker "server"
+)
+
+func TestFileSystemPlayerStore(t *testing.T) {
+	RunPlayerStoreContract(t, Factory{Open: func(t *testing.T, dir string) (poker.PlayerStore, func()) {
+		store, close, err := poker.FileSystemPlayerStoreFromFile(filepath.Join(dir, "game.db.json"))
+		assertNoError(t, err)
+		return store, close
+	}})
+}
+
+func TestEventLogPlayerStore(t *testing.T) {
+	RunPlayerStoreContract(t, Factory{Open: func(t *testing.T, dir string) (poker.PlayerStore, func()) {
+		// compacting often, so the contract holds across snapshots too
+		store, err := poker.NewEventLogPlayerStore(filepath.Join(dir, "game.events.log"), 5)
+		assertNoError(t, err)
+		return store, func() { store.Close() }
+	}})
+}
+
+func TestKVPlayerStore(t *testing.T) {
+	RunPlayerStoreContract(t, Factory{Open: func(t *testing.T, dir string) (poker.PlayerStore, func()) {
+		store, err := poker.NewKVPlayerStore(filepath.Join(dir, "game.kv"))
+		assertNoError(t, err)
+		return store, func() { store.Close() }
+	}})
+}
+
+func TestInMemoryPlayerStore(t *testing.T) {
+	RunPlayerStoreContract(t, Factory{
+		Open: func(t *testing.T, dir string) (poker.PlayerStore, func()) {
+			return poker.NewInMemoryPlayerStore(), func() {}
+		},
+		Volatile: true,
+	})
+}
+
+func TestCanonicalNamePlayerStore(t *testing.T) {
+	RunPlayerStoreContract(t, Factory{
+		Open: func(t *testing.T, dir string) (poker.PlayerStore, func()) {
+			store, close, err := poker.FileSystemPlayerStoreFromFile(filepath.Join(dir, "game.db.json"))
+			assertNoError(t, err)
+			return poker.NewCanonicalNamePlayerStore(store), close
+		},
+		CanonicalNames: true,
+	})
+}
+
+func TestFollower(t *testing.T) {
+	RunReadContract(t, ReadFactory{Open: func(t *testing.T, league poker.League) poker.PlayerStore {
+		dir := t.TempDir()
+		store := poker.NewInMemoryPlayerStore()
+		if len(league) > 0 {
+			assertNoError(t, store.ImportLeague(league))
+		}
+		replication, err := poker.NewReplicationLog(store, filepath.Join(dir, "replication.log"), poker.DefaultReplicationKept)
+		assertNoError(t, err)
+		t.Cleanup(func() { replication.Close() })
+
+		leader := httptest.NewServer(poker.NewPlayerServer(poker.NewCanonicalNamePlayerStore(replication), nil, poker.WithReplication(replication)))
+		t.Cleanup(leader.Close)
+
+		follower, err := poker.NewFollower(leader.URL, filepath.Join(dir, "replica"), nil)
+		assertNoError(t, err)
+		assertNoError(t, follower.Sync(context.Background()))
+		return follower
+	}, CanonicalNames: true})
+}
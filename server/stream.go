@@ -0,0 +1,83 @@
+package poker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const streamHeartbeat = 15 * time.Second
+
+// leagueStreamHandler sends the league as a server-sent event straight
+// away and again every time it changes, until the client goes away.
+func (p *PlayerServer) leagueStreamHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeProblem(w, r, http.StatusInternalServerError, "streaming is not supported by this connection")
+		return
+	}
+
+	// subscribe before reading the league, so no change can slip in
+	// between the two
+	updates := p.stream.Subscribe(r.Context())
+
+	league, err := p.store.GetLeague()
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+
+	// like the websocket, a stream outlives the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("content-type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	writeLeagueEvent(w, LeagueUpdate{League: league})
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case update, ok := <-updates:
+			if !ok {
+				return
+			}
+			if err := writeLeagueEvent(w, update); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			// a comment, so proxies don't think the stream is idle
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+type leagueEventData struct {
+	Winner string `json:",omitempty"`
+	League League
+}
+
+func writeLeagueEvent(w http.ResponseWriter, update LeagueUpdate) error {
+	data, err := json.Marshal(leagueEventData{update.Winner, update.League})
+	if err != nil {
+		return err
+	}
+	if update.ID > 0 {
+		fmt.Fprintf(w, "id: %d\n", update.ID)
+	}
+	_, err = fmt.Fprintf(w, "event: league\ndata: %s\n\n", data)
+	return err
+}
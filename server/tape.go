@@ -1,7 +1,9 @@
 package poker
 
 import (
+	"io/ioutil"
 	"os"
+	"path/filepath"
 )
 
 type tape struct {
@@ -13,3 +15,41 @@ func (t *tape) Write(p []byte) (n int, err error) {
 	t.file.Seek(0, 0)
 	return t.file.Write(p)
 }
+
+// atomicTape replaces the file at path on every write by writing to a
+// temporary sibling and renaming it into place, so a crash mid-write
+// leaves either the old or the new contents on disk, never a mix.
+type atomicTape struct {
+	path string
+}
+
+func (t *atomicTape) Write(p []byte) (n int, err error) {
+	dir, base := filepath.Split(t.path)
+	if dir == "" {
+		dir = "."
+	}
+
+	tmp, err := ioutil.TempFile(dir, base+".tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if info, err := os.Stat(t.path); err == nil {
+		tmp.Chmod(info.Mode())
+	}
+
+	n, err = tmp.Write(p)
+	if err != nil {
+		tmp.Close()
+		return n, err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return n, err
+	}
+	if err = tmp.Close(); err != nil {
+		return n, err
+	}
+	return n, os.Rename(tmp.Name(), t.path)
+}
@@ -2,6 +2,7 @@ package poker
 
 import (
 	"io/ioutil"
+	"path/filepath"
 	"testing"
 )
 
@@ -23,3 +24,26 @@ func TestTape_Write(t *testing.T) {
 		t.Errorf("got %s, want %s", got, want)
 	}
 }
+
+func TestAtomicTape_Write(t *testing.T) {
+	file, clean := createTempFile(t, "12345")
+	defer clean()
+
+	tape := &atomicTape{file.Name()}
+
+	tape.Write([]byte("abc"))
+
+	newFileContents, _ := ioutil.ReadFile(file.Name())
+
+	got := string(newFileContents)
+	want := "abc"
+
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	leftovers, _ := filepath.Glob(file.Name() + ".tmp*")
+	if len(leftovers) != 0 {
+		t.Errorf("expected no temporary files to be left behind, got %v", leftovers)
+	}
+}
@@ -0,0 +1,312 @@
+package poker
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A just-big-enough server side of RFC 6455: text messages in and out,
+// pings answered, closes acknowledged. Extensions and subprotocols are not
+// negotiated.
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+const maxWebsocketMessage = 1 << 20
+
+const (
+	// websocketIdleTimeout is how long a connection can go without the
+	// client sending anything before it's given up on. It's pinged twice
+	// in that time, so a browser that's still there answers with a pong.
+	websocketIdleTimeout = time.Minute
+	websocketWriteWait   = 10 * time.Second
+)
+
+var (
+	errNotWebsocket       = errors.New("not a websocket handshake")
+	errUnmaskedFrame      = errors.New("client frames must be masked")
+	errWebsocketTooLarge  = errors.New("websocket message too large")
+	errUnexpectedOpcode   = errors.New("unexpected websocket opcode")
+	errFragmentedControl  = errors.New("control frames must not be fragmented")
+	errUnexpectedContinue = errors.New("continuation frame without a message to continue")
+	errCrossOrigin        = errors.New("websockets can't be opened from pages on other sites")
+)
+
+type websocketConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	idle   time.Duration
+
+	writeMu   sync.Mutex
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func websocketAccept(key string) string {
+	h := sha1.New()
+	io.WriteString(h, key+websocketGUID)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sameOrigin is whether the page that opened the websocket was served by
+// this server, or by one of allowed, like "https://poker.example.com".
+// Browsers always say which page it was, so a request without an Origin
+// is from a program and is let through; it has to hold a token anyway.
+func sameOrigin(r *http.Request, allowed []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, other := range allowed {
+		if strings.EqualFold(origin, other) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// upgradeWebsocket completes the handshake for a websocket from a page on
+// this server or one of origins. The connection is closed once the client
+// has sent nothing for idle, and pinged so that one that's still there
+// does send something.
+func upgradeWebsocket(w http.ResponseWriter, r *http.Request, origins []string, idle time.Duration) (*websocketConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet ||
+		!headerContainsToken(r.Header, "Connection", "upgrade") ||
+		!headerContainsToken(r.Header, "Upgrade", "websocket") ||
+		r.Header.Get("Sec-WebSocket-Version") != "13" ||
+		key == "" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		writeProblem(w, r, http.StatusBadRequest, errNotWebsocket.Error())
+		return nil, errNotWebsocket
+	}
+	// the token can travel in the URL, so without this any site could
+	// open a game with a token it got hold of
+	if !sameOrigin(r, origins) {
+		writeProblem(w, r, http.StatusForbidden, errCrossOrigin.Error())
+		return nil, errCrossOrigin
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		writeProblem(w, r, http.StatusInternalServerError, "websockets are not supported by this connection")
+		return nil, errors.New("response writer cannot be hijacked")
+	}
+
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("problem hijacking connection, %v", err)
+	}
+	// the http.Server's read and write timeouts are meant for requests,
+	// not for a game that lasts all evening; the connection keeps its own
+	// for each frame
+	conn.SetDeadline(time.Time{})
+
+	fmt.Fprintf(buf, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: %s\r\n\r\n", websocketAccept(key))
+	if err := buf.Flush(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("problem completing websocket handshake, %v", err)
+	}
+
+	ws := &websocketConn{conn: conn, reader: buf.Reader, idle: idle, done: make(chan struct{})}
+	go ws.keepAlive()
+	return ws, nil
+}
+
+// keepAlive pings the client twice every idle, so a browser that's quietly
+// waiting for the game to end answers and isn't taken for gone.
+func (c *websocketConn) keepAlive() {
+	ticker := time.NewTicker(c.idle / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.writeFrame(opPing, nil); err != nil {
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// ReadMessage returns the next text or binary message, answering pings and
+// skipping pongs on the way. It returns io.EOF once the peer closes.
+func (c *websocketConn) ReadMessage() ([]byte, error) {
+	var message []byte
+	started := false
+
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case opPing:
+			c.writeFrame(opPong, payload)
+			continue
+		case opPong:
+			continue
+		case opClose:
+			c.writeFrame(opClose, payload)
+			return nil, io.EOF
+		case opText, opBinary:
+			if started {
+				return nil, errUnexpectedOpcode
+			}
+			started = true
+		case opContinuation:
+			if !started {
+				return nil, errUnexpectedContinue
+			}
+		default:
+			return nil, errUnexpectedOpcode
+		}
+
+		if len(message)+len(payload) > maxWebsocketMessage {
+			return nil, errWebsocketTooLarge
+		}
+		message = append(message, payload...)
+
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+func (c *websocketConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	// any frame, pongs included, shows the client is still there
+	c.conn.SetReadDeadline(time.Now().Add(c.idle))
+
+	var header [2]byte
+	if _, err = io.ReadFull(c.reader, header[:]); err != nil {
+		return
+	}
+
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	if !masked {
+		err = errUnmaskedFrame
+		return
+	}
+	if opcode >= opClose && (!fin || length > 125) {
+		err = errFragmentedControl
+		return
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.reader, ext[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.reader, ext[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > maxWebsocketMessage {
+		err = errWebsocketTooLarge
+		return
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(c.reader, mask[:]); err != nil {
+		return
+	}
+
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.reader, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return
+}
+
+func (c *websocketConn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	header := []byte{0x80 | opcode, 0}
+	switch {
+	case len(payload) <= 125:
+		header[1] = byte(len(payload))
+	case len(payload) <= 0xFFFF:
+		header[1] = 126
+		header = append(header, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(len(payload)))
+	default:
+		header[1] = 127
+		header = append(header, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(len(payload)))
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(websocketWriteWait))
+	if _, err := c.conn.Write(header); err != nil {
+		return err
+	}
+	_, err := c.conn.Write(payload)
+	return err
+}
+
+func (c *websocketConn) WriteText(message string) error {
+	return c.writeFrame(opText, []byte(message))
+}
+
+// Write sends p as a single text message, so a websocketConn can be handed
+// to anything that reports progress to an io.Writer, like Game.Start.
+func (c *websocketConn) Write(p []byte) (int, error) {
+	if err := c.writeFrame(opText, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *websocketConn) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	c.writeFrame(opClose, nil)
+	return c.conn.Close()
+}
@@ -0,0 +1,304 @@
+package poker
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebsocketAccept(t *testing.T) {
+	// the worked example from RFC 6455 section 1.3
+	got := websocketAccept("dGhlIHNhbXBsZSBub25jZQ==")
+	want := "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="
+
+	if got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestGameOverWebsocket(t *testing.T) {
+	t.Run("start a game with 3 players, send some blind alerts and declare Ruth the winner", func(t *testing.T) {
+		wantedBlindAlert := "Blind is 100"
+		winner := "Ruth"
+
+		game := &GameSpy{BlindAlert: []byte(wantedBlindAlert)}
+		server := httptest.NewServer(NewPlayerServer(&StubPlayerStore{}, game))
+		defer server.Close()
+
+		ws := mustDialWS(t, server.URL)
+		defer ws.conn.Close()
+
+		ws.send(t, opText, "3")
+		assertWebsocketMessage(t, ws, wantedBlindAlert)
+
+		ws.send(t, opText, winner)
+		ws.waitForClose(t)
+
+		assertGameStartedWith(t, game, 3)
+		assertFinishCalledWith(t, game, winner)
+		eventually(t, game.Stopped)
+	})
+
+	t.Run("stops the blind alerts when the browser goes away", func(t *testing.T) {
+		game := &GameSpy{}
+		server := httptest.NewServer(NewPlayerServer(&StubPlayerStore{}, game))
+		defer server.Close()
+
+		ws := mustDialWS(t, server.URL)
+		ws.send(t, opText, "3")
+		ws.conn.Close()
+
+		eventually(t, game.Stopped)
+		assertGameNotFinished(t, game)
+	})
+
+	t.Run("puts fragmented messages back together", func(t *testing.T) {
+		game := &GameSpy{}
+		server := httptest.NewServer(NewPlayerServer(&StubPlayerStore{}, game))
+		defer server.Close()
+
+		ws := mustDialWS(t, server.URL)
+		defer ws.conn.Close()
+
+		ws.sendFrame(t, false, opText, "1")
+		ws.sendFrame(t, true, opContinuation, "0")
+		ws.send(t, opText, "Ruth")
+		ws.waitForClose(t)
+
+		assertGameStartedWith(t, game, 10)
+	})
+
+	t.Run("answers pings while waiting for the players", func(t *testing.T) {
+		server := httptest.NewServer(NewPlayerServer(&StubPlayerStore{}, &GameSpy{}))
+		defer server.Close()
+
+		ws := mustDialWS(t, server.URL)
+		defer ws.conn.Close()
+
+		ws.send(t, opPing, "hello")
+		opcode, payload := ws.read(t)
+
+		if opcode != opPong || payload != "hello" {
+			t.Errorf("got opcode %x with %q, want a pong with %q", opcode, payload, "hello")
+		}
+	})
+
+	t.Run("tells the browser when the number of players is bad", func(t *testing.T) {
+		game := &GameSpy{}
+		server := httptest.NewServer(NewPlayerServer(&StubPlayerStore{}, game))
+		defer server.Close()
+
+		ws := mustDialWS(t, server.URL)
+		defer ws.conn.Close()
+
+		ws.send(t, opText, "pies")
+		assertWebsocketMessage(t, ws, BadPlayerInputErrMsg)
+		ws.waitForClose(t)
+
+		assertGameNotStarted(t, game)
+	})
+
+	t.Run("only pages from this server or an allowed site can open one", func(t *testing.T) {
+		server := httptest.NewServer(NewPlayerServer(&StubPlayerStore{}, &GameSpy{}, WithWebsocketOrigins("https://poker.example.com")))
+		defer server.Close()
+
+		cases := map[string]int{
+			"":                          http.StatusSwitchingProtocols,
+			server.URL:                  http.StatusSwitchingProtocols,
+			"https://poker.example.com": http.StatusSwitchingProtocols,
+			"https://evil.example.com":  http.StatusForbidden,
+			"null":                      http.StatusForbidden,
+		}
+		for origin, want := range cases {
+			_, response := dialWS(t, server.URL, origin)
+			if response.StatusCode != want {
+				t.Errorf("got %d for origin %q want %d", response.StatusCode, origin, want)
+			}
+		}
+	})
+
+	t.Run("gives up on a client that stops answering", func(t *testing.T) {
+		game := &GameSpy{}
+		server := NewPlayerServer(&StubPlayerStore{}, game)
+		server.wsIdle = 100 * time.Millisecond
+		httpServer := httptest.NewServer(server)
+		defer httpServer.Close()
+
+		ws := mustDialWS(t, httpServer.URL)
+		ws.send(t, opText, "3")
+
+		// it's pinged, but never says anything back
+		for {
+			opcode, _ := ws.read(t)
+			if opcode == opClose {
+				break
+			}
+		}
+		eventually(t, game.Stopped)
+		assertGameNotFinished(t, game)
+	})
+
+	t.Run("a client answering pings is kept", func(t *testing.T) {
+		game := &GameSpy{}
+		server := NewPlayerServer(&StubPlayerStore{}, game)
+		server.wsIdle = 100 * time.Millisecond
+		httpServer := httptest.NewServer(server)
+		defer httpServer.Close()
+
+		ws := mustDialWS(t, httpServer.URL)
+		for i := 0; i < 6; i++ {
+			opcode, payload := ws.read(t)
+			if opcode != opPing {
+				t.Fatalf("got opcode %x, want a ping", opcode)
+			}
+			ws.send(t, opPong, payload)
+		}
+		ws.send(t, opText, "3")
+		ws.send(t, opText, "Ruth")
+		ws.waitForClose(t)
+
+		assertFinishCalledWith(t, game, "Ruth")
+	})
+
+	t.Run("refuses requests that are not websocket upgrades", func(t *testing.T) {
+		server := NewPlayerServer(&StubPlayerStore{}, &GameSpy{})
+
+		request, _ := http.NewRequest(http.MethodGet, "/ws", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+	})
+}
+
+type testWebsocket struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func mustDialWS(t testing.TB, serverURL string) *testWebsocket {
+	t.Helper()
+
+	ws, response := dialWS(t, serverURL, "")
+	assertStatus(t, response.StatusCode, http.StatusSwitchingProtocols)
+	if got := response.Header.Get("Sec-WebSocket-Accept"); got != websocketAccept(testWebsocketKey) {
+		t.Fatalf("got Sec-WebSocket-Accept %q want %q", got, websocketAccept(testWebsocketKey))
+	}
+	return ws
+}
+
+const testWebsocketKey = "dGhlIHNhbXBsZSBub25jZQ=="
+
+// dialWS asks for a websocket as a page from origin would, or as a
+// program would if origin is "".
+func dialWS(t testing.TB, serverURL, origin string) (*testWebsocket, *http.Response) {
+	t.Helper()
+
+	host := strings.TrimPrefix(serverURL, "http://")
+	conn, err := net.Dial("tcp", host)
+	if err != nil {
+		t.Fatalf("could not open a ws connection on %s %v", serverURL, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	var originHeader string
+	if origin != "" {
+		originHeader = "Origin: " + origin + "\r\n"
+	}
+	fmt.Fprintf(conn, "GET /ws HTTP/1.1\r\n"+
+		"Host: %s\r\n"+
+		"%s"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: %s\r\n"+
+		"Sec-WebSocket-Version: 13\r\n\r\n", host, originHeader, testWebsocketKey)
+
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("could not read handshake response, %v", err)
+	}
+	return &testWebsocket{conn, reader}, response
+}
+
+func (ws *testWebsocket) send(t testing.TB, opcode byte, message string) {
+	t.Helper()
+	ws.sendFrame(t, true, opcode, message)
+}
+
+func (ws *testWebsocket) sendFrame(t testing.TB, fin bool, opcode byte, message string) {
+	t.Helper()
+
+	header := opcode
+	if fin {
+		header |= 0x80
+	}
+
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{header, 0x80 | byte(len(message))}
+	frame = append(frame, mask...)
+	for i := 0; i < len(message); i++ {
+		frame = append(frame, message[i]^mask[i%4])
+	}
+
+	if _, err := ws.conn.Write(frame); err != nil {
+		t.Fatalf("could not send message over ws connection %v", err)
+	}
+}
+
+func (ws *testWebsocket) read(t testing.TB) (byte, string) {
+	t.Helper()
+
+	var header [2]byte
+	if _, err := io.ReadFull(ws.reader, header[:]); err != nil {
+		t.Fatalf("could not read from ws connection %v", err)
+	}
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(ws.reader, ext[:])
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(ws.reader, ext[:])
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(ws.reader, payload); err != nil {
+		t.Fatalf("could not read from ws connection %v", err)
+	}
+	return header[0] & 0x0F, string(payload)
+}
+
+func (ws *testWebsocket) waitForClose(t testing.TB) {
+	t.Helper()
+	for {
+		opcode, _ := ws.read(t)
+		if opcode == opClose {
+			return
+		}
+	}
+}
+
+func assertWebsocketMessage(t testing.TB, ws *testWebsocket, want string) {
+	t.Helper()
+	opcode, got := ws.read(t)
+	if opcode != opText {
+		t.Fatalf("got opcode %x, want a text message", opcode)
+	}
+	if got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}